@@ -0,0 +1,257 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/cloudevents/sdk-go/v2/protocol"
+	cehttp "github.com/cloudevents/sdk-go/v2/protocol/http"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"knative.dev/pkg/apis"
+
+	"github.com/ShixiongQi/brokerchannel/pkg/apis/samples/v1beta1"
+)
+
+const (
+	// breakerThreshold is the number of consecutive retryable failures of a
+	// destination tripping its breaker.
+	breakerThreshold = 5
+	// breakerCooldown is the time a tripped breaker stays open, unless the
+	// destination asks for longer with Retry-After.
+	breakerCooldown = 30 * time.Second
+	// maxRetryAfter bounds the Retry-After honoured.
+	maxRetryAfter = 5 * time.Minute
+)
+
+// retryable tells whether a delivery answered with code may succeed later:
+// the destination could not be reached, failed, or asked to come back
+// later with 408, 409 or 429. The other 4xx are the fault of the event.
+func retryable(code int) bool {
+	switch code {
+	case 0, http.StatusRequestTimeout, http.StatusConflict, http.StatusTooManyRequests:
+		return true
+	}
+	return code >= http.StatusInternalServerError
+}
+
+// statusCode returns the status code of the response to a delivery, 0
+// when the destination could not be reached.
+func statusCode(result protocol.Result) int {
+	var httpResult *cehttp.Result
+	if cloudevents.ResultAs(result, &httpResult) {
+		return httpResult.StatusCode
+	}
+	if cloudevents.IsACK(result) {
+		return http.StatusOK
+	}
+	return 0
+}
+
+// breaker is the circuit breaker of a destination. It trips after
+// breakerThreshold consecutive retryable failures, or when the destination
+// answers with Retry-After, and then holds the events back until its
+// cooldown is over. It then lets one trial event through, closing on
+// success and opening again on failure.
+type breaker struct {
+	uri *apis.URL
+
+	mu       sync.Mutex
+	state    v1beta1.CircuitBreakerState
+	failures int
+	reason   string
+	since    time.Time
+	until    time.Time
+	// trial is set while the trial event of a half-open breaker is sent.
+	trial bool
+	// changed is closed and replaced when the breaker closes or its trial
+	// ends, to wake the waiters.
+	changed chan struct{}
+}
+
+const breakerClosed v1beta1.CircuitBreakerState = ""
+
+func newBreaker(uri *apis.URL) *breaker {
+	return &breaker{uri: uri, changed: make(chan struct{})}
+}
+
+// wait waits until the breaker lets an event through, or ctx is done.
+func (b *breaker) wait(ctx context.Context) error {
+	for {
+		ok, changed, until := b.try(time.Now())
+		if ok {
+			return nil
+		}
+		var timer <-chan time.Time
+		if !until.IsZero() {
+			t := time.NewTimer(time.Until(until))
+			defer t.Stop()
+			timer = t.C
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		case <-timer:
+		}
+	}
+}
+
+// allow tells whether the breaker lets an event through right away.
+func (b *breaker) allow() bool {
+	ok, _, _ := b.try(time.Now())
+	return ok
+}
+
+// try lets an event through at now if the breaker allows it. Otherwise it
+// returns the channel closed on the next change and the end of the
+// cooldown, zero while a trial is in flight.
+func (b *breaker) try(now time.Time) (bool, <-chan struct{}, time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch {
+	case b.state == breakerClosed:
+		return true, nil, time.Time{}
+	case b.state == v1beta1.CircuitBreakerOpen && !now.Before(b.until):
+		b.state, b.trial = v1beta1.CircuitBreakerHalfOpen, true
+		return true, nil, time.Time{}
+	case b.state == v1beta1.CircuitBreakerHalfOpen && !b.trial:
+		b.trial = true
+		return true, nil, time.Time{}
+	case b.state == v1beta1.CircuitBreakerOpen:
+		return false, b.changed, b.until
+	default:
+		return false, b.changed, time.Time{}
+	}
+}
+
+// release gives the trial let through back without an outcome, so that
+// another event is let through instead.
+func (b *breaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state != v1beta1.CircuitBreakerHalfOpen || !b.trial {
+		return
+	}
+	b.trial = false
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
+
+// record records the outcome of a delivery let through, answered with code
+// and retryAfter, zero when absent. It returns true when it trips the
+// breaker.
+func (b *breaker) record(code int, retryAfter time.Duration) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	// Wake the waiters, to check the breaker again.
+	close(b.changed)
+	b.changed = make(chan struct{})
+	wasTrial := b.state == v1beta1.CircuitBreakerHalfOpen
+	b.trial = false
+	if !retryable(code) {
+		b.state, b.failures, b.reason = breakerClosed, 0, ""
+		return false
+	}
+	b.failures++
+	b.reason = failureReason(code)
+	if b.state == v1beta1.CircuitBreakerOpen || (!wasTrial && b.failures < breakerThreshold && retryAfter == 0) {
+		return false
+	}
+	cooldown := breakerCooldown
+	if retryAfter > 0 {
+		cooldown = retryAfter
+	}
+	if b.state == breakerClosed {
+		b.since = now
+	}
+	b.state, b.until = v1beta1.CircuitBreakerOpen, now.Add(cooldown)
+	return !wasTrial
+}
+
+// status returns the status of the breaker, nil when it is closed.
+func (b *breaker) status() *v1beta1.CircuitBreakerStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == breakerClosed {
+		return nil
+	}
+	return &v1beta1.CircuitBreakerStatus{
+		URI:    b.uri,
+		State:  b.state,
+		Reason: b.reason,
+		Since:  metav1.NewTime(b.since),
+	}
+}
+
+// failureReason describes a failed delivery answered with code.
+func failureReason(code int) string {
+	if code == 0 {
+		return "unreachable"
+	}
+	return strconv.Itoa(code) + " " + http.StatusText(code)
+}
+
+// parseRetryAfter parses the value of a Retry-After header, a number of
+// seconds or an HTTP date, bounded by maxRetryAfter.
+func parseRetryAfter(v string, now time.Time) time.Duration {
+	if v == "" {
+		return 0
+	}
+	var d time.Duration
+	if s, err := strconv.Atoi(v); err == nil {
+		d = time.Duration(s) * time.Second
+	} else if t, err := http.ParseTime(v); err == nil {
+		d = t.Sub(now)
+	}
+	if d < 0 {
+		return 0
+	}
+	if d > maxRetryAfter {
+		return maxRetryAfter
+	}
+	return d
+}
+
+// retryAfterKey is the context key of the Retry-After of a delivery.
+type retryAfterKey struct{}
+
+// withRetryAfter returns a context recording the Retry-After of the
+// response to the request sent with it into d.
+func withRetryAfter(ctx context.Context, d *time.Duration) context.Context {
+	return context.WithValue(ctx, retryAfterKey{}, d)
+}
+
+// retryAfterTransport records the Retry-After of the responses of the
+// requests sent with withRetryAfter.
+type retryAfterTransport struct {
+	http.RoundTripper
+}
+
+func (t *retryAfterTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.RoundTripper.RoundTrip(req)
+	if d, ok := req.Context().Value(retryAfterKey{}).(*time.Duration); ok && resp != nil {
+		*d = parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+	}
+	return resp, err
+}
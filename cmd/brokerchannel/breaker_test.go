@@ -0,0 +1,117 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"knative.dev/pkg/apis"
+
+	"github.com/ShixiongQi/brokerchannel/pkg/apis/samples/v1beta1"
+)
+
+func TestRetryable(t *testing.T) {
+	for code, want := range map[int]bool{
+		0:                                        true,
+		http.StatusAccepted:                      false,
+		http.StatusBadRequest:                    false,
+		http.StatusNotFound:                      false,
+		http.StatusRequestTimeout:                true,
+		http.StatusConflict:                      true,
+		http.StatusTooManyRequests:               true,
+		http.StatusInternalServerError:           true,
+		http.StatusServiceUnavailable:            true,
+		http.StatusRequestEntityTooLarge:         false,
+		http.StatusUnprocessableEntity:           false,
+		http.StatusNetworkAuthenticationRequired: true,
+	} {
+		if got := retryable(code); got != want {
+			t.Errorf("retryable(%d) = %t, want %t", code, got, want)
+		}
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+	for v, want := range map[string]time.Duration{
+		"":                              0,
+		"5":                             5 * time.Second,
+		"-5":                            0,
+		"3600":                          maxRetryAfter,
+		"Mon, 01 Mar 2021 12:00:30 GMT": 30 * time.Second,
+		"Mon, 01 Mar 2021 11:00:00 GMT": 0,
+		"soon":                          0,
+	} {
+		if got := parseRetryAfter(v, now); got != want {
+			t.Errorf("parseRetryAfter(%q) = %v, want %v", v, got, want)
+		}
+	}
+}
+
+func TestBreaker(t *testing.T) {
+	b := newBreaker(apis.HTTP("sink.default.svc"))
+	for i := 1; i < breakerThreshold; i++ {
+		if b.record(http.StatusServiceUnavailable, 0) {
+			t.Fatalf("Tripped after %d failures, want %d", i, breakerThreshold)
+		}
+	}
+	if !b.allow() || b.status() != nil {
+		t.Fatal("The breaker is not closed before the threshold")
+	}
+	if !b.record(http.StatusServiceUnavailable, 0) {
+		t.Fatalf("Not tripped after %d failures", breakerThreshold)
+	}
+	if b.allow() {
+		t.Error("An open breaker lets an event through")
+	}
+	if s := b.status(); s == nil || s.State != v1beta1.CircuitBreakerOpen || s.Reason != "503 Service Unavailable" {
+		t.Errorf("status() = %+v, want open after 503", s)
+	}
+
+	// Once the cooldown is over, one trial event goes through.
+	b.until = time.Now()
+	if !b.allow() {
+		t.Fatal("The breaker lets no trial event through")
+	}
+	if b.allow() {
+		t.Error("The breaker lets a second event through during the trial")
+	}
+	// A trial given back lets another event through.
+	b.release()
+	if !b.allow() {
+		t.Error("The breaker lets no trial event through after a release")
+	}
+	if b.record(http.StatusServiceUnavailable, 0) || b.allow() {
+		t.Error("The breaker is not open again after a failed trial")
+	}
+	b.until = time.Now()
+	b.allow()
+	b.record(http.StatusAccepted, 0)
+	if !b.allow() || b.status() != nil {
+		t.Error("The breaker is not closed after a successful trial")
+	}
+
+	// Retry-After trips the breaker right away, for its duration.
+	if !b.record(http.StatusTooManyRequests, time.Hour) {
+		t.Error("Retry-After does not trip the breaker")
+	}
+	if d := time.Until(b.until); d < 59*time.Minute {
+		t.Errorf("Open for %v, want 1h", d)
+	}
+}
@@ -0,0 +1,243 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"time"
+
+	"github.com/eclipse/paho.golang/paho"
+	"go.uber.org/zap"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/ShixiongQi/brokerchannel/pkg/apis/samples/v1beta1"
+	"github.com/ShixiongQi/brokerchannel/pkg/buffer"
+)
+
+const (
+	// forwarders is the number of messages of a buffer sent concurrently.
+	forwarders = 10
+	// minRetryBackoff and maxRetryBackoff bound the delay between two
+	// attempts to send a buffered message.
+	minRetryBackoff = 100 * time.Millisecond
+	maxRetryBackoff = 30 * time.Second
+)
+
+// storedMessage is an MQTT message in a buffer.
+type storedMessage struct {
+	Topic       string            `json:"topic"`
+	QoS         byte              `json:"qos"`
+	Payload     []byte            `json:"payload"`
+	ContentType string            `json:"contentType,omitempty"`
+	User        map[string]string `json:"user,omitempty"`
+	// MessageExpiry is the MQTT 5 Message Expiry Interval of the message
+	// when it was received, which is when it was stored.
+	MessageExpiry *uint32 `json:"messageExpiry,omitempty"`
+	// Retain is set on the retained messages sent when subscribing.
+	Retain bool `json:"retain,omitempty"`
+}
+
+// store writes m to b. QoS 0 messages are dropped when the buffer is full,
+// while QoS 1 and 2 messages wait for room.
+func (mc *MQTTConnection) store(b *buffer.Buffer, m *paho.Publish) error {
+	sm := storedMessage{Topic: m.Topic, QoS: m.QoS, Payload: m.Payload, Retain: m.Retain}
+	if m.Properties != nil {
+		sm.ContentType, sm.User, sm.MessageExpiry = m.Properties.ContentType, m.Properties.User, m.Properties.MessageExpiry
+	}
+	data, err := json.Marshal(&sm)
+	if err != nil {
+		return err
+	}
+	if m.QoS > 0 {
+		return b.Put(mc.ctx, data)
+	}
+	if err := b.TryPut(data); err == buffer.ErrFull {
+		mc.reporter.ReportBufferDrop(mc.args, "full")
+		return err
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
+
+// SetBuffer sets the buffer of the BrokerChannel, which stores the messages
+// received when store is true, and starts sending its messages. maxAge
+// bounds the time the messages are retried.
+func (mc *MQTTConnection) SetBuffer(b *buffer.Buffer, store bool, maxAge time.Duration) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	mc.buffer, mc.maxAge = nil, maxAge
+	if store {
+		mc.buffer = b
+	}
+	if b == nil || b == mc.forwarding {
+		return
+	}
+	mc.forwarding = b
+	for i := 0; i < forwarders; i++ {
+		mc.wg.Add(1)
+		go func() {
+			defer mc.wg.Done()
+			mc.forward(b)
+		}()
+	}
+}
+
+// forward sends the messages of b, until the connection is closed.
+func (mc *MQTTConnection) forward(b *buffer.Buffer) {
+	for {
+		r, data, err := b.Next(mc.ctx)
+		if err != nil {
+			if mc.ctx.Err() != nil || err == buffer.ErrClosed {
+				return
+			}
+			mc.logger.Errorw("Failed to read the buffer", zap.Error(err))
+			select {
+			case <-mc.ctx.Done():
+				return
+			case <-time.After(maxRetryBackoff):
+			}
+			continue
+		}
+		var sm storedMessage
+		if err := json.Unmarshal(data, &sm); err != nil {
+			mc.logger.Errorw("Dropping a corrupted message from the buffer", zap.Uint64("seq", r.Seq), zap.Error(err))
+		} else if !mc.retry(r, &sm) {
+			b.Release(r.Seq)
+			return
+		}
+		if err := b.Remove(r.Seq); err != nil {
+			mc.logger.Errorw("Failed to remove a message from the buffer", zap.Uint64("seq", r.Seq), zap.Error(err))
+		}
+	}
+}
+
+// retry sends a buffered message until it is delivered or expires. It
+// returns false when the connection is closed first.
+func (mc *MQTTConnection) retry(r buffer.Record, sm *storedMessage) bool {
+	m := &paho.Publish{
+		Topic:      sm.Topic,
+		QoS:        sm.QoS,
+		Retain:     sm.Retain,
+		Payload:    sm.Payload,
+		Properties: &paho.PublishProperties{ContentType: sm.ContentType, User: sm.User, MessageExpiry: sm.MessageExpiry},
+	}
+	backoff := minRetryBackoff
+	for {
+		mc.mu.Lock()
+		maxAge := mc.maxAge
+		mc.mu.Unlock()
+		if time.Since(r.Time) > maxAge {
+			mc.logger.Warnw("Dropping an expired message from the buffer", zap.String("topic", m.Topic))
+			mc.reporter.ReportBufferDrop(mc.args, "expired")
+			return true
+		}
+		mc.mu.Lock()
+		l := mc.limiter
+		mc.mu.Unlock()
+		release, err := l.wait(mc.ctx)
+		if err != nil {
+			return false
+		}
+		done := mc.deliver(mc.ctx, m, r.Time, true)
+		release()
+		if done {
+			return true
+		}
+		select {
+		case <-mc.ctx.Done():
+			return false
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > maxRetryBackoff {
+			backoff = maxRetryBackoff
+		}
+	}
+}
+
+// buffered returns the number of messages of the buffer being forwarded.
+func (mc *MQTTConnection) buffered() int {
+	mc.mu.Lock()
+	b := mc.forwarding
+	mc.mu.Unlock()
+	if b == nil {
+		return 0
+	}
+	n, _ := b.Len()
+	return n
+}
+
+// bufferStatus returns the status of the buffer of the connection, nil
+// once the buffer is disabled and empty.
+func (mc *MQTTConnection) bufferStatus() *v1beta1.BufferStatus {
+	mc.mu.Lock()
+	b, store := mc.forwarding, mc.buffer != nil
+	mc.mu.Unlock()
+	if b == nil {
+		return nil
+	}
+	n, size := b.Len()
+	if n == 0 && !store {
+		return nil
+	}
+	return &v1beta1.BufferStatus{Messages: int64(n), Bytes: size}
+}
+
+// errNoBufferDir is returned for a BrokerChannel with a buffer when the
+// data plane has no directory to store it.
+var errNoBufferDir = errors.New("no buffer directory, BUFFER_DIR is not set")
+
+// buffer returns the buffer of bc, opened when bc has one, along with the
+// maximum age of its messages. cm.mu must be held.
+func (cm *ConnectionManager) buffer(bc *v1beta1.BrokerChannel) (*buffer.Buffer, time.Duration, error) {
+	ID := types.NamespacedName{Namespace: bc.Namespace, Name: bc.Name}
+	spec := &v1beta1.Buffer{}
+	if bc.Spec.Buffer != nil {
+		spec = bc.Spec.Buffer.DeepCopy()
+	}
+	spec.SetDefaults(cm.ctx)
+	b, ok := cm.buffers[ID]
+	if ok {
+		b.SetMaxSize(spec.MaxSize.Value())
+		return b, spec.MaxAge.Duration, nil
+	}
+	if bc.Spec.Buffer == nil {
+		return nil, spec.MaxAge.Duration, nil
+	}
+	if cm.bufferDir == "" {
+		return nil, 0, errNoBufferDir
+	}
+	b, err := buffer.Open(filepath.Join(cm.bufferDir, string(bc.UID)), spec.MaxSize.Value())
+	if err != nil {
+		return nil, 0, err
+	}
+	cm.buffers[ID] = b
+	return b, spec.MaxAge.Duration, nil
+}
+
+// deleteBuffer deletes the buffer of the BrokerChannel ID. cm.mu must be
+// held.
+func (cm *ConnectionManager) deleteBuffer(ID types.NamespacedName) {
+	if b, ok := cm.buffers[ID]; ok {
+		if err := b.Delete(); err != nil {
+			cm.logger.Errorw("Failed to delete the buffer", zap.String("brokerchannel", ID.String()), zap.Error(err))
+		}
+		delete(cm.buffers, ID)
+	}
+}
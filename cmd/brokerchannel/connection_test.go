@@ -0,0 +1,1040 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"knative.dev/pkg/apis"
+	duckv1 "knative.dev/pkg/apis/duck/v1"
+	"knative.dev/pkg/controller"
+	"knative.dev/pkg/hash"
+	logtesting "knative.dev/pkg/logging/testing"
+	"knative.dev/pkg/reconciler"
+	"knative.dev/pkg/tracker"
+
+	"github.com/ShixiongQi/brokerchannel/pkg/apis/samples/v1beta1"
+	"github.com/ShixiongQi/brokerchannel/pkg/buffer"
+	"github.com/ShixiongQi/brokerchannel/pkg/client/clientset/versioned"
+	"github.com/ShixiongQi/brokerchannel/pkg/client/clientset/versioned/fake"
+	"github.com/ShixiongQi/brokerchannel/pkg/dedup"
+	"github.com/ShixiongQi/brokerchannel/pkg/mqtt"
+	"github.com/ShixiongQi/brokerchannel/pkg/mqtt/resolver"
+	"github.com/ShixiongQi/brokerchannel/pkg/mqtttest"
+	"github.com/ShixiongQi/brokerchannel/pkg/sink"
+)
+
+// harness runs a ConnectionManager fed by a fake informer, against an
+// in-process broker and sink.
+type harness struct {
+	broker   *mqtttest.Broker
+	sink     *mqtttest.Sink
+	informer *mqtttest.BrokerChannelInformer
+	recorder *record.FakeRecorder
+	secrets  cache.Indexer
+	cm       *ConnectionManager
+}
+
+func newHarness(t *testing.T) *harness {
+	h := &harness{
+		broker:   mqtttest.NewBroker(t),
+		sink:     mqtttest.NewSink(t),
+		informer: mqtttest.NewBrokerChannelInformer(),
+		recorder: record.NewFakeRecorder(1000),
+		secrets:  cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc}),
+	}
+	h.cm = newConnectionManager(t, h.informer, h.recorder)
+	h.cm.resolver.Secrets = corelisters.NewSecretLister(h.secrets)
+	h.cm.resolver.Tracker = tracker.New(func(key types.NamespacedName) {
+		go h.cm.SyncChannel(key)
+	}, time.Hour)
+	h.cm.Promote(reconciler.UniversalBucket(), nil)
+	return h
+}
+
+// conn returns the connection of bc.
+func (h *harness) conn(bc *v1beta1.BrokerChannel) *MQTTConnection {
+	h.cm.mu.Lock()
+	defer h.cm.mu.Unlock()
+	return h.cm.conn[types.NamespacedName{Namespace: bc.Namespace, Name: bc.Name}]
+}
+
+// applied returns the settings applied to the connection of bc.
+func (h *harness) applied(bc *v1beta1.BrokerChannel) *settings {
+	c := h.conn(bc)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.applied
+}
+
+// setSecret adds or updates s, as the informer of the secrets does.
+func (h *harness) setSecret(s *corev1.Secret) {
+	h.secrets.Update(s)
+	controller.EnsureTypeMeta(h.cm.resolver.Tracker.OnChanged, corev1.SchemeGroupVersion.WithKind("Secret"))(s)
+}
+
+// replica starts another ConnectionManager, as run by another replica of
+// the data plane, and returns its informer.
+func (h *harness) replica(t *testing.T) *mqtttest.BrokerChannelInformer {
+	informer := mqtttest.NewBrokerChannelInformer()
+	newConnectionManager(t, informer, record.NewFakeRecorder(1000)).Promote(reconciler.UniversalBucket(), nil)
+	return informer
+}
+
+// newConnectionManager returns a ConnectionManager watching informer,
+// drained when the test ends. It leads no bucket.
+func newConnectionManager(t *testing.T, informer *mqtttest.BrokerChannelInformer, recorder record.EventRecorder) *ConnectionManager {
+	var wg sync.WaitGroup
+	cm := &ConnectionManager{
+		conn:          make(map[types.NamespacedName]*MQTTConnection),
+		channelLister: informer.Lister(),
+		resolver:      &resolver.Resolver{},
+		reporter:      NewStatsReporter(),
+		recorder:      recorder,
+		logger:        logtesting.TestLogger(t),
+		wg:            &wg,
+		ctx:           context.Background(),
+		client:        fake.NewSimpleClientset(),
+		buffers:       make(map[types.NamespacedName]*buffer.Buffer),
+		bufferDir:     t.TempDir(),
+		dedups:        make(map[types.NamespacedName]*dedup.Cache),
+	}
+	cm.WatchBrokerChannels(informer)
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), mqtttest.Timeout)
+		defer cancel()
+		cm.Drain(ctx)
+		wg.Wait()
+	})
+	return cm
+}
+
+func (h *harness) brokerChannel(subs ...v1beta1.Subscription) *v1beta1.BrokerChannel {
+	return &v1beta1.BrokerChannel{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "sensors", UID: "5cbf7a8e"},
+		Spec: v1beta1.BrokerChannelSpec{
+			Broker:        h.broker.Spec(),
+			Subscriptions: subs,
+		},
+		Status: v1beta1.BrokerChannelStatus{
+			SourceStatus: duckv1.SourceStatus{SinkURI: h.sink.URL()},
+		},
+	}
+}
+
+// publish sends a message as a producer of this repository does, with the
+// context attributes of the event in user properties.
+func (h *harness) publish(topic string, qos byte, id string) {
+	h.broker.Publish(topic, qos, []byte(`{"id":"`+id+`"}`), map[string]string{
+		"source": "/sensors/" + topic,
+		"type":   "dev.knative.sample.motion",
+		"ID":     id,
+	})
+}
+
+func TestDeliversMessages(t *testing.T) {
+	for _, qos := range []int32{0, 1} {
+		t.Run(fmt.Sprint("qos ", qos), func(t *testing.T) {
+			h := newHarness(t)
+			h.informer.Add(t, h.brokerChannel(v1beta1.Subscription{Topic: "motion/#", QoS: qos}))
+			h.broker.WaitForSubscription(t, "motion/#")
+			if got := h.broker.Subscriptions()["motion/#"]; got != byte(qos) {
+				t.Errorf("Granted QoS = %d, want %d", got, qos)
+			}
+
+			h.publish("motion/hall", byte(qos), "1")
+			e := h.sink.Next(t)
+			if e.ID() != "1" || e.Source() != "/sensors/motion/hall" || e.Type() != "dev.knative.sample.motion" {
+				t.Errorf("Unexpected event attributes: %v", e)
+			}
+			if got, want := string(e.Data()), `{"id":"1"}`; got != want {
+				t.Errorf("Data = %s, want %s", got, want)
+			}
+
+			h.publish("door/front", byte(qos), "2")
+			h.sink.ExpectNone(t, 200*time.Millisecond)
+		})
+	}
+}
+
+func TestDropsInvalidEvents(t *testing.T) {
+	h := newHarness(t)
+	h.informer.Add(t, h.brokerChannel(v1beta1.Subscription{Topic: "motion/#", QoS: 1}))
+	h.broker.WaitForSubscription(t, "motion/#")
+
+	// The message has no ID, it is acknowledged and never sent.
+	h.broker.Publish("motion/hall", 1, []byte(`{"id":"1"}`), map[string]string{
+		"source": "/sensors/motion/hall",
+		"type":   "dev.knative.sample.motion",
+		"id":     "1",
+	})
+	h.sink.ExpectNone(t, 200*time.Millisecond)
+	h.broker.WaitForUnacked(t, 0)
+
+	h.publish("motion/hall", 1, "2")
+	if e := h.sink.Next(t); e.ID() != "2" {
+		t.Errorf("Sink received %q, want 2", e.ID())
+	}
+}
+
+func TestUpdatesSubscriptions(t *testing.T) {
+	h := newHarness(t)
+	bc := h.brokerChannel(v1beta1.Subscription{Topic: "motion/#"})
+	h.informer.Add(t, bc)
+	h.broker.WaitForSubscription(t, "motion/#")
+
+	bc = bc.DeepCopy()
+	bc.Spec.Subscriptions = []v1beta1.Subscription{{Topic: "door/+", QoS: 1}}
+	h.informer.Update(t, bc)
+	h.broker.WaitForSubscription(t, "door/+")
+	h.broker.WaitForUnsubscription(t, "motion/#")
+
+	h.publish("motion/hall", 1, "1")
+	h.publish("door/front", 1, "2")
+	if e := h.sink.Next(t); e.ID() != "2" {
+		t.Errorf("Received event %q, want 2", e.ID())
+	}
+	h.sink.ExpectNone(t, 200*time.Millisecond)
+}
+
+func TestSkipsUnchangedUpdates(t *testing.T) {
+	h := newHarness(t)
+	bc := h.brokerChannel(v1beta1.Subscription{Topic: "motion/#"})
+	h.informer.Add(t, bc)
+	h.broker.WaitForSubscription(t, "motion/#")
+	s := h.applied(bc)
+	if s == nil {
+		t.Fatal("The settings were not applied")
+	}
+
+	// The status reported by the data plane is not applied again.
+	bc = bc.DeepCopy()
+	bc.Annotations = map[string]string{v1beta1.DataPlaneStatusAnnotation: "{}"}
+	bc.Status.ObservedGeneration++
+	h.informer.Update(t, bc)
+	if h.applied(bc) != s {
+		t.Error("The settings were applied again for an update of the status")
+	}
+
+	// The destinations resolved in the status are.
+	bc = bc.DeepCopy()
+	bc.Status.DeadLetterSinkURI = apis.HTTP("dead-letter.example.com")
+	h.informer.Update(t, bc)
+	if got := h.applied(bc); got == s || got.deadLetter != bc.Status.DeadLetterSinkURI {
+		t.Errorf("Applied dead letter sink %v, want %v", got.deadLetter, bc.Status.DeadLetterSinkURI)
+	}
+
+	// And so is the spec.
+	s = h.applied(bc)
+	bc = bc.DeepCopy()
+	bc.Spec.MarkRetained = true
+	h.informer.Update(t, bc)
+	if got := h.applied(bc); got.generation != s.generation+1 {
+		t.Errorf("Applied generation %d, want %d", got.generation, s.generation+1)
+	}
+}
+
+func TestHandlesRetainedMessages(t *testing.T) {
+	h := newHarness(t)
+	retain := func(topic, id string) {
+		h.broker.PublishRetained(topic, 1, []byte(`{"id":"`+id+`"}`), map[string]string{
+			"source": "/sensors/" + topic,
+			"type":   "dev.knative.sample.status",
+			"ID":     id,
+		})
+	}
+	retain("status/hall", "1")
+	retain("alarms/door", "2")
+
+	// The retained messages are sent on a new subscription, and marked.
+	bc := h.brokerChannel(v1beta1.Subscription{Topic: "status/#", QoS: 1, RetainHandling: v1beta1.SendRetainedIfNew})
+	bc.Spec.MarkRetained = true
+	h.informer.Add(t, bc)
+	e := h.sink.Next(t)
+	if e.ID() != "1" || e.Extensions()[retainedExtension] != "true" {
+		t.Errorf("Received event %q with extensions %v, want 1 retained", e.ID(), e.Extensions())
+	}
+	h.broker.WaitForUnacked(t, 0)
+	h.publish("status/hall", 1, "3")
+	if e := h.sink.Next(t); e.ID() != "3" || e.Extensions()[retainedExtension] != nil {
+		t.Errorf("Received event %q with extensions %v, want 3 not retained", e.ID(), e.Extensions())
+	}
+
+	// They are not sent again for an existing subscription, nor ever.
+	bc = bc.DeepCopy()
+	bc.Spec.Subscriptions = append(bc.Spec.Subscriptions, v1beta1.Subscription{Topic: "alarms/#", QoS: 1, RetainHandling: v1beta1.NeverSendRetained})
+	h.informer.Update(t, bc)
+	h.broker.WaitForSubscription(t, "alarms/#")
+	h.sink.ExpectNone(t, 200*time.Millisecond)
+
+	// They are sent on every subscription by default.
+	bc = bc.DeepCopy()
+	bc.Spec.Subscriptions[0].RetainHandling = ""
+	bc.Spec.MarkRetained = false
+	h.informer.Update(t, bc)
+	if e := h.sink.Next(t); e.ID() != "1" || e.Extensions()[retainedExtension] != nil {
+		t.Errorf("Received event %q with extensions %v, want 1 not marked", e.ID(), e.Extensions())
+	}
+	h.sink.ExpectNone(t, 200*time.Millisecond)
+
+	// Nor on updates which do not change the subscriptions.
+	bc = bc.DeepCopy()
+	bc.Spec.MarkRetained = true
+	h.informer.Update(t, bc)
+	h.sink.ExpectNone(t, 200*time.Millisecond)
+}
+
+func TestFiltersMessages(t *testing.T) {
+	h := newHarness(t)
+	bc := h.brokerChannel(v1beta1.Subscription{Topic: "sensors/#", QoS: 1})
+	bc.Spec.Filter = &v1beta1.Filter{
+		Prefix: map[string]string{"source": "/sensors/sensors/hall"},
+	}
+	h.informer.Add(t, bc)
+	h.broker.WaitForSubscription(t, "sensors/#")
+
+	h.publish("sensors/kitchen", 1, "1")
+	h.publish("sensors/hall", 1, "2")
+	if e := h.sink.Next(t); e.ID() != "2" {
+		t.Errorf("Received event %q, want 2", e.ID())
+	}
+	h.sink.ExpectNone(t, 200*time.Millisecond)
+
+	// The payload is matched by a CEL expression.
+	bc = bc.DeepCopy()
+	bc.Spec.Filter = &v1beta1.Filter{CEL: `data.id != "3"`}
+	h.informer.Update(t, bc)
+	h.publish("sensors/kitchen", 1, "3")
+	h.publish("sensors/kitchen", 1, "4")
+	if e := h.sink.Next(t); e.ID() != "4" {
+		t.Errorf("Received event %q, want 4", e.ID())
+	}
+	h.sink.ExpectNone(t, 200*time.Millisecond)
+
+	// Removing the filter lets every message through.
+	bc = bc.DeepCopy()
+	bc.Spec.Filter = nil
+	h.informer.Update(t, bc)
+	h.publish("sensors/kitchen", 1, "5")
+	if e := h.sink.Next(t); e.ID() != "5" {
+		t.Errorf("Received event %q, want 5", e.ID())
+	}
+}
+
+func TestTransformsMessages(t *testing.T) {
+	h := newHarness(t)
+	bc := h.brokerChannel(v1beta1.Subscription{Topic: "sensors/#"})
+	bc.Spec.Transform = &v1beta1.Transform{
+		Fields: []v1beta1.FieldMapping{{Name: "message", Path: "$.id"}},
+		Type:   "dev.knative.sensor.{{ index .Levels 1 }}",
+	}
+	// The filter sees the transformed type.
+	bc.Spec.Filter = &v1beta1.Filter{
+		Exact: map[string]string{"type": "dev.knative.sensor.hall"},
+	}
+	h.informer.Add(t, bc)
+	h.broker.WaitForSubscription(t, "sensors/#")
+
+	h.publish("sensors/kitchen", 0, "1")
+	h.publish("sensors/hall", 0, "2")
+	e := h.sink.Next(t)
+	if e.ID() != "2" || e.Type() != "dev.knative.sensor.hall" {
+		t.Errorf("Unexpected event attributes: %v", e)
+	}
+	if got, want := string(e.Data()), `{"message":"2"}`; got != want {
+		t.Errorf("Data = %s, want %s", got, want)
+	}
+	h.sink.ExpectNone(t, 200*time.Millisecond)
+}
+
+func TestRoutesMessages(t *testing.T) {
+	h := newHarness(t)
+	alarms, firmware := mqtttest.NewSink(t), mqtttest.NewSink(t)
+	bc := h.brokerChannel(v1beta1.Subscription{Topic: "site/#", QoS: 1})
+	bc.Spec.Routes = []v1beta1.Route{{
+		Name:        "alarms",
+		Topic:       "site/+/alarm",
+		Destination: duckv1.Destination{URI: alarms.URL()},
+	}, {
+		Name:  "hall-firmware",
+		Topic: "site/+/firmware",
+		Filter: &v1beta1.Filter{
+			Suffix: map[string]string{"source": "/hall/firmware"},
+		},
+		Destination: duckv1.Destination{URI: firmware.URL()},
+	}, {
+		// Not resolved yet.
+		Name:  "firmware",
+		Topic: "site/+/firmware",
+	}}
+	bc.Status.Routes = []v1beta1.RouteStatus{
+		{Name: "alarms", URI: alarms.URL()},
+		{Name: "hall-firmware", URI: firmware.URL()},
+	}
+	h.informer.Add(t, bc)
+	h.broker.WaitForSubscription(t, "site/#")
+
+	h.publish("site/hall/alarm", 1, "1")
+	h.publish("site/hall/firmware", 1, "2")
+	h.publish("site/hall/telemetry", 1, "3")
+	h.publish("site/kitchen/firmware", 1, "4")
+	if e := alarms.Next(t); e.ID() != "1" {
+		t.Errorf("Received alarm %q, want 1", e.ID())
+	}
+	if e := firmware.Next(t); e.ID() != "2" {
+		t.Errorf("Received firmware %q, want 2", e.ID())
+	}
+	// The sink is the default route.
+	if e := h.sink.Next(t); e.ID() != "3" {
+		t.Errorf("Received event %q, want 3", e.ID())
+	}
+	for _, s := range []*mqtttest.Sink{alarms, firmware, h.sink} {
+		s.ExpectNone(t, 200*time.Millisecond)
+	}
+	// The event of the route not resolved yet is left unacknowledged.
+	h.broker.WaitForUnacked(t, 1)
+}
+
+func TestSharedSubscriptions(t *testing.T) {
+	h := newHarness(t)
+	bc := h.brokerChannel(v1beta1.Subscription{Topic: "motion/#", QoS: 1})
+	bc.Spec.SubscriptionMode = v1beta1.SharedSubscriptions
+	shared := mqtt.SharedFilter(string(bc.UID), "motion/#")
+	h.informer.Add(t, bc)
+	h.broker.WaitForSubscription(t, shared)
+	h.replica(t).Add(t, bc)
+	h.broker.WaitForSubscribers(t, shared, 2)
+
+	// Each message is delivered once, by either replica.
+	const n = 10
+	for i := 0; i < n; i++ {
+		h.publish("motion/hall", 1, fmt.Sprint(i))
+	}
+	seen := make(map[string]bool)
+	for i := 0; i < n; i++ {
+		e := h.sink.Next(t)
+		if seen[e.ID()] {
+			t.Errorf("Event %q delivered twice", e.ID())
+		}
+		seen[e.ID()] = true
+	}
+	h.sink.ExpectNone(t, 200*time.Millisecond)
+
+	// Switching to exclusive subscriptions replaces the shared ones.
+	bc = bc.DeepCopy()
+	bc.Spec.SubscriptionMode = v1beta1.ExclusiveSubscriptions
+	h.informer.Update(t, bc)
+	h.broker.WaitForSubscription(t, "motion/#")
+}
+
+func TestReconnects(t *testing.T) {
+	h := newHarness(t)
+	bc := h.brokerChannel(v1beta1.Subscription{Topic: "motion/#", QoS: 1})
+	client := fake.NewSimpleClientset(bc)
+	h.cm.client = client
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go h.cm.ReportStatus(ctx, 10*time.Millisecond)
+	h.informer.Add(t, bc)
+	h.broker.WaitForSubscription(t, "motion/#")
+	connected := func(s *v1beta1.BrokerChannelStatus) bool {
+		return s.GetCondition(v1beta1.BrokerChannelConnected).IsTrue()
+	}
+	waitForStatus(t, client, bc, connected)
+
+	// The BrokerChannel is not connected until the session is resumed.
+	h.broker.DropConnections()
+	waitForStatus(t, client, bc, func(s *v1beta1.BrokerChannelStatus) bool { return !connected(s) })
+	h.broker.WaitForUnsubscription(t, "motion/#")
+	// The subscription is restored with the session.
+	h.broker.WaitForSubscription(t, "motion/#")
+	waitForStatus(t, client, bc, connected)
+
+	h.publish("motion/hall", 1, "1")
+	if e := h.sink.Next(t); e.ID() != "1" {
+		t.Errorf("Received event %q, want 1", e.ID())
+	}
+	if !h.recorded("BrokerDisconnected") || !h.recorded("BrokerReconnected") {
+		t.Error("Missing the BrokerDisconnected and BrokerReconnected events")
+	}
+}
+
+func TestDeleteDisconnects(t *testing.T) {
+	h := newHarness(t)
+	bc := h.brokerChannel(v1beta1.Subscription{Topic: "motion/#"})
+	h.informer.Add(t, bc)
+	h.broker.WaitForSubscription(t, "motion/#")
+
+	h.informer.Delete(t, bc)
+	h.broker.WaitForUnsubscription(t, "motion/#")
+	h.publish("motion/hall", 0, "1")
+	h.sink.ExpectNone(t, 200*time.Millisecond)
+	if h.broker.Stored("brokerchannel-" + string(bc.UID)) {
+		t.Error("The session of the deleted BrokerChannel is kept")
+	}
+}
+
+func TestBuffersMessages(t *testing.T) {
+	h := newHarness(t)
+	bc := h.brokerChannel(v1beta1.Subscription{Topic: "motion/#", QoS: 1})
+	bc.Spec.Buffer = &v1beta1.Buffer{}
+	client := fake.NewSimpleClientset(bc)
+	h.cm.client = client
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go h.cm.ReportStatus(ctx, 10*time.Millisecond)
+	h.informer.Add(t, bc)
+	h.broker.WaitForSubscription(t, "motion/#")
+
+	// The messages are acknowledged once buffered, while the sink fails.
+	h.sink.SetStatus(http.StatusServiceUnavailable)
+	h.publish("motion/hall", 1, "1")
+	h.publish("motion/kitchen", 1, "2")
+	h.broker.WaitForUnacked(t, 0)
+	h.sink.Next(t)
+	waitForStatus(t, client, bc, func(s *v1beta1.BrokerChannelStatus) bool { return s.Buffer != nil && s.Buffer.Messages == 2 })
+
+	// They are sent again until the sink accepts them.
+	h.sink.SetStatus(http.StatusAccepted)
+	waitForStatus(t, client, bc, func(s *v1beta1.BrokerChannelStatus) bool { return s.Buffer != nil && s.Buffer.Messages == 0 })
+	seen := make(map[string]bool)
+	for len(seen) < 2 {
+		seen[h.sink.Next(t).ID()] = true
+	}
+	if !seen["1"] || !seen["2"] {
+		t.Errorf("Received events %v, want 1 and 2", seen)
+	}
+}
+
+func TestDeduplicatesMessages(t *testing.T) {
+	h := newHarness(t)
+	bc := h.brokerChannel(v1beta1.Subscription{Topic: "motion/#", QoS: 1})
+	bc.Spec.Deduplication = &v1beta1.Deduplication{Path: "$.id", Persist: true}
+	h.informer.Add(t, bc)
+	h.broker.WaitForSubscription(t, "motion/#")
+
+	// The copies of a message are dropped, even while it is in flight.
+	h.publish("motion/hall", 1, "1")
+	h.publish("motion/hall", 1, "1")
+	h.publish("motion/hall", 1, "2")
+	seen := make(map[string]int)
+	for i := 0; i < 2; i++ {
+		seen[h.sink.Next(t).ID()]++
+	}
+	h.sink.ExpectNone(t, 200*time.Millisecond)
+	if seen["1"] != 1 || seen["2"] != 1 {
+		t.Errorf("Received events %v, want 1 and 2 once", seen)
+	}
+	h.broker.WaitForUnacked(t, 0)
+
+	// The keys survive a restart in the buffer directory.
+	h.cm.mu.Lock()
+	h.cm.dedups[types.NamespacedName{Namespace: "default", Name: "sensors"}].Close()
+	h.cm.dedups = make(map[types.NamespacedName]*dedup.Cache)
+	h.cm.mu.Unlock()
+	bc = bc.DeepCopy()
+	bc.Spec.Deduplication.MaxKeys = 100
+	h.informer.Update(t, bc)
+	h.publish("motion/hall", 1, "2")
+	h.publish("motion/hall", 1, "3")
+	if e := h.sink.Next(t); e.ID() != "3" {
+		t.Errorf("Received event %q, want 3", e.ID())
+	}
+	h.sink.ExpectNone(t, 200*time.Millisecond)
+}
+
+func TestExpiresMessages(t *testing.T) {
+	h := newHarness(t)
+	bc := h.brokerChannel(v1beta1.Subscription{Topic: "motion/#", QoS: 1})
+	h.informer.Add(t, bc)
+	h.broker.WaitForSubscription(t, "motion/#")
+	expiring := func(id string) {
+		h.broker.PublishExpiring("motion/hall", 1, []byte(`{"id":"`+id+`"}`), map[string]string{
+			"source": "/sensors/motion/hall",
+			"type":   "dev.knative.sample.motion",
+			"ID":     id,
+		}, 1)
+	}
+
+	// A message expiring while the breaker of the sink is open is dropped,
+	// and acknowledged. The message which tripped the breaker is left
+	// unacknowledged.
+	h.sink.SetStatus(http.StatusTooManyRequests)
+	h.sink.SetRetryAfter("2")
+	h.publish("motion/hall", 1, "1")
+	h.sink.Next(t)
+	h.waitForOpenBreaker(t)
+	h.broker.WaitForUnacked(t, 1)
+	h.sink.SetStatus(http.StatusAccepted)
+	h.sink.SetRetryAfter("")
+	expiring("2")
+	h.sink.ExpectNone(t, 2500*time.Millisecond)
+	h.broker.WaitForUnacked(t, 1)
+
+	// With a dead letter sink, it is sent there instead.
+	dls := mqtttest.NewSink(t)
+	bc = bc.DeepCopy()
+	bc.Status.DeadLetterSinkURI = dls.URL()
+	h.informer.Update(t, bc)
+	h.sink.SetStatus(http.StatusTooManyRequests)
+	h.sink.SetRetryAfter("2")
+	h.publish("motion/hall", 1, "3")
+	h.sink.Next(t)
+	h.waitForOpenBreaker(t)
+	h.broker.WaitForUnacked(t, 2)
+	h.sink.SetStatus(http.StatusAccepted)
+	h.sink.SetRetryAfter("")
+	expiring("4")
+	e := dls.Next(t)
+	if e.ID() != "4" || e.Extensions()[deadLetterReasonExtension] != expiredReason {
+		t.Errorf("Dead letter sink received %q with extensions %v, want 4 expired", e.ID(), e.Extensions())
+	}
+	h.sink.ExpectNone(t, 200*time.Millisecond)
+
+	// Messages are delivered before they expire.
+	expiring("5")
+	if e := h.sink.Next(t); e.ID() != "5" {
+		t.Errorf("Received event %q, want 5", e.ID())
+	}
+}
+
+func TestLimitsDeliveries(t *testing.T) {
+	h := newHarness(t)
+	bc := h.brokerChannel(v1beta1.Subscription{Topic: "motion/#", QoS: 1})
+	bc.Spec.RateLimit = &v1beta1.RateLimit{EventsPerSecond: 20, Burst: 1}
+	maxInFlight := int32(1)
+	bc.Spec.MaxInFlight = &maxInFlight
+	h.informer.Add(t, bc)
+	h.broker.WaitForSubscription(t, "motion/#")
+
+	// The broker waits for the acknowledgement of each message, sent once
+	// the message is delivered at the rate limit.
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		h.publish("motion/hall", 1, fmt.Sprint(i))
+	}
+	for i := 0; i < 5; i++ {
+		if e := h.sink.Next(t); e.ID() != fmt.Sprint(i) {
+			t.Errorf("Received event %q, want %d", e.ID(), i)
+		}
+	}
+	if d := time.Since(start); d < 150*time.Millisecond {
+		t.Errorf("Delivered 5 events in %v, want 200ms at 20 per second", d)
+	}
+	h.broker.WaitForUnacked(t, 0)
+	if n := h.broker.MaxUnacked(); n != 1 {
+		t.Errorf("MaxUnacked() = %d, want 1", n)
+	}
+
+	// An update which does not change the limits keeps the limiter.
+	c := h.conn(bc)
+	c.mu.Lock()
+	l := c.limiter
+	c.mu.Unlock()
+	bc = bc.DeepCopy()
+	bc.Spec.MarkRetained = true
+	h.informer.Update(t, bc)
+	c.mu.Lock()
+	if c.limiter != l {
+		t.Error("The limiter was replaced by an update of the spec")
+	}
+	c.mu.Unlock()
+
+	// The QoS 0 messages over the limit are dropped.
+	time.Sleep(100 * time.Millisecond)
+	for i := 5; i < 8; i++ {
+		h.publish("motion/hall", 0, fmt.Sprint(i))
+	}
+	h.sink.Next(t)
+	h.sink.ExpectNone(t, 200*time.Millisecond)
+}
+
+func TestAuthenticatesToSinks(t *testing.T) {
+	h := newHarness(t)
+	h.setSecret(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "sink-headers"},
+		Data:       map[string][]byte{"Authorization": []byte("Bearer s3cr3t")},
+	})
+	h.sink.RequireHeader("Authorization", "Bearer s3cr3t")
+	bc := h.brokerChannel(v1beta1.Subscription{Topic: "motion/#", QoS: 1})
+	bc.Spec.SinkAuth = &v1beta1.SinkAuth{Headers: &corev1.LocalObjectReference{Name: "sink-headers"}}
+	h.informer.Add(t, bc)
+	h.broker.WaitForSubscription(t, "motion/#")
+
+	h.publish("motion/hall", 1, "1")
+	if e := h.sink.Next(t); e.ID() != "1" {
+		t.Errorf("Received event %q, want 1", e.ID())
+	}
+
+	// A rotated secret is read again.
+	h.setSecret(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "sink-headers"},
+		Data:       map[string][]byte{"Authorization": []byte("Bearer r0tated")},
+	})
+	h.sink.RequireHeader("Authorization", "Bearer r0tated")
+	h.waitForSink(t, types.NamespacedName{Namespace: "default", Name: "sensors"}, func(cfg *sink.Config) bool {
+		return cfg != nil && cfg.Headers["Authorization"] == "Bearer r0tated"
+	})
+	h.publish("motion/hall", 1, "2")
+	if e := h.sink.Next(t); e.ID() != "2" {
+		t.Errorf("Received event %q, want 2", e.ID())
+	}
+
+	// A missing secret is reported, and the previous settings are kept.
+	bc = bc.DeepCopy()
+	bc.Spec.SinkAuth.Headers.Name = "missing"
+	h.informer.Update(t, bc)
+	if !h.recorded("SinkAuthFailed") {
+		t.Error("Missing the SinkAuthFailed event")
+	}
+	h.publish("motion/hall", 1, "3")
+	if e := h.sink.Next(t); e.ID() != "3" {
+		t.Errorf("Received event %q, want 3", e.ID())
+	}
+}
+
+// waitForOpenBreaker waits for a circuit breaker of the BrokerChannel to
+// open.
+func (h *harness) waitForOpenBreaker(t *testing.T) {
+	t.Helper()
+	ID := types.NamespacedName{Namespace: "default", Name: "sensors"}
+	deadline := time.Now().Add(mqtttest.Timeout)
+	for {
+		h.cm.mu.Lock()
+		c, ok := h.cm.conn[ID]
+		h.cm.mu.Unlock()
+		if ok && len(c.status().CircuitBreakers) > 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for a circuit breaker to open")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// waitForSink waits for the sink settings of the BrokerChannel ID to satisfy
+// cond.
+func (h *harness) waitForSink(t *testing.T, ID types.NamespacedName, cond func(*sink.Config) bool) {
+	t.Helper()
+	deadline := time.Now().Add(mqtttest.Timeout)
+	for {
+		h.cm.mu.Lock()
+		c, ok := h.cm.conn[ID]
+		h.cm.mu.Unlock()
+		if ok {
+			c.mu.Lock()
+			cfg := c.sinkCfg
+			c.mu.Unlock()
+			if cond(cfg) {
+				return
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for the sink settings")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSignsDeliveries(t *testing.T) {
+	h := newHarness(t)
+	h.setSecret(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "sink-signing"},
+		Data:       map[string][]byte{"key": []byte("s3cr3t")},
+	})
+	h.sink.RequireSignature([]byte("s3cr3t"))
+	bc := h.brokerChannel(v1beta1.Subscription{Topic: "motion/#", QoS: 1})
+	bc.Spec.SinkAuth = &v1beta1.SinkAuth{Signing: &v1beta1.Signing{
+		Key: &corev1.SecretKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: "sink-signing"},
+			Key:                  "key",
+		},
+		Algorithm: v1beta1.HMACSHA256,
+	}}
+	h.informer.Add(t, bc)
+	h.broker.WaitForSubscription(t, "motion/#")
+
+	h.publish("motion/hall", 1, "1")
+	if e := h.sink.Next(t); e.ID() != "1" {
+		t.Errorf("Received event %q, want 1", e.ID())
+	}
+}
+
+func TestPausesOverloadedSinks(t *testing.T) {
+	h := newHarness(t)
+	h.informer.Add(t, h.brokerChannel(v1beta1.Subscription{Topic: "motion/#", QoS: 1}))
+	h.broker.WaitForSubscription(t, "motion/#")
+
+	// A 429 with Retry-After trips the breaker of the sink, which holds the
+	// next message back, unacknowledged. The rejected message is left
+	// unacknowledged too, for the broker to send it again.
+	h.sink.SetStatus(http.StatusTooManyRequests)
+	h.sink.SetRetryAfter("1")
+	h.publish("motion/hall", 1, "1")
+	h.sink.Next(t)
+	h.waitForOpenBreaker(t)
+	h.broker.WaitForUnacked(t, 1)
+	h.publish("motion/hall", 1, "2")
+	h.broker.WaitForUnacked(t, 2)
+	h.sink.ExpectNone(t, 200*time.Millisecond)
+	if !h.recorded("CircuitOpen") {
+		t.Error("Missing the CircuitOpen event")
+	}
+
+	h.sink.SetStatus(http.StatusAccepted)
+	h.sink.SetRetryAfter("")
+	if e := h.sink.Next(t); e.ID() != "2" {
+		t.Errorf("Received event %q, want 2", e.ID())
+	}
+	h.broker.WaitForUnacked(t, 1)
+}
+
+func TestRetriesBufferedMessages(t *testing.T) {
+	h := newHarness(t)
+	bc := h.brokerChannel(v1beta1.Subscription{Topic: "motion/#", QoS: 1})
+	bc.Spec.Buffer = &v1beta1.Buffer{}
+	client := fake.NewSimpleClientset(bc)
+	h.cm.client = client
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go h.cm.ReportStatus(ctx, 10*time.Millisecond)
+	h.informer.Add(t, bc)
+	h.broker.WaitForSubscription(t, "motion/#")
+
+	// A 4xx other than 408, 409 and 429 is not retried.
+	h.sink.SetStatus(http.StatusBadRequest)
+	h.publish("motion/hall", 1, "1")
+	h.sink.Next(t)
+	h.sink.ExpectNone(t, 300*time.Millisecond)
+
+	// A 429 is retried after Retry-After, and the open breaker is reported
+	// in the status.
+	h.sink.SetStatus(http.StatusTooManyRequests)
+	h.sink.SetRetryAfter("1")
+	h.publish("motion/hall", 1, "2")
+	h.sink.Next(t)
+	waitForStatus(t, client, bc, func(s *v1beta1.BrokerChannelStatus) bool {
+		return len(s.CircuitBreakers) == 1 && s.CircuitBreakers[0].State == v1beta1.CircuitBreakerOpen &&
+			s.CircuitBreakers[0].Reason == "429 Too Many Requests" && s.CircuitBreakers[0].URI.String() == h.sink.URL().String()
+	})
+	h.sink.SetStatus(http.StatusAccepted)
+	h.sink.SetRetryAfter("")
+	if e := h.sink.Next(t); e.ID() != "2" {
+		t.Errorf("Received event %q, want 2", e.ID())
+	}
+	waitForStatus(t, client, bc, func(s *v1beta1.BrokerChannelStatus) bool {
+		return len(s.CircuitBreakers) == 0 && s.Buffer != nil && s.Buffer.Messages == 0
+	})
+}
+
+// waitForStatus waits for the status of bc, as copied by the controller from
+// the DataPlaneStatusAnnotation, to satisfy cond.
+func waitForStatus(t *testing.T, client versioned.Interface, bc *v1beta1.BrokerChannel, cond func(*v1beta1.BrokerChannelStatus) bool) {
+	t.Helper()
+	deadline := time.Now().Add(mqtttest.Timeout)
+	for {
+		got, err := client.SamplesV1beta1().BrokerChannels(bc.Namespace).Get(context.Background(), bc.Name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatal("Failed to get the BrokerChannel:", err)
+		}
+		if a, ok := got.Annotations[v1beta1.DataPlaneStatusAnnotation]; ok {
+			dps := &v1beta1.DataPlaneStatus{}
+			if err := json.Unmarshal([]byte(a), dps); err != nil {
+				t.Fatal("Invalid data plane status:", err)
+			}
+			got.Status.PropagateDataPlaneStatus(dps)
+		}
+		if cond(&got.Status) {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for the status, got %+v", got.Status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// buckets returns the buckets of a data plane configured with n of them.
+func buckets(n int) []reconciler.Bucket {
+	names := sets.NewString()
+	for i := 0; i < n; i++ {
+		names.Insert(fmt.Sprintf("brokerchannel.brokerchannel.%02d-of-%02d", i, n))
+	}
+	return hash.NewBucketSet(names).Buckets()
+}
+
+// connects tells whether cm is connected for the BrokerChannel ID.
+func connects(cm *ConnectionManager, ID types.NamespacedName) bool {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	_, ok := cm.conn[ID]
+	return ok
+}
+
+func TestShardsBrokerChannels(t *testing.T) {
+	h := newHarness(t)
+	h.cm.Demote(reconciler.UniversalBucket())
+	informer := mqtttest.NewBrokerChannelInformer()
+	other := newConnectionManager(t, informer, record.NewFakeRecorder(1000))
+	bkts := buckets(2)
+	h.cm.Promote(bkts[0], nil)
+	other.Promote(bkts[1], nil)
+
+	const n = 8
+	var bcs []*v1beta1.BrokerChannel
+	for i := 0; i < n; i++ {
+		bc := h.brokerChannel(v1beta1.Subscription{Topic: fmt.Sprint("motion/", i), QoS: 1})
+		bc.Name = fmt.Sprint("sensors-", i)
+		bc.UID = types.UID(fmt.Sprint("5cbf7a8e-", i))
+		h.informer.Add(t, bc)
+		informer.Add(t, bc)
+		bcs = append(bcs, bc)
+	}
+
+	// Every BrokerChannel is connected once, by the leader of its bucket.
+	for i, bc := range bcs {
+		ID := types.NamespacedName{Namespace: bc.Namespace, Name: bc.Name}
+		h.broker.WaitForSubscribers(t, fmt.Sprint("motion/", i), 1)
+		if got, want := connects(h.cm, ID), bkts[0].Has(ID); got != want {
+			t.Errorf("First replica connects %s = %t, want %t", ID, got, want)
+		}
+		if got, want := connects(other, ID), bkts[1].Has(ID); got != want {
+			t.Errorf("Second replica connects %s = %t, want %t", ID, got, want)
+		}
+	}
+
+	// The other replica takes the bucket of the first one over.
+	h.cm.Demote(bkts[0])
+	other.Promote(bkts[0], nil)
+	for i, bc := range bcs {
+		ID := types.NamespacedName{Namespace: bc.Namespace, Name: bc.Name}
+		h.broker.WaitForSubscribers(t, fmt.Sprint("motion/", i), 1)
+		if connects(h.cm, ID) || !connects(other, ID) {
+			t.Errorf("%s is not connected by the second replica only", ID)
+		}
+	}
+	for i := 0; i < n; i++ {
+		h.publish(fmt.Sprint("motion/", i), 1, fmt.Sprint(i))
+	}
+	seen := make(map[string]bool)
+	for i := 0; i < n; i++ {
+		e := h.sink.Next(t)
+		if seen[e.ID()] {
+			t.Errorf("Event %q delivered twice", e.ID())
+		}
+		seen[e.ID()] = true
+	}
+	h.sink.ExpectNone(t, 200*time.Millisecond)
+}
+
+func TestTakesOverSessions(t *testing.T) {
+	h := newHarness(t)
+	bc := h.brokerChannel(v1beta1.Subscription{Topic: "motion/#", QoS: 1})
+	h.informer.Add(t, bc)
+	informer := mqtttest.NewBrokerChannelInformer()
+	other := newConnectionManager(t, informer, record.NewFakeRecorder(1000))
+	informer.Add(t, bc)
+	h.broker.WaitForSubscribers(t, "motion/#", 1)
+
+	// The broker queues the messages published while no replica leads the
+	// bucket, and delivers them to the next leader.
+	h.cm.Demote(reconciler.UniversalBucket())
+	h.broker.WaitForStored(t, "brokerchannel-"+string(bc.UID))
+	h.publish("motion/hall", 1, "1")
+	other.Promote(reconciler.UniversalBucket(), nil)
+	if e := h.sink.Next(t); e.ID() != "1" {
+		t.Errorf("Received event %q, want 1", e.ID())
+	}
+	h.broker.WaitForSubscribers(t, "motion/#", 1)
+	h.sink.ExpectNone(t, 200*time.Millisecond)
+}
+
+func TestDrainAcknowledgesDeliveries(t *testing.T) {
+	h := newHarness(t)
+	h.sink.SetDelay(300 * time.Millisecond)
+	bc := h.brokerChannel(v1beta1.Subscription{Topic: "motion/#", QoS: 1})
+	h.informer.Add(t, bc)
+	h.broker.WaitForSubscription(t, "motion/#")
+	h.publish("motion/hall", 1, "1")
+	c := h.conn(bc)
+	for atomic.LoadInt64(&c.inFlight) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// The message in flight is delivered and acknowledged before the
+	// session is closed, the messages received while draining are left to
+	// the replica taking the session over.
+	drained := make(chan struct{})
+	go func() {
+		defer close(drained)
+		ctx, cancel := context.WithTimeout(context.Background(), mqtttest.Timeout)
+		defer cancel()
+		h.cm.Drain(ctx)
+	}()
+	for {
+		c.mu.Lock()
+		draining := c.draining
+		c.mu.Unlock()
+		if draining {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	h.publish("motion/hall", 1, "2")
+	<-drained
+	if e := h.sink.Next(t); e.ID() != "1" {
+		t.Errorf("Received event %q, want 1", e.ID())
+	}
+	h.broker.WaitForStored(t, "brokerchannel-"+string(bc.UID))
+
+	h.sink.SetDelay(0)
+	h.replica(t).Add(t, bc)
+	if e := h.sink.Next(t); e.ID() != "2" {
+		t.Errorf("Received event %q, want 2", e.ID())
+	}
+	h.sink.ExpectNone(t, 200*time.Millisecond)
+}
+
+// recorded tells whether an event with reason was recorded.
+func (h *harness) recorded(reason string) bool {
+	for {
+		select {
+		case e := <-h.recorder.Events:
+			if strings.Contains(e, " "+reason+" ") {
+				return true
+			}
+		default:
+			return false
+		}
+	}
+}
@@ -0,0 +1,131 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/eclipse/paho.golang/paho"
+	"go.uber.org/zap"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/jsonpath"
+
+	"github.com/ShixiongQi/brokerchannel/pkg/apis/samples/v1beta1"
+	"github.com/ShixiongQi/brokerchannel/pkg/dedup"
+)
+
+// deduplicator drops the copies of the messages delivered recently.
+type deduplicator struct {
+	cache    *dedup.Cache
+	property string
+	path     *jsonpath.JSONPath
+}
+
+// key returns the key identifying the copies of m, whose event is event,
+// or "" when m has no key or d is nil.
+func (d *deduplicator) key(m *paho.Publish, event *cloudevents.Event) string {
+	switch {
+	case d == nil:
+		return ""
+	case d.property != "":
+		if m.Properties == nil {
+			return ""
+		}
+		return m.Properties.User[d.property]
+	case d.path != nil:
+		var payload interface{}
+		if err := json.Unmarshal(m.Payload, &payload); err != nil {
+			return ""
+		}
+		results, err := d.path.FindResults(payload)
+		if err != nil || len(results) == 0 || len(results[0]) == 0 {
+			return ""
+		}
+		v := results[0][0].Interface()
+		if s, ok := v.(string); ok {
+			return s
+		}
+		key, _ := json.Marshal(v)
+		return string(key)
+	case event.ID() != "":
+		return event.Source() + "\x00" + event.ID()
+	default:
+		return ""
+	}
+}
+
+// dedupSuffix is appended to the UID of a BrokerChannel to name the log of
+// its deduplication cache in the buffer directory.
+const dedupSuffix = ".dedup"
+
+// deduplicator returns the deduplicator of bc, nil when bc has none. The
+// cache of the keys is kept across the changes of bc. cm.mu must be held.
+func (cm *ConnectionManager) deduplicator(bc *v1beta1.BrokerChannel) (*deduplicator, error) {
+	ID := types.NamespacedName{Namespace: bc.Namespace, Name: bc.Name}
+	if bc.Spec.Deduplication == nil {
+		cm.deleteDedup(ID)
+		return nil, nil
+	}
+	spec := bc.Spec.Deduplication.DeepCopy()
+	spec.SetDefaults(cm.ctx)
+	d := &deduplicator{property: spec.Property}
+	if spec.Path != "" {
+		d.path = jsonpath.New("key")
+		if err := d.path.Parse(spec.JSONPath()); err != nil {
+			return nil, fmt.Errorf("path: %w", err)
+		}
+	}
+
+	c, ok := cm.dedups[ID]
+	if ok && c.Persistent() != spec.Persist {
+		cm.deleteDedup(ID)
+		ok = false
+	}
+	if ok {
+		c.Resize(int(spec.MaxKeys), spec.TTL.Duration)
+		d.cache = c
+		return d, nil
+	}
+	if !spec.Persist {
+		c = dedup.New(int(spec.MaxKeys), spec.TTL.Duration)
+	} else if cm.bufferDir == "" {
+		return nil, errNoBufferDir
+	} else {
+		var err error
+		c, err = dedup.Open(filepath.Join(cm.bufferDir, string(bc.UID)+dedupSuffix), int(spec.MaxKeys), spec.TTL.Duration)
+		if err != nil {
+			return nil, err
+		}
+	}
+	cm.dedups[ID] = c
+	d.cache = c
+	return d, nil
+}
+
+// deleteDedup deletes the deduplication cache of the BrokerChannel ID.
+// cm.mu must be held.
+func (cm *ConnectionManager) deleteDedup(ID types.NamespacedName) {
+	if c, ok := cm.dedups[ID]; ok {
+		if err := c.Delete(); err != nil {
+			cm.logger.Errorw("Failed to delete the deduplication cache", zap.String("brokerchannel", ID.String()), zap.Error(err))
+		}
+		delete(cm.dedups, ID)
+	}
+}
@@ -0,0 +1,160 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+	pkgreconciler "knative.dev/pkg/reconciler"
+
+	"github.com/ShixiongQi/brokerchannel/pkg/apis/samples/v1beta1"
+)
+
+// The events of a BrokerChannel are aggregated and rate limited by the
+// correlator of client-go: each BrokerChannel may burst eventBurst events,
+// then gets one more every eventRefill, and similar events are folded into a
+// single one with a count.
+const (
+	eventBurst  = 10
+	eventRefill = time.Minute
+)
+
+// sinkErrorBurst is the number of 5xx responses of a sink within
+// sinkErrorWindow that makes a SinkErrors event.
+const (
+	sinkErrorBurst  = 10
+	sinkErrorWindow = time.Minute
+)
+
+// newEventRecorder returns a recorder writing to the API server.
+func newEventRecorder(kc kubernetes.Interface) record.EventRecorder {
+	broadcaster := record.NewBroadcasterWithCorrelatorOptions(record.CorrelatorOptions{
+		BurstSize: eventBurst,
+		QPS:       float32(time.Second) / float32(eventRefill),
+	})
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: kc.CoreV1().Events("")})
+	return broadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: component})
+}
+
+// objectReference refers to bc in its events. The informers strip the type
+// meta of the objects they return, so it is filled in here.
+func objectReference(bc *v1beta1.BrokerChannel) *corev1.ObjectReference {
+	return &corev1.ObjectReference{
+		APIVersion:      v1beta1.SchemeGroupVersion.String(),
+		Kind:            "BrokerChannel",
+		Namespace:       bc.Namespace,
+		Name:            bc.Name,
+		UID:             bc.UID,
+		ResourceVersion: bc.ResourceVersion,
+	}
+}
+
+// recordEvent records event against ref.
+func recordEvent(recorder record.EventRecorder, ref *corev1.ObjectReference, event pkgreconciler.Event) {
+	var re *pkgreconciler.ReconcilerEvent
+	if pkgreconciler.EventAs(event, &re) {
+		recorder.Eventf(ref, re.EventType, re.Reason, re.Format, re.Args...)
+	}
+}
+
+// newBrokerConnected makes a new reconciler event with event type Normal, and
+// reason BrokerConnected.
+func newBrokerConnected(addr string) pkgreconciler.Event {
+	return pkgreconciler.NewEvent(corev1.EventTypeNormal, "BrokerConnected", "connected to broker %q", addr)
+}
+
+// newBrokerReconnected makes a new reconciler event with event type Normal,
+// and reason BrokerReconnected.
+func newBrokerReconnected(addr string) pkgreconciler.Event {
+	return pkgreconciler.NewEvent(corev1.EventTypeNormal, "BrokerReconnected", "reconnected to broker %q", addr)
+}
+
+// newBrokerDisconnected makes a new reconciler event with event type Warning,
+// and reason BrokerDisconnected.
+func newBrokerDisconnected(addr string) pkgreconciler.Event {
+	return pkgreconciler.NewEvent(corev1.EventTypeWarning, "BrokerDisconnected", "lost the connection to broker %q", addr)
+}
+
+// newConnectFailed makes a new reconciler event with event type Warning, and
+// reason ConnectFailed.
+func newConnectFailed(addr string, err error) pkgreconciler.Event {
+	return pkgreconciler.NewEvent(corev1.EventTypeWarning, "ConnectFailed", "failed to connect to broker %q: %v", addr, err)
+}
+
+// newAuthFailed makes a new reconciler event with event type Warning, and
+// reason AuthFailed.
+func newAuthFailed(addr string, err error) pkgreconciler.Event {
+	return pkgreconciler.NewEvent(corev1.EventTypeWarning, "AuthFailed", "broker %q refused the credentials: %v", addr, err)
+}
+
+// newConnectionFailed makes a new reconciler event with event type Warning,
+// and reason ConnectionFailed.
+func newConnectionFailed(err error) pkgreconciler.Event {
+	return pkgreconciler.NewEvent(corev1.EventTypeWarning, "ConnectionFailed", "failed to set up the connection: %v", err)
+}
+
+// newSubscribeFailed makes a new reconciler event with event type Warning,
+// and reason SubscribeFailed.
+func newSubscribeFailed(addr string, err error) pkgreconciler.Event {
+	return pkgreconciler.NewEvent(corev1.EventTypeWarning, "SubscribeFailed", "failed to subscribe on broker %q: %v", addr, err)
+}
+
+// newSinkErrors makes a new reconciler event with event type Warning, and
+// reason SinkErrors.
+func newSinkErrors(n int, sink string, window time.Duration) pkgreconciler.Event {
+	return pkgreconciler.NewEvent(corev1.EventTypeWarning, "SinkErrors", "sink %q answered %d deliveries with 5xx in %v", sink, n, window)
+}
+
+// newSinkAuthFailed makes a new reconciler event with event type Warning,
+// and reason SinkAuthFailed.
+func newSinkAuthFailed(err error) pkgreconciler.Event {
+	return pkgreconciler.NewEvent(corev1.EventTypeWarning, "SinkAuthFailed", "failed to configure the delivery to the sink: %v", err)
+}
+
+// newCircuitOpen makes a new reconciler event with event type Warning, and
+// reason CircuitOpen.
+func newCircuitOpen(sink, reason string) pkgreconciler.Event {
+	return pkgreconciler.NewEvent(corev1.EventTypeWarning, "CircuitOpen", "sink %q is overloaded (%s), pausing the deliveries", sink, reason)
+}
+
+// errorBurst counts errors in fixed windows and reports when a window
+// reaches its limit, once per window.
+type errorBurst struct {
+	limit  int
+	window time.Duration
+
+	mu    sync.Mutex
+	start time.Time
+	n     int
+}
+
+// Add counts an error at now and tells whether it completes a burst.
+func (b *errorBurst) Add(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if now.Sub(b.start) >= b.window {
+		b.start, b.n = now, 0
+	}
+	b.n++
+	return b.n == b.limit
+}
@@ -0,0 +1,77 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+
+	"github.com/ShixiongQi/brokerchannel/pkg/mqtt"
+)
+
+func TestErrorBurst(t *testing.T) {
+	b := errorBurst{limit: 3, window: time.Minute}
+	now := time.Now()
+
+	var got []bool
+	for _, d := range []time.Duration{0, time.Second, 2 * time.Second, 3 * time.Second, time.Minute, time.Minute + time.Second} {
+		got = append(got, b.Add(now.Add(d)))
+	}
+	want := []bool{false, false, true, false, false, false}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("Add() = %v, want %v", got, want)
+	}
+}
+
+func TestConnectFailedEvents(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{{
+		name: "unreachable",
+		err:  errors.New("connection refused"),
+		want: `Warning ConnectFailed failed to connect to broker "mosquitto:1883": connection refused`,
+	}, {
+		name: "bad password",
+		err:  &mqtt.RefusedError{Address: "mosquitto:1883", ReasonCode: 0x86, Reason: "bad password"},
+		want: `Warning AuthFailed broker "mosquitto:1883" refused the credentials: connection refused by mosquitto:1883: 134 - bad password`,
+	}, {
+		name: "server busy",
+		err:  &mqtt.RefusedError{Address: "mosquitto:1883", ReasonCode: 0x89},
+		want: `Warning ConnectFailed failed to connect to broker "mosquitto:1883": connection refused by mosquitto:1883: 137 - `,
+	}}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			recorder := record.NewFakeRecorder(1)
+			mc := &MQTTConnection{
+				cfg:      &mqtt.Config{Address: "mosquitto:1883"},
+				recorder: recorder,
+				ref:      &corev1.ObjectReference{Kind: "BrokerChannel", Namespace: "default", Name: "sensors"},
+			}
+			mc.connectFailed(test.err)
+			if got := <-recorder.Events; got != test.want {
+				t.Errorf("event = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
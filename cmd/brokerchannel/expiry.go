@@ -0,0 +1,70 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/eclipse/paho.golang/paho"
+	"go.uber.org/zap"
+	"knative.dev/pkg/apis"
+)
+
+const (
+	// deadLetterReasonExtension is the extension telling the dead letter
+	// sink why an event was not delivered.
+	deadLetterReasonExtension = "deadletterreason"
+	// deadLetterDestExtension is the extension carrying the destination an
+	// event was not delivered to.
+	deadLetterDestExtension = "knativeerrordest"
+	// expiredReason is the reason of the events which expired before
+	// their delivery.
+	expiredReason = "expired"
+)
+
+// expired reports whether the MQTT 5 Message Expiry Interval of m, counted
+// from received, elapsed at now. Messages without one never expire.
+func expired(m *paho.Publish, received, now time.Time) bool {
+	if m.Properties == nil || m.Properties.MessageExpiry == nil {
+		return false
+	}
+	return !now.Before(received.Add(time.Duration(*m.Properties.MessageExpiry) * time.Second))
+}
+
+// expire drops the event of the expired message m, or sends it to the dead
+// letter sink when there is one. It returns false when the dead letter sink
+// should be retried.
+func (mc *MQTTConnection) expire(ctx context.Context, m *paho.Publish, event cloudevents.Event, addr *apis.URL) bool {
+	mc.reporter.ReportExpired(mc.args)
+	mc.mu.Lock()
+	dls, ceClient := mc.deadLetter, mc.ceClient
+	mc.mu.Unlock()
+	if dls == nil {
+		mc.logger.Debugw("Dropping an expired message", zap.String("id", event.ID()), zap.String("topic", m.Topic))
+		return true
+	}
+
+	event.SetExtension(deadLetterReasonExtension, expiredReason)
+	event.SetExtension(deadLetterDestExtension, addr.String())
+	result := ceClient.Send(cloudevents.ContextWithTarget(ctx, dls.String()), event)
+	if !cloudevents.IsACK(result) {
+		mc.logger.Warnw("Failed to send an expired event to the dead letter sink", zap.String("id", event.ID()), zap.Error(result))
+	}
+	return !retryable(statusCode(result))
+}
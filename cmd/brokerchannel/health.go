@@ -0,0 +1,85 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+)
+
+// healthPort serves the liveness and readiness probes of the kubelet.
+const healthPort = 8080
+
+// prober answers the probes of the kubelet. The process is alive once the
+// informers are synced, and ready as long as it is not draining. A
+// BrokerChannel which cannot reach its broker does not fail the probes, it is
+// reported in its Connected condition instead.
+type prober struct {
+	synced   int32
+	draining int32
+}
+
+func newProber() *prober {
+	return &prober{}
+}
+
+// MarkSynced records that the caches of the informers are synced.
+func (p *prober) MarkSynced() {
+	atomic.StoreInt32(&p.synced, 1)
+}
+
+// MarkDraining makes the readiness probe fail.
+func (p *prober) MarkDraining() {
+	atomic.StoreInt32(&p.draining, 1)
+}
+
+func (p *prober) live() error {
+	if atomic.LoadInt32(&p.synced) == 0 {
+		return fmt.Errorf("informers not synced")
+	}
+	return nil
+}
+
+func (p *prober) ready() error {
+	if err := p.live(); err != nil {
+		return err
+	}
+	if atomic.LoadInt32(&p.draining) == 1 {
+		return fmt.Errorf("draining")
+	}
+	return nil
+}
+
+// Handler serves the liveness probe on /healthz and the readiness probe on
+// /readyz.
+func (p *prober) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", probeHandler(p.live))
+	mux.HandleFunc("/readyz", probeHandler(p.ready))
+	return mux
+}
+
+func probeHandler(check func() error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := check(); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+}
@@ -0,0 +1,95 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/ShixiongQi/brokerchannel/pkg/mqtt"
+)
+
+func TestProber(t *testing.T) {
+	p := newProber()
+	h := p.Handler()
+
+	probe := func(path string) int {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w.Code
+	}
+	check := func(step string, wantLive, wantReady int) {
+		t.Helper()
+		if got := probe("/healthz"); got != wantLive {
+			t.Errorf("%s: /healthz = %d, want %d", step, got, wantLive)
+		}
+		if got := probe("/readyz"); got != wantReady {
+			t.Errorf("%s: /readyz = %d, want %d", step, got, wantReady)
+		}
+	}
+
+	check("not synced", http.StatusServiceUnavailable, http.StatusServiceUnavailable)
+	p.MarkSynced()
+	check("synced", http.StatusOK, http.StatusOK)
+
+	p.MarkDraining()
+	check("draining", http.StatusOK, http.StatusServiceUnavailable)
+}
+
+func TestDrainWaitsForDeliveries(t *testing.T) {
+	mc := &MQTTConnection{logger: zap.NewNop().Sugar(), cfg: &mqtt.Config{}, done: make(chan struct{})}
+	mc.ctx, mc.cancel = context.WithCancel(context.Background())
+	atomic.AddInt64(&mc.inFlight, 1)
+	go func() {
+		time.Sleep(3 * drainPollInterval)
+		atomic.AddInt64(&mc.inFlight, -1)
+	}()
+
+	mc.Drain(context.Background())
+	if n := atomic.LoadInt64(&mc.inFlight); n != 0 {
+		t.Errorf("Drain() returned with %d deliveries in flight", n)
+	}
+	select {
+	case <-mc.done:
+	default:
+		t.Error("Drain() did not close the connection")
+	}
+	if err := mc.Subscribe(context.Background(), nil); err != nil {
+		t.Error("Subscribe() while draining =", err)
+	}
+}
+
+func TestDrainDeadline(t *testing.T) {
+	mc := &MQTTConnection{logger: zap.NewNop().Sugar(), cfg: &mqtt.Config{}, done: make(chan struct{})}
+	mc.ctx, mc.cancel = context.WithCancel(context.Background())
+	atomic.AddInt64(&mc.inFlight, 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), drainPollInterval)
+	defer cancel()
+	mc.Drain(ctx)
+	select {
+	case <-mc.done:
+	default:
+		t.Error("Drain() did not close the connection")
+	}
+}
@@ -0,0 +1,110 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"time"
+
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"knative.dev/pkg/reconciler"
+
+	"github.com/ShixiongQi/brokerchannel/pkg/apis/samples/v1beta1"
+	"github.com/ShixiongQi/brokerchannel/pkg/mqtt"
+)
+
+// sessionExpiry is the time the broker keeps the session of a BrokerChannel
+// once its replica disconnects. It must cover the time taken by another
+// replica to acquire the lease of the bucket.
+const sessionExpiry = 10 * time.Minute
+
+var _ reconciler.LeaderAware = (*ConnectionManager)(nil)
+
+// sharded tells whether bc is connected by the leader of its bucket only.
+// The BrokerChannels with shared subscriptions are connected by every
+// replica instead, the broker spreading their messages.
+func sharded(bc *v1beta1.BrokerChannel) bool {
+	return bc.Spec.SubscriptionMode != v1beta1.SharedSubscriptions
+}
+
+// owns tells whether this replica connects bc.
+func (cm *ConnectionManager) owns(bc *v1beta1.BrokerChannel) bool {
+	return !sharded(bc) || cm.la.IsLeaderFor(types.NamespacedName{Namespace: bc.Namespace, Name: bc.Name})
+}
+
+// persist makes the session of a sharded BrokerChannel outlive its
+// connection, under a client identifier shared by the replicas, so that the
+// replica taking the bucket over resumes it with the messages queued in the
+// meantime.
+func persist(cfg *mqtt.Config, bc *v1beta1.BrokerChannel) {
+	cfg.ClientID = "brokerchannel-" + string(bc.UID)
+	cfg.SessionExpiry = uint32(sessionExpiry / time.Second)
+}
+
+// Promote connects the BrokerChannels of b.
+func (cm *ConnectionManager) Promote(b reconciler.Bucket, enq func(reconciler.Bucket, types.NamespacedName)) error {
+	cm.logger.Infof("Leading %s", b.Name())
+	if err := cm.la.Promote(b, enq); err != nil {
+		return err
+	}
+	bcs, err := cm.channelLister.List(labels.Everything())
+	if err != nil {
+		return err
+	}
+	for _, bc := range bcs {
+		if b.Has(types.NamespacedName{Namespace: bc.Namespace, Name: bc.Name}) {
+			cm.AddConn(bc)
+		}
+	}
+	return nil
+}
+
+// Demote drains the connections of the BrokerChannels of b, whose sessions
+// are taken over by the next leader of b.
+func (cm *ConnectionManager) Demote(b reconciler.Bucket) {
+	cm.logger.Infof("Stopped leading %s", b.Name())
+	cm.la.Demote(b)
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	for ID := range cm.conn {
+		if !b.Has(ID) {
+			continue
+		}
+		if bc, err := cm.channelLister.BrokerChannels(ID.Namespace).Get(ID.Name); err == nil && cm.owns(bc) {
+			continue
+		}
+		cm.release(ID)
+	}
+}
+
+// release drains the connection of the BrokerChannel ID in the background,
+// once this replica does not own it anymore. cm.mu must be held.
+func (cm *ConnectionManager) release(ID types.NamespacedName) {
+	c, ok := cm.conn[ID]
+	if !ok || cm.draining {
+		return
+	}
+	delete(cm.conn, ID)
+	cm.wg.Add(1)
+	go func() {
+		defer cm.wg.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), drainTimeout)
+		defer cancel()
+		c.Drain(ctx)
+	}()
+}
@@ -0,0 +1,116 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+
+	"golang.org/x/time/rate"
+
+	"github.com/ShixiongQi/brokerchannel/pkg/apis/samples/v1beta1"
+)
+
+// limiter bounds the rate of the events sent by a BrokerChannel, and the
+// number of events being sent at once.
+type limiter struct {
+	// rate is nil without a rate limit, and slots without a cap of the
+	// events in flight.
+	rate  *rate.Limiter
+	slots chan struct{}
+	// limits are the settings the limiter was made from.
+	limits limits
+}
+
+// limits are the settings of a limiter, zero when unset.
+type limits struct {
+	rate        v1beta1.RateLimit
+	maxInFlight int32
+}
+
+// newLimiter returns the limiter of bc, nil when bc sets no limit.
+func newLimiter(bc *v1beta1.BrokerChannel) *limiter {
+	if bc.Spec.RateLimit == nil && bc.Spec.MaxInFlight == nil {
+		return nil
+	}
+	l := &limiter{}
+	if rl := bc.Spec.RateLimit.DeepCopy(); rl != nil {
+		rl.SetDefaults(context.Background())
+		l.rate = rate.NewLimiter(rate.Limit(rl.EventsPerSecond), int(rl.Burst))
+		l.limits.rate = *rl
+	}
+	if bc.Spec.MaxInFlight != nil {
+		l.slots = make(chan struct{}, *bc.Spec.MaxInFlight)
+		l.limits.maxInFlight = *bc.Spec.MaxInFlight
+	}
+	return l
+}
+
+// same tells whether l and o have the same limits.
+func (l *limiter) same(o *limiter) bool {
+	if l == nil || o == nil {
+		return l == o
+	}
+	return l.limits == o.limits
+}
+
+// wait waits for a slot and for the rate limit, until ctx is done, and
+// returns the function releasing the slot.
+func (l *limiter) wait(ctx context.Context) (func(), error) {
+	if l == nil {
+		return func() {}, nil
+	}
+	if l.slots != nil {
+		select {
+		case l.slots <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	if l.rate != nil {
+		if err := l.rate.Wait(ctx); err != nil {
+			l.release()
+			return nil, err
+		}
+	}
+	return l.release, nil
+}
+
+// allow is wait without waiting: it returns false when the event would
+// have to wait.
+func (l *limiter) allow() (func(), bool) {
+	if l == nil {
+		return func() {}, true
+	}
+	if l.slots != nil {
+		select {
+		case l.slots <- struct{}{}:
+		default:
+			return nil, false
+		}
+	}
+	if l.rate != nil && !l.rate.Allow() {
+		l.release()
+		return nil, false
+	}
+	return l.release, true
+}
+
+func (l *limiter) release() {
+	if l.slots != nil {
+		<-l.slots
+	}
+}
@@ -1,141 +1,971 @@
 package main
 
 import (
-	"net"
 	"context"
+	"flag"
 	"fmt"
 	"log"
+	"net/http"
+	"os"
+	"reflect"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"k8s.io/client-go/tools/cache"
 	"github.com/eclipse/paho.golang/paho"
 	"go.uber.org/zap"
 	"knative.dev/pkg/logging"
 	"k8s.io/apimachinery/pkg/types"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
 	"knative.dev/pkg/logging/logkey"
 	"knative.dev/pkg/signals"
 	"knative.dev/pkg/controller"
 	"knative.dev/pkg/injection/sharedmain"
 	"knative.dev/pkg/metrics"
+	"knative.dev/pkg/profiling"
+	"knative.dev/pkg/reconciler"
+	"knative.dev/pkg/leaderelection"
 	"knative.dev/pkg/injection"
+	"knative.dev/pkg/tracing"
+	tracingconfig "knative.dev/pkg/tracing/config"
+	"knative.dev/pkg/tracing/propagation/tracecontextb3"
+	"go.opencensus.io/plugin/ochttp"
 
-	v1alpha1 "github.com/ShixiongQi/brokerchannel/pkg/apis/samples/v1alpha1"
-	brokerchannelinformer "github.com/ShixiongQi/brokerchannel/pkg/client/injection/informers/samples/v1alpha1/brokerchannel"
+	"github.com/ShixiongQi/brokerchannel/pkg/apis/samples/v1beta1"
+	"github.com/ShixiongQi/brokerchannel/pkg/buffer"
+	"github.com/ShixiongQi/brokerchannel/pkg/client/clientset/versioned"
+	"github.com/ShixiongQi/brokerchannel/pkg/client/injection/client"
+	brokerchannelinformer "github.com/ShixiongQi/brokerchannel/pkg/client/injection/informers/samples/v1beta1/brokerchannel"
+	mqttbrokerinformer "github.com/ShixiongQi/brokerchannel/pkg/client/injection/informers/samples/v1beta1/mqttbroker"
+	listers "github.com/ShixiongQi/brokerchannel/pkg/client/listers/samples/v1beta1"
+	"github.com/ShixiongQi/brokerchannel/pkg/dedup"
+	"github.com/ShixiongQi/brokerchannel/pkg/filter"
+	"github.com/ShixiongQi/brokerchannel/pkg/mqtt"
+	"github.com/ShixiongQi/brokerchannel/pkg/mqtt/resolver"
+	"github.com/ShixiongQi/brokerchannel/pkg/sink"
+	"github.com/ShixiongQi/brokerchannel/pkg/transform"
+	"k8s.io/apimachinery/pkg/labels"
+	kubeclient "knative.dev/pkg/client/injection/kube/client"
+	"knative.dev/pkg/client/injection/kube/informers/core/v1/secret"
+	"knative.dev/pkg/tracker"
 	"knative.dev/pkg/apis"
 	cloudevents "github.com/cloudevents/sdk-go/v2"
+	cehttp "github.com/cloudevents/sdk-go/v2/protocol/http"
+	"knative.dev/eventing/pkg/eventfilter"
+)
+
+// reconnectBackoff bounds the delay between two attempts to connect to a
+// broker again.
+const (
+	minReconnectBackoff = time.Second
+	maxReconnectBackoff = 30 * time.Second
+)
+
+// drainTimeout bounds the time given to the deliveries in flight on
+// shutdown. It must be shorter than the termination grace period of the
+// Deployment.
+const (
+	drainTimeout      = 5 * time.Minute
+	drainPollInterval = 100 * time.Millisecond
 )
 
 type MQTTConnection struct {
-	client *paho.Client
 	logger *zap.SugaredLogger
-	topic string
 	addr *apis.URL
+	cfg			*mqtt.Config
+	reporter	StatsReporter
+	args		*ReportArgs
+	recorder	record.EventRecorder
+	ref			*corev1.ObjectReference
+	sinkErrors	errorBurst
+	inFlight	int64
+	done		chan struct{}
+	closeOnce	sync.Once
+	// ctx is cancelled once the connection is closed, or once it is
+	// drained.
+	ctx			context.Context
+	cancel		context.CancelFunc
+	wg			*sync.WaitGroup
+
+	mu			sync.Mutex
+	client		*mqtt.Conn
+	// ceClient sends the events as configured by sinkCfg.
 	ceClient	cloudevents.Client
-	stopCh		<-chan struct{}
+	sinkCfg		*sink.Config
+	subs		[]v1beta1.Subscription
+	// subscribed are the subscriptions made in the session of client.
+	subscribed	[]v1beta1.Subscription
+	transform	*transform.Transformer
+	filter		eventfilter.Filter
+	routes		[]route
+	limiter		*limiter
+	dedup		*deduplicator
+	deadLetter	*apis.URL
+	markRetained	bool
+	// breakers are the circuit breakers of the destinations, by URI.
+	breakers	map[string]*breaker
+	draining	bool
+	end			bool
+	// connErr is why the session with the broker is down, nil while it
+	// is up.
+	connErr		error
+	// buffer stores the messages received, when set. forwarding is the
+	// buffer the forwarders send the messages of, kept once the buffer is
+	// disabled until it is empty.
+	buffer		*buffer.Buffer
+	forwarding	*buffer.Buffer
+	maxAge		time.Duration
+	// applied are the settings of the BrokerChannel applied to the
+	// connection, nil until they all applied.
+	applied		*settings
 }
 
-func newMQTTConnection(addr *apis.URL, topic, broker string, port int, logger *zap.SugaredLogger, stopCh <-chan struct{}) (*MQTTConnection, error) {
-	server := fmt.Sprintf("%s:%d", broker, port)
-	logger.Infof("Create connection to %s", server)
-	conn, err := net.Dial("tcp", server)
-	if err != nil {
-		return nil, err
+// settings are the inputs of the configuration of a connection: the spec of
+// its BrokerChannel, by generation, the destinations resolved in its status,
+// and the configuration of the sink read from its secrets.
+type settings struct {
+	generation	int64
+	sinkURI		*apis.URL
+	deadLetter	*apis.URL
+	routes		[]v1beta1.RouteStatus
+	sink		*sink.Config
+}
+
+func newSettings(bc *v1beta1.BrokerChannel, sinkCfg *sink.Config) *settings {
+	return &settings{
+		generation:	bc.Generation,
+		sinkURI:	bc.Status.SinkURI,
+		deadLetter:	bc.Status.DeadLetterSinkURI,
+		routes:		bc.Status.Routes,
+		sink:		sinkCfg,
 	}
+}
 
-	c, err := cloudevents.NewClientHTTP()
+// newMQTTConnection connects to the broker of a BrokerChannel. It records
+// the events of the connection against ref, and keeps trying to connect in
+// Run if the broker cannot be reached yet.
+func newMQTTConnection(addr *apis.URL, cfg *mqtt.Config, args *ReportArgs, reporter StatsReporter, recorder record.EventRecorder, ref *corev1.ObjectReference, logger *zap.SugaredLogger) (*MQTTConnection, error) {
+	logger.Infof("Create connection to %s", cfg.Address)
+	c, err := newCEClient(http.DefaultTransport)
 	if err != nil {
-		logger.Fatalf("failed to create client, %v", err)
-		return nil, err
+		return nil, fmt.Errorf("failed to create the CloudEvents client: %w", err)
 	}
+	ctx, cancel := context.WithCancel(context.Background())
 	mc := &MQTTConnection {
-		client:		paho.NewClient(),
 		logger:		logger,
 		addr:		addr,
-		topic:		topic,
+		cfg:		cfg,
 		ceClient:	c,
-		stopCh:		stopCh,
+		reporter:	reporter,
+		args:		args,
+		recorder:	recorder,
+		ref:		ref,
+		sinkErrors:	errorBurst{limit: sinkErrorBurst, window: sinkErrorWindow},
+		done:		make(chan struct{}),
+		ctx:		ctx,
+		cancel:		cancel,
+		filter:		eventfilter.Filters{},
 	}
-	mc.client.Conn = conn
 	logger.Infof("Url is %v", addr)
-	mc.client.Router = paho.NewSingleHandlerRouter(func(m *paho.Publish) {
-			// logger.Infof("Receive object %v\n", m)
-			event := cloudevents.NewEvent()
-			prop := m.Properties.User
-			event.SetSource(prop["source"])
-			event.SetType(prop["type"])
-			event.SetID(prop["ID"])
-			// logger.Infof("QLOG: source: %v, type: %v, ID: %v", prop["source"], prop["type"], prop["ID"])
-			event.SetData(cloudevents.ApplicationJSON, m.Payload)
-			ctx := cloudevents.ContextWithTarget(context.Background(), mc.addr.URL().String())
-			if result := c.Send(ctx, event); cloudevents.IsUndelivered(result) {
-				mc.logger.Fatalf("failed to send, %v", result)
-			}
-		})
-	ca, err := mc.client.Connect(context.Background(), &paho.Connect{CleanStart: true, KeepAlive:  30,})
+	if err := mc.connect(); err != nil {
+		logger.Warnw("Failed to connect, retrying", zap.Error(err))
+		mc.connectFailed(err)
+	} else {
+		recordEvent(mc.recorder, mc.ref, newBrokerConnected(cfg.Address))
+	}
+
+	return mc, nil
+}
+
+// newCEClient returns the client sending the events through base.
+func newCEClient(base http.RoundTripper) (cloudevents.Client, error) {
+	return cloudevents.NewClientHTTP(cehttp.WithRoundTripper(&retryAfterTransport{&ochttp.Transport{
+		Base:        base,
+		Propagation: tracecontextb3.TraceContextEgress,
+	}}))
+}
+
+// receive handles an MQTT message. Without a buffer, the message is sent
+// to its destination once, and then acknowledged. With a buffer, it is
+// acknowledged once stored, and sent by the forwarders.
+func (mc *MQTTConnection) receive(m *paho.Publish, ack func()) {
+	received := time.Now()
+	mc.mu.Lock()
+	draining := mc.draining
+	mc.mu.Unlock()
+	if draining && mc.cfg.SessionExpiry > 0 {
+		// The broker sends the message again when the session is resumed.
+		return
+	}
+	mc.reporter.ReportMessage(mc.args, m.Topic, len(m.Payload))
+	mc.reporter.ReportInFlight(mc.args, atomic.AddInt64(&mc.inFlight, 1))
+	defer func() {
+		mc.reporter.ReportInFlight(mc.args, atomic.AddInt64(&mc.inFlight, -1))
+	}()
+
+	mc.mu.Lock()
+	b, l := mc.buffer, mc.limiter
+	mc.mu.Unlock()
+	if b != nil {
+		if err := mc.store(b, m); err != nil {
+			// A QoS 1 message left unacknowledged is sent again by the
+			// broker when the session is resumed.
+			mc.logger.Warnw("Failed to buffer a message", zap.String("topic", m.Topic), zap.Error(err))
+			return
+		}
+		ack()
+		return
+	}
+	// QoS 1 and 2 messages are acknowledged once delivered, so that the
+	// broker holds the next ones back once the Receive Maximum is reached,
+	// while a limit or a tripped circuit breaker holds them back. Those
+	// whose delivery failed and may be retried are left unacknowledged,
+	// and the broker sends them again when the session is resumed. The
+	// broker does not hold QoS 0 messages back, they are dropped when they
+	// would have to wait.
+	if m.QoS == 0 {
+		release, ok := l.allow()
+		if !ok {
+			mc.reporter.ReportThrottled(mc.args)
+			return
+		}
+		defer release()
+		mc.deliver(mc.ctx, m, received, false)
+		return
+	}
+	release, err := l.wait(mc.ctx)
 	if err != nil {
-		return nil, err
+		// The connection is closed, the broker sends the message again.
+		return
 	}
-	if ca.ReasonCode != 0 {
-		logger.Errorf("Failed to connect to %s : %d - %s", server, ca.ReasonCode, ca.Properties.ReasonString)
-		return nil, nil
+	ok := mc.deliver(mc.ctx, m, received, true)
+	release()
+	if ok && mc.ctx.Err() == nil {
+		ack()
 	}
+}
 
-	return mc, nil
+// deliver sends an MQTT message received at received to its destination.
+// It returns false when the delivery failed and may be retried. wait tells
+// whether to wait while the circuit breaker of the destination is open, or
+// to drop the message.
+func (mc *MQTTConnection) deliver(ctx context.Context, m *paho.Publish, received time.Time, wait bool) bool {
+	// logger.Infof("Receive object %v\n", m)
+	event := cloudevents.NewEvent()
+	prop := m.Properties.User
+	event.SetSource(prop["source"])
+	event.SetType(prop["type"])
+	event.SetID(prop["ID"])
+	// logger.Infof("QLOG: source: %v, type: %v, ID: %v", prop["source"], prop["type"], prop["ID"])
+	event.SetData(cloudevents.ApplicationJSON, m.Payload)
+	// The span covers the whole handling of the message, so that the time
+	// spent waiting for the circuit breaker is traced.
+	ctx, span := mqtt.StartSpan(ctx, "brokerchannel:"+mc.args.Name+"."+mc.args.Namespace, m)
+	defer span.End()
+
+	mc.mu.Lock()
+	tr, f, routes, d, ceClient, markRetained := mc.transform, mc.filter, mc.routes, mc.dedup, mc.ceClient, mc.markRetained
+	mc.mu.Unlock()
+	if err := tr.Apply(m.Topic, m.Payload, &event); err != nil {
+		mc.logger.Warnw("Failed to transform a message, dropping it", zap.String("id", event.ID()), zap.String("topic", m.Topic), zap.Error(err))
+		return true
+	}
+	if markRetained && m.Retain {
+		event.SetExtension(retainedExtension, true)
+	}
+	// The sink would never accept an invalid event, e.g. one whose message
+	// has no ID user property, and retrying it would block the session.
+	if err := event.Validate(); err != nil {
+		mc.logger.Warnw("Dropping a message which is not a valid event", zap.String("topic", m.Topic), zap.Error(err))
+		return true
+	}
+
+	// Drop the messages the sink is not interested in before sending them.
+	if res := f.Filter(ctx, event); res != eventfilter.NoFilter {
+		mc.reporter.ReportFilter(mc.args, string(res))
+		if res == eventfilter.FailFilter {
+			mc.logger.Debugw("Event filtered out", zap.String("id", event.ID()), zap.String("topic", m.Topic))
+			return true
+		}
+	}
+
+	// The key of a message is reserved until it is delivered, so that its
+	// copies are dropped, even while it is in flight.
+	delivered := false
+	if key := d.key(m, &event); key != "" {
+		if !d.cache.Reserve(key, time.Now()) {
+			mc.logger.Debugw("Dropping a duplicate message", zap.String("id", event.ID()), zap.String("topic", m.Topic))
+			mc.reporter.ReportDuplicate(mc.args)
+			return true
+		}
+		defer func() {
+			if err := d.cache.Done(key, delivered, time.Now()); err != nil {
+				mc.logger.Warnw("Failed to persist the deduplication key", zap.String("id", event.ID()), zap.Error(err))
+			}
+		}()
+	}
+
+	addr := mc.addr
+	if r := selectRoute(ctx, routes, m.Topic, event); r != nil {
+		if r.addr == nil {
+			// The event is retried once the destination is resolved.
+			mc.logger.Warnw("Route not resolved yet, leaving the event unacknowledged", zap.String("id", event.ID()), zap.String("route", r.name))
+			return false
+		}
+		addr = r.addr
+	}
+
+	// A message may expire before it is delivered, or while it waits for
+	// the circuit breaker.
+	if expired(m, received, time.Now()) {
+		return mc.expire(ctx, m, event, addr)
+	}
+	br := mc.breaker(addr)
+	if !wait && !br.allow() {
+		mc.reporter.ReportThrottled(mc.args)
+		return true
+	}
+	if wait {
+		if err := br.wait(ctx); err != nil {
+			return false
+		}
+		if expired(m, received, time.Now()) {
+			br.release()
+			return mc.expire(ctx, m, event, addr)
+		}
+	}
+
+	ctx = cloudevents.ContextWithTarget(ctx, addr.URL().String())
+	var retryAfter time.Duration
+	result := ceClient.Send(withRetryAfter(ctx, &retryAfter), event)
+
+	code := statusCode(result)
+	delivered = cloudevents.IsACK(result)
+	mc.reporter.ReportDispatch(mc.args, code, time.Since(received))
+	if code != 0 {
+		span.SetStatus(ochttp.TraceStatus(code, http.StatusText(code)))
+	}
+	if code >= http.StatusInternalServerError && mc.sinkErrors.Add(time.Now()) {
+		recordEvent(mc.recorder, mc.ref, newSinkErrors(sinkErrorBurst, addr.String(), sinkErrorWindow))
+	}
+	if br.record(code, retryAfter) {
+		mc.logger.Warnw("Sink overloaded, pausing the deliveries", zap.String("sink", addr.String()), zap.Int("code", code))
+		recordEvent(mc.recorder, mc.ref, newCircuitOpen(addr.String(), failureReason(code)))
+	}
+	if !cloudevents.IsACK(result) {
+		mc.logger.Warnw("Failed to send an event", zap.String("id", event.ID()), zap.Error(result))
+	}
+	return !retryable(code)
+}
+
+// breaker returns the circuit breaker of the destination addr.
+func (mc *MQTTConnection) breaker(addr *apis.URL) *breaker {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	if mc.breakers == nil {
+		mc.breakers = make(map[string]*breaker)
+	}
+	br, ok := mc.breakers[addr.String()]
+	if !ok {
+		br = newBreaker(addr)
+		mc.breakers[addr.String()] = br
+	}
+	return br
+}
+
+// connect opens a new session to the broker.
+func (mc *MQTTConnection) connect() error {
+	client, err := mqtt.ConnectWithAcks(context.Background(), mc.cfg, mc.receive)
+	if err != nil {
+		return err
+	}
+	mc.mu.Lock()
+	mc.client = client
+	mc.subscribed = nil
+	mc.connErr = nil
+	mc.mu.Unlock()
+	return nil
+}
+
+// disconnected records why the session with the broker is down, reported
+// in the status until the next connection.
+func (mc *MQTTConnection) disconnected(err error) {
+	mc.mu.Lock()
+	mc.connErr = err
+	mc.mu.Unlock()
+}
+
+// connectFailed records the failure of an attempt to connect.
+func (mc *MQTTConnection) connectFailed(err error) {
+	mc.disconnected(fmt.Errorf("failed to connect to %s: %w", mc.cfg.Address, err))
+	if mqtt.IsAuthError(err) {
+		recordEvent(mc.recorder, mc.ref, newAuthFailed(mc.cfg.Address, err))
+	} else {
+		recordEvent(mc.recorder, mc.ref, newConnectFailed(mc.cfg.Address, err))
+	}
 }
 
 func (mc *MQTTConnection) Run(wg *sync.WaitGroup) {
 	mc.logger.Info("Start routine")
+	mc.wg = wg
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		<-mc.stopCh
-		mc.client.Disconnect(&paho.Disconnect{ReasonCode: 0})
-		mc.logger.Info("Disconnected")
+		for {
+			mc.mu.Lock()
+			client := mc.client
+			mc.mu.Unlock()
+			if client == nil {
+				// The first attempt to connect failed.
+				if mc.reconnect() {
+					continue
+				}
+				mc.logger.Info("Disconnected")
+				return
+			}
+			select {
+			case <-mc.done:
+			case <-client.Done():
+				mc.logger.Warnf("Lost the connection to %s", mc.cfg.Address)
+				mc.disconnected(fmt.Errorf("lost the connection to %s", mc.cfg.Address))
+				recordEvent(mc.recorder, mc.ref, newBrokerDisconnected(mc.cfg.Address))
+				if mc.reconnect() {
+					continue
+				}
+			}
+			mc.mu.Lock()
+			end := mc.end
+			mc.mu.Unlock()
+			if end {
+				client.End()
+			} else {
+				client.Close()
+			}
+			mc.logger.Info("Disconnected")
+			return
+		}
 	}()
 }
 
-func (mc *MQTTConnection) Subscribe(ctx context.Context, topic string) error {
-	if _, err := mc.client.Subscribe(ctx, &paho.Subscribe{Subscriptions: map[string]paho.SubscribeOptions{
-		topic: {QoS: 0},
-	},}); err != nil {
+// reconnect connects to the broker again and restores the subscriptions,
+// until it succeeds or the connection is closed.
+func (mc *MQTTConnection) reconnect() bool {
+	backoff := minReconnectBackoff
+	for {
+		select {
+		case <-mc.done:
+			return false
+		case <-time.After(backoff):
+		}
+		mc.mu.Lock()
+		subs, draining := mc.subs, mc.draining
+		mc.mu.Unlock()
+		if draining {
+			// There is nothing left to deliver.
+			return false
+		}
+		mc.reporter.ReportReconnect(mc.args)
+		err := mc.connect()
+		if err != nil {
+			mc.connectFailed(err)
+		} else if err = mc.Subscribe(context.Background(), subs); err != nil {
+			recordEvent(mc.recorder, mc.ref, newSubscribeFailed(mc.cfg.Address, err))
+		} else {
+			mc.logger.Infof("Reconnected to %s", mc.cfg.Address)
+			recordEvent(mc.recorder, mc.ref, newBrokerReconnected(mc.cfg.Address))
+			return true
+		}
+		mc.logger.Warnw("Failed to reconnect", zap.Error(err))
+		if backoff *= 2; backoff > maxReconnectBackoff {
+			backoff = maxReconnectBackoff
+		}
+	}
+}
+
+// Close disconnects from the broker, which keeps a persistent session for
+// the next connection of the BrokerChannel.
+func (mc *MQTTConnection) Close() {
+	mc.closeOnce.Do(func() {
+		close(mc.done)
+		mc.mu.Lock()
+		draining := mc.draining
+		mc.mu.Unlock()
+		if !draining {
+			mc.cancel()
+		}
+	})
+}
+
+// End disconnects from the broker and discards the session.
+func (mc *MQTTConnection) End() {
+	mc.mu.Lock()
+	mc.end = true
+	mc.mu.Unlock()
+	mc.Close()
+}
+
+// Connected tells whether the session with the broker is up.
+func (mc *MQTTConnection) Connected() bool {
+	mc.mu.Lock()
+	client := mc.client
+	mc.mu.Unlock()
+	if client == nil {
+		return false
+	}
+	select {
+	case <-client.Done():
+		return false
+	default:
+		return true
+	}
+}
+
+// Drain stops the delivery of new messages, waits for the deliveries in
+// flight and for the buffer to be sent until ctx is done, and then
+// disconnects. Buffered messages are already acknowledged to the broker,
+// and the messages in flight are acknowledged once delivered, so they must
+// be delivered before the session ends. A persistent session keeps its
+// subscriptions, and the messages it receives while draining are left
+// unacknowledged for the replica taking it over; other sessions unsubscribe
+// from their topics instead.
+func (mc *MQTTConnection) Drain(ctx context.Context) {
+	mc.mu.Lock()
+	mc.draining = true
+	client, subs := mc.client, mc.subs
+	mc.mu.Unlock()
+	defer mc.cancel()
+	defer mc.Close()
+
+	if mc.cfg.SessionExpiry == 0 && len(subs) > 0 && mc.Connected() {
+		topics := make([]string, 0, len(subs))
+		for _, s := range subs {
+			topics = append(topics, s.Topic)
+		}
+		if _, err := client.Unsubscribe(ctx, &paho.Unsubscribe{Topics: topics}); err != nil {
+			mc.logger.Warnw("Failed to unsubscribe", zap.Error(err))
+		}
+	}
+
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+	for {
+		n, buffered := atomic.LoadInt64(&mc.inFlight), mc.buffered()
+		if n == 0 && buffered == 0 {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			mc.logger.Warnf("Disconnecting with %d deliveries in flight and %d buffered messages", n, buffered)
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// SetTransform replaces the transformation of the messages into events.
+func (mc *MQTTConnection) SetTransform(tr *transform.Transformer) {
+	mc.mu.Lock()
+	mc.transform = tr
+	mc.mu.Unlock()
+}
+
+// SetFilter replaces the filter of the messages sent to the sink.
+func (mc *MQTTConnection) SetFilter(f eventfilter.Filter) {
+	mc.mu.Lock()
+	mc.filter = f
+	mc.mu.Unlock()
+}
+
+// SetSink sets the TLS and authentication settings of the deliveries, nil
+// for the defaults.
+func (mc *MQTTConnection) SetSink(cfg *sink.Config) error {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	if reflect.DeepEqual(cfg, mc.sinkCfg) {
+		return nil
+	}
+	rt, err := cfg.Transport()
+	if err != nil {
 		return err
 	}
+	c, err := newCEClient(rt)
+	if err != nil {
+		return err
+	}
+	mc.ceClient, mc.sinkCfg = c, cfg
+	return nil
+}
+
+// Applied tells whether s are the settings last applied to the connection.
+func (mc *MQTTConnection) Applied(s *settings) bool {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	return mc.applied != nil && reflect.DeepEqual(mc.applied, s)
+}
+
+// SetApplied records the settings applied to the connection, nil when some
+// failed to apply.
+func (mc *MQTTConnection) SetApplied(s *settings) {
+	mc.mu.Lock()
+	mc.applied = s
+	mc.mu.Unlock()
+}
+
+// SetLimiter sets the limits of the deliveries, nil for none. The current
+// limiter is kept when the limits did not change, so that an update of the
+// BrokerChannel does not reset its tokens and its slots in use.
+func (mc *MQTTConnection) SetLimiter(l *limiter) {
+	mc.mu.Lock()
+	if !mc.limiter.same(l) {
+		mc.limiter = l
+	}
+	mc.mu.Unlock()
+}
+
+// SetDeduplicator sets the deduplication of the messages, nil for none.
+func (mc *MQTTConnection) SetDeduplicator(d *deduplicator) {
+	mc.mu.Lock()
+	mc.dedup = d
+	mc.mu.Unlock()
+}
+
+// SetDeadLetterSink sets the destination of the messages which are not
+// delivered, nil to drop them.
+func (mc *MQTTConnection) SetDeadLetterSink(uri *apis.URL) {
+	mc.mu.Lock()
+	mc.deadLetter = uri
+	mc.mu.Unlock()
+}
+
+// SetMarkRetained tells whether the events of the retained messages are
+// marked with the mqttretained extension.
+func (mc *MQTTConnection) SetMarkRetained(mark bool) {
+	mc.mu.Lock()
+	mc.markRetained = mark
+	mc.mu.Unlock()
+}
+
+// SetRoutes replaces the routes of the messages.
+func (mc *MQTTConnection) SetRoutes(routes []route) {
+	mc.mu.Lock()
+	mc.routes = routes
+	mc.mu.Unlock()
+}
+
+// Subscribe subscribes to the subscriptions of subs which are not made in
+// the current session yet, and unsubscribes from the topics which are not in
+// subs anymore. Subscribing again would make the broker send the retained
+// messages again.
+func (mc *MQTTConnection) Subscribe(ctx context.Context, subs []v1beta1.Subscription) error {
+	mc.mu.Lock()
+	mc.subs = subs
+	client, old, draining := mc.client, mc.subscribed, mc.draining
+	mc.mu.Unlock()
+	if draining || client == nil {
+		// Run subscribes once connected.
+		return nil
+	}
+	active := make(map[string]v1beta1.Subscription, len(old))
+	for _, s := range old {
+		active[s.Topic] = s
+	}
+	opts := make(map[string]paho.SubscribeOptions, len(subs))
+	for _, s := range subs {
+		if a, ok := active[s.Topic]; !ok || a != s {
+			opts[s.Topic] = paho.SubscribeOptions{QoS: byte(s.QoS), RetainHandling: retainHandling(s.RetainHandling)}
+		}
+		delete(active, s.Topic)
+	}
+	var removed []string
+	for topic := range active {
+		removed = append(removed, topic)
+	}
+	if len(removed) > 0 {
+		if _, err := client.Unsubscribe(ctx, &paho.Unsubscribe{Topics: removed}); err != nil {
+			return err
+		}
+	}
+	if len(opts) > 0 {
+		if _, err := client.Subscribe(ctx, &paho.Subscribe{Subscriptions: opts}); err != nil {
+			return err
+		}
+	}
+	mc.mu.Lock()
+	if mc.client == client {
+		mc.subscribed = subs
+	}
+	mc.mu.Unlock()
 	return nil
 }
 type ConnectionManager struct {
+	mu					sync.Mutex
 	conn				map[types.NamespacedName]*MQTTConnection
+	draining			bool
+	channelLister		listers.BrokerChannelLister
+	resolver			*resolver.Resolver
+	reporter			StatsReporter
+	recorder			record.EventRecorder
 	logger				*zap.SugaredLogger
-	sigCh				<-chan struct{}
 	wg					*sync.WaitGroup
 	ctx					context.Context
+	// client updates the status of the BrokerChannels.
+	client				versioned.Interface
+	// buffers are the buffers of the BrokerChannels, stored in bufferDir.
+	buffers				map[types.NamespacedName]*buffer.Buffer
+	bufferDir			string
+	// dedups are the deduplication caches of the BrokerChannels.
+	dedups				map[types.NamespacedName]*dedup.Cache
+	// la tracks the buckets led by this replica.
+	la					reconciler.LeaderAwareFuncs
 }
 
 func (cm *ConnectionManager) AddConn(obj interface{}) {
-	bc := obj.(*v1alpha1.BrokerChannel)
+	bc := obj.(*v1beta1.BrokerChannel)
 	ID := types.NamespacedName{Namespace: bc.Namespace, Name: bc.Name}
-	_, ok := cm.conn[ID]
+	if !cm.owns(bc) {
+		// Another replica leads the bucket of bc.
+		cm.mu.Lock()
+		cm.release(ID)
+		cm.mu.Unlock()
+		return
+	}
+	cfg, err := cm.resolver.Resolve(cm.ctx, bc, bc.Namespace, bc.Spec.Broker, bc.Spec.BrokerRef)
+	if err != nil {
+		// The BrokerChannel is added again when its MQTTBroker changes.
+		cm.logger.Errorw("Failed to resolve the broker", zap.String("brokerchannel", ID.String()), zap.Error(err))
+		return
+	}
+	if sharded(bc) {
+		persist(cfg, bc)
+	}
+	if bc.Spec.MaxInFlight != nil {
+		cfg.ReceiveMaximum = uint16(*bc.Spec.MaxInFlight)
+	}
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	// Demote may have run since the ownership was checked.
+	if cm.draining || !cm.owns(bc) {
+		return
+	}
+	sinkCfg, sinkErr := cm.resolveSink(bc)
+	current := newSettings(bc, sinkCfg)
+	old, ok := cm.conn[ID]
+	if ok && *old.cfg != *cfg {
+		cm.logger.Infof("Broker of %s changed, reconnecting", ID)
+		old.Close()
+		cm.reporter.ReportReconnect(old.args)
+		ok = false
+	}
+	if ok && sinkErr == nil && old.Applied(current) {
+		// Most updates only change the status reported by the data plane.
+		return
+	}
 	if !ok {
-		newConn, err := newMQTTConnection(bc.Status.SinkURI, bc.Spec.Topic, bc.Spec.BrokerAddr, bc.Spec.BrokerPort, cm.logger, cm.sigCh)
+		args := &ReportArgs{Namespace: bc.Namespace, Name: bc.Name, Broker: brokerTag(bc)}
+		newConn, err := newMQTTConnection(bc.Status.SinkURI, cfg, args, cm.reporter, cm.recorder, objectReference(bc), cm.logger)
 		if err != nil {
-			panic(err)
+			cm.logger.Errorw("Failed to create the connection", zap.String("brokerchannel", ID.String()), zap.Error(err))
+			recordEvent(cm.recorder, objectReference(bc), newConnectionFailed(err))
+			go cm.reportError(ID, err)
+			return
 		}
 		cm.conn[ID] = newConn
+		newConn.Run(cm.wg)
 	}
 	cm.conn[ID].addr = bc.Status.SinkURI
-	if err := cm.conn[ID].Subscribe(cm.ctx, bc.Spec.Topic); err != nil {
-		panic(err)
+	if tr, err := transform.New(bc.Spec.Transform); err != nil {
+		// The webhook rejects invalid transforms, keep the previous one.
+		cm.logger.Errorw("Invalid transform", zap.String("brokerchannel", ID.String()), zap.Error(err))
+	} else {
+		cm.conn[ID].SetTransform(tr)
+	}
+	applied := true
+	if f, err := filter.New(bc.Spec.Filter); err != nil {
+		// The webhook rejects invalid filters, keep the previous one.
+		cm.logger.Errorw("Invalid filter", zap.String("brokerchannel", ID.String()), zap.Error(err))
+	} else {
+		cm.conn[ID].SetFilter(f)
+	}
+	if routes, err := newRoutes(bc); err != nil {
+		cm.logger.Errorw("Invalid routes", zap.String("brokerchannel", ID.String()), zap.Error(err))
+	} else {
+		cm.conn[ID].SetRoutes(routes)
+	}
+	cm.conn[ID].SetDeadLetterSink(bc.Status.DeadLetterSinkURI)
+	cm.conn[ID].SetMarkRetained(bc.Spec.MarkRetained)
+	cm.conn[ID].SetLimiter(newLimiter(bc))
+	if sinkErr == nil {
+		sinkErr = cm.conn[ID].SetSink(sinkCfg)
+	}
+	if sinkErr != nil {
+		// Keep the previous settings until the BrokerChannel changes.
+		cm.logger.Errorw("Failed to configure the sink", zap.String("brokerchannel", ID.String()), zap.Error(sinkErr))
+		recordEvent(cm.recorder, objectReference(bc), newSinkAuthFailed(sinkErr))
+		applied = false
+	}
+	if d, err := cm.deduplicator(bc); err != nil {
+		cm.logger.Errorw("Failed to open the deduplication cache", zap.String("brokerchannel", ID.String()), zap.Error(err))
+		applied = false
+	} else {
+		cm.conn[ID].SetDeduplicator(d)
+	}
+	if b, maxAge, err := cm.buffer(bc); err != nil {
+		cm.logger.Errorw("Failed to open the buffer", zap.String("brokerchannel", ID.String()), zap.Error(err))
+		applied = false
+	} else {
+		cm.conn[ID].SetBuffer(b, bc.Spec.Buffer != nil, maxAge)
+	}
+	if err := cm.conn[ID].Subscribe(cm.ctx, subscriptions(bc)); err != nil {
+		cm.logger.Errorw("Failed to subscribe", zap.String("brokerchannel", ID.String()), zap.Error(err))
+		recordEvent(cm.recorder, objectReference(bc), newSubscribeFailed(cfg.Address, err))
+		applied = false
+	}
+	if applied {
+		cm.conn[ID].SetApplied(current)
+	} else {
+		// Apply the settings again on the next update.
+		cm.conn[ID].SetApplied(nil)
+	}
+}
+
+// resolveSink returns the configuration of the deliveries of bc, read from
+// the secrets of its SinkAuth.
+func (cm *ConnectionManager) resolveSink(bc *v1beta1.BrokerChannel) (*sink.Config, error) {
+	var track func(string) error
+	if cm.resolver.Tracker != nil {
+		track = func(name string) error {
+			return cm.resolver.Tracker.TrackReference(resolver.SecretReference(bc.Namespace, name), bc)
+		}
+	}
+	return sink.Resolve(cm.ctx, cm.resolver.Secrets, track, bc.Namespace, bc.Spec.SinkAuth)
+}
+
+// eventHandlerAdder is the part of an informer notifying the changes of its
+// objects.
+type eventHandlerAdder interface {
+	AddEventHandler(handler cache.ResourceEventHandler)
+}
+
+// WatchBrokerChannels connects the BrokerChannels of informer.
+func (cm *ConnectionManager) WatchBrokerChannels(informer eventHandlerAdder) {
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: cm.AddConn,
+		UpdateFunc: controller.PassNew(cm.AddConn),
+		DeleteFunc: cm.DeleteConn,
+	})
+}
+
+// WatchMQTTBrokers reconnects the BrokerChannels referencing the MQTTBrokers
+// of informer when they change.
+func (cm *ConnectionManager) WatchMQTTBrokers(informer eventHandlerAdder) {
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: cm.SyncBroker,
+		UpdateFunc: controller.PassNew(cm.SyncBroker),
+	})
+}
+
+// WatchSecrets notifies the tracker of the resolver when the secrets of
+// informer change.
+func (cm *ConnectionManager) WatchSecrets(informer eventHandlerAdder) {
+	informer.AddEventHandler(controller.HandleAll(
+		controller.EnsureTypeMeta(cm.resolver.Tracker.OnChanged, corev1.SchemeGroupVersion.WithKind("Secret")),
+	))
+}
+
+// brokerTag names the broker of bc in the metrics.
+func brokerTag(bc *v1beta1.BrokerChannel) string {
+	if bc.Spec.BrokerRef != nil {
+		return bc.Spec.BrokerRef.Name
+	}
+	return bc.Spec.Broker.Address()
+}
+
+// subscriptions returns the subscriptions of bc as sent to the broker. They
+// are shared by the replicas of the data plane, in a share group named after
+// the UID of bc, when its SubscriptionMode is Shared.
+func subscriptions(bc *v1beta1.BrokerChannel) []v1beta1.Subscription {
+	if bc.Spec.SubscriptionMode != v1beta1.SharedSubscriptions {
+		return bc.Spec.Subscriptions
+	}
+	subs := make([]v1beta1.Subscription, 0, len(bc.Spec.Subscriptions))
+	for _, s := range bc.Spec.Subscriptions {
+		s.Topic = mqtt.SharedFilter(string(bc.UID), s.Topic)
+		subs = append(subs, s)
+	}
+	return subs
+}
+
+// SyncBroker updates the connections of the BrokerChannels referencing the
+// MQTTBroker obj.
+func (cm *ConnectionManager) SyncBroker(obj interface{}) {
+	mb, ok := obj.(*v1beta1.MQTTBroker)
+	if !ok {
+		return
 	}
-	cm.conn[ID].Run(cm.wg)
+	bcs, err := cm.channelLister.BrokerChannels(mb.Namespace).List(labels.Everything())
+	if err != nil {
+		cm.logger.Errorw("Failed to list BrokerChannels", zap.Error(err))
+		return
+	}
+	for _, bc := range bcs {
+		if bc.Spec.BrokerRef != nil && bc.Spec.BrokerRef.Name == mb.Name {
+			cm.AddConn(bc)
+		}
+	}
+}
+
+// SyncChannel connects the BrokerChannel key again, when a secret of its
+// MQTTBroker or of its sinkAuth changed.
+func (cm *ConnectionManager) SyncChannel(key types.NamespacedName) {
+	bc, err := cm.channelLister.BrokerChannels(key.Namespace).Get(key.Name)
+	if err != nil {
+		// The BrokerChannel was deleted.
+		return
+	}
+	cm.AddConn(bc)
 }
 
 func (cm *ConnectionManager) DeleteConn(obj interface{}) {
 	cm.logger.Info("Connection stopped")
-	bc := obj.(*v1alpha1.BrokerChannel)
+	bc := obj.(*v1beta1.BrokerChannel)
 	ID := types.NamespacedName{Namespace: bc.Namespace, Name: bc.Name}
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	if c, ok := cm.conn[ID]; ok {
+		c.End()
+	}
 	delete(cm.conn, ID)
+	cm.deleteBuffer(ID)
+	cm.deleteDedup(ID)
+}
+
+// Drain drains every connection in parallel, until ctx is done.
+func (cm *ConnectionManager) Drain(ctx context.Context) {
+	cm.mu.Lock()
+	cm.draining = true
+	conns := make([]*MQTTConnection, 0, len(cm.conn))
+	for _, c := range cm.conn {
+		conns = append(conns, c)
+	}
+	cm.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, c := range conns {
+		wg.Add(1)
+		go func(c *MQTTConnection) {
+			defer wg.Done()
+			c.Drain(ctx)
+		}(c)
+	}
+	wg.Wait()
 }
 
 
+// component is the name of the data plane in the logs and the metrics.
+const component = "brokerchannel"
+
 func main() {
 	ctx, cancel := context.WithCancel(context.Background())
 	var wg sync.WaitGroup
@@ -143,6 +973,8 @@ func main() {
 
 	metrics.MemStatsOrDie(ctx)
 
+	disableHighAvailability := flag.Bool("disable-ha", false,
+		"Whether to connect every BrokerChannel from this replica, instead of the BrokerChannels of the buckets it leads.")
 	cfg := injection.ParseAndGetRESTConfigOrDie()
 	ctx, informers := injection.Default.SetupInformers(ctx, cfg)
 	// Set up our logger.
@@ -154,31 +986,89 @@ func main() {
 	logger, _ := logging.NewLoggerFromConfig(loggingConfig, "MQTTCoverter")
 	logger = logger.With(zap.String(logkey.ControllerType, "MQTTConverter"))
 	ctx = logging.WithLogger(ctx, logger)
-	if err := controller.StartInformers(ctx.Done(), informers...); err != nil {
-		logger.Fatalw("Failed to start informers", zap.Error(err))
+
+	// Export the metrics as configured by config-observability, and the
+	// traces as configured by config-tracing.
+	cmw := sharedmain.SetupConfigMapWatchOrDie(ctx, logger)
+	sharedmain.WatchObservabilityConfigOrDie(ctx, cmw, profiling.NewHandler(logger, false), logger, component)
+	if err := tracing.SetupDynamicPublishing(logger, cmw, component, tracingconfig.ConfigName); err != nil {
+		logger.Fatalw("Error setting up trace publishing", zap.Error(err))
+	}
+	if err := cmw.Start(ctx.Done()); err != nil {
+		logger.Fatalw("Failed to start the ConfigMap watcher", zap.Error(err))
 	}
 	sigCh := signals.SetupSignalHandler()
 
+	// Every replica connects the BrokerChannels of the buckets it leads, as
+	// configured by config-leader-election.
+	if !*disableHighAvailability {
+		leConfig, err := sharedmain.GetLeaderElectionConfig(ctx)
+		if err != nil {
+			logger.Fatalw("Error loading leader election configuration", zap.Error(err))
+		}
+		ctx = leaderelection.WithDynamicLeaderElectorBuilder(ctx, kubeclient.Get(ctx), leConfig.GetComponentConfig(component))
+	}
+
+	brokerChannelInformer := brokerchannelinformer.Get(ctx)
+	mqttBrokerInformer := mqttbrokerinformer.Get(ctx)
+	secretInformer := secret.Get(ctx)
 	cm := &ConnectionManager {
 		conn: make(map[types.NamespacedName]*MQTTConnection),
+		channelLister:	brokerChannelInformer.Lister(),
+		resolver:		&resolver.Resolver{
+			Brokers:	mqttBrokerInformer.Lister(),
+			Secrets:	secretInformer.Lister(),
+		},
+		reporter: NewStatsReporter(),
+		recorder: newEventRecorder(kubeclient.Get(ctx)),
 		logger: logger,
-		sigCh: sigCh,
 		wg:		&wg,
 		ctx:	ctx,
+		client:	client.Get(ctx),
+		buffers:	make(map[types.NamespacedName]*buffer.Buffer),
+		bufferDir:	os.Getenv("BUFFER_DIR"),
+		dedups:		make(map[types.NamespacedName]*dedup.Cache),
 	}
 
-	brokerChannelInformer := brokerchannelinformer.Get(ctx)
-	brokerChannelInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
-		AddFunc: cm.AddConn,
-		UpdateFunc: controller.PassNew(cm.AddConn),
-		DeleteFunc: cm.DeleteConn,
-	})
-	select {
-	case <-sigCh:
-		logger.Info("Received SIGTERM")
-		// Send a signal to let readiness probes start failing.
-		cancel()
+	cm.WatchBrokerChannels(brokerChannelInformer.Informer())
+	cm.WatchMQTTBrokers(mqttBrokerInformer.Informer())
+	cm.resolver.Tracker = tracker.New(func(key types.NamespacedName) {
+		// The tracker calls back from within Resolve for new references.
+		go cm.SyncChannel(key)
+	}, controller.GetTrackerLease(ctx))
+	cm.WatchSecrets(secretInformer.Informer())
+
+	p := newProber()
+	health := &http.Server{Addr: fmt.Sprintf(":%d", healthPort), Handler: p.Handler()}
+	go func() {
+		if err := health.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logger.Fatalw("Failed to serve the probes", zap.Error(err))
+		}
+	}()
+	if err := controller.StartInformers(ctx.Done(), informers...); err != nil {
+		logger.Fatalw("Failed to start informers", zap.Error(err))
 	}
+	p.MarkSynced()
+
+	// The elector promotes the ConnectionManager for every bucket once the
+	// BrokerChannels are listed, or for all of them when HA is disabled.
+	elector, err := leaderelection.BuildElector(ctx, cm, component, nil)
+	if err != nil {
+		logger.Fatalw("Failed to build the leader elector", zap.Error(err))
+	}
+	go elector.Run(ctx)
+	go cm.ReportStatus(ctx, statusInterval)
+
+	<-sigCh
+	logger.Info("Received SIGTERM, draining")
+	// Let the readiness probe fail, then deliver the messages in flight
+	// before disconnecting.
+	p.MarkDraining()
+	drainCtx, cancelDrain := context.WithTimeout(context.Background(), drainTimeout)
+	cm.Drain(drainCtx)
+	cancelDrain()
+	cancel()
 	wg.Wait()
+	health.Close()
 	logger.Info("terminated")
 }
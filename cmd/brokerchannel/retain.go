@@ -0,0 +1,38 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"github.com/ShixiongQi/brokerchannel/pkg/apis/samples/v1beta1"
+)
+
+// retainedExtension is the extension set to true on the events of the
+// retained messages, when the BrokerChannel marks them.
+const retainedExtension = "mqttretained"
+
+// retainHandling returns the MQTT 5 Retain Handling subscription option
+// of h, in place in the options byte, bits 4 and 5, as paho packs it.
+func retainHandling(h v1beta1.RetainHandling) byte {
+	switch h {
+	case v1beta1.SendRetainedIfNew:
+		return 1 << 4
+	case v1beta1.NeverSendRetained:
+		return 2 << 4
+	default:
+		return 0
+	}
+}
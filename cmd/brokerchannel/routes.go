@@ -0,0 +1,75 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"knative.dev/eventing/pkg/eventfilter"
+	"knative.dev/pkg/apis"
+
+	"github.com/ShixiongQi/brokerchannel/pkg/apis/samples/v1beta1"
+	"github.com/ShixiongQi/brokerchannel/pkg/filter"
+	"github.com/ShixiongQi/brokerchannel/pkg/mqtt"
+)
+
+// route sends the messages matching its topic filter and its attribute
+// filter to addr.
+type route struct {
+	name   string
+	topic  string
+	filter eventfilter.Filter
+	// addr is nil until the controller resolves the destination.
+	addr *apis.URL
+}
+
+// newRoutes returns the routes of bc, to the destinations resolved in its
+// status. It returns an error when the filter of a route is invalid.
+func newRoutes(bc *v1beta1.BrokerChannel) ([]route, error) {
+	addrs := make(map[string]*apis.URL, len(bc.Status.Routes))
+	for _, rs := range bc.Status.Routes {
+		addrs[rs.Name] = rs.URI
+	}
+	routes := make([]route, 0, len(bc.Spec.Routes))
+	for _, r := range bc.Spec.Routes {
+		f, err := filter.New(r.Filter)
+		if err != nil {
+			return nil, fmt.Errorf("invalid filter of route %s: %w", r.Name, err)
+		}
+		routes = append(routes, route{
+			name:   r.Name,
+			topic:  r.Topic,
+			filter: f,
+			addr:   addrs[r.Name],
+		})
+	}
+	return routes, nil
+}
+
+// selectRoute returns the first of routes matching event, received on
+// topic, or nil when the message takes the default route.
+func selectRoute(ctx context.Context, routes []route, topic string, event cloudevents.Event) *route {
+	for i := range routes {
+		r := &routes[i]
+		if mqtt.MatchTopic(r.topic, topic) && r.filter.Filter(ctx, event) != eventfilter.FailFilter {
+			return r
+		}
+	}
+	return nil
+}
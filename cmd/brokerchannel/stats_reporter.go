@@ -0,0 +1,398 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"time"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+	"knative.dev/pkg/metrics"
+	"knative.dev/pkg/metrics/metricskey"
+)
+
+var (
+	// messageCountM is a counter which records the number of MQTT messages
+	// received by a BrokerChannel.
+	messageCountM = stats.Int64(
+		"mqtt_message_count",
+		"Number of MQTT messages received by the BrokerChannel",
+		stats.UnitDimensionless,
+	)
+
+	// messageBytesM records the size of the payloads of the MQTT messages
+	// received by a BrokerChannel.
+	messageBytesM = stats.Int64(
+		"mqtt_message_bytes",
+		"Bytes of MQTT payload received by the BrokerChannel",
+		stats.UnitBytes,
+	)
+
+	// dispatchCountM is a counter which records the delivery attempts to the
+	// sink, with their outcome.
+	dispatchCountM = stats.Int64(
+		"event_dispatch_count",
+		"Number of events sent to the sink of the BrokerChannel",
+		stats.UnitDimensionless,
+	)
+
+	// dispatchTimeInMsecM records the time from the receipt of an MQTT message
+	// to the response of the sink, in milliseconds.
+	dispatchTimeInMsecM = stats.Float64(
+		"event_dispatch_latencies",
+		"The time from the receipt of an MQTT message to the response of the sink",
+		stats.UnitMilliseconds,
+	)
+
+	// inFlightM records the number of messages received but not yet
+	// acknowledged by the sink.
+	inFlightM = stats.Int64(
+		"in_flight_messages",
+		"Number of MQTT messages waiting for the sink of the BrokerChannel",
+		stats.UnitDimensionless,
+	)
+
+	// reconnectCountM is a counter which records the number of times the
+	// BrokerChannel connected to its broker again.
+	reconnectCountM = stats.Int64(
+		"mqtt_reconnect_count",
+		"Number of reconnections of the BrokerChannel to its broker",
+		stats.UnitDimensionless,
+	)
+
+	// filterCountM is a counter which records the events checked against
+	// the filter of a BrokerChannel, with the decision of the filter.
+	filterCountM = stats.Int64(
+		"event_filter_count",
+		"Number of events checked against the filter of the BrokerChannel",
+		stats.UnitDimensionless,
+	)
+
+	// bufferMessagesM and bufferBytesM record the messages stored in the
+	// buffer of a BrokerChannel.
+	bufferMessagesM = stats.Int64(
+		"buffer_messages",
+		"Number of messages in the buffer of the BrokerChannel",
+		stats.UnitDimensionless,
+	)
+	bufferBytesM = stats.Int64(
+		"buffer_bytes",
+		"Bytes of the messages in the buffer of the BrokerChannel",
+		stats.UnitBytes,
+	)
+
+	// bufferDropCountM is a counter which records the messages dropped by
+	// the buffer of a BrokerChannel, with the reason.
+	bufferDropCountM = stats.Int64(
+		"buffer_dropped_count",
+		"Number of messages dropped by the buffer of the BrokerChannel",
+		stats.UnitDimensionless,
+	)
+
+	// throttledCountM is a counter which records the QoS 0 messages dropped
+	// by the rate limit, the cap of the events in flight or an open circuit
+	// breaker.
+	throttledCountM = stats.Int64(
+		"mqtt_throttled_count",
+		"Number of QoS 0 messages dropped by the limits or the circuit breakers of the BrokerChannel",
+		stats.UnitDimensionless,
+	)
+
+	// duplicateCountM is a counter which records the copies of the messages
+	// dropped by the deduplication of a BrokerChannel.
+	duplicateCountM = stats.Int64(
+		"mqtt_duplicate_count",
+		"Number of duplicate MQTT messages dropped by the BrokerChannel",
+		stats.UnitDimensionless,
+	)
+
+	// expiredCountM is a counter which records the messages whose MQTT 5
+	// Message Expiry Interval elapsed before their delivery.
+	expiredCountM = stats.Int64(
+		"mqtt_expired_count",
+		"Number of MQTT messages expired before their delivery by the BrokerChannel",
+		stats.UnitDimensionless,
+	)
+
+	// Create the tag keys that will be used to add tags to our measurements.
+	// Tag keys must conform to the restrictions described in
+	// go.opencensus.io/tag/validate.go. Currently those restrictions are:
+	// - length between 1 and 255 inclusive
+	// - characters are printable US-ASCII
+	namespaceKey         = tag.MustNewKey(metricskey.LabelNamespaceName)
+	nameKey              = tag.MustNewKey(metricskey.LabelName)
+	brokerKey            = tag.MustNewKey("broker")
+	topicKey             = tag.MustNewKey("topic")
+	filterResultKey      = tag.MustNewKey("filter_result")
+	dropReasonKey        = tag.MustNewKey("reason")
+	responseCodeKey      = tag.MustNewKey(metricskey.LabelResponseCode)
+	responseCodeClassKey = tag.MustNewKey(metricskey.LabelResponseCodeClass)
+)
+
+// ReportArgs identifies the BrokerChannel a measurement belongs to.
+type ReportArgs struct {
+	Namespace string
+	Name      string
+	// Broker is the MQTTBroker of the BrokerChannel, or the address of its
+	// inline broker.
+	Broker string
+}
+
+func init() {
+	register()
+}
+
+// StatsReporter reports the metrics of the BrokerChannels.
+type StatsReporter interface {
+	ReportMessage(args *ReportArgs, topic string, bytes int) error
+	// ReportDispatch reports a delivery attempt to the sink. responseCode is
+	// 0 when the sink could not be reached.
+	ReportDispatch(args *ReportArgs, responseCode int, d time.Duration) error
+	ReportInFlight(args *ReportArgs, n int64) error
+	ReportReconnect(args *ReportArgs) error
+	// ReportFilter reports the decision of the filter on an event, pass or
+	// fail.
+	ReportFilter(args *ReportArgs, result string) error
+	ReportBuffer(args *ReportArgs, messages, bytes int64) error
+	// ReportBufferDrop reports a message dropped by the buffer, because it
+	// is full or expired.
+	ReportBufferDrop(args *ReportArgs, reason string) error
+	ReportThrottled(args *ReportArgs) error
+	ReportDuplicate(args *ReportArgs) error
+	ReportExpired(args *ReportArgs) error
+}
+
+var _ StatsReporter = (*reporter)(nil)
+var emptyContext = context.Background()
+
+type reporter struct{}
+
+// NewStatsReporter creates a reporter that collects and reports the
+// BrokerChannel metrics.
+func NewStatsReporter() StatsReporter {
+	return &reporter{}
+}
+
+func register() {
+	tagKeys := []tag.Key{namespaceKey, nameKey, brokerKey}
+	with := func(keys ...tag.Key) []tag.Key {
+		return append(append([]tag.Key(nil), tagKeys...), keys...)
+	}
+
+	// Create view to see our measurements.
+	err := metrics.RegisterResourceView(
+		&view.View{
+			Description: messageCountM.Description(),
+			Measure:     messageCountM,
+			Aggregation: view.Count(),
+			TagKeys:     with(topicKey),
+		},
+		&view.View{
+			Description: messageBytesM.Description(),
+			Measure:     messageBytesM,
+			Aggregation: view.Sum(),
+			TagKeys:     with(topicKey),
+		},
+		&view.View{
+			Description: dispatchCountM.Description(),
+			Measure:     dispatchCountM,
+			Aggregation: view.Count(),
+			TagKeys:     with(responseCodeKey, responseCodeClassKey),
+		},
+		&view.View{
+			Description: dispatchTimeInMsecM.Description(),
+			Measure:     dispatchTimeInMsecM,
+			Aggregation: view.Distribution(metrics.Buckets125(1, 10000)...), // 1, 2, 5, 10, 20, 50, 100, 500, 1000, 5000, 10000
+			TagKeys:     with(responseCodeClassKey),
+		},
+		&view.View{
+			Description: inFlightM.Description(),
+			Measure:     inFlightM,
+			Aggregation: view.LastValue(),
+			TagKeys:     tagKeys,
+		},
+		&view.View{
+			Description: reconnectCountM.Description(),
+			Measure:     reconnectCountM,
+			Aggregation: view.Count(),
+			TagKeys:     tagKeys,
+		},
+		&view.View{
+			Description: filterCountM.Description(),
+			Measure:     filterCountM,
+			Aggregation: view.Count(),
+			TagKeys:     with(filterResultKey),
+		},
+		&view.View{
+			Description: bufferMessagesM.Description(),
+			Measure:     bufferMessagesM,
+			Aggregation: view.LastValue(),
+			TagKeys:     tagKeys,
+		},
+		&view.View{
+			Description: bufferBytesM.Description(),
+			Measure:     bufferBytesM,
+			Aggregation: view.LastValue(),
+			TagKeys:     tagKeys,
+		},
+		&view.View{
+			Description: bufferDropCountM.Description(),
+			Measure:     bufferDropCountM,
+			Aggregation: view.Count(),
+			TagKeys:     with(dropReasonKey),
+		},
+		&view.View{
+			Description: throttledCountM.Description(),
+			Measure:     throttledCountM,
+			Aggregation: view.Count(),
+			TagKeys:     tagKeys,
+		},
+		&view.View{
+			Description: duplicateCountM.Description(),
+			Measure:     duplicateCountM,
+			Aggregation: view.Count(),
+			TagKeys:     tagKeys,
+		},
+		&view.View{
+			Description: expiredCountM.Description(),
+			Measure:     expiredCountM,
+			Aggregation: view.Count(),
+			TagKeys:     tagKeys,
+		},
+	)
+	if err != nil {
+		log.Print("failed to register opencensus views, " + err.Error())
+	}
+}
+
+// ReportMessage captures the receipt of an MQTT message.
+func (r *reporter) ReportMessage(args *ReportArgs, topic string, bytes int) error {
+	ctx, err := generateTag(args, tag.Insert(topicKey, topic))
+	if err != nil {
+		return err
+	}
+	metrics.RecordBatch(ctx, messageCountM.M(1), messageBytesM.M(int64(bytes)))
+	return nil
+}
+
+// ReportDispatch captures a delivery attempt and its latency.
+func (r *reporter) ReportDispatch(args *ReportArgs, responseCode int, d time.Duration) error {
+	ctx, err := generateTag(args,
+		tag.Insert(responseCodeKey, strconv.Itoa(responseCode)),
+		tag.Insert(responseCodeClassKey, metrics.ResponseCodeClass(responseCode)))
+	if err != nil {
+		return err
+	}
+	// convert Time.Duration in nanoseconds to milliseconds.
+	metrics.RecordBatch(ctx, dispatchCountM.M(1), dispatchTimeInMsecM.M(float64(d/time.Millisecond)))
+	return nil
+}
+
+// ReportInFlight captures the number of messages waiting for the sink.
+func (r *reporter) ReportInFlight(args *ReportArgs, n int64) error {
+	ctx, err := generateTag(args)
+	if err != nil {
+		return err
+	}
+	metrics.Record(ctx, inFlightM.M(n))
+	return nil
+}
+
+// ReportReconnect captures a reconnection to the broker.
+func (r *reporter) ReportReconnect(args *ReportArgs) error {
+	ctx, err := generateTag(args)
+	if err != nil {
+		return err
+	}
+	metrics.Record(ctx, reconnectCountM.M(1))
+	return nil
+}
+
+// ReportFilter captures the decision of the filter on an event.
+func (r *reporter) ReportFilter(args *ReportArgs, result string) error {
+	ctx, err := generateTag(args, tag.Insert(filterResultKey, result))
+	if err != nil {
+		return err
+	}
+	metrics.Record(ctx, filterCountM.M(1))
+	return nil
+}
+
+// ReportBuffer captures the messages in the buffer.
+func (r *reporter) ReportBuffer(args *ReportArgs, messages, bytes int64) error {
+	ctx, err := generateTag(args)
+	if err != nil {
+		return err
+	}
+	metrics.RecordBatch(ctx, bufferMessagesM.M(messages), bufferBytesM.M(bytes))
+	return nil
+}
+
+// ReportBufferDrop captures a message dropped by the buffer.
+func (r *reporter) ReportBufferDrop(args *ReportArgs, reason string) error {
+	ctx, err := generateTag(args, tag.Insert(dropReasonKey, reason))
+	if err != nil {
+		return err
+	}
+	metrics.Record(ctx, bufferDropCountM.M(1))
+	return nil
+}
+
+// ReportThrottled captures a QoS 0 message dropped by the limits.
+func (r *reporter) ReportThrottled(args *ReportArgs) error {
+	ctx, err := generateTag(args)
+	if err != nil {
+		return err
+	}
+	metrics.Record(ctx, throttledCountM.M(1))
+	return nil
+}
+
+// ReportDuplicate captures a duplicate message dropped by the
+// deduplication.
+func (r *reporter) ReportDuplicate(args *ReportArgs) error {
+	ctx, err := generateTag(args)
+	if err != nil {
+		return err
+	}
+	metrics.Record(ctx, duplicateCountM.M(1))
+	return nil
+}
+
+// ReportExpired captures a message expired before its delivery.
+func (r *reporter) ReportExpired(args *ReportArgs) error {
+	ctx, err := generateTag(args)
+	if err != nil {
+		return err
+	}
+	metrics.Record(ctx, expiredCountM.M(1))
+	return nil
+}
+
+func generateTag(args *ReportArgs, mutators ...tag.Mutator) (context.Context, error) {
+	return tag.New(
+		emptyContext,
+		append([]tag.Mutator{
+			tag.Insert(namespaceKey, args.Namespace),
+			tag.Insert(nameKey, args.Name),
+			tag.Insert(brokerKey, args.Broker),
+		}, mutators...)...)
+}
@@ -0,0 +1,103 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	"knative.dev/pkg/metrics/metricskey"
+	"knative.dev/pkg/metrics/metricstest"
+	_ "knative.dev/pkg/metrics/testing"
+)
+
+func TestStatsReporter(t *testing.T) {
+	setup()
+	defer unregister()
+
+	r := NewStatsReporter()
+	args := &ReportArgs{Namespace: "default", Name: "sensors", Broker: "mosquitto"}
+	tags := map[string]string{
+		metricskey.LabelNamespaceName: "default",
+		metricskey.LabelName:          "sensors",
+		"broker":                      "mosquitto",
+	}
+	with := func(k, v string) map[string]string {
+		m := map[string]string{k: v}
+		for k, v := range tags {
+			m[k] = v
+		}
+		return m
+	}
+
+	expectSuccess(t, func() error { return r.ReportMessage(args, "sensors/motion", 10) })
+	expectSuccess(t, func() error { return r.ReportMessage(args, "sensors/motion", 5) })
+	metricstest.CheckCountData(t, "mqtt_message_count", with("topic", "sensors/motion"), 2)
+	metricstest.CheckSumData(t, "mqtt_message_bytes", with("topic", "sensors/motion"), 15)
+
+	expectSuccess(t, func() error { return r.ReportDispatch(args, 202, 20*time.Millisecond) })
+	expectSuccess(t, func() error { return r.ReportDispatch(args, 202, 40*time.Millisecond) })
+	dispatchTags := with(metricskey.LabelResponseCode, "202")
+	dispatchTags[metricskey.LabelResponseCodeClass] = "2xx"
+	metricstest.CheckCountData(t, "event_dispatch_count", dispatchTags, 2)
+	metricstest.CheckDistributionData(t, "event_dispatch_latencies", with(metricskey.LabelResponseCodeClass, "2xx"), 2, 20, 40)
+
+	expectSuccess(t, func() error { return r.ReportInFlight(args, 3) })
+	metricstest.CheckLastValueData(t, "in_flight_messages", tags, 3)
+
+	expectSuccess(t, func() error { return r.ReportReconnect(args) })
+	metricstest.CheckCountData(t, "mqtt_reconnect_count", tags, 1)
+
+	expectSuccess(t, func() error { return r.ReportFilter(args, "fail") })
+	expectSuccess(t, func() error { return r.ReportFilter(args, "fail") })
+	metricstest.CheckCountData(t, "event_filter_count", with("filter_result", "fail"), 2)
+
+	expectSuccess(t, func() error { return r.ReportBuffer(args, 4, 120) })
+	metricstest.CheckLastValueData(t, "buffer_messages", tags, 4)
+	metricstest.CheckLastValueData(t, "buffer_bytes", tags, 120)
+
+	expectSuccess(t, func() error { return r.ReportBufferDrop(args, "expired") })
+	metricstest.CheckCountData(t, "buffer_dropped_count", with("reason", "expired"), 1)
+
+	expectSuccess(t, func() error { return r.ReportThrottled(args) })
+	metricstest.CheckCountData(t, "mqtt_throttled_count", tags, 1)
+
+	expectSuccess(t, func() error { return r.ReportDuplicate(args) })
+	metricstest.CheckCountData(t, "mqtt_duplicate_count", tags, 1)
+
+	expectSuccess(t, func() error { return r.ReportExpired(args) })
+	metricstest.CheckCountData(t, "mqtt_expired_count", tags, 1)
+}
+
+func expectSuccess(t *testing.T, f func() error) {
+	t.Helper()
+	if err := f(); err != nil {
+		t.Error("Reporter expected success but got error:", err)
+	}
+}
+
+func setup() {
+	unregister()
+	register()
+}
+
+func unregister() {
+	metricstest.Unregister("mqtt_message_count", "mqtt_message_bytes", "event_dispatch_count",
+		"event_dispatch_latencies", "in_flight_messages", "mqtt_reconnect_count", "event_filter_count",
+		"buffer_messages", "buffer_bytes", "buffer_dropped_count", "mqtt_throttled_count",
+		"mqtt_duplicate_count", "mqtt_expired_count")
+}
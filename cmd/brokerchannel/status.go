@@ -0,0 +1,123 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"go.uber.org/zap"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/ShixiongQi/brokerchannel/pkg/apis/samples/v1beta1"
+)
+
+// statusInterval is the period of the updates of the status reported by the
+// data plane.
+const statusInterval = 10 * time.Second
+
+// status returns the status of the session, of the buffer and of the
+// circuit breakers of the connection.
+func (mc *MQTTConnection) status() *v1beta1.DataPlaneStatus {
+	st := &v1beta1.DataPlaneStatus{Buffer: mc.bufferStatus()}
+	mc.mu.Lock()
+	if mc.connErr != nil {
+		st.Error = mc.connErr.Error()
+	}
+	breakers := make([]*breaker, 0, len(mc.breakers))
+	for _, br := range mc.breakers {
+		breakers = append(breakers, br)
+	}
+	mc.mu.Unlock()
+	for _, br := range breakers {
+		if s := br.status(); s != nil {
+			st.CircuitBreakers = append(st.CircuitBreakers, *s)
+		}
+	}
+	sort.Slice(st.CircuitBreakers, func(i, j int) bool {
+		return st.CircuitBreakers[i].URI.String() < st.CircuitBreakers[j].URI.String()
+	})
+	return st
+}
+
+// ReportStatus reports the messages in the buffers of the connected
+// BrokerChannels in the metrics, and their sessions, buffers and circuit
+// breakers in their DataPlaneStatusAnnotation, every interval until ctx is done. The
+// controller copies the annotation into the status.
+func (cm *ConnectionManager) ReportStatus(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		cm.mu.Lock()
+		conns := make(map[types.NamespacedName]*MQTTConnection, len(cm.conn))
+		for ID, c := range cm.conn {
+			conns[ID] = c
+		}
+		cm.mu.Unlock()
+		for ID, c := range conns {
+			status := c.status()
+			if status.Buffer != nil {
+				cm.reporter.ReportBuffer(c.args, status.Buffer.Messages, status.Buffer.Bytes)
+			}
+			if err := cm.patchStatus(ctx, ID, status); err != nil {
+				cm.logger.Warnw("Failed to update the status", zap.String("brokerchannel", ID.String()), zap.Error(err))
+			}
+		}
+	}
+}
+
+// reportError reports that the connection of the BrokerChannel ID could not
+// be set up, which marks it not ready until its status is reported again.
+func (cm *ConnectionManager) reportError(ID types.NamespacedName, err error) {
+	if err := cm.patchStatus(cm.ctx, ID, &v1beta1.DataPlaneStatus{Error: err.Error()}); err != nil {
+		cm.logger.Warnw("Failed to update the status", zap.String("brokerchannel", ID.String()), zap.Error(err))
+	}
+}
+
+// patchStatus sets the DataPlaneStatusAnnotation of the BrokerChannel ID to
+// status, unless it already holds it.
+func (cm *ConnectionManager) patchStatus(ctx context.Context, ID types.NamespacedName, status *v1beta1.DataPlaneStatus) error {
+	value, err := json.Marshal(status)
+	if err != nil {
+		return err
+	}
+	bc, err := cm.channelLister.BrokerChannels(ID.Namespace).Get(ID.Name)
+	if err != nil {
+		return err
+	}
+	if bc.Annotations[v1beta1.DataPlaneStatusAnnotation] == string(value) {
+		return nil
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{v1beta1.DataPlaneStatusAnnotation: string(value)},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = cm.client.SamplesV1beta1().BrokerChannels(ID.Namespace).Patch(ctx, ID.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+	return err
+}
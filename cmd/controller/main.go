@@ -18,6 +18,10 @@ package main
 
 import (
 	// The set of controllers this controller process runs.
+	"github.com/ShixiongQi/brokerchannel/pkg/reconciler/broker"
+	"github.com/ShixiongQi/brokerchannel/pkg/reconciler/broker/trigger"
+	"github.com/ShixiongQi/brokerchannel/pkg/reconciler/mqttbroker"
+	"github.com/ShixiongQi/brokerchannel/pkg/reconciler/mqttchannel"
 	"github.com/ShixiongQi/brokerchannel/pkg/reconciler/samples"
 
 	// This defines the shared main for injected controllers.
@@ -25,5 +29,6 @@ import (
 )
 
 func main() {
-	sharedmain.Main("broker-channel-controller", samples.NewController)
+	sharedmain.Main("broker-channel-controller", samples.NewController, mqttbroker.NewController, mqttchannel.NewController,
+		broker.NewController, trigger.NewController)
 }
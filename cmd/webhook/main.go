@@ -31,15 +31,21 @@ import (
 	"knative.dev/pkg/webhook/certificates"
 	"knative.dev/pkg/webhook/configmaps"
 	"knative.dev/pkg/webhook/resourcesemantics"
+	"knative.dev/pkg/webhook/resourcesemantics/conversion"
 	"knative.dev/pkg/webhook/resourcesemantics/defaulting"
 	"knative.dev/pkg/webhook/resourcesemantics/validation"
 
+	"github.com/ShixiongQi/brokerchannel/pkg/apis/samples"
 	"github.com/ShixiongQi/brokerchannel/pkg/apis/samples/v1alpha1"
+	"github.com/ShixiongQi/brokerchannel/pkg/apis/samples/v1beta1"
 )
 
 var types = map[schema.GroupVersionKind]resourcesemantics.GenericCRD{
 	// List the types to validate
 	v1alpha1.SchemeGroupVersion.WithKind("BrokerChannel"): &v1alpha1.BrokerChannel{},
+	v1beta1.SchemeGroupVersion.WithKind("BrokerChannel"):  &v1beta1.BrokerChannel{},
+	v1beta1.SchemeGroupVersion.WithKind("MQTTBroker"):     &v1beta1.MQTTBroker{},
+	v1beta1.SchemeGroupVersion.WithKind("MQTTChannel"):    &v1beta1.MQTTChannel{},
 }
 
 var callbacks = map[schema.GroupVersionKind]validation.Callback{}
@@ -117,6 +123,32 @@ func NewConfigValidationController(ctx context.Context, cmw configmap.Watcher) *
 	)
 }
 
+// NewConversionController sets up the CRD conversion webhook.
+func NewConversionController(ctx context.Context, cmw configmap.Watcher) *controller.Impl {
+	return conversion.NewConversionController(ctx,
+
+		// The path on which to serve the webhook.
+		"/resource-conversion",
+
+		// Specify the types of custom resource definitions that should be converted.
+		map[schema.GroupKind]conversion.GroupKindConversion{
+			v1beta1.Kind("BrokerChannel"): {
+				DefinitionName: samples.BrokerChannelsResource.String(),
+				HubVersion:     v1beta1.SchemeGroupVersion.Version,
+				Zygotes: map[string]conversion.ConvertibleObject{
+					v1alpha1.SchemeGroupVersion.Version: &v1alpha1.BrokerChannel{},
+					v1beta1.SchemeGroupVersion.Version:  &v1beta1.BrokerChannel{},
+				},
+			},
+		},
+
+		// A function that infuses the context passed to ConvertTo/ConvertFrom/SetDefaults with custom metadata.
+		func(ctx context.Context) context.Context {
+			return ctx
+		},
+	)
+}
+
 func main() {
 	// Set up a signal context with our webhook options
 	ctx := webhook.WithOptions(signals.NewContext(), webhook.Options{
@@ -130,5 +162,6 @@ func main() {
 		NewDefaultingAdmissionController,
 		NewValidationAdmissionController,
 		NewConfigValidationController,
+		NewConversionController,
 	)
 }
@@ -5,14 +5,21 @@ go 1.14
 require (
 	github.com/cloudevents/sdk-go/v2 v2.4.1
 	github.com/eclipse/paho.golang v0.9.0
+	github.com/google/go-cmp v0.5.5
+	github.com/google/uuid v1.2.0
 	github.com/stretchr/testify v1.6.1
+	go.opencensus.io v0.23.0
 	go.uber.org/zap v1.16.0
+	golang.org/x/oauth2 v0.0.0-20210413134643-5e61552d6c78
+	golang.org/x/time v0.0.0-20210220033141-f8bda1e9f3ba
 	k8s.io/api v0.19.7
+	k8s.io/apiextensions-apiserver v0.19.7
 	k8s.io/apimachinery v0.19.7
 	k8s.io/client-go v0.19.7
 	knative.dev/eventing v0.22.1-0.20210420082335-31cda4cec54b
 	knative.dev/hack v0.0.0-20210325223819-b6ab329907d3
 	knative.dev/pkg v0.0.0-20210420053235-1afd04993622
+	sigs.k8s.io/yaml v1.2.0
 )
 
 replace github.com/prometheus/client_golang => github.com/prometheus/client_golang v0.9.2
@@ -33,7 +33,7 @@ group "Kubernetes Codegen"
 #                  instead of the $GOPATH directly. For normal projects this can be dropped.
 ${CODEGEN_PKG}/generate-groups.sh "deepcopy,client,informer,lister" \
   github.com/ShixiongQi/brokerchannel/pkg/client github.com/ShixiongQi/brokerchannel/pkg/apis \
-  "samples:v1alpha1" \
+  "samples:v1alpha1,v1beta1" \
   --go-header-file ${REPO_ROOT_DIR}/hack/boilerplate/boilerplate.go.txt
 
 group "Knative Codegen"
@@ -41,7 +41,7 @@ group "Knative Codegen"
 # Knative Injection
 ${KNATIVE_CODEGEN_PKG}/hack/generate-knative.sh "injection" \
   github.com/ShixiongQi/brokerchannel/pkg/client github.com/ShixiongQi/brokerchannel/pkg/apis \
-  "samples:v1alpha1" \
+  "samples:v1alpha1,v1beta1" \
   --go-header-file ${REPO_ROOT_DIR}/hack/boilerplate/boilerplate.go.txt
 
 group "Update deps post-codegen"
@@ -11,88 +11,198 @@ See the License for the specific language governing permissions and
 limitations under the License.
 */
 
-// Package adapter implements a sample receive adapter that generates events
-// at a regular interval.
+// Package adapter implements a receive adapter that consumes messages from
+// an MQTT broker and forwards them as CloudEvents to K_SINK.
 package adapter
 
 import (
 	"context"
-	"time"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"strings"
 
 	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/eclipse/paho.golang/paho"
+	"github.com/google/uuid"
 	"go.uber.org/zap"
 
 	"knative.dev/eventing/pkg/adapter/v2"
 	"knative.dev/pkg/logging"
+
+	"github.com/ShixiongQi/brokerchannel/pkg/mqtt"
+)
+
+const (
+	// EventType is the CloudEvents type used when the publisher did not set
+	// a "type" user property on the MQTT message.
+	EventType = "dev.knative.mqtt.message"
+
+	keepAlive = 30
 )
 
 type envConfig struct {
 	// Include the standard adapter.EnvConfig used by all adapters.
 	adapter.EnvConfig
 
-	// Interval between events, for example "5s", "100ms"
-	Interval time.Duration `envconfig:"INTERVAL" required:"true"`
+	// BrokerURL is the MQTT broker to connect to, for example
+	// "tcp://mosquitto:1883" or "ssl://mosquitto:8883".
+	BrokerURL string `envconfig:"MQTT_BROKER_URL" required:"true"`
+
+	// Topics is a comma separated list of topic filters to subscribe to.
+	Topics []string `envconfig:"MQTT_TOPICS" required:"true"`
+
+	// QoS is the maximum quality of service requested for every topic, 0,
+	// 1 or 2.
+	QoS byte `envconfig:"MQTT_QOS" default:"0"`
+
+	// ClientID identifies the adapter to the broker. The broker assigns
+	// one when empty.
+	ClientID string `envconfig:"MQTT_CLIENT_ID"`
+
+	// Files holding the credentials, typically mounted from a Secret.
+	UsernameFile   string `envconfig:"MQTT_USERNAME_FILE"`
+	PasswordFile   string `envconfig:"MQTT_PASSWORD_FILE"`
+	CACertFile     string `envconfig:"MQTT_CA_CERT_FILE"`
+	ClientCertFile string `envconfig:"MQTT_CLIENT_CERT_FILE"`
+	ClientKeyFile  string `envconfig:"MQTT_CLIENT_KEY_FILE"`
 }
 
 func NewEnv() adapter.EnvConfigAccessor { return &envConfig{} }
 
-// Adapter generates events at a regular interval.
+// Adapter consumes MQTT messages and sends them to the sink.
 type Adapter struct {
-	client   cloudevents.Client
-	interval time.Duration
-	logger   *zap.SugaredLogger
-
-	nextID int
+	env    *envConfig
+	client cloudevents.Client
+	logger *zap.SugaredLogger
 }
 
-type dataExample struct {
-	Sequence  int    `json:"sequence"`
-	Heartbeat string `json:"heartbeat"`
+// Start runs the adapter.
+// Returns if ctx is cancelled or the connection to the broker is lost.
+func (a *Adapter) Start(ctx context.Context) error {
+	if a.env.QoS > 2 {
+		return fmt.Errorf("invalid MQTT_QOS %d, expected 0, 1 or 2", a.env.QoS)
+	}
+	u, err := url.Parse(a.env.BrokerURL)
+	if err != nil {
+		return fmt.Errorf("invalid broker URL %q: %w", a.env.BrokerURL, err)
+	}
+	cfg, err := a.config(u)
+	if err != nil {
+		return err
+	}
+
+	a.logger.Infow("Connecting to broker", zap.String("broker", u.Host))
+	c, err := mqtt.Connect(ctx, cfg, paho.NewSingleHandlerRouter(func(m *paho.Publish) {
+		event := NewEvent(u, m)
+		if result := a.client.Send(ctx, event); !cloudevents.IsACK(result) {
+			a.logger.Infow("failed to send event", zap.String("id", event.ID()), zap.Error(result))
+		}
+	}))
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s: %w", u.Host, err)
+	}
+
+	sub := &paho.Subscribe{Subscriptions: make(map[string]paho.SubscribeOptions, len(a.env.Topics))}
+	for _, t := range a.env.Topics {
+		sub.Subscriptions[t] = paho.SubscribeOptions{QoS: a.env.QoS}
+	}
+	if _, err := c.Subscribe(ctx, sub); err != nil {
+		c.Close()
+		return fmt.Errorf("failed to subscribe to %v: %w", a.env.Topics, err)
+	}
+	a.logger.Infow("Subscribed", zap.Strings("topics", a.env.Topics))
+
+	select {
+	case <-ctx.Done():
+		a.logger.Info("Shutting down...")
+		c.Close()
+		return nil
+	case <-c.Done():
+		return errors.New("connection to the broker was lost")
+	}
 }
 
-func (a *Adapter) newEvent() cloudevents.Event {
-	event := cloudevents.NewEvent()
-	event.SetType("dev.knative.sample")
-	event.SetSource("sample.knative.dev/heartbeat-source")
-
-	if err := event.SetData(cloudevents.ApplicationJSON, &dataExample{
-		Sequence:  a.nextID,
-		Heartbeat: a.interval.String(),
-	}); err != nil {
-		a.logger.Errorw("failed to set data")
+// config returns the settings of the connection to the broker at u, with
+// the credentials and certificates read from their files.
+func (a *Adapter) config(u *url.URL) (*mqtt.Config, error) {
+	cfg := &mqtt.Config{Address: u.Host, KeepAlive: keepAlive, ClientID: a.env.ClientID}
+	switch u.Scheme {
+	case "tcp", "mqtt", "":
+	case "ssl", "tls", "mqtts":
+		cfg.TLS = true
+	default:
+		return nil, fmt.Errorf("unsupported scheme %q", u.Scheme)
 	}
-	a.nextID++
-	return event
+	files := []struct {
+		name  string
+		value *string
+	}{
+		{a.env.UsernameFile, &cfg.Username},
+		{a.env.PasswordFile, &cfg.Password},
+		{a.env.CACertFile, &cfg.CACert},
+		{a.env.ClientCertFile, &cfg.ClientCert},
+		{a.env.ClientKeyFile, &cfg.ClientKey},
+	}
+	for _, f := range files {
+		if f.name == "" {
+			continue
+		}
+		b, err := ioutil.ReadFile(f.name)
+		if err != nil {
+			return nil, err
+		}
+		*f.value = string(b)
+	}
+	cfg.Username, cfg.Password = strings.TrimSpace(cfg.Username), strings.TrimSpace(cfg.Password)
+	return cfg, nil
 }
 
-// Start runs the adapter.
-// Returns if ctx is cancelled or Send() returns an error.
-func (a *Adapter) Start(ctx context.Context) error {
-	a.logger.Infow("Starting heartbeat", zap.String("interval", a.interval.String()))
-	for {
-		select {
-		case <-time.After(a.interval):
-			event := a.newEvent()
-			a.logger.Infow("Sending new event", zap.String("event", event.String()))
-			if result := a.client.Send(context.Background(), event); !cloudevents.IsACK(result) {
-				a.logger.Infow("failed to send event", zap.String("event", event.String()), zap.Error(result))
-				// We got an error but it could be transient, try again next interval.
-				continue
+// NewEvent converts an MQTT message received from broker into a CloudEvent.
+// CloudEvent attributes are read from the MQTT user properties; the ones the
+// publisher did not set are derived from the broker and the topic.
+func NewEvent(broker *url.URL, m *paho.Publish) cloudevents.Event {
+	event := cloudevents.NewEvent()
+	event.SetID(uuid.New().String())
+	event.SetType(EventType)
+	event.SetSource(broker.String() + "/" + m.Topic)
+	event.SetSubject(m.Topic)
+
+	contentType := cloudevents.ApplicationJSON
+	if m.Properties != nil {
+		if m.Properties.ContentType != "" {
+			contentType = m.Properties.ContentType
+		}
+		for k, v := range m.Properties.User {
+			switch strings.ToLower(k) {
+			case "id":
+				event.SetID(v)
+			case "type":
+				event.SetType(v)
+			case "source":
+				event.SetSource(v)
+			case "subject":
+				event.SetSubject(v)
+			case "specversion", "datacontenttype":
+			default:
+				// Not every user property is a valid extension name, those
+				// are not forwarded.
+				_ = event.Context.SetExtension(k, v)
 			}
-		case <-ctx.Done():
-			a.logger.Info("Shutting down...")
-			return nil
 		}
 	}
+	event.SetData(contentType, m.Payload)
+	return event
 }
 
 func NewAdapter(ctx context.Context, aEnv adapter.EnvConfigAccessor, ceClient cloudevents.Client) adapter.Adapter {
 	env := aEnv.(*envConfig) // Will always be our own envConfig type
 	logger := logging.FromContext(ctx)
-	logger.Infow("Heartbeat example", zap.Duration("interval", env.Interval))
+	logger.Infow("MQTT adapter", zap.String("broker", env.BrokerURL), zap.Strings("topics", env.Topics))
 	return &Adapter{
-		interval: env.Interval,
-		client:   ceClient,
-		logger:   logger,
+		env:    env,
+		client: ceClient,
+		logger: logger,
 	}
 }
@@ -18,6 +18,7 @@ import (
 	"net"
 	"os"
 	"os/exec"
+	"strconv"
 	"testing"
 	"time"
 
@@ -29,7 +30,14 @@ import (
 	"knative.dev/pkg/logging"
 )
 
+type dataExample struct {
+	Sequence int `json:"sequence"`
+}
+
 func TestAdapter(t *testing.T) {
+	b := newBroker(t)
+	defer b.close()
+
 	// Test sink to receive events.
 	sink := newSink(t)
 	defer sink.close()
@@ -41,7 +49,7 @@ func TestAdapter(t *testing.T) {
 
 	// Keep the adapter logging quiet for tests.
 	ctx := logging.WithLogger(context.Background(), zap.NewNop().Sugar())
-	a := NewAdapter(ctx, &envConfig{Interval: time.Millisecond}, c)
+	a := NewAdapter(ctx, &envConfig{BrokerURL: b.URL(), Topics: []string{"sensors/+"}}, c)
 	ctx, cancel := context.WithCancel(ctx)
 	go func() {
 		if err := a.Start(ctx); err != nil {
@@ -49,19 +57,48 @@ func TestAdapter(t *testing.T) {
 		}
 	}()
 	defer func() { cancel() }()
-	verify(t, sink.received)
+	publish(t, b)
+	verify(t, b, sink.received)
+}
+
+func TestAdapterInvalidQoS(t *testing.T) {
+	ctx := logging.WithLogger(context.Background(), zap.NewNop().Sugar())
+	a := NewAdapter(ctx, &envConfig{BrokerURL: "tcp://127.0.0.1:1", Topics: []string{"sensors/+"}, QoS: 3}, nil)
+	assert.EqualError(t, a.Start(ctx), "invalid MQTT_QOS 3, expected 0, 1 or 2")
 }
 
-func verify(t *testing.T, received chan cloudevents.Event) {
+// publish waits for the adapter to subscribe and then publishes the
+// messages checked by verify.
+func publish(t *testing.T, b *broker) {
+	select {
+	case <-b.subscribed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the adapter to subscribe")
+	}
 	for _, id := range []int{0, 1, 2} {
-		e := <-received
+		b.publish("sensors/motion", []byte(`{"sequence":`+strconv.Itoa(id)+`}`), map[string]string{
+			"id":   strconv.Itoa(id),
+			"type": "dev.knative.sample",
+		})
+	}
+}
+
+// verify checks the events sent by publish. paho routes every message on its
+// own goroutine, so they may arrive in any order.
+func verify(t *testing.T, b *broker, received chan cloudevents.Event) {
+	seen := make(map[string]bool)
+	for range []int{0, 1, 2} {
+		e, ok := <-received
+		require.True(t, ok, "sink closed before all events were received")
 		assert.Equal(t, "dev.knative.sample", e.Type())
-		//m := map[string]json.RawMessage{}
+		assert.Equal(t, b.URL()+"/sensors/motion", e.Source())
+		assert.Equal(t, "sensors/motion", e.Subject())
 		m := &dataExample{}
 		assert.NoError(t, e.DataAs(&m))
-		n := &dataExample{Sequence: id, Heartbeat: "1ms"}
-		assert.Equal(t, n, m)
+		assert.Equal(t, e.ID(), strconv.Itoa(m.Sequence))
+		seen[e.ID()] = true
 	}
+	assert.Equal(t, map[string]bool{"0": true, "1": true, "2": true}, seen)
 }
 
 func TestAdapterMain(t *testing.T) {
@@ -69,10 +106,13 @@ func TestAdapterMain(t *testing.T) {
 	// environment var t.Name() is set to "main"
 	// (see https://talks.golang.org/2014/testing.slide#23)
 	if os.Getenv(t.Name()) == "main" {
-		adapter.Main("sample-source", NewEnv, NewAdapter)
+		adapter.Main("mqtt-source", NewEnv, NewAdapter)
 		return
 	}
 
+	b := newBroker(t)
+	defer b.close()
+
 	// Set up a test sink to receive from the adapter.
 	sink := newSink(t)
 	defer sink.close()
@@ -82,7 +122,8 @@ func TestAdapterMain(t *testing.T) {
 	cmd.Env = append(os.Environ(),
 		t.Name()+"=main",
 		"K_SINK="+sink.URL(),
-		"INTERVAL="+"1ms",
+		"MQTT_BROKER_URL="+b.URL(),
+		"MQTT_TOPICS=sensors/+",
 		"NAMESPACE=namespace",
 		"NAME=name",
 		`K_METRICS_CONFIG={"domain":"x", "component":"x", "prometheusport":0, "configmap":{}}`,
@@ -93,7 +134,8 @@ func TestAdapterMain(t *testing.T) {
 		t.Error(err)
 	}
 	defer func() { cmd.Process.Kill(); cmd.Wait() }()
-	verify(t, sink.received)
+	publish(t, b)
+	verify(t, b, sink.received)
 }
 
 type sink struct {
@@ -107,8 +149,7 @@ type sink struct {
 
 func newSink(t *testing.T) *sink {
 	s := &sink{received: make(chan cloudevents.Event)}
-	//s.ctx, s.close = context.WithTimeout(context.Background(), 5*time.Second)
-	s.ctx, s.close = context.WithTimeout(context.Background(), 1500*time.Millisecond)
+	s.ctx, s.close = context.WithTimeout(context.Background(), 10*time.Second)
 	var err error
 	s.listener, err = net.Listen("tcp", ":0")
 	require.NoError(t, err)
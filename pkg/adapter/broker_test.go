@@ -0,0 +1,149 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package adapter
+
+import (
+	"bytes"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/eclipse/paho.golang/packets"
+	"github.com/stretchr/testify/require"
+)
+
+// broker is a minimal in-process MQTT 5 broker. It accepts any client,
+// records subscriptions and delivers the messages injected with publish.
+type broker struct {
+	listener   net.Listener
+	subscribed chan string
+
+	mu    sync.Mutex
+	conns map[net.Conn][]string
+}
+
+func newBroker(t *testing.T) *broker {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	b := &broker{
+		listener:   l,
+		subscribed: make(chan string, 10),
+		conns:      make(map[net.Conn][]string),
+	}
+	go b.serve()
+	return b
+}
+
+func (b *broker) URL() string { return "tcp://" + b.listener.Addr().String() }
+
+func (b *broker) close() {
+	b.listener.Close()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for c := range b.conns {
+		c.Close()
+	}
+}
+
+func (b *broker) serve() {
+	for {
+		c, err := b.listener.Accept()
+		if err != nil {
+			return
+		}
+		go b.handle(c)
+	}
+}
+
+func (b *broker) handle(c net.Conn) {
+	defer func() {
+		b.mu.Lock()
+		delete(b.conns, c)
+		b.mu.Unlock()
+		c.Close()
+	}()
+	for {
+		cp, err := packets.ReadPacket(c)
+		if err != nil {
+			return
+		}
+		switch p := cp.Content.(type) {
+		case *packets.Connect:
+			b.mu.Lock()
+			b.conns[c] = nil
+			b.mu.Unlock()
+			b.write(c, &packets.Connack{Properties: &packets.Properties{}})
+		case *packets.Subscribe:
+			sa := &packets.Suback{PacketID: p.PacketID, Properties: &packets.Properties{}}
+			b.mu.Lock()
+			for t := range p.Subscriptions {
+				b.conns[c] = append(b.conns[c], t)
+				sa.Reasons = append(sa.Reasons, 0)
+			}
+			b.mu.Unlock()
+			b.write(c, sa)
+			for t := range p.Subscriptions {
+				b.subscribed <- t
+			}
+		case *packets.Pingreq:
+			b.write(c, &packets.Pingresp{})
+		case *packets.Disconnect:
+			return
+		}
+	}
+}
+
+// publish delivers a QoS 0 message to every client subscribed to topic.
+func (b *broker) publish(topic string, payload []byte, user map[string]string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for c, filters := range b.conns {
+		for _, f := range filters {
+			if match(f, topic) {
+				b.write(c, &packets.Publish{
+					Topic:      topic,
+					Payload:    payload,
+					Properties: &packets.Properties{User: user},
+				})
+				break
+			}
+		}
+	}
+}
+
+// write sends p in a single Write so concurrent writers do not interleave.
+func (b *broker) write(c net.Conn, p packets.Packet) {
+	var buf bytes.Buffer
+	p.WriteTo(&buf)
+	c.Write(buf.Bytes())
+}
+
+func match(filter, topic string) bool {
+	f, t := strings.Split(filter, "/"), strings.Split(topic, "/")
+	for i, level := range f {
+		switch {
+		case level == "#":
+			return true
+		case i >= len(t):
+			return false
+		case level != "+" && level != t[i]:
+			return false
+		}
+	}
+	return len(f) == len(t)
+}
@@ -16,6 +16,16 @@ limitations under the License.
 
 package samples
 
+import "k8s.io/apimachinery/pkg/runtime/schema"
+
 const (
 	GroupName = "samples.knative.dev"
 )
+
+var (
+	// BrokerChannelsResource represents a BrokerChannel.
+	BrokerChannelsResource = schema.GroupResource{
+		Group:    GroupName,
+		Resource: "brokerchannels",
+	}
+)
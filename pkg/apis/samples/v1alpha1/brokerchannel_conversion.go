@@ -0,0 +1,195 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	"knative.dev/pkg/apis"
+	duckv1 "knative.dev/pkg/apis/duck/v1"
+
+	"github.com/ShixiongQi/brokerchannel/pkg/apis/samples/v1beta1"
+)
+
+const (
+	// brokerAddrAnnotation keeps the original brokeraddr when it cannot be
+	// rebuilt from the structured v1beta1 broker, e.g. "tcp://mosquitto".
+	brokerAddrAnnotation = "samples.knative.dev/v1alpha1-brokeraddr"
+
+	// specAnnotation keeps the v1beta1 spec of objects which cannot be
+	// represented in v1alpha1, e.g. with several subscriptions, so that they
+	// survive an update through the v1alpha1 API.
+	specAnnotation = "samples.knative.dev/v1beta1-spec"
+
+	// statusAnnotation keeps the part of the v1beta1 status v1alpha1 has no
+	// fields for, e.g. the resolved routes, so that it survives an update
+	// through the v1alpha1 API.
+	statusAnnotation = "samples.knative.dev/v1beta1-status"
+)
+
+// ConvertTo implements apis.Convertible.
+// Converts source from v1alpha1.BrokerChannel into a higher version.
+func (source *BrokerChannel) ConvertTo(ctx context.Context, obj apis.Convertible) error {
+	switch sink := obj.(type) {
+	case *v1beta1.BrokerChannel:
+		sink.ObjectMeta = *source.ObjectMeta.DeepCopy()
+		if err := source.Spec.ConvertTo(ctx, &sink.Spec, sink.Annotations[specAnnotation]); err != nil {
+			return err
+		}
+		delete(sink.Annotations, specAnnotation)
+		sink.Status = v1beta1.BrokerChannelStatus{}
+		if s := sink.Annotations[statusAnnotation]; s != "" {
+			if err := json.Unmarshal([]byte(s), &sink.Status); err != nil {
+				return fmt.Errorf("invalid %s annotation: %w", statusAnnotation, err)
+			}
+		}
+		delete(sink.Annotations, statusAnnotation)
+		if addr := brokerAddrFrom(sink.Spec.Broker); addr != source.Spec.BrokerAddr {
+			if sink.Annotations == nil {
+				sink.Annotations = make(map[string]string, 1)
+			}
+			sink.Annotations[brokerAddrAnnotation] = source.Spec.BrokerAddr
+		}
+		if len(sink.Annotations) == 0 {
+			sink.Annotations = nil
+		}
+		sink.Status.SourceStatus = *source.Status.SourceStatus.DeepCopy()
+		return nil
+	default:
+		return fmt.Errorf("unknown version, got: %T", sink)
+	}
+}
+
+// ConvertTo converts source into sink. base is the JSON of a v1beta1 spec
+// saved by ConvertFrom, it provides the fields v1alpha1 does not have.
+func (source *BrokerChannelSpec) ConvertTo(ctx context.Context, sink *v1beta1.BrokerChannelSpec, base string) error {
+	if base != "" {
+		if err := json.Unmarshal([]byte(base), sink); err != nil {
+			return fmt.Errorf("invalid %s annotation: %w", specAnnotation, err)
+		}
+	}
+	sink.Broker = nil
+	if source.BrokerAddr != "" || source.BrokerPort != 0 {
+		// An inline broker replaces the brokerRef kept in the base.
+		sink.BrokerRef = nil
+		sink.Broker = &v1beta1.BrokerSpec{
+			Host: source.BrokerHost(),
+			Port: int32(source.BrokerPort),
+			TLS:  source.IsTLS(),
+		}
+	}
+	switch {
+	case source.Topic == "":
+		sink.Subscriptions = nil
+	case len(sink.Subscriptions) == 0:
+		sink.Subscriptions = []v1beta1.Subscription{{Topic: source.Topic}}
+	default:
+		sink.Subscriptions[0].Topic = source.Topic
+	}
+	sink.SourceSpec = *source.SourceSpec.DeepCopy()
+	return nil
+}
+
+// ConvertFrom implements apis.Convertible.
+// Converts obj from a higher version into v1alpha1.BrokerChannel.
+func (sink *BrokerChannel) ConvertFrom(ctx context.Context, obj apis.Convertible) error {
+	switch source := obj.(type) {
+	case *v1beta1.BrokerChannel:
+		sink.ObjectMeta = *source.ObjectMeta.DeepCopy()
+		sink.Spec.ConvertFrom(ctx, &source.Spec, source.Annotations[brokerAddrAnnotation])
+		delete(sink.Annotations, brokerAddrAnnotation)
+
+		// Keep what v1alpha1 cannot express.
+		var roundTrip v1beta1.BrokerChannelSpec
+		if err := sink.Spec.ConvertTo(ctx, &roundTrip, ""); err != nil {
+			return err
+		}
+		if !equality.Semantic.DeepEqual(roundTrip, source.Spec) {
+			b, err := json.Marshal(source.Spec)
+			if err != nil {
+				return err
+			}
+			if sink.Annotations == nil {
+				sink.Annotations = make(map[string]string, 1)
+			}
+			sink.Annotations[specAnnotation] = string(b)
+		}
+		extra := source.Status.DeepCopy()
+		extra.SourceStatus = duckv1.SourceStatus{}
+		if !equality.Semantic.DeepEqual(*extra, v1beta1.BrokerChannelStatus{}) {
+			b, err := json.Marshal(extra)
+			if err != nil {
+				return err
+			}
+			if sink.Annotations == nil {
+				sink.Annotations = make(map[string]string, 1)
+			}
+			sink.Annotations[statusAnnotation] = string(b)
+		}
+		if len(sink.Annotations) == 0 {
+			sink.Annotations = nil
+		}
+		sink.Status = BrokerChannelStatus{
+			SourceStatus: *source.Status.SourceStatus.DeepCopy(),
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown version, got: %T", source)
+	}
+}
+
+// ConvertFrom converts source into sink. brokerAddr is the original
+// brokeraddr saved by ConvertTo, it is used as long as it still designates
+// the same broker.
+func (sink *BrokerChannelSpec) ConvertFrom(ctx context.Context, source *v1beta1.BrokerChannelSpec, brokerAddr string) {
+	sink.BrokerAddr = brokerAddrFrom(source.Broker)
+	sink.BrokerPort = 0
+	if source.Broker != nil {
+		if brokerAddr != "" {
+			saved := BrokerChannelSpec{BrokerAddr: brokerAddr}
+			if saved.BrokerHost() == source.Broker.Host && saved.IsTLS() == source.Broker.TLS {
+				sink.BrokerAddr = brokerAddr
+			}
+		}
+		sink.BrokerPort = int(source.Broker.Port)
+	}
+	sink.Topic = ""
+	if len(source.Subscriptions) > 0 {
+		sink.Topic = source.Subscriptions[0].Topic
+	}
+	sink.SourceSpec = *source.SourceSpec.DeepCopy()
+}
+
+// brokerAddrFrom returns the v1alpha1 brokeraddr of broker, which is empty
+// when the broker is referenced instead.
+func brokerAddrFrom(broker *v1beta1.BrokerSpec) string {
+	if broker == nil {
+		return ""
+	}
+	if !broker.TLS {
+		return broker.Host
+	}
+	host := broker.Host
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	return "ssl://" + host
+}
@@ -0,0 +1,198 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"knative.dev/pkg/apis"
+	duckv1 "knative.dev/pkg/apis/duck/v1"
+
+	"github.com/ShixiongQi/brokerchannel/pkg/apis/samples/v1beta1"
+)
+
+func TestBrokerChannelConversionRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		spec BrokerChannelSpec
+		want *v1beta1.BrokerSpec
+	}{{
+		name: "IP",
+		spec: BrokerChannelSpec{BrokerAddr: "10.244.1.61", BrokerPort: 1883, Topic: "motion", SourceSpec: validSink},
+		want: &v1beta1.BrokerSpec{Host: "10.244.1.61", Port: 1883},
+	}, {
+		name: "TLS URL",
+		spec: BrokerChannelSpec{BrokerAddr: "ssl://mosquitto:8883", BrokerPort: 8883, Topic: "sensors/#", SourceSpec: validSink},
+		want: &v1beta1.BrokerSpec{Host: "mosquitto", Port: 8883, TLS: true},
+	}, {
+		name: "TCP URL",
+		spec: BrokerChannelSpec{BrokerAddr: "tcp://mosquitto", BrokerPort: 1883, Topic: "motion", SourceSpec: validSink},
+		want: &v1beta1.BrokerSpec{Host: "mosquitto", Port: 1883},
+	}, {
+		name: "IPv6 TLS URL",
+		spec: BrokerChannelSpec{BrokerAddr: "mqtts://[fd00::1]", BrokerPort: 8883, Topic: "motion", SourceSpec: validSink},
+		want: &v1beta1.BrokerSpec{Host: "fd00::1", Port: 8883, TLS: true},
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			source := &BrokerChannel{
+				ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "default"},
+				Spec:       tc.spec,
+			}
+			source.Status.MarkSink(nil)
+
+			beta := &v1beta1.BrokerChannel{}
+			if err := source.ConvertTo(context.Background(), beta); err != nil {
+				t.Fatal("ConvertTo() =", err)
+			}
+			if !cmp.Equal(beta.Spec.Broker, tc.want) {
+				t.Error("Broker (-want, +got):", cmp.Diff(tc.want, beta.Spec.Broker))
+			}
+
+			got := &BrokerChannel{}
+			if err := got.ConvertFrom(context.Background(), beta); err != nil {
+				t.Fatal("ConvertFrom() =", err)
+			}
+			if !cmp.Equal(source, got) {
+				t.Error("Round trip (-want, +got):", cmp.Diff(source, got))
+			}
+		})
+	}
+}
+
+func TestBrokerChannelConversionKeepsV1beta1Fields(t *testing.T) {
+	source := &v1beta1.BrokerChannel{
+		ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "default"},
+		Spec: v1beta1.BrokerChannelSpec{
+			Broker:        &v1beta1.BrokerSpec{Host: "mosquitto", Port: 8883, TLS: true},
+			Subscriptions: []v1beta1.Subscription{{Topic: "motion", QoS: 1}, {Topic: "alarms/#", QoS: 2}},
+			SourceSpec:    validSink,
+		},
+	}
+
+	alpha := &BrokerChannel{}
+	if err := alpha.ConvertFrom(context.Background(), source); err != nil {
+		t.Fatal("ConvertFrom() =", err)
+	}
+	if alpha.Spec.BrokerAddr != "ssl://mosquitto" || alpha.Spec.Topic != "motion" {
+		t.Errorf("ConvertFrom() = %s %s, want ssl://mosquitto motion", alpha.Spec.BrokerAddr, alpha.Spec.Topic)
+	}
+
+	// An update through v1alpha1 changes the first topic only.
+	alpha.Spec.Topic = "sensors/motion"
+	got := &v1beta1.BrokerChannel{}
+	if err := alpha.ConvertTo(context.Background(), got); err != nil {
+		t.Fatal("ConvertTo() =", err)
+	}
+	want := source.DeepCopy()
+	want.Spec.Subscriptions[0].Topic = "sensors/motion"
+	if !cmp.Equal(want, got) {
+		t.Error("Round trip (-want, +got):", cmp.Diff(want, got))
+	}
+}
+
+func TestBrokerChannelConversionKeepsV1beta1Status(t *testing.T) {
+	source := &v1beta1.BrokerChannel{
+		ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "default"},
+		Spec: v1beta1.BrokerChannelSpec{
+			Broker:        &v1beta1.BrokerSpec{Host: "mosquitto", Port: 1883},
+			Subscriptions: []v1beta1.Subscription{{Topic: "motion"}},
+			SourceSpec:    validSink,
+		},
+		Status: v1beta1.BrokerChannelStatus{
+			SourceStatus: duckv1.SourceStatus{SinkURI: apis.HTTP("helloworld-go.default.svc.cluster.local")},
+			Routes: []v1beta1.RouteStatus{
+				{Name: "alarms", URI: apis.HTTP("alarms.default.svc.cluster.local")},
+			},
+			DeadLetterSinkURI: apis.HTTP("dls.default.svc.cluster.local"),
+			Buffer:            &v1beta1.BufferStatus{Messages: 3, Bytes: 42},
+			CircuitBreakers: []v1beta1.CircuitBreakerStatus{{
+				URI:   apis.HTTP("alarms.default.svc.cluster.local"),
+				State: v1beta1.CircuitBreakerOpen,
+				Since: metav1.Unix(1600000000, 0),
+			}},
+		},
+	}
+
+	alpha := &BrokerChannel{}
+	if err := alpha.ConvertFrom(context.Background(), source); err != nil {
+		t.Fatal("ConvertFrom() =", err)
+	}
+	if !cmp.Equal(source.Status.SourceStatus, alpha.Status.SourceStatus) {
+		t.Error("ConvertFrom() status (-want, +got):", cmp.Diff(source.Status.SourceStatus, alpha.Status.SourceStatus))
+	}
+
+	got := &v1beta1.BrokerChannel{}
+	if err := alpha.ConvertTo(context.Background(), got); err != nil {
+		t.Fatal("ConvertTo() =", err)
+	}
+	if !cmp.Equal(source, got) {
+		t.Error("Round trip (-want, +got):", cmp.Diff(source, got))
+	}
+}
+
+func TestBrokerChannelConversionKeepsBrokerRef(t *testing.T) {
+	source := &v1beta1.BrokerChannel{
+		ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "default"},
+		Spec: v1beta1.BrokerChannelSpec{
+			BrokerRef:     &corev1.LocalObjectReference{Name: "mosquitto"},
+			Subscriptions: []v1beta1.Subscription{{Topic: "motion"}},
+			SourceSpec:    validSink,
+		},
+	}
+
+	alpha := &BrokerChannel{}
+	if err := alpha.ConvertFrom(context.Background(), source); err != nil {
+		t.Fatal("ConvertFrom() =", err)
+	}
+	if alpha.Spec.BrokerAddr != "" {
+		t.Errorf("ConvertFrom() brokeraddr = %q, want none", alpha.Spec.BrokerAddr)
+	}
+
+	got := &v1beta1.BrokerChannel{}
+	if err := alpha.ConvertTo(context.Background(), got); err != nil {
+		t.Fatal("ConvertTo() =", err)
+	}
+	if !cmp.Equal(source, got) {
+		t.Error("Round trip (-want, +got):", cmp.Diff(source, got))
+	}
+
+	// Setting a brokeraddr through v1alpha1 replaces the reference.
+	alpha.Spec.BrokerAddr, alpha.Spec.BrokerPort = "emqx", 1883
+	if err := alpha.ConvertTo(context.Background(), got); err != nil {
+		t.Fatal("ConvertTo() =", err)
+	}
+	if want := (&v1beta1.BrokerSpec{Host: "emqx", Port: 1883}); got.Spec.BrokerRef != nil || !cmp.Equal(want, got.Spec.Broker) {
+		t.Errorf("ConvertTo() = %v %v, want broker %v", got.Spec.BrokerRef, got.Spec.Broker, want)
+	}
+}
+
+func TestBrokerChannelConversionBadType(t *testing.T) {
+	good, bad := &BrokerChannel{}, &BrokerChannel{}
+
+	if err := good.ConvertTo(context.Background(), bad); err == nil {
+		t.Errorf("ConvertTo() = %#v, wanted error", bad)
+	}
+	if err := good.ConvertFrom(context.Background(), bad); err == nil {
+		t.Errorf("ConvertFrom() = %#v, wanted error", good)
+	}
+}
@@ -18,15 +18,35 @@ package v1alpha1
 
 import (
 	"context"
+	"strconv"
+
+	"knative.dev/pkg/apis"
 )
 
-// SetDefaults mutates SampleSource.
+// SetDefaults mutates BrokerChannel.
 func (bc *BrokerChannel) SetDefaults(ctx context.Context) {
-	//Add code for Mutating admission webhook.
-
-	// call SetDefaults against duckv1.Destination with a context of ObjectMeta of SampleSource.
+	// call SetDefaults against duckv1.Destination with a context of ObjectMeta of BrokerChannel.
+	ctx = apis.WithinParent(ctx, bc.ObjectMeta)
 	bc.Spec.SetDefaults(ctx)
 }
 
 func (bcs *BrokerChannelSpec) SetDefaults(ctx context.Context) {
+	if bcs.BrokerPort == 0 {
+		bcs.BrokerPort = bcs.defaultPort()
+	}
+	bcs.Sink.SetDefaults(ctx)
+}
+
+// defaultPort returns the port of a BrokerAddr URL, or the IANA port of the
+// protocol used to reach the broker.
+func (bcs *BrokerChannelSpec) defaultPort() int {
+	if u, err := parseBrokerURL(bcs.BrokerAddr); err == nil && u != nil && u.Port() != "" {
+		if port, err := strconv.Atoi(u.Port()); err == nil {
+			return port
+		}
+	}
+	if bcs.IsTLS() {
+		return DefaultTLSBrokerPort
+	}
+	return DefaultBrokerPort
 }
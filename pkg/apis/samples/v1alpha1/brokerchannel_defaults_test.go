@@ -0,0 +1,92 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	duckv1 "knative.dev/pkg/apis/duck/v1"
+)
+
+func TestBrokerChannelDefaults(t *testing.T) {
+	tests := []struct {
+		name string
+		in   BrokerChannelSpec
+		want BrokerChannelSpec
+	}{{
+		name: "plain TCP",
+		in:   BrokerChannelSpec{BrokerAddr: "mosquitto"},
+		want: BrokerChannelSpec{BrokerAddr: "mosquitto", BrokerPort: DefaultBrokerPort},
+	}, {
+		name: "TLS",
+		in:   BrokerChannelSpec{BrokerAddr: "mqtts://mosquitto"},
+		want: BrokerChannelSpec{BrokerAddr: "mqtts://mosquitto", BrokerPort: DefaultTLSBrokerPort},
+	}, {
+		name: "port from URL",
+		in:   BrokerChannelSpec{BrokerAddr: "tcp://mosquitto:11883"},
+		want: BrokerChannelSpec{BrokerAddr: "tcp://mosquitto:11883", BrokerPort: 11883},
+	}, {
+		name: "explicit port",
+		in:   BrokerChannelSpec{BrokerAddr: "ssl://mosquitto", BrokerPort: 443},
+		want: BrokerChannelSpec{BrokerAddr: "ssl://mosquitto", BrokerPort: 443},
+	}, {
+		name: "sink namespace",
+		in: BrokerChannelSpec{
+			BrokerAddr: "mosquitto",
+			SourceSpec: duckv1.SourceSpec{Sink: duckv1.Destination{Ref: &duckv1.KReference{Kind: "Service", Name: "svc"}}},
+		},
+		want: BrokerChannelSpec{
+			BrokerAddr: "mosquitto",
+			BrokerPort: DefaultBrokerPort,
+			SourceSpec: duckv1.SourceSpec{Sink: duckv1.Destination{Ref: &duckv1.KReference{Kind: "Service", Name: "svc", Namespace: "ns"}}},
+		},
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			bc := &BrokerChannel{ObjectMeta: metav1.ObjectMeta{Namespace: "ns"}, Spec: tc.in}
+			bc.SetDefaults(context.Background())
+			if diff := cmp.Diff(tc.want, bc.Spec); diff != "" {
+				t.Errorf("SetDefaults() (-want, +got) = %s", diff)
+			}
+		})
+	}
+}
+
+func TestBrokerChannelAddress(t *testing.T) {
+	tests := []struct {
+		spec    BrokerChannelSpec
+		address string
+		tls     bool
+	}{
+		{BrokerChannelSpec{BrokerAddr: "10.244.1.61", BrokerPort: 1883}, "10.244.1.61:1883", false},
+		{BrokerChannelSpec{BrokerAddr: "fd00::1", BrokerPort: 1883}, "[fd00::1]:1883", false},
+		{BrokerChannelSpec{BrokerAddr: "ssl://mosquitto:8883", BrokerPort: 8883}, "mosquitto:8883", true},
+		{BrokerChannelSpec{BrokerAddr: "tcp://mosquitto", BrokerPort: 1883}, "mosquitto:1883", false},
+	}
+	for _, tc := range tests {
+		if got := tc.spec.Address(); got != tc.address {
+			t.Errorf("Address() = %q, want %q", got, tc.address)
+		}
+		if got := tc.spec.IsTLS(); got != tc.tls {
+			t.Errorf("IsTLS(%q) = %v, want %v", tc.spec.BrokerAddr, got, tc.tls)
+		}
+	}
+}
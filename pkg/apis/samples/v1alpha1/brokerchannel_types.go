@@ -17,9 +17,15 @@ limitations under the License.
 package v1alpha1
 
 import (
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"knative.dev/pkg/apis"
 	"knative.dev/pkg/apis/duck"
 	duckv1 "knative.dev/pkg/apis/duck/v1"
@@ -28,7 +34,6 @@ import (
 )
 
 // +genclient
-// +genreconciler
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
 type BrokerChannel struct {
 	metav1.TypeMeta `json:",inline"`
@@ -66,9 +71,13 @@ var (
 
 // SampleSourceSpec holds the desired state of the SampleSource (from the client).
 type BrokerChannelSpec struct {
+	// BrokerAddr is the hostname or IP address of the MQTT broker, or a URL
+	// such as "ssl://mosquitto:8883" whose scheme selects TLS.
 	BrokerAddr string `json:"brokeraddr"`
+	// BrokerPort defaults to 1883, or 8883 when the broker is reached over TLS.
 	// +optional
 	BrokerPort int `json:"brokerport"`
+	// Topic is the MQTT topic filter to subscribe to.
 	Topic string `json:"topic"`
 	// +optional
 	duckv1.SourceSpec `json:",inline"`
@@ -101,3 +110,51 @@ type BrokerChannelList struct {
 func (bc *BrokerChannel) GetStatus() *duckv1.Status {
 	return &bc.Status.Status
 }
+
+const (
+	// DefaultBrokerPort is the IANA port for MQTT over TCP.
+	DefaultBrokerPort = 1883
+	// DefaultTLSBrokerPort is the IANA port for MQTT over TLS.
+	DefaultTLSBrokerPort = 8883
+)
+
+// BrokerScheme returns the URL scheme of BrokerAddr, or "tcp" when
+// BrokerAddr is a plain hostname or IP address.
+func (bcs *BrokerChannelSpec) BrokerScheme() string {
+	if u, err := parseBrokerURL(bcs.BrokerAddr); err == nil && u != nil {
+		return u.Scheme
+	}
+	return "tcp"
+}
+
+// IsTLS returns true if the broker is reached over TLS, that is when
+// BrokerAddr is a URL with an ssl, tls or mqtts scheme.
+func (bcs *BrokerChannelSpec) IsTLS() bool {
+	return tlsSchemes.Has(bcs.BrokerScheme())
+}
+
+// BrokerHost returns the hostname or IP address of the broker.
+func (bcs *BrokerChannelSpec) BrokerHost() string {
+	if u, err := parseBrokerURL(bcs.BrokerAddr); err == nil && u != nil {
+		return u.Hostname()
+	}
+	return bcs.BrokerAddr
+}
+
+// Address returns the host:port the data plane dials to reach the broker.
+func (bcs *BrokerChannelSpec) Address() string {
+	return net.JoinHostPort(bcs.BrokerHost(), strconv.Itoa(bcs.BrokerPort))
+}
+
+var (
+	tlsSchemes    = sets.NewString("ssl", "tls", "mqtts")
+	brokerSchemes = sets.NewString("tcp", "mqtt").Union(tlsSchemes)
+)
+
+// parseBrokerURL returns the URL held in addr, or nil if addr is not a URL.
+func parseBrokerURL(addr string) (*url.URL, error) {
+	if !strings.Contains(addr, "://") {
+		return nil, nil
+	}
+	return url.Parse(addr)
+}
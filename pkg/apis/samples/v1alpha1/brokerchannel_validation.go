@@ -2,16 +2,107 @@ package v1alpha1
 
 import (
 	"context"
+	"fmt"
+	"net"
+	"strconv"
+
+	"k8s.io/apimachinery/pkg/util/validation"
 	"knative.dev/pkg/apis"
+
+	"github.com/ShixiongQi/brokerchannel/pkg/apis/samples/v1beta1"
+	"github.com/ShixiongQi/brokerchannel/pkg/mqtt"
 )
 
+// Validate validates the BrokerChannel. The broker may change, the data
+// plane then reconnects.
 func (bc *BrokerChannel) Validate(ctx context.Context) *apis.FieldError {
-	return bc.Spec.Validate(ctx).ViaField("spec")
+	errs := bc.Spec.Validate(ctx).ViaField("spec")
+
+	if apis.IsInUpdate(ctx) {
+		original := apis.GetBaseline(ctx).(*BrokerChannel)
+		errs = errs.Also(bc.CheckImmutableFields(ctx, original))
+	}
+	return errs
+}
+
+// CheckImmutableFields rejects the changes rejected by v1beta1, to the fields
+// kept in the annotation of the v1beta1 spec.
+func (bc *BrokerChannel) CheckImmutableFields(ctx context.Context, original *BrokerChannel) *apis.FieldError {
+	if original == nil {
+		return nil
+	}
+
+	before, after := &v1beta1.BrokerChannel{}, &v1beta1.BrokerChannel{}
+	if err := original.ConvertTo(ctx, before); err != nil {
+		return apis.ErrGeneric(err.Error(), "metadata.annotations")
+	}
+	if err := bc.ConvertTo(ctx, after); err != nil {
+		return apis.ErrGeneric(err.Error(), "metadata.annotations")
+	}
+	return after.CheckImmutableFields(ctx, before)
 }
 
 func (bcs *BrokerChannelSpec) Validate(ctx context.Context) *apis.FieldError {
 	var errs *apis.FieldError
 
+	if bcs.BrokerAddr == "" {
+		errs = errs.Also(apis.ErrMissingField("brokeraddr"))
+	} else if err := validateBrokerAddr(bcs.BrokerAddr); err != nil {
+		fe := apis.ErrInvalidValue(bcs.BrokerAddr, "brokeraddr")
+		fe.Details = err.Error()
+		errs = errs.Also(fe)
+	} else if u, _ := parseBrokerURL(bcs.BrokerAddr); u != nil && u.Port() != "" && bcs.BrokerPort != 0 &&
+		u.Port() != strconv.Itoa(bcs.BrokerPort) {
+		errs = errs.Also(&apis.FieldError{
+			Message: fmt.Sprintf("port %s of brokeraddr does not match brokerport %d", u.Port(), bcs.BrokerPort),
+			Paths:   []string{"brokeraddr", "brokerport"},
+		})
+	}
+
+	// A zero port is replaced by the defaulting webhook.
+	if bcs.BrokerPort < 0 || bcs.BrokerPort > 65535 {
+		errs = errs.Also(apis.ErrOutOfBoundsValue(bcs.BrokerPort, 1, 65535, "brokerport"))
+	}
+
+	if bcs.Topic == "" {
+		errs = errs.Also(apis.ErrMissingField("topic"))
+	} else if err := mqtt.ValidateTopicFilter(bcs.Topic); err != nil {
+		fe := apis.ErrInvalidValue(bcs.Topic, "topic")
+		fe.Details = err.Error()
+		errs = errs.Also(fe)
+	}
+
 	errs = errs.Also(bcs.Sink.Validate(ctx).ViaField("sink"))
 	return errs
 }
+
+// validateBrokerAddr accepts a hostname, an IP address or a URL with one of
+// the supported schemes.
+func validateBrokerAddr(addr string) error {
+	u, err := parseBrokerURL(addr)
+	if err != nil {
+		return err
+	}
+	host := addr
+	if u != nil {
+		if !brokerSchemes.Has(u.Scheme) {
+			return fmt.Errorf("unsupported scheme %q, must be one of %v", u.Scheme, brokerSchemes.List())
+		}
+		if u.Path != "" && u.Path != "/" || u.RawQuery != "" || u.Fragment != "" {
+			return fmt.Errorf("broker URL must not have a path, query or fragment")
+		}
+		if p := u.Port(); p != "" {
+			if port, err := strconv.Atoi(p); err != nil || port < 1 || port > 65535 {
+				return fmt.Errorf("invalid port %q", p)
+			}
+		}
+		host = u.Hostname()
+	}
+	if net.ParseIP(host) != nil {
+		return nil
+	}
+	if len(validation.IsDNS1123Subdomain(host)) != 0 {
+		return fmt.Errorf("%q is neither an IP address nor a hostname", host)
+	}
+	return nil
+}
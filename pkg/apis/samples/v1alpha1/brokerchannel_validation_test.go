@@ -0,0 +1,136 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"context"
+	"testing"
+
+	"knative.dev/pkg/apis"
+	duckv1 "knative.dev/pkg/apis/duck/v1"
+
+	"github.com/ShixiongQi/brokerchannel/pkg/apis/samples/v1beta1"
+)
+
+var validSink = duckv1.SourceSpec{
+	Sink: duckv1.Destination{
+		Ref: &duckv1.KReference{
+			APIVersion: "v1",
+			Kind:       "Service",
+			Name:       "helloworld-go",
+			Namespace:  "default",
+		},
+	},
+}
+
+func TestBrokerChannelSpecValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		spec BrokerChannelSpec
+		want string
+	}{{
+		name: "valid IP",
+		spec: BrokerChannelSpec{BrokerAddr: "10.244.1.61", BrokerPort: 1883, Topic: "motion", SourceSpec: validSink},
+	}, {
+		name: "valid hostname",
+		spec: BrokerChannelSpec{BrokerAddr: "mosquitto.default.svc", BrokerPort: 1883, Topic: "sensors/+/motion", SourceSpec: validSink},
+	}, {
+		name: "valid URL",
+		spec: BrokerChannelSpec{BrokerAddr: "ssl://mosquitto:8883", BrokerPort: 8883, Topic: "sensors/#", SourceSpec: validSink},
+	}, {
+		name: "valid IPv6",
+		spec: BrokerChannelSpec{BrokerAddr: "fd00::1", BrokerPort: 1883, Topic: "motion", SourceSpec: validSink},
+	}, {
+		name: "missing fields",
+		spec: BrokerChannelSpec{SourceSpec: validSink},
+		want: "missing field(s): brokeraddr, topic",
+	}, {
+		name: "invalid hostname",
+		spec: BrokerChannelSpec{BrokerAddr: "mosquitto_broker", BrokerPort: 1883, Topic: "motion", SourceSpec: validSink},
+		want: "invalid value: mosquitto_broker: brokeraddr\n\"mosquitto_broker\" is neither an IP address nor a hostname",
+	}, {
+		name: "unsupported scheme",
+		spec: BrokerChannelSpec{BrokerAddr: "http://mosquitto", BrokerPort: 1883, Topic: "motion", SourceSpec: validSink},
+		want: "invalid value: http://mosquitto: brokeraddr\nunsupported scheme \"http\", must be one of [mqtt mqtts ssl tcp tls]",
+	}, {
+		name: "conflicting ports",
+		spec: BrokerChannelSpec{BrokerAddr: "tcp://mosquitto:1884", BrokerPort: 1883, Topic: "motion", SourceSpec: validSink},
+		want: "port 1884 of brokeraddr does not match brokerport 1883: brokeraddr, brokerport",
+	}, {
+		name: "port out of range",
+		spec: BrokerChannelSpec{BrokerAddr: "mosquitto", BrokerPort: 65536, Topic: "motion", SourceSpec: validSink},
+		want: "expected 1 <= 65536 <= 65535: brokerport",
+	}, {
+		name: "multi-level wildcard not last",
+		spec: BrokerChannelSpec{BrokerAddr: "mosquitto", BrokerPort: 1883, Topic: "sensors/#/motion", SourceSpec: validSink},
+		want: "invalid value: sensors/#/motion: topic\n\"#\" must occupy the last level of the filter",
+	}, {
+		name: "partial single-level wildcard",
+		spec: BrokerChannelSpec{BrokerAddr: "mosquitto", BrokerPort: 1883, Topic: "sensors/mo+", SourceSpec: validSink},
+		want: "invalid value: sensors/mo+: topic\n\"+\" must occupy an entire level of the filter",
+	}, {
+		name: "missing sink",
+		spec: BrokerChannelSpec{BrokerAddr: "mosquitto", BrokerPort: 1883, Topic: "motion"},
+		want: "expected at least one, got none: sink.ref, sink.uri",
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := tc.spec.Validate(context.Background())
+			if got.Error() != tc.want {
+				t.Errorf("Validate() = %q, want %q", got.Error(), tc.want)
+			}
+		})
+	}
+}
+
+func TestBrokerChannelImmutableFields(t *testing.T) {
+	original := &BrokerChannel{
+		Spec: BrokerChannelSpec{BrokerAddr: "mosquitto", BrokerPort: 1883, Topic: "motion", SourceSpec: validSink},
+	}
+
+	topicChanged := original.DeepCopy()
+	topicChanged.Spec.Topic = "sensors/#"
+	ctx := apis.WithinUpdate(context.Background(), original)
+	if err := topicChanged.Validate(ctx); err != nil {
+		t.Errorf("Validate() = %v, wanted topic to be mutable", err)
+	}
+
+	brokerChanged := original.DeepCopy()
+	brokerChanged.Spec.BrokerAddr = "emqx"
+	if err := brokerChanged.Validate(ctx); err != nil {
+		t.Errorf("Validate() = %v, wanted brokeraddr to be mutable", err)
+	}
+
+	shared := &BrokerChannel{}
+	if err := shared.ConvertFrom(ctx, &v1beta1.BrokerChannel{
+		Spec: v1beta1.BrokerChannelSpec{
+			Broker:           &v1beta1.BrokerSpec{Host: "mosquitto", Port: 1883},
+			Subscriptions:    []v1beta1.Subscription{{Topic: "motion", QoS: 1}},
+			SubscriptionMode: v1beta1.SharedSubscriptions,
+			SourceSpec:       validSink,
+		},
+	}); err != nil {
+		t.Fatal("ConvertFrom() =", err)
+	}
+	modeChanged := shared.DeepCopy()
+	modeChanged.Annotations = nil
+	ctx = apis.WithinUpdate(context.Background(), shared)
+	if err := modeChanged.Validate(ctx); err == nil {
+		t.Error("Validate() = nil, wanted an error for a changed subscriptionMode")
+	}
+}
@@ -0,0 +1,97 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"knative.dev/pkg/apis"
+)
+
+// SetDefaults mutates BrokerChannel.
+func (bc *BrokerChannel) SetDefaults(ctx context.Context) {
+	// call SetDefaults against duckv1.Destination with a context of ObjectMeta of BrokerChannel.
+	ctx = apis.WithinParent(ctx, bc.ObjectMeta)
+	bc.Spec.SetDefaults(ctx)
+}
+
+func (bcs *BrokerChannelSpec) SetDefaults(ctx context.Context) {
+	if bcs.Broker != nil {
+		bcs.Broker.SetDefaults(ctx)
+	}
+	bcs.Sink.SetDefaults(ctx)
+	for i := range bcs.Routes {
+		bcs.Routes[i].Destination.SetDefaults(ctx)
+	}
+	if bcs.DeadLetterSink != nil {
+		bcs.DeadLetterSink.SetDefaults(ctx)
+	}
+	if bcs.Buffer != nil {
+		bcs.Buffer.SetDefaults(ctx)
+	}
+	if bcs.RateLimit != nil {
+		bcs.RateLimit.SetDefaults(ctx)
+	}
+	if bcs.SinkAuth != nil && bcs.SinkAuth.Signing != nil {
+		bcs.SinkAuth.Signing.SetDefaults(ctx)
+	}
+	if bcs.Deduplication != nil {
+		bcs.Deduplication.SetDefaults(ctx)
+	}
+}
+
+func (b *Buffer) SetDefaults(ctx context.Context) {
+	if b.MaxSize == nil {
+		size := resource.MustParse(DefaultBufferMaxSize)
+		b.MaxSize = &size
+	}
+	if b.MaxAge == nil {
+		b.MaxAge = &metav1.Duration{Duration: DefaultBufferMaxAge}
+	}
+}
+
+func (d *Deduplication) SetDefaults(ctx context.Context) {
+	if d.TTL == nil {
+		d.TTL = &metav1.Duration{Duration: DefaultDeduplicationTTL}
+	}
+	if d.MaxKeys == 0 {
+		d.MaxKeys = DefaultDeduplicationMaxKeys
+	}
+}
+
+func (rl *RateLimit) SetDefaults(ctx context.Context) {
+	if rl.Burst == 0 {
+		rl.Burst = rl.EventsPerSecond
+	}
+}
+
+func (s *Signing) SetDefaults(ctx context.Context) {
+	if s.Algorithm == "" {
+		s.Algorithm = HMACSHA256
+	}
+}
+
+func (bs *BrokerSpec) SetDefaults(ctx context.Context) {
+	if bs.Port == 0 {
+		bs.Port = DefaultBrokerPort
+		if bs.TLS {
+			bs.Port = DefaultTLSBrokerPort
+		}
+	}
+}
@@ -0,0 +1,143 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"knative.dev/pkg/apis"
+)
+
+var sCondSet = apis.NewLivingConditionSet(BrokerChannelSinkProvided, BrokerChannelBrokerReady, BrokerChannelRoutesResolved, BrokerChannelDeadLetterSinkResolved, BrokerChannelConnected)
+
+const (
+	// BrokerChannelConditionReady has status True when all subconditions below have been set to True.
+	BrokerChannelConditionReady = apis.ConditionReady
+	// BrokerChannelSinkProvided has status True when the sink has been resolved.
+	BrokerChannelSinkProvided apis.ConditionType = "SinkProvided"
+	// BrokerChannelBrokerReady has status True when the referenced MQTTBroker
+	// is ready, or when the broker is given inline.
+	BrokerChannelBrokerReady apis.ConditionType = "BrokerReady"
+	// BrokerChannelRoutesResolved has status True when the destinations of
+	// all the routes have been resolved, or when there is no route.
+	BrokerChannelRoutesResolved apis.ConditionType = "RoutesResolved"
+	// BrokerChannelDeadLetterSinkResolved has status True when the dead
+	// letter sink has been resolved, or when there is none.
+	BrokerChannelDeadLetterSinkResolved apis.ConditionType = "DeadLetterSinkResolved"
+	// BrokerChannelConnected has status True unless the data plane reports
+	// that it could not set up the connection of the BrokerChannel, or that
+	// its session with the broker is down.
+	BrokerChannelConnected apis.ConditionType = "Connected"
+)
+
+// GetConditionSet retrieves the condition set for this resource. Implements the KRShaped interface.
+func (*BrokerChannel) GetConditionSet() apis.ConditionSet {
+	return sCondSet
+}
+
+// GetUntypedSpec returns the spec of the BrokerChannel.
+func (bc *BrokerChannel) GetUntypedSpec() interface{} {
+	return bc.Spec
+}
+
+// GetCondition returns the condition currently associated with the given type, or nil.
+func (bcs *BrokerChannelStatus) GetCondition(t apis.ConditionType) *apis.Condition {
+	return sCondSet.Manage(bcs).GetCondition(t)
+}
+
+// IsReady returns true if the resource is ready overall.
+func (bcs *BrokerChannelStatus) IsReady() bool {
+	return sCondSet.Manage(bcs).IsHappy()
+}
+
+// InitializeConditions sets relevant unset conditions to Unknown state.
+func (bcs *BrokerChannelStatus) InitializeConditions() {
+	sCondSet.Manage(bcs).InitializeConditions()
+}
+
+// MarkSink sets the condition that the source has a sink configured.
+func (bcs *BrokerChannelStatus) MarkSink(uri *apis.URL) {
+	bcs.SinkURI = uri
+	if uri != nil {
+		sCondSet.Manage(bcs).MarkTrue(BrokerChannelSinkProvided)
+	} else {
+		sCondSet.Manage(bcs).MarkUnknown(BrokerChannelSinkProvided,
+			"SinkEmpty", "Sink has resolved to empty.")
+	}
+}
+
+// MarkNoSink sets the condition that the source does not have a sink configured.
+func (bcs *BrokerChannelStatus) MarkNoSink(reason, messageFormat string, messageA ...interface{}) {
+	sCondSet.Manage(bcs).MarkFalse(BrokerChannelSinkProvided, reason, messageFormat, messageA...)
+}
+
+// MarkBrokerReady sets the condition that the broker can be connected to.
+func (bcs *BrokerChannelStatus) MarkBrokerReady() {
+	sCondSet.Manage(bcs).MarkTrue(BrokerChannelBrokerReady)
+}
+
+// MarkNoBroker sets the condition that the referenced MQTTBroker does not exist.
+func (bcs *BrokerChannelStatus) MarkNoBroker(reason, messageFormat string, messageA ...interface{}) {
+	sCondSet.Manage(bcs).MarkFalse(BrokerChannelBrokerReady, reason, messageFormat, messageA...)
+}
+
+// PropagateBrokerStatus mirrors the readiness of the referenced MQTTBroker.
+func (bcs *BrokerChannelStatus) PropagateBrokerStatus(mbs *MQTTBrokerStatus) {
+	PropagateMQTTBrokerStatus(sCondSet.Manage(bcs), BrokerChannelBrokerReady, mbs)
+}
+
+// PropagateDataPlaneStatus copies the status reported by the data plane,
+// nil when it has reported none, and sets the condition that the data plane
+// set up the connection.
+func (bcs *BrokerChannelStatus) PropagateDataPlaneStatus(dps *DataPlaneStatus) {
+	if dps == nil {
+		dps = &DataPlaneStatus{}
+	}
+	bcs.Buffer = dps.Buffer
+	bcs.CircuitBreakers = dps.CircuitBreakers
+	if dps.Error != "" {
+		sCondSet.Manage(bcs).MarkFalse(BrokerChannelConnected, "ConnectionFailed", "%s", dps.Error)
+	} else {
+		sCondSet.Manage(bcs).MarkTrue(BrokerChannelConnected)
+	}
+}
+
+// MarkRoutes sets the condition that the destinations of all the routes have
+// been resolved, to routes.
+func (bcs *BrokerChannelStatus) MarkRoutes(routes []RouteStatus) {
+	bcs.Routes = routes
+	sCondSet.Manage(bcs).MarkTrue(BrokerChannelRoutesResolved)
+}
+
+// MarkNoRoutes sets the condition that the destination of a route could not
+// be resolved. routes holds the routes resolved so far.
+func (bcs *BrokerChannelStatus) MarkNoRoutes(routes []RouteStatus, reason, messageFormat string, messageA ...interface{}) {
+	bcs.Routes = routes
+	sCondSet.Manage(bcs).MarkFalse(BrokerChannelRoutesResolved, reason, messageFormat, messageA...)
+}
+
+// MarkDeadLetterSink sets the condition that the dead letter sink has been
+// resolved to uri, nil when there is none.
+func (bcs *BrokerChannelStatus) MarkDeadLetterSink(uri *apis.URL) {
+	bcs.DeadLetterSinkURI = uri
+	sCondSet.Manage(bcs).MarkTrue(BrokerChannelDeadLetterSinkResolved)
+}
+
+// MarkNoDeadLetterSink sets the condition that the dead letter sink could
+// not be resolved.
+func (bcs *BrokerChannelStatus) MarkNoDeadLetterSink(reason, messageFormat string, messageA ...interface{}) {
+	bcs.DeadLetterSinkURI = nil
+	sCondSet.Manage(bcs).MarkFalse(BrokerChannelDeadLetterSinkResolved, reason, messageFormat, messageA...)
+}
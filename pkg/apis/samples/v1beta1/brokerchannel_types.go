@@ -0,0 +1,608 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"knative.dev/pkg/apis"
+	"knative.dev/pkg/apis/duck"
+	duckv1 "knative.dev/pkg/apis/duck/v1"
+	"knative.dev/pkg/kmeta"
+	"knative.dev/pkg/webhook/resourcesemantics"
+)
+
+// +genclient
+// +genreconciler
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// BrokerChannel forwards the messages of MQTT subscriptions to a sink.
+type BrokerChannel struct {
+	metav1.TypeMeta `json:",inline"`
+	// +optional
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	// Spec holds the desired state of the BrokerChannel (from the client).
+	Spec BrokerChannelSpec `json:"spec,omitempty"`
+
+	// Status communicates the observed state of the BrokerChannel (from the controller).
+	// +optional
+	Status BrokerChannelStatus `json:"status,omitempty"`
+}
+
+// GetGroupVersionKind returns the GroupVersionKind.
+func (*BrokerChannel) GetGroupVersionKind() schema.GroupVersionKind {
+	return SchemeGroupVersion.WithKind("BrokerChannel")
+}
+
+var (
+	// Check that BrokerChannel can be validated and defaulted.
+	_ apis.Defaultable = (*BrokerChannel)(nil)
+	_ apis.Validatable = (*BrokerChannel)(nil)
+	// Check that BrokerChannel can be converted to other versions.
+	_ apis.Convertible = (*BrokerChannel)(nil)
+	// Check that we can create OwnerReferences to a BrokerChannel.
+	_ kmeta.OwnerRefable = (*BrokerChannel)(nil)
+	// Check that BrokerChannel is a runtime.Object.
+	_ runtime.Object = (*BrokerChannel)(nil)
+	// Check that BrokerChannel satisfies resourcesemantics.GenericCRD.
+	_ resourcesemantics.GenericCRD = (*BrokerChannel)(nil)
+	// Check that BrokerChannel implements the Conditions duck type.
+	_ = duck.VerifyType(&BrokerChannel{}, &duckv1.Conditions{})
+	// Check that the type conforms to the duck Knative Resource shape.
+	_ duckv1.KRShaped = (*BrokerChannel)(nil)
+)
+
+// BrokerChannelSpec holds the desired state of the BrokerChannel (from the client).
+type BrokerChannelSpec struct {
+	// Broker describes how to reach the MQTT broker. Exactly one of Broker
+	// and BrokerRef must be set.
+	// +optional
+	Broker *BrokerSpec `json:"broker,omitempty"`
+
+	// BrokerRef names the MQTTBroker, in the namespace of the BrokerChannel,
+	// holding the connection profile of the broker.
+	// +optional
+	BrokerRef *corev1.LocalObjectReference `json:"brokerRef,omitempty"`
+
+	// Subscriptions are the MQTT subscriptions whose messages are sent to
+	// the sink.
+	Subscriptions []Subscription `json:"subscriptions"`
+
+	// SubscriptionMode tells whether the replicas of the data plane share
+	// the subscriptions, Exclusive by default.
+	// +optional
+	SubscriptionMode SubscriptionMode `json:"subscriptionMode,omitempty"`
+
+	// Filter selects the messages sent to the sink. All the messages are
+	// sent when it is not set.
+	// +optional
+	Filter *Filter `json:"filter,omitempty"`
+
+	// Transform reshapes the messages into the events sent to the sink. It
+	// runs before the filter, which sees the transformed attributes.
+	// +optional
+	Transform *Transform `json:"transform,omitempty"`
+
+	// Routes send the messages of some topics to other destinations than
+	// the sink. A message goes to the first route it matches, or to the
+	// sink, the default route, when it matches none.
+	// +optional
+	Routes []Route `json:"routes,omitempty"`
+
+	// Buffer stores the messages on the local disk of the data plane, which
+	// acknowledges them to the broker once stored and sends them to their
+	// destination in the background, until they are delivered. Without it,
+	// a QoS 1 or 2 message is acknowledged once delivered, and left
+	// unacknowledged when its delivery failed and may be retried, for the
+	// broker to send it again when the session is resumed.
+	// +optional
+	Buffer *Buffer `json:"buffer,omitempty"`
+
+	// RateLimit bounds the rate of the events sent to the sink and to the
+	// destinations of the routes.
+	// +optional
+	RateLimit *RateLimit `json:"rateLimit,omitempty"`
+
+	// MaxInFlight bounds the number of events being sent at once. It is
+	// also the MQTT 5 Receive Maximum of the connection, the number of QoS 1
+	// and 2 messages the broker sends before waiting for their
+	// acknowledgement.
+	// +optional
+	MaxInFlight *int32 `json:"maxInFlight,omitempty"`
+
+	// SinkAuth configures the TLS connections and the authentication of the
+	// requests to the sink and to the destinations of the routes.
+	// +optional
+	SinkAuth *SinkAuth `json:"sinkAuth,omitempty"`
+
+	// Deduplication drops the copies of the messages delivered recently,
+	// which the broker sends again after a reconnection or a lost
+	// acknowledgement, so that the sink receives each message once.
+	// +optional
+	Deduplication *Deduplication `json:"deduplication,omitempty"`
+
+	// MarkRetained sets the mqttretained extension attribute to true on the
+	// events of the retained messages sent by the broker when subscribing,
+	// so that the sink can tell them apart from the live messages.
+	// +optional
+	MarkRetained bool `json:"markRetained,omitempty"`
+
+	// DeadLetterSink receives the messages whose MQTT 5 Message Expiry
+	// Interval elapsed before they were delivered, with `expired` in the
+	// deadletterreason extension attribute. They are dropped when it is not
+	// set. The other failed deliveries are not sent to it.
+	// +optional
+	DeadLetterSink *duckv1.Destination `json:"deadLetterSink,omitempty"`
+
+	// inherits duck/v1 SourceSpec, which currently provides:
+	// * Sink - a reference to an object that will resolve to a domain name or
+	//   a URI directly to use as the sink.
+	// * CloudEventOverrides - defines overrides to control the output format
+	//   and modifications of the event sent to the sink.
+	duckv1.SourceSpec `json:",inline"`
+}
+
+// BrokerSpec describes how to reach an MQTT broker.
+type BrokerSpec struct {
+	// Host is the hostname or IP address of the broker.
+	Host string `json:"host"`
+
+	// Port defaults to 1883, or 8883 when TLS is enabled.
+	// +optional
+	Port int32 `json:"port,omitempty"`
+
+	// TLS connects to the broker over TLS.
+	// +optional
+	TLS bool `json:"tls,omitempty"`
+}
+
+// Subscription is an MQTT subscription.
+type Subscription struct {
+	// Topic is the MQTT topic filter to subscribe to.
+	Topic string `json:"topic"`
+
+	// QoS is the maximum quality of service the broker uses to deliver the
+	// messages of this subscription, 0 by default.
+	// +optional
+	QoS int32 `json:"qos,omitempty"`
+
+	// RetainHandling tells whether the broker sends the retained messages
+	// matching the topic filter when subscribing, Send by default.
+	// +optional
+	RetainHandling RetainHandling `json:"retainHandling,omitempty"`
+}
+
+// RetainHandling is the MQTT 5 Retain Handling option of a subscription.
+type RetainHandling string
+
+const (
+	// SendRetained sends the retained messages on every subscription, so
+	// also whenever the data plane connects again or updates its
+	// subscriptions.
+	SendRetained RetainHandling = "Send"
+
+	// SendRetainedIfNew sends the retained messages only when the
+	// subscription does not exist yet, and not when the session of the data
+	// plane is resumed.
+	SendRetainedIfNew RetainHandling = "SendIfNew"
+
+	// NeverSendRetained never sends the retained messages.
+	NeverSendRetained RetainHandling = "Never"
+)
+
+// Filter selects messages by the attributes of the CloudEvents they are
+// turned into, and by their payload. A message passes the filter when it
+// matches all of its entries. The keys of each map are attribute names,
+// either context attributes, like type or source, or extensions.
+type Filter struct {
+	// Exact matches the attributes equal to the given value. As in the
+	// filter of a Trigger, an empty value matches any value, as long as the
+	// attribute is set.
+	// +optional
+	Exact map[string]string `json:"exact,omitempty"`
+
+	// Prefix matches the attributes starting with the given value.
+	// +optional
+	Prefix map[string]string `json:"prefix,omitempty"`
+
+	// Suffix matches the attributes ending with the given value.
+	// +optional
+	Suffix map[string]string `json:"suffix,omitempty"`
+
+	// CEL matches the events for which the CEL expression evaluates to
+	// true. The event variable maps the names of the attributes set to
+	// their value, and the data variable is the JSON payload, e.g.
+	// `event.type == "dev.knative.sensor.temperature" && data.celsius > 30`.
+	// An expression failing to evaluate, e.g. on a missing field, does not
+	// match.
+	// +optional
+	CEL string `json:"cel,omitempty"`
+}
+
+// SubscriptionMode tells how the replicas of the data plane receive the
+// messages of the subscriptions of a BrokerChannel.
+type SubscriptionMode string
+
+const (
+	// ExclusiveSubscriptions subscribes every replica to the topics, so
+	// that each of them delivers every message. The data plane must run a
+	// single replica.
+	ExclusiveSubscriptions SubscriptionMode = "Exclusive"
+
+	// SharedSubscriptions subscribes the replicas to MQTT 5 shared
+	// subscriptions, $share/<uid>/<topic> with the UID of the BrokerChannel
+	// as share name. The broker delivers each message to one of them.
+	SharedSubscriptions SubscriptionMode = "Shared"
+)
+
+// Route sends the messages matching a topic filter, and optionally an
+// attribute filter, to a destination.
+type Route struct {
+	// Name identifies the route in the status of the BrokerChannel.
+	Name string `json:"name"`
+
+	// Topic is the MQTT topic filter matched against the topic of the
+	// messages, e.g. `site/+/alarm`. The messages are received through the
+	// subscriptions of the BrokerChannel, which must cover it.
+	Topic string `json:"topic"`
+
+	// Filter further selects the messages of the route by their attributes.
+	// +optional
+	Filter *Filter `json:"filter,omitempty"`
+
+	// Destination receives the messages of the route.
+	Destination duckv1.Destination `json:"destination"`
+}
+
+// Buffer bounds the store-and-forward buffer of a BrokerChannel.
+type Buffer struct {
+	// MaxSize bounds the size of the messages in the buffer, 64Mi by
+	// default. Once the buffer is full, the QoS 1 messages wait for room
+	// before they are acknowledged, and the QoS 0 messages are dropped.
+	// +optional
+	MaxSize *resource.Quantity `json:"maxSize,omitempty"`
+
+	// MaxAge is the time after which a message which could not be delivered
+	// is dropped from the buffer, 24h by default.
+	// +optional
+	MaxAge *metav1.Duration `json:"maxAge,omitempty"`
+}
+
+const (
+	// DefaultBufferMaxSize is the default maximum size of a buffer.
+	DefaultBufferMaxSize = "64Mi"
+	// DefaultBufferMaxAge is the default maximum age of a buffered message.
+	DefaultBufferMaxAge = 24 * time.Hour
+)
+
+// Deduplication identifies the copies of a message by a key, by default
+// the id and the source of its event. At most one of Property and Path is
+// set. The messages without key are always delivered.
+type Deduplication struct {
+	// Property is the MQTT 5 user property holding the key of the messages.
+	// +optional
+	Property string `json:"property,omitempty"`
+
+	// Path is the JSONPath expression selecting the key in the payload,
+	// e.g. `$.reading.id`.
+	// +optional
+	Path string `json:"path,omitempty"`
+
+	// TTL is how long the key of a delivered message is remembered, 10m by
+	// default.
+	// +optional
+	TTL *metav1.Duration `json:"ttl,omitempty"`
+
+	// MaxKeys bounds the number of keys remembered, the least recently
+	// used ones being forgotten first, 10000 by default.
+	// +optional
+	MaxKeys int32 `json:"maxKeys,omitempty"`
+
+	// Persist stores the keys in the buffer directory of the data plane,
+	// so that they survive its restarts.
+	// +optional
+	Persist bool `json:"persist,omitempty"`
+}
+
+const (
+	// DefaultDeduplicationTTL is the default time a key is remembered.
+	DefaultDeduplicationTTL = 10 * time.Minute
+	// DefaultDeduplicationMaxKeys is the default number of keys remembered.
+	DefaultDeduplicationMaxKeys = 10000
+)
+
+// JSONPath returns Path in the template syntax of k8s.io/client-go/util/jsonpath.
+func (d *Deduplication) JSONPath() string {
+	return jsonPathTemplate(d.Path)
+}
+
+// RateLimit is a token bucket: events are sent at EventsPerSecond on
+// average, and up to Burst at once.
+type RateLimit struct {
+	// EventsPerSecond is the sustained rate of the events.
+	EventsPerSecond int32 `json:"eventsPerSecond"`
+
+	// Burst is the number of events sent at once after an idle period,
+	// EventsPerSecond by default.
+	// +optional
+	Burst int32 `json:"burst,omitempty"`
+}
+
+// SinkAuth configures the delivery to the sink and to the destinations of
+// the routes. The secrets are read from the namespace of the BrokerChannel.
+type SinkAuth struct {
+	// CACert holds the PEM certificates used to verify the destinations.
+	// The system roots are used when it is not set.
+	// +optional
+	CACert *corev1.SecretKeySelector `json:"caCert,omitempty"`
+
+	// ClientCert and ClientKey hold the PEM certificate and key presented to
+	// the destinations. Both or neither must be set.
+	// +optional
+	ClientCert *corev1.SecretKeySelector `json:"clientCert,omitempty"`
+	// +optional
+	ClientKey *corev1.SecretKeySelector `json:"clientKey,omitempty"`
+
+	// Headers names a secret whose keys and values are added as headers to
+	// the requests, e.g. Authorization: Bearer <token>.
+	// +optional
+	Headers *corev1.LocalObjectReference `json:"headers,omitempty"`
+
+	// OAuth2 authenticates the requests with the tokens of an OAuth2
+	// client credentials grant.
+	// +optional
+	OAuth2 *OAuth2ClientCredentials `json:"oauth2,omitempty"`
+
+	// Signing signs the requests with an HMAC of their timestamp and body,
+	// which the destinations verify with the key.
+	// +optional
+	Signing *Signing `json:"signing,omitempty"`
+}
+
+// OAuth2ClientCredentials is an OAuth2 client credentials grant.
+type OAuth2ClientCredentials struct {
+	// TokenURL is the token endpoint of the authorization server.
+	TokenURL string `json:"tokenURL"`
+
+	// ClientID and ClientSecret identify the client.
+	ClientID     *corev1.SecretKeySelector `json:"clientID"`
+	ClientSecret *corev1.SecretKeySelector `json:"clientSecret"`
+
+	// Scopes are the scopes requested.
+	// +optional
+	Scopes []string `json:"scopes,omitempty"`
+}
+
+// Signing signs the requests to the destinations. Each request carries its
+// timestamp and signature in the X-Brokerchannel-Timestamp and
+// X-Brokerchannel-Signature headers, which the signature package verifies.
+type Signing struct {
+	// Key holds the HMAC key.
+	Key *corev1.SecretKeySelector `json:"key"`
+
+	// Algorithm is the HMAC algorithm, HMAC-SHA256 by default.
+	// +optional
+	Algorithm SigningAlgorithm `json:"algorithm,omitempty"`
+}
+
+// SigningAlgorithm is the HMAC algorithm of the signatures.
+type SigningAlgorithm string
+
+const (
+	// HMACSHA256 signs with HMAC-SHA256.
+	HMACSHA256 SigningAlgorithm = "HMAC-SHA256"
+
+	// HMACSHA512 signs with HMAC-SHA512.
+	HMACSHA512 SigningAlgorithm = "HMAC-SHA512"
+)
+
+// MaxReceiveMaximum is the highest MQTT 5 Receive Maximum, and MaxInFlight.
+const MaxReceiveMaximum = 65535
+
+// Transform reshapes an MQTT message into the event sent to the sink.
+//
+// Type, Subject and the values of Extensions are Go templates executed with
+// .Topic, the topic of the message, .Levels, the levels of the topic, and
+// .Payload, the decoded JSON payload. For instance
+// `{{ index .Levels 1 }}/{{ .Payload.device.id }}`.
+type Transform struct {
+	// Fields projects the JSON payload into the data of the event, which
+	// only holds the listed fields. The whole payload is kept when it is
+	// empty.
+	// +optional
+	Fields []FieldMapping `json:"fields,omitempty"`
+
+	// Set adds fields with static values to the data of the event,
+	// replacing the projected fields of the same name.
+	// +optional
+	Set map[string]apiextensionsv1.JSON `json:"set,omitempty"`
+
+	// Type is the template of the type of the event.
+	// +optional
+	Type string `json:"type,omitempty"`
+
+	// Subject is the template of the subject of the event.
+	// +optional
+	Subject string `json:"subject,omitempty"`
+
+	// Extensions are the templates of extension attributes of the event,
+	// by attribute name.
+	// +optional
+	Extensions map[string]string `json:"extensions,omitempty"`
+}
+
+// FieldMapping sets a field of the data of an event to the value selected
+// in the payload of the message.
+type FieldMapping struct {
+	// Name is the name of the field in the data of the event.
+	Name string `json:"name"`
+
+	// Path is the JSONPath expression selecting the value in the payload,
+	// e.g. `$.readings[0].temp`. When it selects several values, the field
+	// is an array of them. The field is left out when nothing is selected.
+	Path string `json:"path"`
+}
+
+// JSONPath returns Path in the template syntax of k8s.io/client-go/util/jsonpath.
+func (fm *FieldMapping) JSONPath() string {
+	return jsonPathTemplate(fm.Path)
+}
+
+func jsonPathTemplate(path string) string {
+	if strings.HasPrefix(path, "{") {
+		return path
+	}
+	return "{" + path + "}"
+}
+
+const (
+	// DefaultBrokerPort is the IANA port for MQTT over TCP.
+	DefaultBrokerPort = 1883
+	// DefaultTLSBrokerPort is the IANA port for MQTT over TLS.
+	DefaultTLSBrokerPort = 8883
+)
+
+// Address returns the host:port the data plane dials to reach the broker.
+func (bs *BrokerSpec) Address() string {
+	return net.JoinHostPort(bs.Host, strconv.Itoa(int(bs.Port)))
+}
+
+// BrokerChannelStatus communicates the observed state of the BrokerChannel (from the controller).
+type BrokerChannelStatus struct {
+	// inherits duck/v1 SourceStatus, which currently provides:
+	// * ObservedGeneration - the 'Generation' of the Service that was last
+	//   processed by the controller.
+	// * Conditions - the latest available observations of a resource's current
+	//   state.
+	// * SinkURI - the current active sink URI that has been configured for the
+	//   Source.
+	duckv1.SourceStatus `json:",inline"`
+
+	// Routes are the resolved destinations of the routes, in the order of
+	// the spec.
+	// +optional
+	Routes []RouteStatus `json:"routes,omitempty"`
+
+	// DeadLetterSinkURI is the resolved URI of the dead letter sink.
+	// +optional
+	DeadLetterSinkURI *apis.URL `json:"deadLetterSinkUri,omitempty"`
+
+	// Buffer reports the messages waiting in the buffer of the data plane.
+	// +optional
+	Buffer *BufferStatus `json:"buffer,omitempty"`
+
+	// CircuitBreakers are the circuit breakers of the sink and of the
+	// destinations of the routes which are not closed, as the data plane
+	// stops sending them events for a while.
+	// +optional
+	CircuitBreakers []CircuitBreakerStatus `json:"circuitBreakers,omitempty"`
+}
+
+// DataPlaneStatusAnnotation holds the DataPlaneStatus of a BrokerChannel, as
+// JSON. The data plane writes it and the controller copies it into the
+// status, which the controller is the only writer of.
+const DataPlaneStatusAnnotation = "samples.knative.dev/data-plane-status"
+
+// DataPlaneStatus is the part of the status of a BrokerChannel observed by
+// the data plane.
+type DataPlaneStatus struct {
+	// +optional
+	Buffer *BufferStatus `json:"buffer,omitempty"`
+
+	// +optional
+	CircuitBreakers []CircuitBreakerStatus `json:"circuitBreakers,omitempty"`
+
+	// Error is why the data plane could not set up the connection of the
+	// BrokerChannel, or why its session with the broker is down.
+	// +optional
+	Error string `json:"error,omitempty"`
+}
+
+// RouteStatus is the resolved destination of a route.
+type RouteStatus struct {
+	// Name is the name of the route.
+	Name string `json:"name"`
+
+	// URI is the URI of the destination of the route.
+	// +optional
+	URI *apis.URL `json:"uri,omitempty"`
+}
+
+// BufferStatus reports the messages waiting in a buffer. It is observed by
+// the data plane.
+type BufferStatus struct {
+	// Messages is the number of messages in the buffer.
+	Messages int64 `json:"messages"`
+
+	// Bytes is the size of the messages in the buffer.
+	Bytes int64 `json:"bytes"`
+}
+
+// CircuitBreakerState is the state of a circuit breaker.
+type CircuitBreakerState string
+
+const (
+	// CircuitBreakerOpen is the state of a breaker pausing the events sent
+	// to its destination.
+	CircuitBreakerOpen CircuitBreakerState = "Open"
+	// CircuitBreakerHalfOpen is the state of a breaker sending a trial
+	// event to its destination.
+	CircuitBreakerHalfOpen CircuitBreakerState = "HalfOpen"
+)
+
+// CircuitBreakerStatus reports a circuit breaker which is not closed. It is
+// observed by the data plane.
+type CircuitBreakerStatus struct {
+	// URI is the destination of the breaker.
+	URI *apis.URL `json:"uri"`
+
+	// State is the state of the breaker.
+	State CircuitBreakerState `json:"state"`
+
+	// Reason is the last failure of the destination, e.g. 429 Too Many
+	// Requests.
+	// +optional
+	Reason string `json:"reason,omitempty"`
+
+	// Since is the time the breaker tripped.
+	Since metav1.Time `json:"since"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// BrokerChannelList is a list of BrokerChannel resources
+type BrokerChannelList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata"`
+
+	Items []BrokerChannel `json:"items"`
+}
+
+// GetStatus retrieves the status of the resource. Implements the KRShaped interface.
+func (bc *BrokerChannel) GetStatus() *duckv1.Status {
+	return &bc.Status.Status
+}
@@ -0,0 +1,419 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net"
+	"net/url"
+	"regexp"
+	"text/template"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/util/jsonpath"
+	"knative.dev/pkg/apis"
+	"knative.dev/pkg/kmp"
+
+	"github.com/ShixiongQi/brokerchannel/pkg/filter/expression"
+	"github.com/ShixiongQi/brokerchannel/pkg/mqtt"
+)
+
+// Validate validates the BrokerChannel. The broker may change, the data
+// plane then reconnects.
+func (bc *BrokerChannel) Validate(ctx context.Context) *apis.FieldError {
+	errs := bc.Spec.Validate(ctx).ViaField("spec")
+
+	if apis.IsInUpdate(ctx) {
+		original := apis.GetBaseline(ctx).(*BrokerChannel)
+		errs = errs.Also(bc.CheckImmutableFields(ctx, original))
+	}
+	return errs
+}
+
+func (bcs *BrokerChannelSpec) Validate(ctx context.Context) *apis.FieldError {
+	errs := validateBrokerSource(ctx, bcs.Broker, bcs.BrokerRef)
+
+	if len(bcs.Subscriptions) == 0 {
+		errs = errs.Also(apis.ErrMissingField("subscriptions"))
+	}
+	topics := sets.NewString()
+	for i, s := range bcs.Subscriptions {
+		errs = errs.Also(s.Validate(ctx).ViaFieldIndex("subscriptions", i))
+		if topics.Has(s.Topic) {
+			errs = errs.Also(apis.ErrGeneric("duplicate topic "+s.Topic, "topic").ViaFieldIndex("subscriptions", i))
+		}
+		topics.Insert(s.Topic)
+	}
+
+	switch bcs.SubscriptionMode {
+	case "", ExclusiveSubscriptions, SharedSubscriptions:
+	default:
+		errs = errs.Also(apis.ErrInvalidValue(bcs.SubscriptionMode, "subscriptionMode"))
+	}
+
+	if bcs.Filter != nil {
+		errs = errs.Also(bcs.Filter.Validate(ctx).ViaField("filter"))
+	}
+	if bcs.Transform != nil {
+		errs = errs.Also(bcs.Transform.Validate(ctx).ViaField("transform"))
+	}
+	names := sets.NewString()
+	for i, r := range bcs.Routes {
+		errs = errs.Also(r.Validate(ctx).ViaFieldIndex("routes", i))
+		if names.Has(r.Name) {
+			errs = errs.Also(apis.ErrGeneric("duplicate route "+r.Name, "name").ViaFieldIndex("routes", i))
+		}
+		names.Insert(r.Name)
+	}
+	if bcs.Buffer != nil {
+		errs = errs.Also(bcs.Buffer.Validate(ctx).ViaField("buffer"))
+	}
+	if bcs.RateLimit != nil {
+		errs = errs.Also(bcs.RateLimit.Validate(ctx).ViaField("rateLimit"))
+	}
+	if bcs.SinkAuth != nil {
+		errs = errs.Also(bcs.SinkAuth.Validate(ctx).ViaField("sinkAuth"))
+	}
+	if bcs.Deduplication != nil {
+		errs = errs.Also(bcs.Deduplication.Validate(ctx).ViaField("deduplication"))
+	}
+	if bcs.DeadLetterSink != nil {
+		errs = errs.Also(bcs.DeadLetterSink.Validate(ctx).ViaField("deadLetterSink"))
+	}
+	if bcs.MaxInFlight != nil && (*bcs.MaxInFlight < 1 || *bcs.MaxInFlight > MaxReceiveMaximum) {
+		errs = errs.Also(apis.ErrOutOfBoundsValue(*bcs.MaxInFlight, 1, MaxReceiveMaximum, "maxInFlight"))
+	}
+
+	errs = errs.Also(bcs.Sink.Validate(ctx).ViaField("sink"))
+	return errs
+}
+
+// validateBrokerSource checks that exactly one of an inline broker and a
+// reference to an MQTTBroker is set.
+func validateBrokerSource(ctx context.Context, broker *BrokerSpec, ref *corev1.LocalObjectReference) *apis.FieldError {
+	switch {
+	case broker != nil && ref != nil:
+		return apis.ErrMultipleOneOf("broker", "brokerRef")
+	case broker != nil:
+		return broker.Validate(ctx).ViaField("broker")
+	case ref != nil:
+		if ref.Name == "" {
+			return apis.ErrMissingField("brokerRef.name")
+		}
+		return nil
+	default:
+		return apis.ErrMissingOneOf("broker", "brokerRef")
+	}
+}
+
+func (bs *BrokerSpec) Validate(ctx context.Context) *apis.FieldError {
+	var errs *apis.FieldError
+
+	if bs.Host == "" {
+		errs = errs.Also(apis.ErrMissingField("host"))
+	} else if net.ParseIP(bs.Host) == nil && len(validation.IsDNS1123Subdomain(bs.Host)) != 0 {
+		fe := apis.ErrInvalidValue(bs.Host, "host")
+		fe.Details = "must be an IP address or a hostname"
+		errs = errs.Also(fe)
+	}
+
+	// A zero port is replaced by the defaulting webhook.
+	if bs.Port < 0 || bs.Port > 65535 {
+		errs = errs.Also(apis.ErrOutOfBoundsValue(bs.Port, 1, 65535, "port"))
+	}
+	return errs
+}
+
+func (s *Subscription) Validate(ctx context.Context) *apis.FieldError {
+	var errs *apis.FieldError
+
+	if s.Topic == "" {
+		errs = errs.Also(apis.ErrMissingField("topic"))
+	} else if err := mqtt.ValidateTopicFilter(s.Topic); err != nil {
+		fe := apis.ErrInvalidValue(s.Topic, "topic")
+		fe.Details = err.Error()
+		errs = errs.Also(fe)
+	}
+
+	if s.QoS < 0 || s.QoS > 2 {
+		errs = errs.Also(apis.ErrOutOfBoundsValue(s.QoS, 0, 2, "qos"))
+	}
+
+	switch s.RetainHandling {
+	case "", SendRetained, SendRetainedIfNew, NeverSendRetained:
+	default:
+		errs = errs.Also(apis.ErrInvalidValue(s.RetainHandling, "retainHandling"))
+	}
+	return errs
+}
+
+func (r *Route) Validate(ctx context.Context) *apis.FieldError {
+	var errs *apis.FieldError
+
+	if r.Name == "" {
+		errs = errs.Also(apis.ErrMissingField("name"))
+	}
+	if r.Topic == "" {
+		errs = errs.Also(apis.ErrMissingField("topic"))
+	} else if err := mqtt.ValidateTopicFilter(r.Topic); err != nil {
+		fe := apis.ErrInvalidValue(r.Topic, "topic")
+		fe.Details = err.Error()
+		errs = errs.Also(fe)
+	}
+	if r.Filter != nil {
+		errs = errs.Also(r.Filter.Validate(ctx).ViaField("filter"))
+	}
+	return errs.Also(r.Destination.Validate(ctx).ViaField("destination"))
+}
+
+// validAttributeName matches the names of CloudEvents attributes.
+var validAttributeName = regexp.MustCompile(`^[a-z0-9]+$`)
+
+func (b *Buffer) Validate(ctx context.Context) *apis.FieldError {
+	var errs *apis.FieldError
+	if b.MaxSize != nil && b.MaxSize.Sign() <= 0 {
+		errs = errs.Also(apis.ErrOutOfBoundsValue(b.MaxSize.String(), "1", "+Inf", "maxSize"))
+	}
+	if b.MaxAge != nil && b.MaxAge.Duration <= 0 {
+		errs = errs.Also(apis.ErrOutOfBoundsValue(b.MaxAge.Duration, "1ns", "+Inf", "maxAge"))
+	}
+	return errs
+}
+
+func (d *Deduplication) Validate(ctx context.Context) *apis.FieldError {
+	var errs *apis.FieldError
+	if d.Property != "" && d.Path != "" {
+		errs = errs.Also(apis.ErrGeneric("expected at most one, got both", "property", "path"))
+	}
+	if d.Path != "" {
+		if err := jsonpath.New("key").Parse(d.JSONPath()); err != nil {
+			fe := apis.ErrInvalidValue(d.Path, "path")
+			fe.Details = err.Error()
+			errs = errs.Also(fe)
+		}
+	}
+	if d.TTL != nil && d.TTL.Duration <= 0 {
+		errs = errs.Also(apis.ErrOutOfBoundsValue(d.TTL.Duration, "1ns", "+Inf", "ttl"))
+	}
+	if d.MaxKeys < 0 {
+		errs = errs.Also(apis.ErrOutOfBoundsValue(d.MaxKeys, 0, math.MaxInt32, "maxKeys"))
+	}
+	return errs
+}
+
+func (rl *RateLimit) Validate(ctx context.Context) *apis.FieldError {
+	var errs *apis.FieldError
+	if rl.EventsPerSecond < 1 {
+		errs = errs.Also(apis.ErrOutOfBoundsValue(rl.EventsPerSecond, 1, math.MaxInt32, "eventsPerSecond"))
+	}
+	if rl.Burst < 0 {
+		errs = errs.Also(apis.ErrOutOfBoundsValue(rl.Burst, 0, math.MaxInt32, "burst"))
+	}
+	return errs
+}
+
+func (sa *SinkAuth) Validate(ctx context.Context) *apis.FieldError {
+	errs := validateSecretKeySelector(sa.CACert).ViaField("caCert").
+		Also(validateSecretKeySelector(sa.ClientCert).ViaField("clientCert")).
+		Also(validateSecretKeySelector(sa.ClientKey).ViaField("clientKey"))
+
+	if sa.ClientCert != nil && sa.ClientKey == nil {
+		errs = errs.Also(apis.ErrMissingField("clientKey"))
+	} else if sa.ClientCert == nil && sa.ClientKey != nil {
+		errs = errs.Also(apis.ErrMissingField("clientCert"))
+	}
+	if sa.Headers != nil && sa.Headers.Name == "" {
+		errs = errs.Also(apis.ErrMissingField("headers.name"))
+	}
+	if sa.OAuth2 != nil {
+		errs = errs.Also(sa.OAuth2.Validate(ctx).ViaField("oauth2"))
+	}
+	if sa.Signing != nil {
+		errs = errs.Also(sa.Signing.Validate(ctx).ViaField("signing"))
+	}
+	return errs
+}
+
+func (s *Signing) Validate(ctx context.Context) *apis.FieldError {
+	var errs *apis.FieldError
+	if s.Key == nil {
+		errs = errs.Also(apis.ErrMissingField("key"))
+	}
+	switch s.Algorithm {
+	case "", HMACSHA256, HMACSHA512:
+	default:
+		errs = errs.Also(apis.ErrInvalidValue(s.Algorithm, "algorithm"))
+	}
+	return errs.Also(validateSecretKeySelector(s.Key).ViaField("key"))
+}
+
+func (o *OAuth2ClientCredentials) Validate(ctx context.Context) *apis.FieldError {
+	var errs *apis.FieldError
+	if o.TokenURL == "" {
+		errs = errs.Also(apis.ErrMissingField("tokenURL"))
+	} else if u, err := url.Parse(o.TokenURL); err != nil || !u.IsAbs() {
+		errs = errs.Also(apis.ErrInvalidValue(o.TokenURL, "tokenURL"))
+	}
+	if o.ClientID == nil {
+		errs = errs.Also(apis.ErrMissingField("clientID"))
+	}
+	if o.ClientSecret == nil {
+		errs = errs.Also(apis.ErrMissingField("clientSecret"))
+	}
+	return errs.Also(validateSecretKeySelector(o.ClientID).ViaField("clientID")).
+		Also(validateSecretKeySelector(o.ClientSecret).ViaField("clientSecret"))
+}
+
+func (f *Filter) Validate(ctx context.Context) *apis.FieldError {
+	if len(f.Exact) == 0 && len(f.Prefix) == 0 && len(f.Suffix) == 0 && f.CEL == "" {
+		return apis.ErrGeneric("expected at least one, got none", "exact", "prefix", "suffix", "cel")
+	}
+	errs := validateAttributes(f.Exact, true).ViaField("exact").
+		Also(validateAttributes(f.Prefix, false).ViaField("prefix")).
+		Also(validateAttributes(f.Suffix, false).ViaField("suffix"))
+	if f.CEL != "" {
+		if _, err := expression.Compile(f.CEL); err != nil {
+			fe := apis.ErrInvalidValue(f.CEL, "cel")
+			fe.Details = err.Error()
+			errs = errs.Also(fe)
+		}
+	}
+	return errs
+}
+
+// validateAttributes checks the attribute names of a filter, and that their
+// values are not empty unless allowEmpty.
+func validateAttributes(attrs map[string]string, allowEmpty bool) *apis.FieldError {
+	var errs *apis.FieldError
+	for name, value := range attrs {
+		if !validAttributeName.MatchString(name) {
+			errs = errs.Also(apis.ErrInvalidKeyName(name, apis.CurrentField,
+				"attribute names must be lowercase alphanumeric"))
+		} else if value == "" && !allowEmpty {
+			errs = errs.Also(apis.ErrMissingField(name))
+		}
+	}
+	return errs
+}
+
+// contextAttributes are the names of the CloudEvents context attributes,
+// which cannot be set as extensions.
+var contextAttributes = sets.NewString("specversion", "id", "source", "type",
+	"subject", "time", "datacontenttype", "dataschema", "data")
+
+func (t *Transform) Validate(ctx context.Context) *apis.FieldError {
+	var errs *apis.FieldError
+
+	names := sets.NewString()
+	for i, fm := range t.Fields {
+		errs = errs.Also(fm.Validate(ctx).ViaFieldIndex("fields", i))
+		if names.Has(fm.Name) {
+			errs = errs.Also(apis.ErrGeneric("duplicate field "+fm.Name, "name").ViaFieldIndex("fields", i))
+		}
+		names.Insert(fm.Name)
+	}
+	for name, v := range t.Set {
+		if !json.Valid(v.Raw) {
+			errs = errs.Also(apis.ErrInvalidValue(string(v.Raw), name).ViaField("set"))
+		}
+	}
+
+	errs = errs.Also(validateTemplate(t.Type, "type"), validateTemplate(t.Subject, "subject"))
+	for name, tmpl := range t.Extensions {
+		switch {
+		case !validAttributeName.MatchString(name):
+			errs = errs.Also(apis.ErrInvalidKeyName(name, "extensions",
+				"attribute names must be lowercase alphanumeric"))
+		case contextAttributes.Has(name):
+			errs = errs.Also(apis.ErrInvalidKeyName(name, "extensions",
+				"context attributes cannot be set as extensions"))
+		case tmpl == "":
+			errs = errs.Also(apis.ErrMissingField(name).ViaField("extensions"))
+		default:
+			errs = errs.Also(validateTemplate(tmpl, name).ViaField("extensions"))
+		}
+	}
+	return errs
+}
+
+func (fm *FieldMapping) Validate(ctx context.Context) *apis.FieldError {
+	var errs *apis.FieldError
+
+	if fm.Name == "" {
+		errs = errs.Also(apis.ErrMissingField("name"))
+	}
+	if fm.Path == "" {
+		errs = errs.Also(apis.ErrMissingField("path"))
+	} else if err := jsonpath.New(fm.Name).Parse(fm.JSONPath()); err != nil {
+		fe := apis.ErrInvalidValue(fm.Path, "path")
+		fe.Details = err.Error()
+		errs = errs.Also(fe)
+	}
+	return errs
+}
+
+// validateTemplate checks that tmpl, if set, is a valid Go template.
+func validateTemplate(tmpl, field string) *apis.FieldError {
+	if tmpl == "" {
+		return nil
+	}
+	if _, err := template.New(field).Parse(tmpl); err != nil {
+		fe := apis.ErrInvalidValue(tmpl, field)
+		fe.Details = err.Error()
+		return fe
+	}
+	return nil
+}
+
+// CheckImmutableFields rejects changes to the subscription mode of a
+// BrokerChannel. It decides the share group of the subscriptions and whether
+// the data plane keeps a persistent session, which a replica only takes over
+// with the same client identifier and subscriptions.
+func (bc *BrokerChannel) CheckImmutableFields(ctx context.Context, original *BrokerChannel) *apis.FieldError {
+	if original == nil {
+		return nil
+	}
+
+	before, after := original.Spec.subscriptionMode(), bc.Spec.subscriptionMode()
+	if diff, err := kmp.ShortDiff(before, after); err != nil {
+		return &apis.FieldError{
+			Message: "Failed to diff BrokerChannel",
+			Paths:   []string{"spec"},
+			Details: err.Error(),
+		}
+	} else if diff != "" {
+		return &apis.FieldError{
+			Message: "Immutable fields changed (-old +new)",
+			Paths:   []string{"spec", "subscriptionMode"},
+			Details: diff,
+		}
+	}
+	return nil
+}
+
+// subscriptionMode returns the SubscriptionMode of bcs, Exclusive when it is
+// not set.
+func (bcs *BrokerChannelSpec) subscriptionMode() SubscriptionMode {
+	if bcs.SubscriptionMode == "" {
+		return ExclusiveSubscriptions
+	}
+	return bcs.SubscriptionMode
+}
@@ -0,0 +1,389 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"knative.dev/pkg/apis"
+	duckv1 "knative.dev/pkg/apis/duck/v1"
+)
+
+var validSink = duckv1.SourceSpec{
+	Sink: duckv1.Destination{
+		Ref: &duckv1.KReference{
+			APIVersion: "v1",
+			Kind:       "Service",
+			Name:       "helloworld-go",
+			Namespace:  "default",
+		},
+	},
+}
+
+func TestBrokerChannelSpecValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		spec BrokerChannelSpec
+		want string
+	}{{
+		name: "valid",
+		spec: BrokerChannelSpec{
+			Broker:        &BrokerSpec{Host: "mosquitto.default.svc", Port: 8883, TLS: true},
+			Subscriptions: []Subscription{{Topic: "sensors/+/motion", QoS: 1}, {Topic: "alarms/#"}},
+			SourceSpec:    validSink,
+		},
+	}, {
+		name: "missing fields",
+		spec: BrokerChannelSpec{SourceSpec: validSink},
+		want: "expected exactly one, got neither: broker, brokerRef\nmissing field(s): subscriptions",
+	}, {
+		name: "valid brokerRef",
+		spec: BrokerChannelSpec{
+			BrokerRef:     &corev1.LocalObjectReference{Name: "mosquitto"},
+			Subscriptions: []Subscription{{Topic: "motion"}},
+			SourceSpec:    validSink,
+		},
+	}, {
+		name: "broker and brokerRef",
+		spec: BrokerChannelSpec{
+			Broker:        &BrokerSpec{Host: "mosquitto", Port: 1883},
+			BrokerRef:     &corev1.LocalObjectReference{Name: "mosquitto"},
+			Subscriptions: []Subscription{{Topic: "motion"}},
+			SourceSpec:    validSink,
+		},
+		want: "expected exactly one, got both: broker, brokerRef",
+	}, {
+		name: "invalid host",
+		spec: BrokerChannelSpec{
+			Broker:        &BrokerSpec{Host: "mosquitto_broker", Port: 1883},
+			Subscriptions: []Subscription{{Topic: "motion"}},
+			SourceSpec:    validSink,
+		},
+		want: "invalid value: mosquitto_broker: broker.host\nmust be an IP address or a hostname",
+	}, {
+		name: "invalid subscriptions",
+		spec: BrokerChannelSpec{
+			Broker:        &BrokerSpec{Host: "mosquitto", Port: 1883},
+			Subscriptions: []Subscription{{Topic: "motion", QoS: 3}, {Topic: "motion"}, {Topic: "sensors/#/motion", RetainHandling: "Always"}},
+			SourceSpec:    validSink,
+		},
+		want: "duplicate topic motion: subscriptions[1].topic\n" +
+			"expected 0 <= 3 <= 2: subscriptions[0].qos\n" +
+			"invalid value: Always: subscriptions[2].retainHandling\n" +
+			"invalid value: sensors/#/motion: subscriptions[2].topic\n\"#\" must occupy the last level of the filter",
+	}, {
+		name: "retain handling",
+		spec: BrokerChannelSpec{
+			Broker:        &BrokerSpec{Host: "mosquitto", Port: 1883},
+			Subscriptions: []Subscription{{Topic: "sensors/#", RetainHandling: SendRetainedIfNew}, {Topic: "alarms/#", RetainHandling: NeverSendRetained}},
+			MarkRetained:  true,
+			SourceSpec:    validSink,
+		},
+	}, {
+		name: "shared subscriptions",
+		spec: BrokerChannelSpec{
+			Broker:           &BrokerSpec{Host: "mosquitto", Port: 1883},
+			Subscriptions:    []Subscription{{Topic: "sensors/#"}},
+			SubscriptionMode: SharedSubscriptions,
+			SourceSpec:       validSink,
+		},
+	}, {
+		name: "invalid subscription mode",
+		spec: BrokerChannelSpec{
+			Broker:           &BrokerSpec{Host: "mosquitto", Port: 1883},
+			Subscriptions:    []Subscription{{Topic: "sensors/#"}},
+			SubscriptionMode: "Broadcast",
+			SourceSpec:       validSink,
+		},
+		want: "invalid value: Broadcast: subscriptionMode",
+	}, {
+		name: "valid filter",
+		spec: BrokerChannelSpec{
+			Broker:        &BrokerSpec{Host: "mosquitto", Port: 1883},
+			Subscriptions: []Subscription{{Topic: "sensors/#"}},
+			Filter: &Filter{
+				Exact:  map[string]string{"type": "dev.knative.sensor.motion", "location": ""},
+				Prefix: map[string]string{"source": "/sensors/"},
+				Suffix: map[string]string{"subject": "/door"},
+				CEL:    `event.location != "garage" && data.confidence > 0.8`,
+			},
+			SourceSpec: validSink,
+		},
+	}, {
+		name: "empty filter",
+		spec: BrokerChannelSpec{
+			Broker:        &BrokerSpec{Host: "mosquitto", Port: 1883},
+			Subscriptions: []Subscription{{Topic: "sensors/#"}},
+			Filter:        &Filter{},
+			SourceSpec:    validSink,
+		},
+		want: "expected at least one, got none: filter.cel, filter.exact, filter.prefix, filter.suffix",
+	}, {
+		name: "invalid filter",
+		spec: BrokerChannelSpec{
+			Broker:        &BrokerSpec{Host: "mosquitto", Port: 1883},
+			Subscriptions: []Subscription{{Topic: "sensors/#"}},
+			Filter: &Filter{
+				Exact:  map[string]string{"Type": "dev.knative.sensor.motion"},
+				Prefix: map[string]string{"source": ""},
+				CEL:    `event.type + 1`,
+			},
+			SourceSpec: validSink,
+		},
+		want: "invalid key name \"Type\": filter.exact\nattribute names must be lowercase alphanumeric\n" +
+			"invalid value: event.type + 1: filter.cel\n1:12: no matching overload for '+' applied to (string, int)\n" +
+			"missing field(s): filter.prefix.source",
+	}, {
+		name: "valid transform",
+		spec: BrokerChannelSpec{
+			Broker:        &BrokerSpec{Host: "mosquitto", Port: 1883},
+			Subscriptions: []Subscription{{Topic: "sensors/#"}},
+			Transform: &Transform{
+				Fields:     []FieldMapping{{Name: "device", Path: "$.dev.id"}, {Name: "values", Path: "{.readings[*].v}"}},
+				Set:        map[string]apiextensionsv1.JSON{"schema": {Raw: []byte("2")}},
+				Type:       "dev.knative.sensor.{{ index .Levels 1 }}",
+				Subject:    "{{ .Payload.dev.id }}",
+				Extensions: map[string]string{"building": "{{ index .Levels 2 }}"},
+			},
+			SourceSpec: validSink,
+		},
+	}, {
+		name: "invalid transform",
+		spec: BrokerChannelSpec{
+			Broker:        &BrokerSpec{Host: "mosquitto", Port: 1883},
+			Subscriptions: []Subscription{{Topic: "sensors/#"}},
+			Transform: &Transform{
+				Fields:     []FieldMapping{{Name: "device", Path: "$.dev["}, {Name: "device"}},
+				Set:        map[string]apiextensionsv1.JSON{"schema": {Raw: []byte("{")}},
+				Type:       "{{ .Topic",
+				Extensions: map[string]string{"subject": "{{ .Topic }}", "building": ""},
+			},
+			SourceSpec: validSink,
+		},
+		want: "duplicate field device: transform.fields[1].name\n" +
+			"invalid key name \"subject\": transform.extensions\ncontext attributes cannot be set as extensions\n" +
+			"invalid value: $.dev[: transform.fields[0].path\nunterminated array\n" +
+			"invalid value: {: transform.set.schema\n" +
+			"invalid value: {{ .Topic: transform.type\ntemplate: type:1: unclosed action\n" +
+			"missing field(s): transform.extensions.building, transform.fields[1].path",
+	}, {
+		name: "valid routes",
+		spec: BrokerChannelSpec{
+			Broker:        &BrokerSpec{Host: "mosquitto", Port: 1883},
+			Subscriptions: []Subscription{{Topic: "site/#"}},
+			Routes: []Route{{
+				Name:        "alarms",
+				Topic:       "site/+/alarm",
+				Destination: validSink.Sink,
+			}, {
+				Name:        "firmware",
+				Topic:       "site/+/firmware",
+				Filter:      &Filter{Exact: map[string]string{"type": "dev.knative.firmware"}},
+				Destination: validSink.Sink,
+			}},
+			SourceSpec: validSink,
+		},
+	}, {
+		name: "invalid routes",
+		spec: BrokerChannelSpec{
+			Broker:        &BrokerSpec{Host: "mosquitto", Port: 1883},
+			Subscriptions: []Subscription{{Topic: "site/#"}},
+			Routes: []Route{{
+				Name:        "alarms",
+				Topic:       "site/#/alarm",
+				Filter:      &Filter{},
+				Destination: validSink.Sink,
+			}, {
+				Name: "alarms",
+			}},
+			SourceSpec: validSink,
+		},
+		want: "duplicate route alarms: routes[1].name\n" +
+			"expected at least one, got none: routes[0].filter.cel, routes[0].filter.exact, routes[0].filter.prefix, routes[0].filter.suffix, " +
+			"routes[1].destination.ref, routes[1].destination.uri\n" +
+			"invalid value: site/#/alarm: routes[0].topic\n\"#\" must occupy the last level of the filter\n" +
+			"missing field(s): routes[1].topic",
+	}, {
+		name: "valid buffer",
+		spec: BrokerChannelSpec{
+			Broker:        &BrokerSpec{Host: "mosquitto", Port: 1883},
+			Subscriptions: []Subscription{{Topic: "site/#", QoS: 1}},
+			Buffer:        &Buffer{MaxSize: quantity("1Gi"), MaxAge: &metav1.Duration{Duration: time.Hour}},
+			SourceSpec:    validSink,
+		},
+	}, {
+		name: "invalid buffer",
+		spec: BrokerChannelSpec{
+			Broker:        &BrokerSpec{Host: "mosquitto", Port: 1883},
+			Subscriptions: []Subscription{{Topic: "site/#", QoS: 1}},
+			Buffer:        &Buffer{MaxSize: quantity("0"), MaxAge: &metav1.Duration{Duration: -time.Minute}},
+			SourceSpec:    validSink,
+		},
+		want: "expected 1 <= 0 <= +Inf: buffer.maxSize\nexpected 1ns <= -1m0s <= +Inf: buffer.maxAge",
+	}, {
+		name: "valid rate limit",
+		spec: BrokerChannelSpec{
+			Broker:        &BrokerSpec{Host: "mosquitto", Port: 1883},
+			Subscriptions: []Subscription{{Topic: "site/#", QoS: 1}},
+			RateLimit:     &RateLimit{EventsPerSecond: 50, Burst: 100},
+			MaxInFlight:   int32Ptr(10),
+			SourceSpec:    validSink,
+		},
+	}, {
+		name: "invalid rate limit",
+		spec: BrokerChannelSpec{
+			Broker:        &BrokerSpec{Host: "mosquitto", Port: 1883},
+			Subscriptions: []Subscription{{Topic: "site/#", QoS: 1}},
+			RateLimit:     &RateLimit{EventsPerSecond: 0, Burst: -1},
+			MaxInFlight:   int32Ptr(70000),
+			SourceSpec:    validSink,
+		},
+		want: "expected 0 <= -1 <= 2147483647: rateLimit.burst\n" +
+			"expected 1 <= 0 <= 2147483647: rateLimit.eventsPerSecond\n" +
+			"expected 1 <= 70000 <= 65535: maxInFlight",
+	}, {
+		name: "valid deduplication",
+		spec: BrokerChannelSpec{
+			Broker:        &BrokerSpec{Host: "mosquitto", Port: 1883},
+			Subscriptions: []Subscription{{Topic: "site/#", QoS: 1}},
+			Deduplication: &Deduplication{Path: "$.reading.id", TTL: &metav1.Duration{Duration: time.Hour}, MaxKeys: 100, Persist: true},
+			SourceSpec:    validSink,
+		},
+	}, {
+		name: "invalid deduplication",
+		spec: BrokerChannelSpec{
+			Broker:        &BrokerSpec{Host: "mosquitto", Port: 1883},
+			Subscriptions: []Subscription{{Topic: "site/#", QoS: 1}},
+			Deduplication: &Deduplication{Property: "msgid", Path: "$.reading[", TTL: &metav1.Duration{}, MaxKeys: -1},
+			SourceSpec:    validSink,
+		},
+		want: "expected 0 <= -1 <= 2147483647: deduplication.maxKeys\n" +
+			"expected 1ns <= 0s <= +Inf: deduplication.ttl\n" +
+			"expected at most one, got both: deduplication.path, deduplication.property\n" +
+			"invalid value: $.reading[: deduplication.path\nunterminated array",
+	}, {
+		name: "invalid dead letter sink",
+		spec: BrokerChannelSpec{
+			Broker:         &BrokerSpec{Host: "mosquitto", Port: 1883},
+			Subscriptions:  []Subscription{{Topic: "site/#", QoS: 1}},
+			DeadLetterSink: &duckv1.Destination{},
+			SourceSpec:     validSink,
+		},
+		want: "expected at least one, got none: deadLetterSink.ref, deadLetterSink.uri",
+	}, {
+		name: "valid sink auth",
+		spec: BrokerChannelSpec{
+			Broker:        &BrokerSpec{Host: "mosquitto", Port: 1883},
+			Subscriptions: []Subscription{{Topic: "site/#", QoS: 1}},
+			SinkAuth: &SinkAuth{
+				CACert:     secretKey("sink-tls", "ca.crt"),
+				ClientCert: secretKey("sink-tls", "tls.crt"),
+				ClientKey:  secretKey("sink-tls", "tls.key"),
+				Headers:    &corev1.LocalObjectReference{Name: "sink-headers"},
+				OAuth2: &OAuth2ClientCredentials{
+					TokenURL:     "https://auth.example.com/token",
+					ClientID:     secretKey("sink-oauth2", "client-id"),
+					ClientSecret: secretKey("sink-oauth2", "client-secret"),
+				},
+				Signing: &Signing{Key: secretKey("sink-signing", "key"), Algorithm: HMACSHA512},
+			},
+			SourceSpec: validSink,
+		},
+	}, {
+		name: "invalid sink auth",
+		spec: BrokerChannelSpec{
+			Broker:        &BrokerSpec{Host: "mosquitto", Port: 1883},
+			Subscriptions: []Subscription{{Topic: "site/#", QoS: 1}},
+			SinkAuth: &SinkAuth{
+				ClientCert: secretKey("sink-tls", "tls.crt"),
+				Headers:    &corev1.LocalObjectReference{},
+				OAuth2: &OAuth2ClientCredentials{
+					TokenURL: "/token",
+					ClientID: secretKey("sink-oauth2", ""),
+				},
+				Signing: &Signing{Algorithm: "HMAC-MD5"},
+			},
+			SourceSpec: validSink,
+		},
+		want: "invalid value: /token: sinkAuth.oauth2.tokenURL\n" +
+			"invalid value: HMAC-MD5: sinkAuth.signing.algorithm\n" +
+			"missing field(s): sinkAuth.clientKey, sinkAuth.headers.name, sinkAuth.oauth2.clientID.key, sinkAuth.oauth2.clientSecret, sinkAuth.signing.key",
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := tc.spec.Validate(context.Background())
+			if got.Error() != tc.want {
+				t.Errorf("Validate() = %q, want %q", got.Error(), tc.want)
+			}
+		})
+	}
+}
+
+func secretKey(name, key string) *corev1.SecretKeySelector {
+	return &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: name}, Key: key}
+}
+
+func int32Ptr(i int32) *int32 {
+	return &i
+}
+
+func quantity(s string) *resource.Quantity {
+	q := resource.MustParse(s)
+	return &q
+}
+
+func TestBrokerChannelImmutableFields(t *testing.T) {
+	original := &BrokerChannel{
+		Spec: BrokerChannelSpec{
+			Broker:        &BrokerSpec{Host: "mosquitto", Port: 1883},
+			Subscriptions: []Subscription{{Topic: "motion"}},
+			SourceSpec:    validSink,
+		},
+	}
+	ctx := apis.WithinUpdate(context.Background(), original)
+
+	subscriptionsChanged := original.DeepCopy()
+	subscriptionsChanged.Spec.Subscriptions = append(subscriptionsChanged.Spec.Subscriptions, Subscription{Topic: "sensors/#"})
+	if err := subscriptionsChanged.Validate(ctx); err != nil {
+		t.Errorf("Validate() = %v, wanted subscriptions to be mutable", err)
+	}
+
+	brokerChanged := original.DeepCopy()
+	brokerChanged.Spec.Broker.TLS = true
+	if err := brokerChanged.Validate(ctx); err != nil {
+		t.Errorf("Validate() = %v, wanted broker to be mutable", err)
+	}
+
+	modeDefaulted := original.DeepCopy()
+	modeDefaulted.Spec.SubscriptionMode = ExclusiveSubscriptions
+	if err := modeDefaulted.Validate(ctx); err != nil {
+		t.Errorf("Validate() = %v, wanted no error for the default subscriptionMode", err)
+	}
+
+	modeChanged := original.DeepCopy()
+	modeChanged.Spec.SubscriptionMode = SharedSubscriptions
+	if err := modeChanged.Validate(ctx); err == nil {
+		t.Error("Validate() = nil, wanted an error for a changed subscriptionMode")
+	}
+}
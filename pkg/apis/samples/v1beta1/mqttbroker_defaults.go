@@ -0,0 +1,41 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"context"
+)
+
+// SetDefaults mutates MQTTBroker.
+func (mb *MQTTBroker) SetDefaults(ctx context.Context) {
+	mb.Spec.SetDefaults(ctx)
+}
+
+func (mbs *MQTTBrokerSpec) SetDefaults(ctx context.Context) {
+	if mbs.Port == 0 {
+		mbs.Port = DefaultBrokerPort
+		if mbs.TLS != nil {
+			mbs.Port = DefaultTLSBrokerPort
+		}
+	}
+	if mbs.ProtocolVersion == 0 {
+		mbs.ProtocolVersion = MQTTProtocolVersion5
+	}
+	if mbs.KeepAlive == 0 {
+		mbs.KeepAlive = DefaultKeepAlive
+	}
+}
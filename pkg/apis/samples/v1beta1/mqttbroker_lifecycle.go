@@ -0,0 +1,82 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"knative.dev/pkg/apis"
+)
+
+var mbCondSet = apis.NewLivingConditionSet(MQTTBrokerConditionReachable)
+
+const (
+	// MQTTBrokerConditionReady has status True when all subconditions below have been set to True.
+	MQTTBrokerConditionReady = apis.ConditionReady
+	// MQTTBrokerConditionReachable has status True when the controller could
+	// open an MQTT session with the broker, using its credentials.
+	MQTTBrokerConditionReachable apis.ConditionType = "Reachable"
+)
+
+// GetConditionSet retrieves the condition set for this resource. Implements the KRShaped interface.
+func (*MQTTBroker) GetConditionSet() apis.ConditionSet {
+	return mbCondSet
+}
+
+// GetUntypedSpec returns the spec of the MQTTBroker.
+func (mb *MQTTBroker) GetUntypedSpec() interface{} {
+	return mb.Spec
+}
+
+// GetCondition returns the condition currently associated with the given type, or nil.
+func (mbs *MQTTBrokerStatus) GetCondition(t apis.ConditionType) *apis.Condition {
+	return mbCondSet.Manage(mbs).GetCondition(t)
+}
+
+// IsReady returns true if the resource is ready overall.
+func (mbs *MQTTBrokerStatus) IsReady() bool {
+	return mbCondSet.Manage(mbs).IsHappy()
+}
+
+// InitializeConditions sets relevant unset conditions to Unknown state.
+func (mbs *MQTTBrokerStatus) InitializeConditions() {
+	mbCondSet.Manage(mbs).InitializeConditions()
+}
+
+// MarkReachable sets the condition that the broker accepts sessions.
+func (mbs *MQTTBrokerStatus) MarkReachable() {
+	mbCondSet.Manage(mbs).MarkTrue(MQTTBrokerConditionReachable)
+}
+
+// MarkUnreachable sets the condition that the broker cannot be connected to.
+func (mbs *MQTTBrokerStatus) MarkUnreachable(reason, messageFormat string, messageA ...interface{}) {
+	mbCondSet.Manage(mbs).MarkFalse(MQTTBrokerConditionReachable, reason, messageFormat, messageA...)
+}
+
+// PropagateMQTTBrokerStatus mirrors the readiness of an MQTTBroker in the
+// condition t of the resource referencing it.
+func PropagateMQTTBrokerStatus(m apis.ConditionManager, t apis.ConditionType, mbs *MQTTBrokerStatus) {
+	cond := mbs.GetCondition(MQTTBrokerConditionReady)
+	switch {
+	case cond == nil:
+		m.MarkUnknown(t, "BrokerUnknown", "The status of the MQTTBroker is unknown.")
+	case cond.IsTrue():
+		m.MarkTrue(t)
+	case cond.IsFalse():
+		m.MarkFalse(t, cond.Reason, "%s", cond.Message)
+	default:
+		m.MarkUnknown(t, cond.Reason, "%s", cond.Message)
+	}
+}
@@ -0,0 +1,159 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"knative.dev/pkg/apis"
+	"knative.dev/pkg/apis/duck"
+	duckv1 "knative.dev/pkg/apis/duck/v1"
+	"knative.dev/pkg/kmeta"
+	"knative.dev/pkg/webhook/resourcesemantics"
+)
+
+// +genclient
+// +genreconciler
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// MQTTBroker is a connection profile for an MQTT broker, shared by the
+// BrokerChannels which reference it.
+type MQTTBroker struct {
+	metav1.TypeMeta `json:",inline"`
+	// +optional
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	// Spec holds the desired state of the MQTTBroker (from the client).
+	Spec MQTTBrokerSpec `json:"spec,omitempty"`
+
+	// Status communicates the observed state of the MQTTBroker (from the controller).
+	// +optional
+	Status MQTTBrokerStatus `json:"status,omitempty"`
+}
+
+// GetGroupVersionKind returns the GroupVersionKind.
+func (*MQTTBroker) GetGroupVersionKind() schema.GroupVersionKind {
+	return SchemeGroupVersion.WithKind("MQTTBroker")
+}
+
+var (
+	// Check that MQTTBroker can be validated and defaulted.
+	_ apis.Defaultable = (*MQTTBroker)(nil)
+	_ apis.Validatable = (*MQTTBroker)(nil)
+	// Check that we can create OwnerReferences to an MQTTBroker.
+	_ kmeta.OwnerRefable = (*MQTTBroker)(nil)
+	// Check that MQTTBroker is a runtime.Object.
+	_ runtime.Object = (*MQTTBroker)(nil)
+	// Check that MQTTBroker satisfies resourcesemantics.GenericCRD.
+	_ resourcesemantics.GenericCRD = (*MQTTBroker)(nil)
+	// Check that MQTTBroker implements the Conditions duck type.
+	_ = duck.VerifyType(&MQTTBroker{}, &duckv1.Conditions{})
+	// Check that the type conforms to the duck Knative Resource shape.
+	_ duckv1.KRShaped = (*MQTTBroker)(nil)
+)
+
+// MQTTBrokerSpec holds the desired state of the MQTTBroker (from the client).
+type MQTTBrokerSpec struct {
+	// Host is the hostname or IP address of the broker.
+	Host string `json:"host"`
+
+	// Port defaults to 1883, or 8883 when TLS is configured.
+	// +optional
+	Port int32 `json:"port,omitempty"`
+
+	// ProtocolVersion is the MQTT protocol version spoken to the broker.
+	// Only 5 is supported, which is also the default.
+	// +optional
+	ProtocolVersion int32 `json:"protocolVersion,omitempty"`
+
+	// TLS connects to the broker over TLS when set.
+	// +optional
+	TLS *BrokerTLS `json:"tls,omitempty"`
+
+	// Credentials authenticate the clients to the broker.
+	// +optional
+	Credentials *BrokerCredentials `json:"credentials,omitempty"`
+
+	// KeepAlive is the MQTT keep alive interval in seconds, 30 by default.
+	// +optional
+	KeepAlive int32 `json:"keepAlive,omitempty"`
+}
+
+// BrokerTLS configures the TLS connection to a broker. The secrets are read
+// from the namespace of the MQTTBroker.
+type BrokerTLS struct {
+	// CACert holds the PEM certificates used to verify the broker. The system
+	// roots are used when it is not set.
+	// +optional
+	CACert *corev1.SecretKeySelector `json:"caCert,omitempty"`
+
+	// ClientCert and ClientKey hold the PEM certificate and key presented to
+	// the broker. Both or neither must be set.
+	// +optional
+	ClientCert *corev1.SecretKeySelector `json:"clientCert,omitempty"`
+	// +optional
+	ClientKey *corev1.SecretKeySelector `json:"clientKey,omitempty"`
+
+	// ServerName overrides the name verified in the broker certificate,
+	// which is the host by default.
+	// +optional
+	ServerName string `json:"serverName,omitempty"`
+}
+
+// BrokerCredentials holds the MQTT user name and password of the clients.
+type BrokerCredentials struct {
+	Username *corev1.SecretKeySelector `json:"username"`
+	// +optional
+	Password *corev1.SecretKeySelector `json:"password,omitempty"`
+}
+
+const (
+	// MQTTProtocolVersion5 is the only protocol version supported by the
+	// data plane.
+	MQTTProtocolVersion5 = 5
+
+	// DefaultKeepAlive is the keep alive interval, in seconds, used when
+	// none is set.
+	DefaultKeepAlive = 30
+)
+
+// Endpoint returns where the broker is reached.
+func (mbs *MQTTBrokerSpec) Endpoint() *BrokerSpec {
+	return &BrokerSpec{Host: mbs.Host, Port: mbs.Port, TLS: mbs.TLS != nil}
+}
+
+// MQTTBrokerStatus communicates the observed state of the MQTTBroker (from the controller).
+type MQTTBrokerStatus struct {
+	duckv1.Status `json:",inline"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// MQTTBrokerList is a list of MQTTBroker resources
+type MQTTBrokerList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata"`
+
+	Items []MQTTBroker `json:"items"`
+}
+
+// GetStatus retrieves the status of the resource. Implements the KRShaped interface.
+func (mb *MQTTBroker) GetStatus() *duckv1.Status {
+	return &mb.Status.Status
+}
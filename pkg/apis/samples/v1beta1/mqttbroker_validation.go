@@ -0,0 +1,89 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"context"
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+	"knative.dev/pkg/apis"
+)
+
+func (mb *MQTTBroker) Validate(ctx context.Context) *apis.FieldError {
+	return mb.Spec.Validate(ctx).ViaField("spec")
+}
+
+func (mbs *MQTTBrokerSpec) Validate(ctx context.Context) *apis.FieldError {
+	errs := mbs.Endpoint().Validate(ctx)
+
+	// A zero version is replaced by the defaulting webhook.
+	if mbs.ProtocolVersion != 0 && mbs.ProtocolVersion != MQTTProtocolVersion5 {
+		fe := apis.ErrInvalidValue(strconv.Itoa(int(mbs.ProtocolVersion)), "protocolVersion")
+		fe.Details = "only MQTT 5 is supported"
+		errs = errs.Also(fe)
+	}
+
+	if mbs.KeepAlive < 0 || mbs.KeepAlive > 65535 {
+		errs = errs.Also(apis.ErrOutOfBoundsValue(mbs.KeepAlive, 0, 65535, "keepAlive"))
+	}
+
+	if mbs.TLS != nil {
+		errs = errs.Also(mbs.TLS.Validate(ctx).ViaField("tls"))
+	}
+	if mbs.Credentials != nil {
+		errs = errs.Also(mbs.Credentials.Validate(ctx).ViaField("credentials"))
+	}
+	return errs
+}
+
+func (bt *BrokerTLS) Validate(ctx context.Context) *apis.FieldError {
+	errs := validateSecretKeySelector(bt.CACert).ViaField("caCert").
+		Also(validateSecretKeySelector(bt.ClientCert).ViaField("clientCert")).
+		Also(validateSecretKeySelector(bt.ClientKey).ViaField("clientKey"))
+
+	if bt.ClientCert != nil && bt.ClientKey == nil {
+		errs = errs.Also(apis.ErrMissingField("clientKey"))
+	} else if bt.ClientCert == nil && bt.ClientKey != nil {
+		errs = errs.Also(apis.ErrMissingField("clientCert"))
+	}
+	return errs
+}
+
+func (bc *BrokerCredentials) Validate(ctx context.Context) *apis.FieldError {
+	var errs *apis.FieldError
+	if bc.Username == nil {
+		errs = errs.Also(apis.ErrMissingField("username"))
+	}
+	return errs.Also(validateSecretKeySelector(bc.Username).ViaField("username")).
+		Also(validateSecretKeySelector(bc.Password).ViaField("password"))
+}
+
+// validateSecretKeySelector checks that an optional selector designates a key.
+func validateSecretKeySelector(s *corev1.SecretKeySelector) *apis.FieldError {
+	if s == nil {
+		return nil
+	}
+	var errs *apis.FieldError
+	if s.Name == "" {
+		errs = errs.Also(apis.ErrMissingField("name"))
+	}
+	if s.Key == "" {
+		errs = errs.Also(apis.ErrMissingField("key"))
+	}
+	return errs
+}
@@ -0,0 +1,92 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestMQTTBrokerSpecValidation(t *testing.T) {
+	secret := func(name, key string) *corev1.SecretKeySelector {
+		return &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: name}, Key: key}
+	}
+
+	tests := []struct {
+		name string
+		spec MQTTBrokerSpec
+		want string
+	}{{
+		name: "valid",
+		spec: MQTTBrokerSpec{
+			Host:            "mosquitto.default.svc",
+			Port:            8883,
+			ProtocolVersion: 5,
+			TLS: &BrokerTLS{
+				CACert:     secret("mosquitto-tls", "ca.crt"),
+				ClientCert: secret("mosquitto-tls", "tls.crt"),
+				ClientKey:  secret("mosquitto-tls", "tls.key"),
+			},
+			Credentials: &BrokerCredentials{
+				Username: secret("mosquitto-auth", "username"),
+				Password: secret("mosquitto-auth", "password"),
+			},
+			KeepAlive: 60,
+		},
+	}, {
+		name: "missing host",
+		spec: MQTTBrokerSpec{},
+		want: "missing field(s): host",
+	}, {
+		name: "unsupported protocol version",
+		spec: MQTTBrokerSpec{Host: "mosquitto", ProtocolVersion: 4},
+		want: "invalid value: 4: protocolVersion\nonly MQTT 5 is supported",
+	}, {
+		name: "keep alive out of range",
+		spec: MQTTBrokerSpec{Host: "mosquitto", KeepAlive: 65536},
+		want: "expected 0 <= 65536 <= 65535: keepAlive",
+	}, {
+		name: "client certificate without key",
+		spec: MQTTBrokerSpec{Host: "mosquitto", TLS: &BrokerTLS{ClientCert: secret("mosquitto-tls", "")}},
+		want: "missing field(s): tls.clientCert.key, tls.clientKey",
+	}, {
+		name: "credentials without username",
+		spec: MQTTBrokerSpec{Host: "mosquitto", Credentials: &BrokerCredentials{Password: secret("", "password")}},
+		want: "missing field(s): credentials.password.name, credentials.username",
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := tc.spec.Validate(context.Background())
+			if got.Error() != tc.want {
+				t.Errorf("Validate() = %q, want %q", got.Error(), tc.want)
+			}
+		})
+	}
+}
+
+func TestMQTTBrokerSpecDefaults(t *testing.T) {
+	got := MQTTBrokerSpec{Host: "mosquitto", TLS: &BrokerTLS{}}
+	got.SetDefaults(context.Background())
+
+	want := MQTTBrokerSpec{Host: "mosquitto", Port: 8883, ProtocolVersion: 5, TLS: &BrokerTLS{}, KeepAlive: 30}
+	if got.Port != want.Port || got.ProtocolVersion != want.ProtocolVersion || got.KeepAlive != want.KeepAlive {
+		t.Errorf("SetDefaults() = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,47 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"context"
+	"path"
+
+	"knative.dev/pkg/apis"
+)
+
+// SetDefaults mutates MQTTChannel.
+func (mc *MQTTChannel) SetDefaults(ctx context.Context) {
+	ctx = apis.WithinParent(ctx, mc.ObjectMeta)
+	if mc.Spec.Topic == "" && mc.Name != "" {
+		mc.Spec.Topic = DefaultChannelTopic(mc.Namespace, mc.Name)
+	}
+	mc.Spec.SetDefaults(ctx)
+}
+
+func (mcs *MQTTChannelSpec) SetDefaults(ctx context.Context) {
+	if mcs.Broker != nil {
+		mcs.Broker.SetDefaults(ctx)
+	}
+	if mcs.Delivery != nil && mcs.Delivery.DeadLetterSink != nil {
+		mcs.Delivery.DeadLetterSink.SetDefaults(ctx)
+	}
+}
+
+// DefaultChannelTopic is the topic of an MQTTChannel which does not set one.
+func DefaultChannelTopic(namespace, name string) string {
+	return path.Join("knative/channels", namespace, name)
+}
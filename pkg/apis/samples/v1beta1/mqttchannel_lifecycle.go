@@ -0,0 +1,99 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"knative.dev/pkg/apis"
+	duckv1 "knative.dev/pkg/apis/duck/v1"
+)
+
+var mcCondSet = apis.NewLivingConditionSet(MQTTChannelConditionBrokerReady, MQTTChannelConditionChannelServiceReady, MQTTChannelConditionAddressable)
+
+const (
+	// MQTTChannelConditionReady has status True when all subconditions below have been set to True.
+	MQTTChannelConditionReady = apis.ConditionReady
+	// MQTTChannelConditionBrokerReady has status True when the referenced
+	// MQTTBroker is ready, or when the broker is given inline.
+	MQTTChannelConditionBrokerReady apis.ConditionType = "BrokerReady"
+	// MQTTChannelConditionChannelServiceReady has status True when the
+	// Service routing the address of the channel to the dispatcher exists.
+	MQTTChannelConditionChannelServiceReady apis.ConditionType = "ChannelServiceReady"
+	// MQTTChannelConditionAddressable has status True when the channel has
+	// an address.
+	MQTTChannelConditionAddressable apis.ConditionType = "Addressable"
+)
+
+// GetConditionSet retrieves the condition set for this resource. Implements the KRShaped interface.
+func (*MQTTChannel) GetConditionSet() apis.ConditionSet {
+	return mcCondSet
+}
+
+// GetUntypedSpec returns the spec of the MQTTChannel.
+func (mc *MQTTChannel) GetUntypedSpec() interface{} {
+	return mc.Spec
+}
+
+// GetCondition returns the condition currently associated with the given type, or nil.
+func (mcs *MQTTChannelStatus) GetCondition(t apis.ConditionType) *apis.Condition {
+	return mcCondSet.Manage(mcs).GetCondition(t)
+}
+
+// IsReady returns true if the resource is ready overall.
+func (mcs *MQTTChannelStatus) IsReady() bool {
+	return mcCondSet.Manage(mcs).IsHappy()
+}
+
+// InitializeConditions sets relevant unset conditions to Unknown state.
+func (mcs *MQTTChannelStatus) InitializeConditions() {
+	mcCondSet.Manage(mcs).InitializeConditions()
+}
+
+// MarkBrokerReady sets the condition that the broker can be connected to.
+func (mcs *MQTTChannelStatus) MarkBrokerReady() {
+	mcCondSet.Manage(mcs).MarkTrue(MQTTChannelConditionBrokerReady)
+}
+
+// MarkNoBroker sets the condition that the referenced MQTTBroker does not exist.
+func (mcs *MQTTChannelStatus) MarkNoBroker(reason, messageFormat string, messageA ...interface{}) {
+	mcCondSet.Manage(mcs).MarkFalse(MQTTChannelConditionBrokerReady, reason, messageFormat, messageA...)
+}
+
+// PropagateBrokerStatus mirrors the readiness of the referenced MQTTBroker.
+func (mcs *MQTTChannelStatus) PropagateBrokerStatus(mbs *MQTTBrokerStatus) {
+	PropagateMQTTBrokerStatus(mcCondSet.Manage(mcs), MQTTChannelConditionBrokerReady, mbs)
+}
+
+// MarkChannelServiceTrue sets the condition that the channel Service exists.
+func (mcs *MQTTChannelStatus) MarkChannelServiceTrue() {
+	mcCondSet.Manage(mcs).MarkTrue(MQTTChannelConditionChannelServiceReady)
+}
+
+// MarkChannelServiceFailed sets the condition that the channel Service could
+// not be reconciled.
+func (mcs *MQTTChannelStatus) MarkChannelServiceFailed(reason, messageFormat string, messageA ...interface{}) {
+	mcCondSet.Manage(mcs).MarkFalse(MQTTChannelConditionChannelServiceReady, reason, messageFormat, messageA...)
+}
+
+// SetAddress sets the address of the channel and the Addressable condition.
+func (mcs *MQTTChannelStatus) SetAddress(url *apis.URL) {
+	mcs.Address = &duckv1.Addressable{URL: url}
+	if url != nil {
+		mcCondSet.Manage(mcs).MarkTrue(MQTTChannelConditionAddressable)
+	} else {
+		mcCondSet.Manage(mcs).MarkFalse(MQTTChannelConditionAddressable, "EmptyHostname", "hostname is the empty string")
+	}
+}
@@ -0,0 +1,117 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	eventingduckv1 "knative.dev/eventing/pkg/apis/duck/v1"
+	"knative.dev/pkg/apis"
+	"knative.dev/pkg/apis/duck"
+	duckv1 "knative.dev/pkg/apis/duck/v1"
+	"knative.dev/pkg/kmeta"
+	"knative.dev/pkg/webhook/resourcesemantics"
+)
+
+// +genclient
+// +genreconciler
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// MQTTChannel is a Knative Channel storing its events in an MQTT topic.
+type MQTTChannel struct {
+	metav1.TypeMeta `json:",inline"`
+	// +optional
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	// Spec holds the desired state of the MQTTChannel (from the client).
+	Spec MQTTChannelSpec `json:"spec,omitempty"`
+
+	// Status communicates the observed state of the MQTTChannel (from the controller).
+	// +optional
+	Status MQTTChannelStatus `json:"status,omitempty"`
+}
+
+// GetGroupVersionKind returns the GroupVersionKind.
+func (*MQTTChannel) GetGroupVersionKind() schema.GroupVersionKind {
+	return SchemeGroupVersion.WithKind("MQTTChannel")
+}
+
+var (
+	// Check that MQTTChannel can be validated and defaulted.
+	_ apis.Defaultable = (*MQTTChannel)(nil)
+	_ apis.Validatable = (*MQTTChannel)(nil)
+	// Check that we can create OwnerReferences to an MQTTChannel.
+	_ kmeta.OwnerRefable = (*MQTTChannel)(nil)
+	// Check that MQTTChannel is a runtime.Object.
+	_ runtime.Object = (*MQTTChannel)(nil)
+	// Check that MQTTChannel satisfies resourcesemantics.GenericCRD.
+	_ resourcesemantics.GenericCRD = (*MQTTChannel)(nil)
+	// Check that MQTTChannel is a Channelable.
+	_ = duck.VerifyType(&MQTTChannel{}, &eventingduckv1.Channelable{})
+	// Check that the type conforms to the duck Knative Resource shape.
+	_ duckv1.KRShaped = (*MQTTChannel)(nil)
+)
+
+// MQTTChannelSpec holds the desired state of the MQTTChannel (from the client).
+type MQTTChannelSpec struct {
+	// Broker describes how to reach the MQTT broker storing the events.
+	// Exactly one of Broker and BrokerRef must be set.
+	// +optional
+	Broker *BrokerSpec `json:"broker,omitempty"`
+
+	// BrokerRef names the MQTTBroker, in the namespace of the MQTTChannel,
+	// holding the connection profile of the broker.
+	// +optional
+	BrokerRef *corev1.LocalObjectReference `json:"brokerRef,omitempty"`
+
+	// Topic is the MQTT topic the events of the channel are published to.
+	// Defaults to knative/channels/<namespace>/<name>.
+	// +optional
+	Topic string `json:"topic,omitempty"`
+
+	// inherits the eventing duck/v1 ChannelableSpec, which provides:
+	// * Subscribers - the subscribers of the channel, managed by the
+	//   Subscriptions of the channel.
+	// * Delivery - the default delivery options of the subscribers.
+	eventingduckv1.ChannelableSpec `json:",inline"`
+}
+
+// MQTTChannelStatus communicates the observed state of the MQTTChannel (from the controller).
+type MQTTChannelStatus struct {
+	// inherits the eventing duck/v1 ChannelableStatus, which provides:
+	// * ObservedGeneration and Conditions
+	// * Address - where the events of the channel are sent.
+	// * Subscribers - the status of each subscriber.
+	eventingduckv1.ChannelableStatus `json:",inline"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// MQTTChannelList is a list of MQTTChannel resources
+type MQTTChannelList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata"`
+
+	Items []MQTTChannel `json:"items"`
+}
+
+// GetStatus retrieves the status of the resource. Implements the KRShaped interface.
+func (mc *MQTTChannel) GetStatus() *duckv1.Status {
+	return &mc.Status.Status
+}
@@ -0,0 +1,94 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"knative.dev/pkg/apis"
+	"knative.dev/pkg/kmp"
+
+	"github.com/ShixiongQi/brokerchannel/pkg/mqtt"
+)
+
+func (mc *MQTTChannel) Validate(ctx context.Context) *apis.FieldError {
+	errs := mc.Spec.Validate(ctx).ViaField("spec")
+
+	if apis.IsInUpdate(ctx) {
+		original := apis.GetBaseline(ctx).(*MQTTChannel)
+		errs = errs.Also(mc.CheckImmutableFields(ctx, original))
+	}
+	return errs
+}
+
+func (mcs *MQTTChannelSpec) Validate(ctx context.Context) *apis.FieldError {
+	errs := validateBrokerSource(ctx, mcs.Broker, mcs.BrokerRef)
+
+	// An empty topic is replaced by the defaulting webhook.
+	if mcs.Topic != "" {
+		if err := mqtt.ValidateTopicName(mcs.Topic); err != nil {
+			fe := apis.ErrInvalidValue(mcs.Topic, "topic")
+			fe.Details = err.Error()
+			errs = errs.Also(fe)
+		}
+	}
+
+	for i, sub := range mcs.Subscribers {
+		if sub.SubscriberURI == nil && sub.ReplyURI == nil {
+			fe := apis.ErrMissingField("replyUri", "subscriberUri")
+			fe.Details = "expected at least one of, got none"
+			errs = errs.Also(fe.ViaFieldIndex("subscribers", i))
+		}
+	}
+
+	if mcs.Delivery != nil {
+		errs = errs.Also(mcs.Delivery.Validate(ctx).ViaField("delivery"))
+	}
+	return errs
+}
+
+// CheckImmutableFields rejects changes to the broker and the topic, which
+// would strand the events stored by the channel.
+func (mc *MQTTChannel) CheckImmutableFields(ctx context.Context, original *MQTTChannel) *apis.FieldError {
+	if original == nil {
+		return nil
+	}
+
+	type storage struct {
+		Broker    *BrokerSpec
+		BrokerRef *corev1.LocalObjectReference
+		Topic     string
+	}
+	before := storage{original.Spec.Broker, original.Spec.BrokerRef, original.Spec.Topic}
+	after := storage{mc.Spec.Broker, mc.Spec.BrokerRef, mc.Spec.Topic}
+	if diff, err := kmp.ShortDiff(before, after); err != nil {
+		return &apis.FieldError{
+			Message: "Failed to diff MQTTChannel",
+			Paths:   []string{"spec"},
+			Details: err.Error(),
+		}
+	} else if diff != "" {
+		return &apis.FieldError{
+			Message: "Immutable fields changed (-old +new)",
+			Paths:   []string{"spec"},
+			Details: diff,
+		}
+	}
+	return nil
+}
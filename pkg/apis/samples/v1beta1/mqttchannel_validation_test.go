@@ -0,0 +1,94 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	eventingduckv1 "knative.dev/eventing/pkg/apis/duck/v1"
+	"knative.dev/pkg/apis"
+)
+
+func TestMQTTChannelSpecValidation(t *testing.T) {
+	ref := &corev1.LocalObjectReference{Name: "mosquitto"}
+	subscriber := apis.HTTP("subscriber.default.svc")
+
+	tests := []struct {
+		name string
+		spec MQTTChannelSpec
+		want string
+	}{{
+		name: "valid",
+		spec: MQTTChannelSpec{
+			BrokerRef: ref,
+			Topic:     "knative/channels/default/orders",
+			ChannelableSpec: eventingduckv1.ChannelableSpec{
+				SubscribableSpec: eventingduckv1.SubscribableSpec{
+					Subscribers: []eventingduckv1.SubscriberSpec{{SubscriberURI: subscriber}},
+				},
+			},
+		},
+	}, {
+		name: "missing broker",
+		spec: MQTTChannelSpec{Topic: "orders"},
+		want: "expected exactly one, got neither: broker, brokerRef",
+	}, {
+		name: "wildcard topic",
+		spec: MQTTChannelSpec{BrokerRef: ref, Topic: "orders/#"},
+		want: "invalid value: orders/#: topic\n" + "wildcards are not allowed in topic names",
+	}, {
+		name: "subscriber without destination",
+		spec: MQTTChannelSpec{
+			BrokerRef: ref,
+			ChannelableSpec: eventingduckv1.ChannelableSpec{
+				SubscribableSpec: eventingduckv1.SubscribableSpec{
+					Subscribers: []eventingduckv1.SubscriberSpec{{}},
+				},
+			},
+		},
+		want: "missing field(s): subscribers[0].replyUri, subscribers[0].subscriberUri\n" + "expected at least one of, got none",
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := tc.spec.Validate(context.Background())
+			if got.Error() != tc.want {
+				t.Errorf("Validate() = %q, want %q", got.Error(), tc.want)
+			}
+		})
+	}
+}
+
+func TestMQTTChannelImmutableTopic(t *testing.T) {
+	original := &MQTTChannel{Spec: MQTTChannelSpec{Topic: "orders"}}
+	mc := original.DeepCopy()
+	mc.Spec.Topic = "invoices"
+	if err := mc.CheckImmutableFields(context.Background(), original); err == nil {
+		t.Error("CheckImmutableFields() = nil, want an error")
+	}
+}
+
+func TestMQTTChannelDefaults(t *testing.T) {
+	mc := &MQTTChannel{Spec: MQTTChannelSpec{BrokerRef: &corev1.LocalObjectReference{Name: "mosquitto"}}}
+	mc.Namespace, mc.Name = "default", "orders"
+	mc.SetDefaults(context.Background())
+	if want := "knative/channels/default/orders"; mc.Spec.Topic != want {
+		t.Errorf("Topic = %q, want %q", mc.Spec.Topic, want)
+	}
+}
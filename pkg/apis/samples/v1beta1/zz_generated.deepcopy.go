@@ -0,0 +1,867 @@
+// +build !ignore_autogenerated
+
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Code generated by deepcopy-gen. DO NOT EDIT.
+
+package v1beta1
+
+import (
+	v1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	runtime "k8s.io/apimachinery/pkg/runtime"
+	apis "knative.dev/pkg/apis"
+	duckv1 "knative.dev/pkg/apis/duck/v1"
+)
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BrokerChannel) DeepCopyInto(out *BrokerChannel) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BrokerChannel.
+func (in *BrokerChannel) DeepCopy() *BrokerChannel {
+	if in == nil {
+		return nil
+	}
+	out := new(BrokerChannel)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *BrokerChannel) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BrokerChannelList) DeepCopyInto(out *BrokerChannelList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]BrokerChannel, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BrokerChannelList.
+func (in *BrokerChannelList) DeepCopy() *BrokerChannelList {
+	if in == nil {
+		return nil
+	}
+	out := new(BrokerChannelList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *BrokerChannelList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BrokerChannelSpec) DeepCopyInto(out *BrokerChannelSpec) {
+	*out = *in
+	if in.Broker != nil {
+		in, out := &in.Broker, &out.Broker
+		*out = new(BrokerSpec)
+		**out = **in
+	}
+	if in.BrokerRef != nil {
+		in, out := &in.BrokerRef, &out.BrokerRef
+		*out = new(v1.LocalObjectReference)
+		**out = **in
+	}
+	if in.Subscriptions != nil {
+		in, out := &in.Subscriptions, &out.Subscriptions
+		*out = make([]Subscription, len(*in))
+		copy(*out, *in)
+	}
+	if in.Filter != nil {
+		in, out := &in.Filter, &out.Filter
+		*out = new(Filter)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Transform != nil {
+		in, out := &in.Transform, &out.Transform
+		*out = new(Transform)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Routes != nil {
+		in, out := &in.Routes, &out.Routes
+		*out = make([]Route, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Buffer != nil {
+		in, out := &in.Buffer, &out.Buffer
+		*out = new(Buffer)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.RateLimit != nil {
+		in, out := &in.RateLimit, &out.RateLimit
+		*out = new(RateLimit)
+		**out = **in
+	}
+	if in.MaxInFlight != nil {
+		in, out := &in.MaxInFlight, &out.MaxInFlight
+		*out = new(int32)
+		**out = **in
+	}
+	if in.SinkAuth != nil {
+		in, out := &in.SinkAuth, &out.SinkAuth
+		*out = new(SinkAuth)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Deduplication != nil {
+		in, out := &in.Deduplication, &out.Deduplication
+		*out = new(Deduplication)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.DeadLetterSink != nil {
+		in, out := &in.DeadLetterSink, &out.DeadLetterSink
+		*out = new(duckv1.Destination)
+		(*in).DeepCopyInto(*out)
+	}
+	in.SourceSpec.DeepCopyInto(&out.SourceSpec)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BrokerChannelSpec.
+func (in *BrokerChannelSpec) DeepCopy() *BrokerChannelSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(BrokerChannelSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BrokerChannelStatus) DeepCopyInto(out *BrokerChannelStatus) {
+	*out = *in
+	in.SourceStatus.DeepCopyInto(&out.SourceStatus)
+	if in.Routes != nil {
+		in, out := &in.Routes, &out.Routes
+		*out = make([]RouteStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.DeadLetterSinkURI != nil {
+		in, out := &in.DeadLetterSinkURI, &out.DeadLetterSinkURI
+		*out = new(apis.URL)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Buffer != nil {
+		in, out := &in.Buffer, &out.Buffer
+		*out = new(BufferStatus)
+		**out = **in
+	}
+	if in.CircuitBreakers != nil {
+		in, out := &in.CircuitBreakers, &out.CircuitBreakers
+		*out = make([]CircuitBreakerStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BrokerChannelStatus.
+func (in *BrokerChannelStatus) DeepCopy() *BrokerChannelStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(BrokerChannelStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BrokerCredentials) DeepCopyInto(out *BrokerCredentials) {
+	*out = *in
+	if in.Username != nil {
+		in, out := &in.Username, &out.Username
+		*out = new(v1.SecretKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Password != nil {
+		in, out := &in.Password, &out.Password
+		*out = new(v1.SecretKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BrokerCredentials.
+func (in *BrokerCredentials) DeepCopy() *BrokerCredentials {
+	if in == nil {
+		return nil
+	}
+	out := new(BrokerCredentials)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BrokerSpec) DeepCopyInto(out *BrokerSpec) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BrokerSpec.
+func (in *BrokerSpec) DeepCopy() *BrokerSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(BrokerSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BrokerTLS) DeepCopyInto(out *BrokerTLS) {
+	*out = *in
+	if in.CACert != nil {
+		in, out := &in.CACert, &out.CACert
+		*out = new(v1.SecretKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ClientCert != nil {
+		in, out := &in.ClientCert, &out.ClientCert
+		*out = new(v1.SecretKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ClientKey != nil {
+		in, out := &in.ClientKey, &out.ClientKey
+		*out = new(v1.SecretKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BrokerTLS.
+func (in *BrokerTLS) DeepCopy() *BrokerTLS {
+	if in == nil {
+		return nil
+	}
+	out := new(BrokerTLS)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Buffer) DeepCopyInto(out *Buffer) {
+	*out = *in
+	if in.MaxSize != nil {
+		in, out := &in.MaxSize, &out.MaxSize
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+	if in.MaxAge != nil {
+		in, out := &in.MaxAge, &out.MaxAge
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Buffer.
+func (in *Buffer) DeepCopy() *Buffer {
+	if in == nil {
+		return nil
+	}
+	out := new(Buffer)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BufferStatus) DeepCopyInto(out *BufferStatus) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BufferStatus.
+func (in *BufferStatus) DeepCopy() *BufferStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(BufferStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CircuitBreakerStatus) DeepCopyInto(out *CircuitBreakerStatus) {
+	*out = *in
+	if in.URI != nil {
+		in, out := &in.URI, &out.URI
+		*out = new(apis.URL)
+		(*in).DeepCopyInto(*out)
+	}
+	in.Since.DeepCopyInto(&out.Since)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CircuitBreakerStatus.
+func (in *CircuitBreakerStatus) DeepCopy() *CircuitBreakerStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(CircuitBreakerStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DataPlaneStatus) DeepCopyInto(out *DataPlaneStatus) {
+	*out = *in
+	if in.Buffer != nil {
+		in, out := &in.Buffer, &out.Buffer
+		*out = new(BufferStatus)
+		**out = **in
+	}
+	if in.CircuitBreakers != nil {
+		in, out := &in.CircuitBreakers, &out.CircuitBreakers
+		*out = make([]CircuitBreakerStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DataPlaneStatus.
+func (in *DataPlaneStatus) DeepCopy() *DataPlaneStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(DataPlaneStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Deduplication) DeepCopyInto(out *Deduplication) {
+	*out = *in
+	if in.TTL != nil {
+		in, out := &in.TTL, &out.TTL
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Deduplication.
+func (in *Deduplication) DeepCopy() *Deduplication {
+	if in == nil {
+		return nil
+	}
+	out := new(Deduplication)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FieldMapping) DeepCopyInto(out *FieldMapping) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FieldMapping.
+func (in *FieldMapping) DeepCopy() *FieldMapping {
+	if in == nil {
+		return nil
+	}
+	out := new(FieldMapping)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Filter) DeepCopyInto(out *Filter) {
+	*out = *in
+	if in.Exact != nil {
+		in, out := &in.Exact, &out.Exact
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Prefix != nil {
+		in, out := &in.Prefix, &out.Prefix
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Suffix != nil {
+		in, out := &in.Suffix, &out.Suffix
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Filter.
+func (in *Filter) DeepCopy() *Filter {
+	if in == nil {
+		return nil
+	}
+	out := new(Filter)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MQTTBroker) DeepCopyInto(out *MQTTBroker) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MQTTBroker.
+func (in *MQTTBroker) DeepCopy() *MQTTBroker {
+	if in == nil {
+		return nil
+	}
+	out := new(MQTTBroker)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *MQTTBroker) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MQTTBrokerList) DeepCopyInto(out *MQTTBrokerList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]MQTTBroker, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MQTTBrokerList.
+func (in *MQTTBrokerList) DeepCopy() *MQTTBrokerList {
+	if in == nil {
+		return nil
+	}
+	out := new(MQTTBrokerList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *MQTTBrokerList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MQTTBrokerSpec) DeepCopyInto(out *MQTTBrokerSpec) {
+	*out = *in
+	if in.TLS != nil {
+		in, out := &in.TLS, &out.TLS
+		*out = new(BrokerTLS)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Credentials != nil {
+		in, out := &in.Credentials, &out.Credentials
+		*out = new(BrokerCredentials)
+		(*in).DeepCopyInto(*out)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MQTTBrokerSpec.
+func (in *MQTTBrokerSpec) DeepCopy() *MQTTBrokerSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(MQTTBrokerSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MQTTBrokerStatus) DeepCopyInto(out *MQTTBrokerStatus) {
+	*out = *in
+	in.Status.DeepCopyInto(&out.Status)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MQTTBrokerStatus.
+func (in *MQTTBrokerStatus) DeepCopy() *MQTTBrokerStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(MQTTBrokerStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MQTTChannel) DeepCopyInto(out *MQTTChannel) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MQTTChannel.
+func (in *MQTTChannel) DeepCopy() *MQTTChannel {
+	if in == nil {
+		return nil
+	}
+	out := new(MQTTChannel)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *MQTTChannel) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MQTTChannelList) DeepCopyInto(out *MQTTChannelList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]MQTTChannel, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MQTTChannelList.
+func (in *MQTTChannelList) DeepCopy() *MQTTChannelList {
+	if in == nil {
+		return nil
+	}
+	out := new(MQTTChannelList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *MQTTChannelList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MQTTChannelSpec) DeepCopyInto(out *MQTTChannelSpec) {
+	*out = *in
+	if in.Broker != nil {
+		in, out := &in.Broker, &out.Broker
+		*out = new(BrokerSpec)
+		**out = **in
+	}
+	if in.BrokerRef != nil {
+		in, out := &in.BrokerRef, &out.BrokerRef
+		*out = new(v1.LocalObjectReference)
+		**out = **in
+	}
+	in.ChannelableSpec.DeepCopyInto(&out.ChannelableSpec)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MQTTChannelSpec.
+func (in *MQTTChannelSpec) DeepCopy() *MQTTChannelSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(MQTTChannelSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MQTTChannelStatus) DeepCopyInto(out *MQTTChannelStatus) {
+	*out = *in
+	in.ChannelableStatus.DeepCopyInto(&out.ChannelableStatus)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MQTTChannelStatus.
+func (in *MQTTChannelStatus) DeepCopy() *MQTTChannelStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(MQTTChannelStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OAuth2ClientCredentials) DeepCopyInto(out *OAuth2ClientCredentials) {
+	*out = *in
+	if in.ClientID != nil {
+		in, out := &in.ClientID, &out.ClientID
+		*out = new(v1.SecretKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ClientSecret != nil {
+		in, out := &in.ClientSecret, &out.ClientSecret
+		*out = new(v1.SecretKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Scopes != nil {
+		in, out := &in.Scopes, &out.Scopes
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OAuth2ClientCredentials.
+func (in *OAuth2ClientCredentials) DeepCopy() *OAuth2ClientCredentials {
+	if in == nil {
+		return nil
+	}
+	out := new(OAuth2ClientCredentials)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RateLimit) DeepCopyInto(out *RateLimit) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RateLimit.
+func (in *RateLimit) DeepCopy() *RateLimit {
+	if in == nil {
+		return nil
+	}
+	out := new(RateLimit)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Route) DeepCopyInto(out *Route) {
+	*out = *in
+	if in.Filter != nil {
+		in, out := &in.Filter, &out.Filter
+		*out = new(Filter)
+		(*in).DeepCopyInto(*out)
+	}
+	in.Destination.DeepCopyInto(&out.Destination)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Route.
+func (in *Route) DeepCopy() *Route {
+	if in == nil {
+		return nil
+	}
+	out := new(Route)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RouteStatus) DeepCopyInto(out *RouteStatus) {
+	*out = *in
+	if in.URI != nil {
+		in, out := &in.URI, &out.URI
+		*out = new(apis.URL)
+		(*in).DeepCopyInto(*out)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RouteStatus.
+func (in *RouteStatus) DeepCopy() *RouteStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(RouteStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Signing) DeepCopyInto(out *Signing) {
+	*out = *in
+	if in.Key != nil {
+		in, out := &in.Key, &out.Key
+		*out = new(v1.SecretKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Signing.
+func (in *Signing) DeepCopy() *Signing {
+	if in == nil {
+		return nil
+	}
+	out := new(Signing)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SinkAuth) DeepCopyInto(out *SinkAuth) {
+	*out = *in
+	if in.CACert != nil {
+		in, out := &in.CACert, &out.CACert
+		*out = new(v1.SecretKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ClientCert != nil {
+		in, out := &in.ClientCert, &out.ClientCert
+		*out = new(v1.SecretKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ClientKey != nil {
+		in, out := &in.ClientKey, &out.ClientKey
+		*out = new(v1.SecretKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Headers != nil {
+		in, out := &in.Headers, &out.Headers
+		*out = new(v1.LocalObjectReference)
+		**out = **in
+	}
+	if in.OAuth2 != nil {
+		in, out := &in.OAuth2, &out.OAuth2
+		*out = new(OAuth2ClientCredentials)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Signing != nil {
+		in, out := &in.Signing, &out.Signing
+		*out = new(Signing)
+		(*in).DeepCopyInto(*out)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SinkAuth.
+func (in *SinkAuth) DeepCopy() *SinkAuth {
+	if in == nil {
+		return nil
+	}
+	out := new(SinkAuth)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Subscription) DeepCopyInto(out *Subscription) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Subscription.
+func (in *Subscription) DeepCopy() *Subscription {
+	if in == nil {
+		return nil
+	}
+	out := new(Subscription)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Transform) DeepCopyInto(out *Transform) {
+	*out = *in
+	if in.Fields != nil {
+		in, out := &in.Fields, &out.Fields
+		*out = make([]FieldMapping, len(*in))
+		copy(*out, *in)
+	}
+	if in.Set != nil {
+		in, out := &in.Set, &out.Set
+		*out = make(map[string]apiextensionsv1.JSON, len(*in))
+		for key, val := range *in {
+			(*out)[key] = *val.DeepCopy()
+		}
+	}
+	if in.Extensions != nil {
+		in, out := &in.Extensions, &out.Extensions
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Transform.
+func (in *Transform) DeepCopy() *Transform {
+	if in == nil {
+		return nil
+	}
+	out := new(Transform)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -0,0 +1,115 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package broker holds what the control and data planes of the MQTT Broker
+// class share.
+package broker
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"knative.dev/eventing/pkg/apis/eventing"
+	eventingv1 "knative.dev/eventing/pkg/apis/eventing/v1"
+	eventinglisters "knative.dev/eventing/pkg/client/listers/eventing/v1"
+
+	"github.com/ShixiongQi/brokerchannel/pkg/apis/samples/v1beta1"
+)
+
+const (
+	// Class is the value of the eventing.knative.dev/broker.class annotation
+	// of the brokers backed by an MQTT broker.
+	Class = "MQTT"
+
+	// IngressService is the Service of the ingress, in the system namespace.
+	IngressService = "mqtt-broker-ingress"
+	// FilterService is the Service of the filter, in the system namespace.
+	FilterService = "mqtt-broker-filter"
+
+	// DefaultTTL is the number of times an event may be replied to before it
+	// is dropped, to break loops between Triggers.
+	DefaultTTL = 255
+)
+
+// Topic is the MQTT topic storing the events of a broker.
+func Topic(namespace, name string) string {
+	return "knative/brokers/" + namespace + "/" + name
+}
+
+// IngressPath is the path of the ingress receiving the events of a broker.
+func IngressPath(namespace, name string) string {
+	return "/" + namespace + "/" + name
+}
+
+// ParseIngressPath returns the broker addressed by the path p.
+func ParseIngressPath(p string) (types.NamespacedName, error) {
+	parts := strings.Split(strings.Trim(path.Clean(p), "/"), "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return types.NamespacedName{}, fmt.Errorf("expected a path of the form /<namespace>/<name>, got %q", p)
+	}
+	return types.NamespacedName{Namespace: parts[0], Name: parts[1]}, nil
+}
+
+// ConfigRef returns the namespace and the name of the MQTTBroker configuring
+// b, from its spec.config.
+func ConfigRef(b *eventingv1.Broker) (string, *corev1.LocalObjectReference, error) {
+	c := b.Spec.Config
+	if c == nil {
+		return "", nil, fmt.Errorf("spec.config must reference an MQTTBroker")
+	}
+	if c.Kind != "MQTTBroker" || (c.APIVersion != "" && c.APIVersion != v1beta1.SchemeGroupVersion.String()) {
+		return "", nil, fmt.Errorf("spec.config must reference an MQTTBroker, got %s %s", c.APIVersion, c.Kind)
+	}
+	namespace := c.Namespace
+	if namespace == "" {
+		namespace = b.Namespace
+	}
+	return namespace, &corev1.LocalObjectReference{Name: c.Name}, nil
+}
+
+// IsMQTT tells whether b belongs to the MQTT Broker class.
+func IsMQTT(b *eventingv1.Broker) bool {
+	return b.GetAnnotations()[eventing.BrokerClassKey] == Class
+}
+
+// EnqueueBrokersOf returns an event handler for MQTTBrokers enqueueing the
+// brokers of the MQTT class they configure.
+func EnqueueBrokersOf(lister eventinglisters.BrokerLister, enqueue func(interface{}), logger *zap.SugaredLogger) func(interface{}) {
+	return func(obj interface{}) {
+		mb, ok := obj.(*v1beta1.MQTTBroker)
+		if !ok {
+			return
+		}
+		brokers, err := lister.List(labels.Everything())
+		if err != nil {
+			logger.Errorw("Failed to list brokers", zap.Error(err))
+			return
+		}
+		for _, b := range brokers {
+			if !IsMQTT(b) {
+				continue
+			}
+			if namespace, ref, err := ConfigRef(b); err == nil && namespace == mb.Namespace && ref.Name == mb.Name {
+				enqueue(b)
+			}
+		}
+	}
+}
@@ -0,0 +1,70 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package broker
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/types"
+	eventingv1 "knative.dev/eventing/pkg/apis/eventing/v1"
+	duckv1 "knative.dev/pkg/apis/duck/v1"
+)
+
+func TestParseIngressPath(t *testing.T) {
+	tests := []struct {
+		path    string
+		want    types.NamespacedName
+		wantErr bool
+	}{
+		{path: "/default/orders", want: types.NamespacedName{Namespace: "default", Name: "orders"}},
+		{path: "/default/orders/", want: types.NamespacedName{Namespace: "default", Name: "orders"}},
+		{path: "/default", wantErr: true},
+		{path: "/default/orders/extra", wantErr: true},
+		{path: "/", wantErr: true},
+	}
+	for _, tc := range tests {
+		got, err := ParseIngressPath(tc.path)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("ParseIngressPath(%q) error = %v, wantErr %v", tc.path, err, tc.wantErr)
+		}
+		if got != tc.want {
+			t.Errorf("ParseIngressPath(%q) = %v, want %v", tc.path, got, tc.want)
+		}
+	}
+}
+
+func TestConfigRef(t *testing.T) {
+	b := &eventingv1.Broker{}
+	b.Namespace = "default"
+	if _, _, err := ConfigRef(b); err == nil {
+		t.Error("ConfigRef() without config = nil error, want an error")
+	}
+
+	b.Spec.Config = &duckv1.KReference{Kind: "ConfigMap", APIVersion: "v1", Name: "config-br-defaults"}
+	if _, _, err := ConfigRef(b); err == nil {
+		t.Error("ConfigRef() with a ConfigMap = nil error, want an error")
+	}
+
+	b.Spec.Config = &duckv1.KReference{Kind: "MQTTBroker", APIVersion: "samples.knative.dev/v1beta1", Name: "mosquitto"}
+	namespace, ref, err := ConfigRef(b)
+	if err != nil {
+		t.Fatal("ConfigRef() =", err)
+	}
+	if namespace != "default" || ref.Name != "mosquitto" {
+		t.Errorf("ConfigRef() = %s/%s, want default/mosquitto", namespace, ref.Name)
+	}
+}
@@ -0,0 +1,135 @@
+/*
+Copyright 2019 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package filter
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/cache"
+	eventingv1 "knative.dev/eventing/pkg/apis/eventing/v1"
+	brokerinformer "knative.dev/eventing/pkg/client/injection/informers/eventing/v1/broker"
+	triggerinformer "knative.dev/eventing/pkg/client/injection/informers/eventing/v1/trigger"
+	brokerreconciler "knative.dev/eventing/pkg/client/injection/reconciler/eventing/v1/broker"
+	eventinglisters "knative.dev/eventing/pkg/client/listers/eventing/v1"
+	"knative.dev/pkg/client/injection/kube/informers/core/v1/secret"
+	"knative.dev/pkg/configmap"
+	"knative.dev/pkg/controller"
+	"knative.dev/pkg/logging"
+	pkgreconciler "knative.dev/pkg/reconciler"
+	"knative.dev/pkg/tracing"
+	tracingconfig "knative.dev/pkg/tracing/config"
+	"knative.dev/pkg/tracker"
+
+	"github.com/ShixiongQi/brokerchannel/pkg/broker"
+	mqttbrokerinformer "github.com/ShixiongQi/brokerchannel/pkg/client/injection/informers/samples/v1beta1/mqttbroker"
+	"github.com/ShixiongQi/brokerchannel/pkg/mqtt/resolver"
+)
+
+// Reconciler connects the filter to the MQTT broker of every broker and
+// keeps the Triggers of the brokers up to date.
+type Reconciler struct {
+	triggerLister eventinglisters.TriggerLister
+	resolver      *resolver.Resolver
+	handler       *Handler
+}
+
+func (r *Reconciler) ReconcileKind(ctx context.Context, b *eventingv1.Broker) pkgreconciler.Event {
+	namespace, ref, err := broker.ConfigRef(b)
+	if err != nil {
+		// The control plane reports the invalid config.
+		return nil
+	}
+	cfg, err := r.resolver.Resolve(ctx, b, namespace, nil, ref)
+	if err != nil {
+		return err
+	}
+	triggers, err := r.triggerLister.Triggers(b.Namespace).List(labels.Everything())
+	if err != nil {
+		return err
+	}
+	return r.handler.SetBroker(ctx, b, cfg, triggers)
+}
+
+// NewController initializes the filter controller.
+func NewController(
+	ctx context.Context,
+	cmw configmap.Watcher,
+) *controller.Impl {
+	logger := logging.FromContext(ctx)
+	if err := tracing.SetupDynamicPublishing(logger, cmw, broker.FilterService, tracingconfig.ConfigName); err != nil {
+		logger.Fatalw("Error setting up trace publishing", zap.Error(err))
+	}
+	brokerInformer := brokerinformer.Get(ctx)
+	triggerInformer := triggerinformer.Get(ctx)
+	mqttBrokerInformer := mqttbrokerinformer.Get(ctx)
+	secretInformer := secret.Get(ctx)
+
+	var impl *controller.Impl
+	h, err := NewHandler(logger.Desugar(), func(key types.NamespacedName) {
+		// Reconnect the broker.
+		impl.EnqueueKey(key)
+	})
+	if err != nil {
+		logger.Fatalw("Failed to create the filter", zap.Error(err))
+	}
+	r := &Reconciler{
+		triggerLister: triggerInformer.Lister(),
+		resolver: &resolver.Resolver{
+			Brokers: mqttBrokerInformer.Lister(),
+			Secrets: secretInformer.Lister(),
+		},
+		handler: h,
+	}
+	impl = brokerreconciler.NewImpl(ctx, r, broker.Class, func(impl *controller.Impl) controller.Options {
+		return controller.Options{SkipStatusUpdates: true}
+	})
+
+	logger.Info("Setting up event handlers")
+	brokerInformer.Informer().AddEventHandler(cache.FilteringResourceEventHandler{
+		FilterFunc: pkgreconciler.AnnotationFilterFunc(brokerreconciler.ClassAnnotationKey, broker.Class, false),
+		Handler: cache.ResourceEventHandlerFuncs{
+			AddFunc:    impl.Enqueue,
+			UpdateFunc: controller.PassNew(impl.Enqueue),
+			DeleteFunc: func(obj interface{}) {
+				if b, ok := obj.(*eventingv1.Broker); ok {
+					h.DeleteBroker(types.NamespacedName{Namespace: b.Namespace, Name: b.Name})
+				}
+			},
+		},
+	})
+	// Update the broker of a Trigger when it changes.
+	triggerInformer.Informer().AddEventHandler(controller.HandleAll(func(obj interface{}) {
+		if t, ok := obj.(*eventingv1.Trigger); ok {
+			impl.EnqueueKey(types.NamespacedName{Namespace: t.Namespace, Name: t.Spec.Broker})
+		}
+	}))
+	mqttBrokerInformer.Informer().AddEventHandler(controller.HandleAll(
+		broker.EnqueueBrokersOf(brokerInformer.Lister(), impl.Enqueue, logger),
+	))
+
+	// Reconnect the brokers when a secret of their MQTTBroker changes.
+	r.resolver.Tracker = tracker.New(impl.EnqueueKey, controller.GetTrackerLease(ctx))
+	secretInformer.Informer().AddEventHandler(controller.HandleAll(
+		controller.EnsureTypeMeta(r.resolver.Tracker.OnChanged, corev1.SchemeGroupVersion.WithKind("Secret")),
+	))
+
+	return impl
+}
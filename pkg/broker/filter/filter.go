@@ -0,0 +1,328 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package filter reads the topics of the MQTT brokers and sends their events
+// to the subscribers of the matching Triggers.
+package filter
+
+import (
+	"context"
+	"fmt"
+	nethttp "net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/cloudevents/sdk-go/v2/binding"
+	cehttp "github.com/cloudevents/sdk-go/v2/protocol/http"
+	"github.com/eclipse/paho.golang/paho"
+	"go.uber.org/zap"
+	"k8s.io/apimachinery/pkg/types"
+	eventingduckv1 "knative.dev/eventing/pkg/apis/duck/v1"
+	eventingv1 "knative.dev/eventing/pkg/apis/eventing/v1"
+	eventingbroker "knative.dev/eventing/pkg/broker"
+	"knative.dev/eventing/pkg/eventfilter"
+	"knative.dev/eventing/pkg/eventfilter/attributes"
+	"knative.dev/eventing/pkg/kncloudevents"
+	"knative.dev/eventing/pkg/tracing"
+
+	"github.com/ShixiongQi/brokerchannel/pkg/broker"
+	"github.com/ShixiongQi/brokerchannel/pkg/mqtt"
+)
+
+const (
+	// subscribeQoS is the quality of service the filter reads the topics of
+	// the brokers with.
+	subscribeQoS = 1
+
+	// defaultBackoff is the delay between retries when the delivery spec
+	// sets no backoff policy.
+	defaultBackoff = time.Second
+)
+
+// Handler sends the events of the brokers to their Triggers.
+type Handler struct {
+	sender *kncloudevents.HTTPMessageSender
+	logger *zap.Logger
+
+	// lost is called with the key of a broker whose connection was lost.
+	lost func(types.NamespacedName)
+
+	mu      sync.RWMutex
+	brokers map[types.NamespacedName]*session
+}
+
+// session is the connection of the filter to the MQTT broker of a broker.
+type session struct {
+	cfg   mqtt.Config
+	topic string
+	conn  *mqtt.Conn
+
+	mu   sync.RWMutex
+	subs []subscription
+}
+
+// subscription is the delivery configuration of a Trigger.
+type subscription struct {
+	trigger    types.NamespacedName
+	filter     eventfilter.Filter
+	subscriber *url.URL
+	deadLetter *url.URL
+	retry      kncloudevents.RetryConfig
+}
+
+// NewHandler returns a Handler calling lost when the connection of a broker
+// is lost.
+func NewHandler(logger *zap.Logger, lost func(types.NamespacedName)) (*Handler, error) {
+	sender, err := kncloudevents.NewHTTPMessageSenderWithTarget("")
+	if err != nil {
+		return nil, err
+	}
+	return &Handler{
+		sender:  sender,
+		logger:  logger,
+		lost:    lost,
+		brokers: make(map[types.NamespacedName]*session),
+	}, nil
+}
+
+// SetBroker connects the broker b to the MQTT broker described by cfg and
+// sends its events to triggers. The connection is reused as long as cfg does
+// not change.
+func (h *Handler) SetBroker(ctx context.Context, b *eventingv1.Broker, cfg *mqtt.Config, triggers []*eventingv1.Trigger) error {
+	key := types.NamespacedName{Namespace: b.Namespace, Name: b.Name}
+	subs, err := subscriptions(b, triggers)
+	if err != nil {
+		return err
+	}
+
+	h.mu.RLock()
+	s, ok := h.brokers[key]
+	h.mu.RUnlock()
+	if !ok || s.cfg != *cfg || isClosed(s.conn) {
+		h.DeleteBroker(key)
+		if s, err = h.connect(ctx, key, cfg); err != nil {
+			return err
+		}
+	}
+
+	s.mu.Lock()
+	s.subs = subs
+	s.mu.Unlock()
+	return nil
+}
+
+func (h *Handler) connect(ctx context.Context, key types.NamespacedName, cfg *mqtt.Config) (*session, error) {
+	s := &session{cfg: *cfg, topic: broker.Topic(key.Namespace, key.Name)}
+	conn, err := mqtt.Connect(ctx, cfg, paho.NewSingleHandlerRouter(func(m *paho.Publish) {
+		h.dispatch(s, m)
+	}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", cfg.Address, err)
+	}
+	s.conn = conn
+	if _, err := conn.Subscribe(ctx, &paho.Subscribe{Subscriptions: map[string]paho.SubscribeOptions{
+		s.topic: {QoS: subscribeQoS},
+	}}); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to subscribe to %s: %w", s.topic, err)
+	}
+	go func() {
+		<-conn.Done()
+		h.lost(key)
+	}()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.brokers[key] = s
+	return s, nil
+}
+
+// DeleteBroker disconnects the broker key.
+func (h *Handler) DeleteBroker(key types.NamespacedName) {
+	h.mu.Lock()
+	s, ok := h.brokers[key]
+	delete(h.brokers, key)
+	h.mu.Unlock()
+	if ok {
+		s.conn.Close()
+	}
+}
+
+// subscriptions returns the delivery configuration of the Triggers of b
+// whose subscriber is resolved. Triggers without a delivery spec use the one
+// of the broker. Only dead letter sinks with a URI are honored.
+func subscriptions(b *eventingv1.Broker, triggers []*eventingv1.Trigger) ([]subscription, error) {
+	subs := make([]subscription, 0, len(triggers))
+	for _, t := range triggers {
+		if t.Spec.Broker != b.Name || t.Status.SubscriberURI == nil {
+			continue
+		}
+		sub := subscription{
+			trigger:    types.NamespacedName{Namespace: t.Namespace, Name: t.Name},
+			filter:     triggerFilter(t.Spec.Filter),
+			subscriber: t.Status.SubscriberURI.URL(),
+			retry:      kncloudevents.NoRetries(),
+		}
+		delivery := t.Spec.Delivery
+		if delivery == nil {
+			delivery = b.Spec.Delivery
+		}
+		if delivery != nil {
+			if err := sub.setDelivery(delivery); err != nil {
+				return nil, fmt.Errorf("trigger %s: %w", sub.trigger, err)
+			}
+		}
+		subs = append(subs, sub)
+	}
+	return subs, nil
+}
+
+func (s *subscription) setDelivery(delivery *eventingduckv1.DeliverySpec) error {
+	rc, err := kncloudevents.RetryConfigFromDeliverySpec(*delivery)
+	if err != nil {
+		return err
+	}
+	if rc.Backoff == nil {
+		rc.Backoff = func(int, *nethttp.Response) time.Duration { return defaultBackoff }
+	}
+	s.retry = rc
+	if dls := delivery.DeadLetterSink; dls != nil && dls.URI != nil {
+		s.deadLetter = dls.URI.URL()
+	}
+	return nil
+}
+
+func triggerFilter(f *eventingv1.TriggerFilter) eventfilter.Filter {
+	if f == nil || len(f.Attributes) == 0 {
+		return eventfilter.Filters{}
+	}
+	return attributes.NewAttributesFilter(f.Attributes)
+}
+
+// dispatch sends an event read from the topic of a broker to the subscribers
+// of the Triggers it passes the filter of. Replies are published back to the
+// topic.
+func (h *Handler) dispatch(s *session, m *paho.Publish) {
+	event, err := mqtt.DecodeEvent(m)
+	if err != nil {
+		h.logger.Warn("Dropping a message which is not an event", zap.String("topic", m.Topic), zap.Error(err))
+		return
+	}
+	ttl, err := eventingbroker.GetTTL(event.Context)
+	if err != nil {
+		ttl = broker.DefaultTTL
+	}
+	if err := eventingbroker.DeleteTTL(event.Context); err != nil {
+		h.logger.Warn("Failed to delete the TTL", zap.Error(err))
+	}
+
+	s.mu.RLock()
+	subs := s.subs
+	s.mu.RUnlock()
+
+	ctx := context.Background()
+	var wg sync.WaitGroup
+	for _, sub := range subs {
+		if sub.filter.Filter(ctx, *event) == eventfilter.FailFilter {
+			continue
+		}
+		wg.Add(1)
+		go func(sub subscription) {
+			defer wg.Done()
+			ctx, span := mqtt.StartSpan(ctx, tracing.TriggerMessagingDestination(sub.trigger), m)
+			defer span.End()
+			span.AddAttributes(
+				tracing.TriggerMessagingDestinationAttribute(sub.trigger),
+				tracing.MessagingMessageIDAttribute(event.ID()),
+			)
+			logger := h.logger.With(zap.String("trigger", sub.trigger.String()), zap.String("id", event.ID()))
+			reply, err := h.send(ctx, sub.subscriber, event, &sub.retry)
+			if err != nil {
+				logger.Warn("Failed to send an event", zap.Error(err))
+				if sub.deadLetter != nil {
+					if _, err := h.send(ctx, sub.deadLetter, event, nil); err != nil {
+						logger.Error("Failed to send an event to the dead letter sink", zap.Error(err))
+					}
+				}
+				return
+			}
+			if reply == nil {
+				return
+			}
+			if ttl <= 1 {
+				logger.Info("Dropping a reply whose TTL expired")
+				return
+			}
+			if err := h.publish(ctx, s, reply, ttl-1); err != nil {
+				logger.Error("Failed to publish a reply", zap.Error(err))
+			}
+		}(sub)
+	}
+	wg.Wait()
+}
+
+// send posts event to target and returns the event of the response, if any.
+func (h *Handler) send(ctx context.Context, target *url.URL, event *cloudevents.Event, retry *kncloudevents.RetryConfig) (*cloudevents.Event, error) {
+	req, err := h.sender.NewCloudEventRequestWithTarget(ctx, target.String())
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the request: %w", err)
+	}
+	message := binding.ToMessage(event)
+	defer message.Finish(nil)
+	if err := kncloudevents.WriteHTTPRequestWithAdditionalHeaders(ctx, message, req, nil); err != nil {
+		return nil, fmt.Errorf("failed to write the request: %w", err)
+	}
+
+	resp, err := h.sender.SendWithRetries(req, retry)
+	if err != nil {
+		return nil, err
+	}
+	response := cehttp.NewMessageFromHttpResponse(resp)
+	defer response.Finish(nil)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("unexpected HTTP response, expected 2xx, got %d", resp.StatusCode)
+	}
+	if response.ReadEncoding() == binding.EncodingUnknown {
+		return nil, nil
+	}
+	return binding.ToEvent(ctx, response)
+}
+
+// publish sends a reply back to the broker.
+func (h *Handler) publish(ctx context.Context, s *session, reply *cloudevents.Event, ttl int32) error {
+	if err := eventingbroker.SetTTL(reply.Context, ttl); err != nil {
+		return err
+	}
+	pub, err := mqtt.EncodeEvent(s.topic, reply)
+	if err != nil {
+		return err
+	}
+	pub.QoS = subscribeQoS
+	mqtt.InjectSpanContext(ctx, pub)
+	_, err = s.conn.Publish(ctx, pub)
+	return err
+}
+
+func isClosed(c *mqtt.Conn) bool {
+	select {
+	case <-c.Done():
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,121 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package filter
+
+import (
+	"context"
+	nethttp "net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"go.uber.org/zap"
+	eventingduckv1 "knative.dev/eventing/pkg/apis/duck/v1"
+	eventingv1 "knative.dev/eventing/pkg/apis/eventing/v1"
+	"knative.dev/eventing/pkg/eventfilter"
+	"knative.dev/pkg/apis"
+	duckv1 "knative.dev/pkg/apis/duck/v1"
+)
+
+func TestSubscriptions(t *testing.T) {
+	retry := int32(3)
+	b := &eventingv1.Broker{Spec: eventingv1.BrokerSpec{Delivery: &eventingduckv1.DeliverySpec{
+		Retry:          &retry,
+		DeadLetterSink: &duckv1.Destination{URI: apis.HTTP("dls.default.svc")},
+	}}}
+	b.Namespace, b.Name = "default", "default"
+
+	trigger := func(name, broker string, subscriber *apis.URL, attrs map[string]string) *eventingv1.Trigger {
+		t := &eventingv1.Trigger{Spec: eventingv1.TriggerSpec{Broker: broker}}
+		t.Namespace, t.Name = "default", name
+		t.Status.SubscriberURI = subscriber
+		if attrs != nil {
+			t.Spec.Filter = &eventingv1.TriggerFilter{Attributes: attrs}
+		}
+		return t
+	}
+	subs, err := subscriptions(b, []*eventingv1.Trigger{
+		trigger("orders", "default", apis.HTTP("orders.default.svc"), map[string]string{"type": "order.created"}),
+		trigger("unresolved", "default", nil, nil),
+		trigger("other-broker", "other", apis.HTTP("other.default.svc"), nil),
+	})
+	if err != nil {
+		t.Fatal("subscriptions() =", err)
+	}
+	if len(subs) != 1 {
+		t.Fatalf("subscriptions() returned %d subscriptions, want 1", len(subs))
+	}
+	sub := subs[0]
+	if sub.subscriber.Host != "orders.default.svc" {
+		t.Errorf("subscriber = %s, want orders.default.svc", sub.subscriber)
+	}
+	if sub.deadLetter == nil || sub.deadLetter.Host != "dls.default.svc" {
+		t.Errorf("deadLetter = %v, want the dead letter sink of the broker", sub.deadLetter)
+	}
+	if sub.retry.RetryMax != 3 {
+		t.Errorf("RetryMax = %d, want 3", sub.retry.RetryMax)
+	}
+
+	event := cloudevents.NewEvent()
+	event.SetType("order.created")
+	if got := sub.filter.Filter(context.Background(), event); got != eventfilter.PassFilter {
+		t.Errorf("Filter(order.created) = %s, want %s", got, eventfilter.PassFilter)
+	}
+	event.SetType("order.deleted")
+	if got := sub.filter.Filter(context.Background(), event); got != eventfilter.FailFilter {
+		t.Errorf("Filter(order.deleted) = %s, want %s", got, eventfilter.FailFilter)
+	}
+}
+
+func TestSendReply(t *testing.T) {
+	subscriber := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		if r.Header.Get("Ce-Type") != "order.created" {
+			w.WriteHeader(nethttp.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Ce-Specversion", "1.0")
+		w.Header().Set("Ce-Id", "reply")
+		w.Header().Set("Ce-Source", "/orders")
+		w.Header().Set("Ce-Type", "order.accepted")
+		w.WriteHeader(nethttp.StatusOK)
+	}))
+	defer subscriber.Close()
+
+	h, err := NewHandler(zap.NewNop(), nil)
+	if err != nil {
+		t.Fatal("NewHandler() =", err)
+	}
+	event := cloudevents.NewEvent()
+	event.SetID("1")
+	event.SetSource("/test")
+	event.SetType("order.created")
+
+	target, _ := url.Parse(subscriber.URL)
+	reply, err := h.send(context.Background(), target, &event, nil)
+	if err != nil {
+		t.Fatal("send() =", err)
+	}
+	if reply == nil || reply.Type() != "order.accepted" {
+		t.Errorf("send() reply = %v, want an order.accepted event", reply)
+	}
+
+	event.SetType("order.deleted")
+	if _, err := h.send(context.Background(), target, &event, nil); err == nil {
+		t.Error("send() = nil error for a 400 response, want an error")
+	}
+}
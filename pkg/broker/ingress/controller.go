@@ -0,0 +1,125 @@
+/*
+Copyright 2019 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ingress
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/cache"
+	eventingv1 "knative.dev/eventing/pkg/apis/eventing/v1"
+	brokerinformer "knative.dev/eventing/pkg/client/injection/informers/eventing/v1/broker"
+	brokerreconciler "knative.dev/eventing/pkg/client/injection/reconciler/eventing/v1/broker"
+	"knative.dev/eventing/pkg/kncloudevents"
+	"knative.dev/pkg/client/injection/kube/informers/core/v1/secret"
+	"knative.dev/pkg/configmap"
+	"knative.dev/pkg/controller"
+	"knative.dev/pkg/logging"
+	pkgreconciler "knative.dev/pkg/reconciler"
+	"knative.dev/pkg/tracing"
+	tracingconfig "knative.dev/pkg/tracing/config"
+	"knative.dev/pkg/tracker"
+
+	"github.com/ShixiongQi/brokerchannel/pkg/broker"
+	mqttbrokerinformer "github.com/ShixiongQi/brokerchannel/pkg/client/injection/informers/samples/v1beta1/mqttbroker"
+	"github.com/ShixiongQi/brokerchannel/pkg/mqtt/resolver"
+)
+
+// port is the port the ingress listens on.
+const port = 8080
+
+// Reconciler connects the ingress to the MQTT broker of every broker.
+type Reconciler struct {
+	resolver *resolver.Resolver
+	handler  *Handler
+}
+
+func (r *Reconciler) ReconcileKind(ctx context.Context, b *eventingv1.Broker) pkgreconciler.Event {
+	namespace, ref, err := broker.ConfigRef(b)
+	if err != nil {
+		// The control plane reports the invalid config.
+		return nil
+	}
+	cfg, err := r.resolver.Resolve(ctx, b, namespace, nil, ref)
+	if err != nil {
+		return err
+	}
+	return r.handler.SetBroker(ctx, types.NamespacedName{Namespace: b.Namespace, Name: b.Name}, cfg)
+}
+
+// NewController initializes the ingress controller and starts the ingress.
+func NewController(
+	ctx context.Context,
+	cmw configmap.Watcher,
+) *controller.Impl {
+	logger := logging.FromContext(ctx)
+	if err := tracing.SetupDynamicPublishing(logger, cmw, broker.IngressService, tracingconfig.ConfigName); err != nil {
+		logger.Fatalw("Error setting up trace publishing", zap.Error(err))
+	}
+	brokerInformer := brokerinformer.Get(ctx)
+	mqttBrokerInformer := mqttbrokerinformer.Get(ctx)
+	secretInformer := secret.Get(ctx)
+
+	var impl *controller.Impl
+	h := NewHandler(logger.Desugar(), func(key types.NamespacedName) {
+		// Reconnect the broker.
+		impl.EnqueueKey(key)
+	})
+	r := &Reconciler{
+		resolver: &resolver.Resolver{
+			Brokers: mqttBrokerInformer.Lister(),
+			Secrets: secretInformer.Lister(),
+		},
+		handler: h,
+	}
+	impl = brokerreconciler.NewImpl(ctx, r, broker.Class, func(impl *controller.Impl) controller.Options {
+		return controller.Options{SkipStatusUpdates: true}
+	})
+
+	logger.Info("Setting up event handlers")
+	brokerInformer.Informer().AddEventHandler(cache.FilteringResourceEventHandler{
+		FilterFunc: pkgreconciler.AnnotationFilterFunc(brokerreconciler.ClassAnnotationKey, broker.Class, false),
+		Handler: cache.ResourceEventHandlerFuncs{
+			AddFunc:    impl.Enqueue,
+			UpdateFunc: controller.PassNew(impl.Enqueue),
+			DeleteFunc: func(obj interface{}) {
+				if b, ok := obj.(*eventingv1.Broker); ok {
+					h.DeleteBroker(types.NamespacedName{Namespace: b.Namespace, Name: b.Name})
+				}
+			},
+		},
+	})
+	mqttBrokerInformer.Informer().AddEventHandler(controller.HandleAll(
+		broker.EnqueueBrokersOf(brokerInformer.Lister(), impl.Enqueue, logger),
+	))
+
+	// Reconnect the brokers when a secret of their MQTTBroker changes.
+	r.resolver.Tracker = tracker.New(impl.EnqueueKey, controller.GetTrackerLease(ctx))
+	secretInformer.Informer().AddEventHandler(controller.HandleAll(
+		controller.EnsureTypeMeta(r.resolver.Tracker.OnChanged, corev1.SchemeGroupVersion.WithKind("Secret")),
+	))
+
+	go func() {
+		if err := kncloudevents.NewHTTPMessageReceiver(port).StartListen(ctx, h); err != nil {
+			logger.Fatalw("Failed to start the ingress", zap.Error(err))
+		}
+	}()
+
+	return impl
+}
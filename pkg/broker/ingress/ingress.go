@@ -0,0 +1,176 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package ingress receives the events sent to the MQTT brokers over HTTP
+// and publishes them to the topics of the brokers.
+package ingress
+
+import (
+	"context"
+	"fmt"
+	nethttp "net/http"
+	"sync"
+
+	"github.com/cloudevents/sdk-go/v2/binding"
+	cehttp "github.com/cloudevents/sdk-go/v2/protocol/http"
+	"github.com/eclipse/paho.golang/paho"
+	"go.opencensus.io/trace"
+	"go.uber.org/zap"
+	"k8s.io/apimachinery/pkg/types"
+	eventingbroker "knative.dev/eventing/pkg/broker"
+	"knative.dev/eventing/pkg/tracing"
+
+	"github.com/ShixiongQi/brokerchannel/pkg/broker"
+	"github.com/ShixiongQi/brokerchannel/pkg/mqtt"
+)
+
+// publishQoS is the quality of service of the events published by the
+// ingress.
+const publishQoS = 1
+
+// Handler publishes the events posted to /<namespace>/<name> to the topic of
+// the broker namespace/name.
+type Handler struct {
+	logger *zap.Logger
+
+	// lost is called with the key of a broker whose connection was lost.
+	lost func(types.NamespacedName)
+
+	mu      sync.RWMutex
+	brokers map[types.NamespacedName]*session
+}
+
+// session is the connection of the ingress to the MQTT broker of a broker.
+type session struct {
+	cfg   mqtt.Config
+	topic string
+	conn  *mqtt.Conn
+}
+
+// NewHandler returns a Handler calling lost when the connection of a broker
+// is lost.
+func NewHandler(logger *zap.Logger, lost func(types.NamespacedName)) *Handler {
+	return &Handler{
+		logger:  logger,
+		lost:    lost,
+		brokers: make(map[types.NamespacedName]*session),
+	}
+}
+
+// SetBroker connects the broker key to the MQTT broker described by cfg. The
+// connection is reused as long as cfg does not change.
+func (h *Handler) SetBroker(ctx context.Context, key types.NamespacedName, cfg *mqtt.Config) error {
+	h.mu.RLock()
+	s, ok := h.brokers[key]
+	h.mu.RUnlock()
+	if ok && s.cfg == *cfg && !isClosed(s.conn) {
+		return nil
+	}
+	h.DeleteBroker(key)
+
+	// The ingress only publishes.
+	conn, err := mqtt.Connect(ctx, cfg, paho.NewSingleHandlerRouter(nil))
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s: %w", cfg.Address, err)
+	}
+	go func() {
+		<-conn.Done()
+		h.lost(key)
+	}()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.brokers[key] = &session{cfg: *cfg, topic: broker.Topic(key.Namespace, key.Name), conn: conn}
+	return nil
+}
+
+// DeleteBroker disconnects the broker key.
+func (h *Handler) DeleteBroker(key types.NamespacedName) {
+	h.mu.Lock()
+	s, ok := h.brokers[key]
+	delete(h.brokers, key)
+	h.mu.Unlock()
+	if ok {
+		s.conn.Close()
+	}
+}
+
+func (h *Handler) ServeHTTP(w nethttp.ResponseWriter, r *nethttp.Request) {
+	if r.Method != nethttp.MethodPost {
+		w.WriteHeader(nethttp.StatusMethodNotAllowed)
+		return
+	}
+	key, err := broker.ParseIngressPath(r.URL.Path)
+	if err != nil {
+		h.logger.Info("Unable to parse the path as a broker", zap.Error(err))
+		w.WriteHeader(nethttp.StatusBadRequest)
+		return
+	}
+	h.mu.RLock()
+	s, ok := h.brokers[key]
+	h.mu.RUnlock()
+	if !ok {
+		w.WriteHeader(nethttp.StatusNotFound)
+		return
+	}
+
+	ctx := r.Context()
+	message := cehttp.NewMessageFromHttpRequest(r)
+	defer message.Finish(nil)
+	event, err := binding.ToEvent(ctx, message)
+	if err != nil {
+		h.logger.Warn("Failed to extract the event from the request", zap.Error(err))
+		w.WriteHeader(nethttp.StatusBadRequest)
+		return
+	}
+	if _, err := eventingbroker.GetTTL(event.Context); err != nil {
+		if err := eventingbroker.SetTTL(event.Context, broker.DefaultTTL); err != nil {
+			h.logger.Warn("Failed to set the TTL", zap.Error(err))
+		}
+	}
+
+	pub, err := mqtt.EncodeEvent(s.topic, event)
+	if err != nil {
+		h.logger.Warn("Failed to encode the event", zap.Error(err))
+		w.WriteHeader(nethttp.StatusBadRequest)
+		return
+	}
+	pub.QoS = publishQoS
+	if span := trace.FromContext(ctx); span.IsRecordingEvents() {
+		span.AddAttributes(
+			tracing.MessagingSystemAttribute,
+			tracing.MessagingProtocolHTTP,
+			tracing.BrokerMessagingDestinationAttribute(key),
+			tracing.MessagingMessageIDAttribute(event.ID()),
+		)
+	}
+	mqtt.InjectSpanContext(ctx, pub)
+	if _, err := s.conn.Publish(ctx, pub); err != nil {
+		h.logger.Error("Failed to publish the event", zap.String("broker", key.String()), zap.Error(err))
+		w.WriteHeader(nethttp.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(nethttp.StatusAccepted)
+}
+
+func isClosed(c *mqtt.Conn) bool {
+	select {
+	case <-c.Done():
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,351 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package buffer stores messages on the local disk until they are
+// delivered, so that they survive a restart of the process.
+package buffer
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrFull is returned by TryPut when the buffer has no room left.
+	ErrFull = errors.New("buffer full")
+	// ErrTooLarge is returned for data larger than the buffer.
+	ErrTooLarge = errors.New("data larger than the buffer")
+	// ErrClosed is returned once the buffer is closed.
+	ErrClosed = errors.New("buffer closed")
+)
+
+// tmpSuffix marks the files of the records being written.
+const tmpSuffix = ".tmp"
+
+// Record is the metadata of data stored in a Buffer.
+type Record struct {
+	// Seq orders the records of a Buffer.
+	Seq uint64
+	// Time is when the data was stored.
+	Time time.Time
+	// Size is the size of the data in bytes.
+	Size int64
+}
+
+// entry is a Record, leased while it is handed out by Next.
+type entry struct {
+	Record
+	leased bool
+}
+
+// Buffer stores data in a directory, one file per record, up to a maximum
+// size. Records are handed out in the order they were stored, and stay in
+// the buffer until they are removed.
+type Buffer struct {
+	dir string
+
+	mu      sync.Mutex
+	maxSize int64
+	entries []*entry
+	// size is the size of the entries and of the records being written.
+	size   int64
+	next   uint64
+	closed bool
+	// changed is closed and replaced whenever a record is stored or
+	// removed.
+	changed chan struct{}
+}
+
+// Open opens the buffer stored in dir, creating dir if needed. It recovers
+// the records left by a previous process.
+func Open(dir string, maxSize int64) (*Buffer, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	b := &Buffer{dir: dir, maxSize: maxSize, next: 1, changed: make(chan struct{})}
+	for _, f := range files {
+		if strings.HasSuffix(f.Name(), tmpSuffix) {
+			// The process stopped before the record was stored.
+			os.Remove(filepath.Join(dir, f.Name()))
+			continue
+		}
+		seq, err := strconv.ParseUint(f.Name(), 10, 64)
+		if err != nil || f.Size() < 8 {
+			continue
+		}
+		t, err := readTime(filepath.Join(dir, f.Name()))
+		if err != nil {
+			return nil, err
+		}
+		b.entries = append(b.entries, &entry{Record: Record{Seq: seq, Time: t, Size: f.Size() - 8}})
+		b.size += f.Size() - 8
+		if seq >= b.next {
+			b.next = seq + 1
+		}
+	}
+	sort.Slice(b.entries, func(i, j int) bool { return b.entries[i].Seq < b.entries[j].Seq })
+	return b, nil
+}
+
+func readTime(path string) (time.Time, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer f.Close()
+	var ns int64
+	if err := binary.Read(f, binary.BigEndian, &ns); err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(0, ns), nil
+}
+
+// SetMaxSize changes the maximum size of the buffer. The records already
+// stored are kept when they exceed it.
+func (b *Buffer) SetMaxSize(n int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.maxSize = n
+	b.broadcast()
+}
+
+// Len returns the number of records in the buffer and their size.
+func (b *Buffer) Len() (int, int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var size int64
+	for _, e := range b.entries {
+		size += e.Size
+	}
+	return len(b.entries), size
+}
+
+// Put stores data once it is synced to the disk, waiting for room in the
+// buffer until ctx is done.
+func (b *Buffer) Put(ctx context.Context, data []byte) error {
+	return b.put(ctx, data, true)
+}
+
+// TryPut stores data once it is synced to the disk, or returns ErrFull
+// when the buffer has no room left for it.
+func (b *Buffer) TryPut(data []byte) error {
+	return b.put(context.Background(), data, false)
+}
+
+func (b *Buffer) put(ctx context.Context, data []byte, wait bool) error {
+	size := int64(len(data))
+	b.mu.Lock()
+	for {
+		if b.closed {
+			b.mu.Unlock()
+			return ErrClosed
+		}
+		if size > b.maxSize {
+			b.mu.Unlock()
+			return ErrTooLarge
+		}
+		if b.size+size <= b.maxSize {
+			break
+		}
+		if !wait {
+			b.mu.Unlock()
+			return ErrFull
+		}
+		changed := b.changed
+		b.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		}
+		b.mu.Lock()
+	}
+	e := &entry{Record: Record{Seq: b.next, Time: time.Now(), Size: size}}
+	b.next++
+	b.size += size
+	b.mu.Unlock()
+
+	err := b.write(&e.Record, data)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err != nil {
+		b.size -= size
+		b.broadcast()
+		return err
+	}
+	// Concurrent puts may complete out of order.
+	i := sort.Search(len(b.entries), func(i int) bool { return b.entries[i].Seq > e.Seq })
+	b.entries = append(b.entries, nil)
+	copy(b.entries[i+1:], b.entries[i:])
+	b.entries[i] = e
+	b.broadcast()
+	return nil
+}
+
+// write stores a record in a temporary file, and renames it once synced.
+func (b *Buffer) write(r *Record, data []byte) error {
+	path := b.path(r.Seq)
+	f, err := os.OpenFile(path+tmpSuffix, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if err := binary.Write(f, binary.BigEndian, r.Time.UnixNano()); err != nil {
+		f.Close()
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(path+tmpSuffix, path); err != nil {
+		return err
+	}
+	return syncDir(b.dir)
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// Next leases the oldest record which is not leased yet, and returns it
+// with its data. It waits for a record until ctx is done. The record must
+// be removed once handled, or released to be handed out again.
+func (b *Buffer) Next(ctx context.Context) (Record, []byte, error) {
+	b.mu.Lock()
+	for {
+		if b.closed {
+			b.mu.Unlock()
+			return Record{}, nil, ErrClosed
+		}
+		for _, e := range b.entries {
+			if !e.leased {
+				e.leased = true
+				b.mu.Unlock()
+				data, err := b.read(e.Record)
+				if err != nil {
+					b.Release(e.Seq)
+					return Record{}, nil, err
+				}
+				return e.Record, data, nil
+			}
+		}
+		changed := b.changed
+		b.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			return Record{}, nil, ctx.Err()
+		case <-changed:
+		}
+		b.mu.Lock()
+	}
+}
+
+func (b *Buffer) read(r Record) ([]byte, error) {
+	data, err := ioutil.ReadFile(b.path(r.Seq))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) != r.Size+8 {
+		return nil, fmt.Errorf("record %d: read %d bytes, want %d", r.Seq, len(data), r.Size+8)
+	}
+	return data[8:], nil
+}
+
+// Release makes the record seq available to Next again.
+func (b *Buffer) Release(seq uint64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if e := b.find(seq); e != nil {
+		e.leased = false
+		b.broadcast()
+	}
+}
+
+// Remove deletes the record seq.
+func (b *Buffer) Remove(seq uint64) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	i := sort.Search(len(b.entries), func(i int) bool { return b.entries[i].Seq >= seq })
+	if i == len(b.entries) || b.entries[i].Seq != seq {
+		return nil
+	}
+	if err := os.Remove(b.path(seq)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	b.size -= b.entries[i].Size
+	b.entries = append(b.entries[:i], b.entries[i+1:]...)
+	b.broadcast()
+	return nil
+}
+
+// Close wakes up the callers waiting in Put and Next, which return
+// ErrClosed. The records stay on the disk.
+func (b *Buffer) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	b.broadcast()
+}
+
+// Delete closes the buffer and deletes its records.
+func (b *Buffer) Delete() error {
+	b.Close()
+	return os.RemoveAll(b.dir)
+}
+
+func (b *Buffer) find(seq uint64) *entry {
+	i := sort.Search(len(b.entries), func(i int) bool { return b.entries[i].Seq >= seq })
+	if i == len(b.entries) || b.entries[i].Seq != seq {
+		return nil
+	}
+	return b.entries[i]
+}
+
+func (b *Buffer) path(seq uint64) string {
+	return filepath.Join(b.dir, fmt.Sprintf("%020d", seq))
+}
+
+// broadcast wakes up the callers waiting for a change. b.mu must be held.
+func (b *Buffer) broadcast() {
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
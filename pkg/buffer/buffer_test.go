@@ -0,0 +1,164 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package buffer
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func open(t *testing.T, dir string, maxSize int64) *Buffer {
+	t.Helper()
+	b, err := Open(dir, maxSize)
+	if err != nil {
+		t.Fatal("Open() =", err)
+	}
+	return b
+}
+
+func next(t *testing.T, b *Buffer) (Record, string) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	r, data, err := b.Next(ctx)
+	if err != nil {
+		t.Fatal("Next() =", err)
+	}
+	return r, string(data)
+}
+
+func TestBufferOrder(t *testing.T) {
+	b := open(t, t.TempDir(), 100)
+	for _, data := range []string{"a", "bb", "ccc"} {
+		if err := b.Put(context.Background(), []byte(data)); err != nil {
+			t.Fatal("Put() =", err)
+		}
+	}
+	if n, size := b.Len(); n != 3 || size != 6 {
+		t.Errorf("Len() = %d, %d, want 3, 6", n, size)
+	}
+
+	// Leased records are not handed out again until they are released.
+	ra, a := next(t, b)
+	rb, bb := next(t, b)
+	if a != "a" || bb != "bb" {
+		t.Errorf("Next() = %q, %q, want a, bb", a, bb)
+	}
+	b.Release(ra.Seq)
+	if _, got := next(t, b); got != "a" {
+		t.Errorf("Next() after Release() = %q, want a", got)
+	}
+	if err := b.Remove(rb.Seq); err != nil {
+		t.Fatal("Remove() =", err)
+	}
+	if _, got := next(t, b); got != "ccc" {
+		t.Errorf("Next() = %q, want ccc", got)
+	}
+	if n, size := b.Len(); n != 2 || size != 4 {
+		t.Errorf("Len() = %d, %d, want 2, 4", n, size)
+	}
+}
+
+func TestBufferRecovers(t *testing.T) {
+	dir := t.TempDir()
+	b := open(t, dir, 100)
+	b.Put(context.Background(), []byte("a"))
+	b.Put(context.Background(), []byte("b"))
+	r, _ := next(t, b)
+	b.Remove(r.Seq)
+	// A record the process did not finish writing.
+	if err := ioutil.WriteFile(filepath.Join(dir, "00000000000000000003"+tmpSuffix), []byte("c"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	b = open(t, dir, 100)
+	if n, size := b.Len(); n != 1 || size != 1 {
+		t.Errorf("Len() = %d, %d, want 1, 1", n, size)
+	}
+	r, data := next(t, b)
+	if data != "b" || r.Seq != 2 || time.Since(r.Time) > time.Minute {
+		t.Errorf("Next() = %+v, %q, want the second record", r, data)
+	}
+	b.Put(context.Background(), []byte("d"))
+	if r, _ := next(t, b); r.Seq != 3 {
+		t.Errorf("Seq of a new record = %d, want 3", r.Seq)
+	}
+	files, _ := ioutil.ReadDir(dir)
+	if len(files) != 2 {
+		t.Errorf("%d files left, want 2", len(files))
+	}
+}
+
+func TestBufferFull(t *testing.T) {
+	b := open(t, t.TempDir(), 4)
+	if err := b.Put(context.Background(), []byte("abcde")); err != ErrTooLarge {
+		t.Errorf("Put() of a large record = %v, want ErrTooLarge", err)
+	}
+	if err := b.TryPut([]byte("abc")); err != nil {
+		t.Fatal("TryPut() =", err)
+	}
+	if err := b.TryPut([]byte("de")); err != ErrFull {
+		t.Errorf("TryPut() = %v, want ErrFull", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := b.Put(ctx, []byte("de")); err != context.DeadlineExceeded {
+		t.Errorf("Put() = %v, want DeadlineExceeded", err)
+	}
+
+	// Put waits for room in the buffer.
+	done := make(chan error)
+	go func() {
+		done <- b.Put(context.Background(), []byte("de"))
+	}()
+	r, _ := next(t, b)
+	b.Remove(r.Seq)
+	if err := <-done; err != nil {
+		t.Error("Put() =", err)
+	}
+}
+
+func TestBufferClose(t *testing.T) {
+	dir := t.TempDir()
+	b := open(t, dir, 100)
+	done := make(chan error)
+	go func() {
+		_, _, err := b.Next(context.Background())
+		done <- err
+	}()
+	b.Put(context.Background(), []byte("a"))
+	if err := <-done; err != nil {
+		t.Fatal("Next() =", err)
+	}
+	go func() {
+		_, _, err := b.Next(context.Background())
+		done <- err
+	}()
+	b.Close()
+	if err := <-done; err != ErrClosed {
+		t.Errorf("Next() = %v, want ErrClosed", err)
+	}
+	if err := b.Delete(); err != nil {
+		t.Error("Delete() =", err)
+	}
+	if _, err := ioutil.ReadDir(dir); err == nil {
+		t.Error("Delete() left the directory")
+	}
+}
@@ -22,6 +22,8 @@ import (
 	clientset "github.com/ShixiongQi/brokerchannel/pkg/client/clientset/versioned"
 	samplesv1alpha1 "github.com/ShixiongQi/brokerchannel/pkg/client/clientset/versioned/typed/samples/v1alpha1"
 	fakesamplesv1alpha1 "github.com/ShixiongQi/brokerchannel/pkg/client/clientset/versioned/typed/samples/v1alpha1/fake"
+	samplesv1beta1 "github.com/ShixiongQi/brokerchannel/pkg/client/clientset/versioned/typed/samples/v1beta1"
+	fakesamplesv1beta1 "github.com/ShixiongQi/brokerchannel/pkg/client/clientset/versioned/typed/samples/v1beta1/fake"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/discovery"
@@ -80,3 +82,8 @@ var _ clientset.Interface = &Clientset{}
 func (c *Clientset) SamplesV1alpha1() samplesv1alpha1.SamplesV1alpha1Interface {
 	return &fakesamplesv1alpha1.FakeSamplesV1alpha1{Fake: &c.Fake}
 }
+
+// SamplesV1beta1 retrieves the SamplesV1beta1Client
+func (c *Clientset) SamplesV1beta1() samplesv1beta1.SamplesV1beta1Interface {
+	return &fakesamplesv1beta1.FakeSamplesV1beta1{Fake: &c.Fake}
+}
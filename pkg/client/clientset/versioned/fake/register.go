@@ -20,6 +20,7 @@ package fake
 
 import (
 	samplesv1alpha1 "github.com/ShixiongQi/brokerchannel/pkg/apis/samples/v1alpha1"
+	samplesv1beta1 "github.com/ShixiongQi/brokerchannel/pkg/apis/samples/v1beta1"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 	schema "k8s.io/apimachinery/pkg/runtime/schema"
@@ -32,6 +33,7 @@ var codecs = serializer.NewCodecFactory(scheme)
 
 var localSchemeBuilder = runtime.SchemeBuilder{
 	samplesv1alpha1.AddToScheme,
+	samplesv1beta1.AddToScheme,
 }
 
 // AddToScheme adds all types of this clientset into the given scheme. This allows composition
@@ -0,0 +1,142 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Code generated by client-gen. DO NOT EDIT.
+
+package fake
+
+import (
+	"context"
+
+	v1beta1 "github.com/ShixiongQi/brokerchannel/pkg/apis/samples/v1beta1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	labels "k8s.io/apimachinery/pkg/labels"
+	schema "k8s.io/apimachinery/pkg/runtime/schema"
+	types "k8s.io/apimachinery/pkg/types"
+	watch "k8s.io/apimachinery/pkg/watch"
+	testing "k8s.io/client-go/testing"
+)
+
+// FakeMQTTBrokers implements MQTTBrokerInterface
+type FakeMQTTBrokers struct {
+	Fake *FakeSamplesV1beta1
+	ns   string
+}
+
+var mqttbrokersResource = schema.GroupVersionResource{Group: "samples.knative.dev", Version: "v1beta1", Resource: "mqttbrokers"}
+
+var mqttbrokersKind = schema.GroupVersionKind{Group: "samples.knative.dev", Version: "v1beta1", Kind: "MQTTBroker"}
+
+// Get takes name of the mQTTBroker, and returns the corresponding mQTTBroker object, and an error if there is any.
+func (c *FakeMQTTBrokers) Get(ctx context.Context, name string, options v1.GetOptions) (result *v1beta1.MQTTBroker, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewGetAction(mqttbrokersResource, c.ns, name), &v1beta1.MQTTBroker{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1beta1.MQTTBroker), err
+}
+
+// List takes label and field selectors, and returns the list of MQTTBrokers that match those selectors.
+func (c *FakeMQTTBrokers) List(ctx context.Context, opts v1.ListOptions) (result *v1beta1.MQTTBrokerList, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewListAction(mqttbrokersResource, mqttbrokersKind, c.ns, opts), &v1beta1.MQTTBrokerList{})
+
+	if obj == nil {
+		return nil, err
+	}
+
+	label, _, _ := testing.ExtractFromListOptions(opts)
+	if label == nil {
+		label = labels.Everything()
+	}
+	list := &v1beta1.MQTTBrokerList{ListMeta: obj.(*v1beta1.MQTTBrokerList).ListMeta}
+	for _, item := range obj.(*v1beta1.MQTTBrokerList).Items {
+		if label.Matches(labels.Set(item.Labels)) {
+			list.Items = append(list.Items, item)
+		}
+	}
+	return list, err
+}
+
+// Watch returns a watch.Interface that watches the requested mQTTBrokers.
+func (c *FakeMQTTBrokers) Watch(ctx context.Context, opts v1.ListOptions) (watch.Interface, error) {
+	return c.Fake.
+		InvokesWatch(testing.NewWatchAction(mqttbrokersResource, c.ns, opts))
+
+}
+
+// Create takes the representation of a mQTTBroker and creates it.  Returns the server's representation of the mQTTBroker, and an error, if there is any.
+func (c *FakeMQTTBrokers) Create(ctx context.Context, mQTTBroker *v1beta1.MQTTBroker, opts v1.CreateOptions) (result *v1beta1.MQTTBroker, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewCreateAction(mqttbrokersResource, c.ns, mQTTBroker), &v1beta1.MQTTBroker{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1beta1.MQTTBroker), err
+}
+
+// Update takes the representation of a mQTTBroker and updates it. Returns the server's representation of the mQTTBroker, and an error, if there is any.
+func (c *FakeMQTTBrokers) Update(ctx context.Context, mQTTBroker *v1beta1.MQTTBroker, opts v1.UpdateOptions) (result *v1beta1.MQTTBroker, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewUpdateAction(mqttbrokersResource, c.ns, mQTTBroker), &v1beta1.MQTTBroker{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1beta1.MQTTBroker), err
+}
+
+// UpdateStatus was generated because the type contains a Status member.
+// Add a +genclient:noStatus comment above the type to avoid generating UpdateStatus().
+func (c *FakeMQTTBrokers) UpdateStatus(ctx context.Context, mQTTBroker *v1beta1.MQTTBroker, opts v1.UpdateOptions) (*v1beta1.MQTTBroker, error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewUpdateSubresourceAction(mqttbrokersResource, "status", c.ns, mQTTBroker), &v1beta1.MQTTBroker{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1beta1.MQTTBroker), err
+}
+
+// Delete takes name of the mQTTBroker and deletes it. Returns an error if one occurs.
+func (c *FakeMQTTBrokers) Delete(ctx context.Context, name string, opts v1.DeleteOptions) error {
+	_, err := c.Fake.
+		Invokes(testing.NewDeleteAction(mqttbrokersResource, c.ns, name), &v1beta1.MQTTBroker{})
+
+	return err
+}
+
+// DeleteCollection deletes a collection of objects.
+func (c *FakeMQTTBrokers) DeleteCollection(ctx context.Context, opts v1.DeleteOptions, listOpts v1.ListOptions) error {
+	action := testing.NewDeleteCollectionAction(mqttbrokersResource, c.ns, listOpts)
+
+	_, err := c.Fake.Invokes(action, &v1beta1.MQTTBrokerList{})
+	return err
+}
+
+// Patch applies the patch and returns the patched mQTTBroker.
+func (c *FakeMQTTBrokers) Patch(ctx context.Context, name string, pt types.PatchType, data []byte, opts v1.PatchOptions, subresources ...string) (result *v1beta1.MQTTBroker, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewPatchSubresourceAction(mqttbrokersResource, c.ns, name, pt, data, subresources...), &v1beta1.MQTTBroker{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1beta1.MQTTBroker), err
+}
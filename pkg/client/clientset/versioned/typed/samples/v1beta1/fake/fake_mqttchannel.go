@@ -0,0 +1,142 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Code generated by client-gen. DO NOT EDIT.
+
+package fake
+
+import (
+	"context"
+
+	v1beta1 "github.com/ShixiongQi/brokerchannel/pkg/apis/samples/v1beta1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	labels "k8s.io/apimachinery/pkg/labels"
+	schema "k8s.io/apimachinery/pkg/runtime/schema"
+	types "k8s.io/apimachinery/pkg/types"
+	watch "k8s.io/apimachinery/pkg/watch"
+	testing "k8s.io/client-go/testing"
+)
+
+// FakeMQTTChannels implements MQTTChannelInterface
+type FakeMQTTChannels struct {
+	Fake *FakeSamplesV1beta1
+	ns   string
+}
+
+var mqttchannelsResource = schema.GroupVersionResource{Group: "samples.knative.dev", Version: "v1beta1", Resource: "mqttchannels"}
+
+var mqttchannelsKind = schema.GroupVersionKind{Group: "samples.knative.dev", Version: "v1beta1", Kind: "MQTTChannel"}
+
+// Get takes name of the mQTTChannel, and returns the corresponding mQTTChannel object, and an error if there is any.
+func (c *FakeMQTTChannels) Get(ctx context.Context, name string, options v1.GetOptions) (result *v1beta1.MQTTChannel, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewGetAction(mqttchannelsResource, c.ns, name), &v1beta1.MQTTChannel{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1beta1.MQTTChannel), err
+}
+
+// List takes label and field selectors, and returns the list of MQTTChannels that match those selectors.
+func (c *FakeMQTTChannels) List(ctx context.Context, opts v1.ListOptions) (result *v1beta1.MQTTChannelList, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewListAction(mqttchannelsResource, mqttchannelsKind, c.ns, opts), &v1beta1.MQTTChannelList{})
+
+	if obj == nil {
+		return nil, err
+	}
+
+	label, _, _ := testing.ExtractFromListOptions(opts)
+	if label == nil {
+		label = labels.Everything()
+	}
+	list := &v1beta1.MQTTChannelList{ListMeta: obj.(*v1beta1.MQTTChannelList).ListMeta}
+	for _, item := range obj.(*v1beta1.MQTTChannelList).Items {
+		if label.Matches(labels.Set(item.Labels)) {
+			list.Items = append(list.Items, item)
+		}
+	}
+	return list, err
+}
+
+// Watch returns a watch.Interface that watches the requested mQTTChannels.
+func (c *FakeMQTTChannels) Watch(ctx context.Context, opts v1.ListOptions) (watch.Interface, error) {
+	return c.Fake.
+		InvokesWatch(testing.NewWatchAction(mqttchannelsResource, c.ns, opts))
+
+}
+
+// Create takes the representation of a mQTTChannel and creates it.  Returns the server's representation of the mQTTChannel, and an error, if there is any.
+func (c *FakeMQTTChannels) Create(ctx context.Context, mQTTChannel *v1beta1.MQTTChannel, opts v1.CreateOptions) (result *v1beta1.MQTTChannel, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewCreateAction(mqttchannelsResource, c.ns, mQTTChannel), &v1beta1.MQTTChannel{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1beta1.MQTTChannel), err
+}
+
+// Update takes the representation of a mQTTChannel and updates it. Returns the server's representation of the mQTTChannel, and an error, if there is any.
+func (c *FakeMQTTChannels) Update(ctx context.Context, mQTTChannel *v1beta1.MQTTChannel, opts v1.UpdateOptions) (result *v1beta1.MQTTChannel, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewUpdateAction(mqttchannelsResource, c.ns, mQTTChannel), &v1beta1.MQTTChannel{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1beta1.MQTTChannel), err
+}
+
+// UpdateStatus was generated because the type contains a Status member.
+// Add a +genclient:noStatus comment above the type to avoid generating UpdateStatus().
+func (c *FakeMQTTChannels) UpdateStatus(ctx context.Context, mQTTChannel *v1beta1.MQTTChannel, opts v1.UpdateOptions) (*v1beta1.MQTTChannel, error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewUpdateSubresourceAction(mqttchannelsResource, "status", c.ns, mQTTChannel), &v1beta1.MQTTChannel{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1beta1.MQTTChannel), err
+}
+
+// Delete takes name of the mQTTChannel and deletes it. Returns an error if one occurs.
+func (c *FakeMQTTChannels) Delete(ctx context.Context, name string, opts v1.DeleteOptions) error {
+	_, err := c.Fake.
+		Invokes(testing.NewDeleteAction(mqttchannelsResource, c.ns, name), &v1beta1.MQTTChannel{})
+
+	return err
+}
+
+// DeleteCollection deletes a collection of objects.
+func (c *FakeMQTTChannels) DeleteCollection(ctx context.Context, opts v1.DeleteOptions, listOpts v1.ListOptions) error {
+	action := testing.NewDeleteCollectionAction(mqttchannelsResource, c.ns, listOpts)
+
+	_, err := c.Fake.Invokes(action, &v1beta1.MQTTChannelList{})
+	return err
+}
+
+// Patch applies the patch and returns the patched mQTTChannel.
+func (c *FakeMQTTChannels) Patch(ctx context.Context, name string, pt types.PatchType, data []byte, opts v1.PatchOptions, subresources ...string) (result *v1beta1.MQTTChannel, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewPatchSubresourceAction(mqttchannelsResource, c.ns, name, pt, data, subresources...), &v1beta1.MQTTChannel{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1beta1.MQTTChannel), err
+}
@@ -22,6 +22,7 @@ import (
 	"fmt"
 
 	v1alpha1 "github.com/ShixiongQi/brokerchannel/pkg/apis/samples/v1alpha1"
+	v1beta1 "github.com/ShixiongQi/brokerchannel/pkg/apis/samples/v1beta1"
 	schema "k8s.io/apimachinery/pkg/runtime/schema"
 	cache "k8s.io/client-go/tools/cache"
 )
@@ -56,6 +57,14 @@ func (f *sharedInformerFactory) ForResource(resource schema.GroupVersionResource
 	case v1alpha1.SchemeGroupVersion.WithResource("brokerchannels"):
 		return &genericInformer{resource: resource.GroupResource(), informer: f.Samples().V1alpha1().BrokerChannels().Informer()}, nil
 
+		// Group=samples.knative.dev, Version=v1beta1
+	case v1beta1.SchemeGroupVersion.WithResource("brokerchannels"):
+		return &genericInformer{resource: resource.GroupResource(), informer: f.Samples().V1beta1().BrokerChannels().Informer()}, nil
+	case v1beta1.SchemeGroupVersion.WithResource("mqttbrokers"):
+		return &genericInformer{resource: resource.GroupResource(), informer: f.Samples().V1beta1().MQTTBrokers().Informer()}, nil
+	case v1beta1.SchemeGroupVersion.WithResource("mqttchannels"):
+		return &genericInformer{resource: resource.GroupResource(), informer: f.Samples().V1beta1().MQTTChannels().Informer()}, nil
+
 	}
 
 	return nil, fmt.Errorf("no informer found for %v", resource)
@@ -0,0 +1,59 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Code generated by informer-gen. DO NOT EDIT.
+
+package v1beta1
+
+import (
+	internalinterfaces "github.com/ShixiongQi/brokerchannel/pkg/client/informers/externalversions/internalinterfaces"
+)
+
+// Interface provides access to all the informers in this group version.
+type Interface interface {
+	// BrokerChannels returns a BrokerChannelInformer.
+	BrokerChannels() BrokerChannelInformer
+	// MQTTBrokers returns a MQTTBrokerInformer.
+	MQTTBrokers() MQTTBrokerInformer
+	// MQTTChannels returns a MQTTChannelInformer.
+	MQTTChannels() MQTTChannelInformer
+}
+
+type version struct {
+	factory          internalinterfaces.SharedInformerFactory
+	namespace        string
+	tweakListOptions internalinterfaces.TweakListOptionsFunc
+}
+
+// New returns a new Interface.
+func New(f internalinterfaces.SharedInformerFactory, namespace string, tweakListOptions internalinterfaces.TweakListOptionsFunc) Interface {
+	return &version{factory: f, namespace: namespace, tweakListOptions: tweakListOptions}
+}
+
+// BrokerChannels returns a BrokerChannelInformer.
+func (v *version) BrokerChannels() BrokerChannelInformer {
+	return &brokerChannelInformer{factory: v.factory, namespace: v.namespace, tweakListOptions: v.tweakListOptions}
+}
+
+// MQTTBrokers returns a MQTTBrokerInformer.
+func (v *version) MQTTBrokers() MQTTBrokerInformer {
+	return &mQTTBrokerInformer{factory: v.factory, namespace: v.namespace, tweakListOptions: v.tweakListOptions}
+}
+
+// MQTTChannels returns a MQTTChannelInformer.
+func (v *version) MQTTChannels() MQTTChannelInformer {
+	return &mQTTChannelInformer{factory: v.factory, namespace: v.namespace, tweakListOptions: v.tweakListOptions}
+}
@@ -26,7 +26,7 @@ import (
 
 	versionedscheme "github.com/ShixiongQi/brokerchannel/pkg/client/clientset/versioned/scheme"
 	client "github.com/ShixiongQi/brokerchannel/pkg/client/injection/client"
-	brokerchannel "github.com/ShixiongQi/brokerchannel/pkg/client/injection/informers/samples/v1alpha1/brokerchannel"
+	brokerchannel "github.com/ShixiongQi/brokerchannel/pkg/client/injection/informers/samples/v1beta1/brokerchannel"
 	zap "go.uber.org/zap"
 	corev1 "k8s.io/api/core/v1"
 	labels "k8s.io/apimachinery/pkg/labels"
@@ -24,9 +24,9 @@ import (
 	fmt "fmt"
 	reflect "reflect"
 
-	v1alpha1 "github.com/ShixiongQi/brokerchannel/pkg/apis/samples/v1alpha1"
+	v1beta1 "github.com/ShixiongQi/brokerchannel/pkg/apis/samples/v1beta1"
 	versioned "github.com/ShixiongQi/brokerchannel/pkg/client/clientset/versioned"
-	samplesv1alpha1 "github.com/ShixiongQi/brokerchannel/pkg/client/listers/samples/v1alpha1"
+	samplesv1beta1 "github.com/ShixiongQi/brokerchannel/pkg/client/listers/samples/v1beta1"
 	zap "go.uber.org/zap"
 	v1 "k8s.io/api/core/v1"
 	equality "k8s.io/apimachinery/pkg/api/equality"
@@ -43,50 +43,50 @@ import (
 )
 
 // Interface defines the strongly typed interfaces to be implemented by a
-// controller reconciling v1alpha1.BrokerChannel.
+// controller reconciling v1beta1.BrokerChannel.
 type Interface interface {
-	// ReconcileKind implements custom logic to reconcile v1alpha1.BrokerChannel. Any changes
+	// ReconcileKind implements custom logic to reconcile v1beta1.BrokerChannel. Any changes
 	// to the objects .Status or .Finalizers will be propagated to the stored
 	// object. It is recommended that implementors do not call any update calls
 	// for the Kind inside of ReconcileKind, it is the responsibility of the calling
 	// controller to propagate those properties. The resource passed to ReconcileKind
 	// will always have an empty deletion timestamp.
-	ReconcileKind(ctx context.Context, o *v1alpha1.BrokerChannel) reconciler.Event
+	ReconcileKind(ctx context.Context, o *v1beta1.BrokerChannel) reconciler.Event
 }
 
 // Finalizer defines the strongly typed interfaces to be implemented by a
-// controller finalizing v1alpha1.BrokerChannel.
+// controller finalizing v1beta1.BrokerChannel.
 type Finalizer interface {
-	// FinalizeKind implements custom logic to finalize v1alpha1.BrokerChannel. Any changes
+	// FinalizeKind implements custom logic to finalize v1beta1.BrokerChannel. Any changes
 	// to the objects .Status or .Finalizers will be ignored. Returning a nil or
 	// Normal type reconciler.Event will allow the finalizer to be deleted on
 	// the resource. The resource passed to FinalizeKind will always have a set
 	// deletion timestamp.
-	FinalizeKind(ctx context.Context, o *v1alpha1.BrokerChannel) reconciler.Event
+	FinalizeKind(ctx context.Context, o *v1beta1.BrokerChannel) reconciler.Event
 }
 
 // ReadOnlyInterface defines the strongly typed interfaces to be implemented by a
-// controller reconciling v1alpha1.BrokerChannel if they want to process resources for which
+// controller reconciling v1beta1.BrokerChannel if they want to process resources for which
 // they are not the leader.
 type ReadOnlyInterface interface {
-	// ObserveKind implements logic to observe v1alpha1.BrokerChannel.
+	// ObserveKind implements logic to observe v1beta1.BrokerChannel.
 	// This method should not write to the API.
-	ObserveKind(ctx context.Context, o *v1alpha1.BrokerChannel) reconciler.Event
+	ObserveKind(ctx context.Context, o *v1beta1.BrokerChannel) reconciler.Event
 }
 
 // ReadOnlyFinalizer defines the strongly typed interfaces to be implemented by a
-// controller finalizing v1alpha1.BrokerChannel if they want to process tombstoned resources
+// controller finalizing v1beta1.BrokerChannel if they want to process tombstoned resources
 // even when they are not the leader.  Due to the nature of how finalizers are handled
 // there are no guarantees that this will be called.
 type ReadOnlyFinalizer interface {
-	// ObserveFinalizeKind implements custom logic to observe the final state of v1alpha1.BrokerChannel.
+	// ObserveFinalizeKind implements custom logic to observe the final state of v1beta1.BrokerChannel.
 	// This method should not write to the API.
-	ObserveFinalizeKind(ctx context.Context, o *v1alpha1.BrokerChannel) reconciler.Event
+	ObserveFinalizeKind(ctx context.Context, o *v1beta1.BrokerChannel) reconciler.Event
 }
 
-type doReconcile func(ctx context.Context, o *v1alpha1.BrokerChannel) reconciler.Event
+type doReconcile func(ctx context.Context, o *v1beta1.BrokerChannel) reconciler.Event
 
-// reconcilerImpl implements controller.Reconciler for v1alpha1.BrokerChannel resources.
+// reconcilerImpl implements controller.Reconciler for v1beta1.BrokerChannel resources.
 type reconcilerImpl struct {
 	// LeaderAwareFuncs is inlined to help us implement reconciler.LeaderAware.
 	reconciler.LeaderAwareFuncs
@@ -95,7 +95,7 @@ type reconcilerImpl struct {
 	Client versioned.Interface
 
 	// Listers index properties about resources.
-	Lister samplesv1alpha1.BrokerChannelLister
+	Lister samplesv1beta1.BrokerChannelLister
 
 	// Recorder is an event recorder for recording Event resources to the
 	// Kubernetes API.
@@ -122,7 +122,7 @@ var _ controller.Reconciler = (*reconcilerImpl)(nil)
 // Check that our generated Reconciler is always LeaderAware.
 var _ reconciler.LeaderAware = (*reconcilerImpl)(nil)
 
-func NewReconciler(ctx context.Context, logger *zap.SugaredLogger, client versioned.Interface, lister samplesv1alpha1.BrokerChannelLister, recorder record.EventRecorder, r Interface, options ...controller.Options) controller.Reconciler {
+func NewReconciler(ctx context.Context, logger *zap.SugaredLogger, client versioned.Interface, lister samplesv1beta1.BrokerChannelLister, recorder record.EventRecorder, r Interface, options ...controller.Options) controller.Reconciler {
 	// Check the options function input. It should be 0 or 1.
 	if len(options) > 1 {
 		logger.Fatal("Up to one options struct is supported, found: ", len(options))
@@ -315,13 +315,13 @@ func (r *reconcilerImpl) Reconcile(ctx context.Context, key string) error {
 	return nil
 }
 
-func (r *reconcilerImpl) updateStatus(ctx context.Context, existing *v1alpha1.BrokerChannel, desired *v1alpha1.BrokerChannel) error {
+func (r *reconcilerImpl) updateStatus(ctx context.Context, existing *v1beta1.BrokerChannel, desired *v1beta1.BrokerChannel) error {
 	existing = existing.DeepCopy()
 	return reconciler.RetryUpdateConflicts(func(attempts int) (err error) {
 		// The first iteration tries to use the injectionInformer's state, subsequent attempts fetch the latest state via API.
 		if attempts > 0 {
 
-			getter := r.Client.SamplesV1alpha1().BrokerChannels(desired.Namespace)
+			getter := r.Client.SamplesV1beta1().BrokerChannels(desired.Namespace)
 
 			existing, err = getter.Get(ctx, desired.Name, metav1.GetOptions{})
 			if err != nil {
@@ -340,7 +340,7 @@ func (r *reconcilerImpl) updateStatus(ctx context.Context, existing *v1alpha1.Br
 
 		existing.Status = desired.Status
 
-		updater := r.Client.SamplesV1alpha1().BrokerChannels(existing.Namespace)
+		updater := r.Client.SamplesV1beta1().BrokerChannels(existing.Namespace)
 		_, err = updater.UpdateStatus(ctx, existing, metav1.UpdateOptions{})
 		if err != nil {
 			logging.FromContext(ctx).Debug(err)
@@ -352,7 +352,7 @@ func (r *reconcilerImpl) updateStatus(ctx context.Context, existing *v1alpha1.Br
 // updateFinalizersFiltered will update the Finalizers of the resource.
 // TODO: this method could be generic and sync all finalizers. For now it only
 // updates defaultFinalizerName or its override.
-func (r *reconcilerImpl) updateFinalizersFiltered(ctx context.Context, resource *v1alpha1.BrokerChannel) (*v1alpha1.BrokerChannel, error) {
+func (r *reconcilerImpl) updateFinalizersFiltered(ctx context.Context, resource *v1beta1.BrokerChannel) (*v1beta1.BrokerChannel, error) {
 
 	getter := r.Lister.BrokerChannels(resource.Namespace)
 
@@ -399,7 +399,7 @@ func (r *reconcilerImpl) updateFinalizersFiltered(ctx context.Context, resource
 		return resource, err
 	}
 
-	patcher := r.Client.SamplesV1alpha1().BrokerChannels(resource.Namespace)
+	patcher := r.Client.SamplesV1beta1().BrokerChannels(resource.Namespace)
 
 	resourceName := resource.Name
 	updated, err := patcher.Patch(ctx, resourceName, types.MergePatchType, patch, metav1.PatchOptions{})
@@ -413,7 +413,7 @@ func (r *reconcilerImpl) updateFinalizersFiltered(ctx context.Context, resource
 	return updated, err
 }
 
-func (r *reconcilerImpl) setFinalizerIfFinalizer(ctx context.Context, resource *v1alpha1.BrokerChannel) (*v1alpha1.BrokerChannel, error) {
+func (r *reconcilerImpl) setFinalizerIfFinalizer(ctx context.Context, resource *v1beta1.BrokerChannel) (*v1beta1.BrokerChannel, error) {
 	if _, ok := r.reconciler.(Finalizer); !ok {
 		return resource, nil
 	}
@@ -431,7 +431,7 @@ func (r *reconcilerImpl) setFinalizerIfFinalizer(ctx context.Context, resource *
 	return r.updateFinalizersFiltered(ctx, resource)
 }
 
-func (r *reconcilerImpl) clearFinalizer(ctx context.Context, resource *v1alpha1.BrokerChannel, reconcileEvent reconciler.Event) (*v1alpha1.BrokerChannel, error) {
+func (r *reconcilerImpl) clearFinalizer(ctx context.Context, resource *v1beta1.BrokerChannel, reconcileEvent reconciler.Event) (*v1beta1.BrokerChannel, error) {
 	if _, ok := r.reconciler.(Finalizer); !ok {
 		return resource, nil
 	}
@@ -0,0 +1,43 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Code generated by lister-gen. DO NOT EDIT.
+
+package v1beta1
+
+// BrokerChannelListerExpansion allows custom methods to be added to
+// BrokerChannelLister.
+type BrokerChannelListerExpansion interface{}
+
+// BrokerChannelNamespaceListerExpansion allows custom methods to be added to
+// BrokerChannelNamespaceLister.
+type BrokerChannelNamespaceListerExpansion interface{}
+
+// MQTTBrokerListerExpansion allows custom methods to be added to
+// MQTTBrokerLister.
+type MQTTBrokerListerExpansion interface{}
+
+// MQTTBrokerNamespaceListerExpansion allows custom methods to be added to
+// MQTTBrokerNamespaceLister.
+type MQTTBrokerNamespaceListerExpansion interface{}
+
+// MQTTChannelListerExpansion allows custom methods to be added to
+// MQTTChannelLister.
+type MQTTChannelListerExpansion interface{}
+
+// MQTTChannelNamespaceListerExpansion allows custom methods to be added to
+// MQTTChannelNamespaceLister.
+type MQTTChannelNamespaceListerExpansion interface{}
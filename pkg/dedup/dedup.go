@@ -0,0 +1,255 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package dedup remembers the keys of the messages delivered recently, so
+// that the copies of a message sent again by the broker are dropped.
+package dedup
+
+import (
+	"bufio"
+	"container/list"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+// minCompaction is the number of lines a log holds at least before it is
+// compacted.
+const minCompaction = 1024
+
+// Cache is an LRU cache of keys, each remembered for a TTL. A key is
+// reserved while its message is delivered, and remembered once the message
+// is delivered. The keys are optionally appended to a log on the local
+// disk, so that they survive a restart of the process.
+type Cache struct {
+	mu      sync.Mutex
+	maxKeys int
+	ttl     time.Duration
+	// lru holds the remembered keys, the most recently used first.
+	lru     *list.List
+	keys    map[string]*list.Element
+	pending map[string]struct{}
+
+	path string
+	log  *os.File
+	// lines is the number of lines of the log.
+	lines int
+}
+
+// entry is a key in the cache, and in the log.
+type entry struct {
+	Key     string    `json:"key"`
+	Expires time.Time `json:"expires"`
+}
+
+// New returns a Cache remembering up to maxKeys keys, for ttl each.
+func New(maxKeys int, ttl time.Duration) *Cache {
+	return &Cache{
+		maxKeys: maxKeys,
+		ttl:     ttl,
+		lru:     list.New(),
+		keys:    make(map[string]*list.Element),
+		pending: make(map[string]struct{}),
+	}
+}
+
+// Open returns a Cache logging its keys to the file path, and recovers
+// the keys logged by a previous process.
+func Open(path string, maxKeys int, ttl time.Duration) (*Cache, error) {
+	c := New(maxKeys, ttl)
+	c.path = path
+	if f, err := os.Open(path); err == nil {
+		now := time.Now()
+		s := bufio.NewScanner(f)
+		for s.Scan() {
+			var e entry
+			if json.Unmarshal(s.Bytes(), &e) != nil {
+				// The process stopped while writing the line.
+				continue
+			}
+			if e.Expires.After(now) {
+				c.add(e)
+			}
+		}
+		f.Close()
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err := c.compact(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Resize changes the maximum number of keys and the TTL of the keys
+// remembered from now on.
+func (c *Cache) Resize(maxKeys int, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.maxKeys, c.ttl = maxKeys, ttl
+	for c.lru.Len() > c.maxKeys {
+		c.remove(c.lru.Back())
+	}
+}
+
+// Persistent tells whether the keys are logged to the local disk.
+func (c *Cache) Persistent() bool {
+	return c.path != ""
+}
+
+// Len returns the number of keys remembered.
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
+
+// Reserve reserves key, and returns true, unless key is remembered or
+// already reserved. A reserved key must be released with Done.
+func (c *Cache) Reserve(key string, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.pending[key]; ok {
+		return false
+	}
+	if el, ok := c.keys[key]; ok {
+		if el.Value.(*entry).Expires.After(now) {
+			c.lru.MoveToFront(el)
+			return false
+		}
+		c.remove(el)
+	}
+	c.pending[key] = struct{}{}
+	return true
+}
+
+// Done releases a reserved key, which is remembered when its message was
+// delivered. The error of the log is returned, the key is remembered in
+// memory anyway.
+func (c *Cache) Done(key string, delivered bool, now time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.pending, key)
+	if !delivered {
+		return nil
+	}
+	e := entry{Key: key, Expires: now.Add(c.ttl)}
+	c.add(e)
+	if c.log == nil {
+		return nil
+	}
+	if c.lines >= 2*c.lru.Len() && c.lines >= minCompaction {
+		return c.compact()
+	}
+	return c.append(e)
+}
+
+// Close closes the log.
+func (c *Cache) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.log == nil {
+		return nil
+	}
+	err := c.log.Close()
+	c.log = nil
+	return err
+}
+
+// Delete closes the log and deletes it.
+func (c *Cache) Delete() error {
+	if err := c.Close(); err != nil {
+		return err
+	}
+	if c.path == "" {
+		return nil
+	}
+	if err := os.Remove(c.path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// add remembers e, evicting the least recently used keys beyond maxKeys.
+// c.mu must be held.
+func (c *Cache) add(e entry) {
+	if el, ok := c.keys[e.Key]; ok {
+		el.Value = &e
+		c.lru.MoveToFront(el)
+	} else {
+		c.keys[e.Key] = c.lru.PushFront(&e)
+	}
+	for c.lru.Len() > c.maxKeys {
+		c.remove(c.lru.Back())
+	}
+}
+
+// remove forgets the key of el. c.mu must be held.
+func (c *Cache) remove(el *list.Element) {
+	c.lru.Remove(el)
+	delete(c.keys, el.Value.(*entry).Key)
+}
+
+// append appends e to the log. c.mu must be held.
+func (c *Cache) append(e entry) error {
+	line, err := json.Marshal(&e)
+	if err != nil {
+		return err
+	}
+	if _, err := c.log.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	c.lines++
+	return nil
+}
+
+// compact replaces the log with the keys remembered, least recently used
+// first so that they are recovered in the same order. c.mu must be held.
+func (c *Cache) compact() error {
+	tmp := c.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	for el := c.lru.Back(); el != nil; el = el.Prev() {
+		line, err := json.Marshal(el.Value)
+		if err != nil {
+			f.Close()
+			return err
+		}
+		w.Write(append(line, '\n'))
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, c.path); err != nil {
+		return err
+	}
+	if c.log != nil {
+		c.log.Close()
+	}
+	if c.log, err = os.OpenFile(c.path, os.O_WRONLY|os.O_APPEND, 0600); err != nil {
+		return err
+	}
+	c.lines = c.lru.Len()
+	return nil
+}
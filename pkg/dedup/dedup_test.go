@@ -0,0 +1,122 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dedup
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func deliver(t *testing.T, c *Cache, key string, now time.Time) {
+	t.Helper()
+	if !c.Reserve(key, now) {
+		t.Fatalf("Reserve(%q) = false, want true", key)
+	}
+	if err := c.Done(key, true, now); err != nil {
+		t.Fatal("Done() =", err)
+	}
+}
+
+func TestCache(t *testing.T) {
+	now := time.Now()
+	c := New(2, time.Minute)
+
+	// A key is reserved once while its message is delivered.
+	if !c.Reserve("a", now) {
+		t.Fatal("Reserve(a) = false, want true")
+	}
+	if c.Reserve("a", now) {
+		t.Error("Reserve(a) of a pending key = true, want false")
+	}
+	// A key whose message was not delivered is forgotten.
+	c.Done("a", false, now)
+	if c.Len() != 0 {
+		t.Errorf("Len() = %d, want 0", c.Len())
+	}
+	deliver(t, c, "a", now)
+	if c.Reserve("a", now.Add(30*time.Second)) {
+		t.Error("Reserve(a) of a delivered key = true, want false")
+	}
+
+	// The keys expire after the TTL.
+	if !c.Reserve("a", now.Add(2*time.Minute)) {
+		t.Error("Reserve(a) of an expired key = false, want true")
+	}
+	c.Done("a", true, now)
+
+	// The least recently used keys are evicted.
+	deliver(t, c, "b", now)
+	c.Reserve("a", now)
+	deliver(t, c, "c", now)
+	if c.Len() != 2 {
+		t.Errorf("Len() = %d, want 2", c.Len())
+	}
+	if !c.Reserve("b", now) {
+		t.Error("Reserve(b) of an evicted key = false, want true")
+	}
+	if c.Reserve("a", now) {
+		t.Error("Reserve(a) of a recently used key = true, want false")
+	}
+
+	c.Resize(1, time.Minute)
+	if c.Len() != 1 {
+		t.Errorf("Len() after Resize() = %d, want 1", c.Len())
+	}
+}
+
+func TestCacheLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys")
+	now := time.Now()
+	c, err := Open(path, 2*minCompaction, time.Minute)
+	if err != nil {
+		t.Fatal("Open() =", err)
+	}
+	// Enough keys to compact the log.
+	for i := 0; i < 3*minCompaction; i++ {
+		deliver(t, c, string(rune('b'+i)), now)
+	}
+	if c.lines > 2*c.maxKeys {
+		t.Errorf("The log holds %d lines, want at most %d", c.lines, 2*c.maxKeys)
+	}
+	deliver(t, c, "a", now.Add(-2*time.Minute))
+	deliver(t, c, "last", now)
+	if err := c.Close(); err != nil {
+		t.Fatal("Close() =", err)
+	}
+
+	// The keys survive a restart, but for the expired ones.
+	c, err = Open(path, 2*minCompaction, time.Minute)
+	if err != nil {
+		t.Fatal("Open() =", err)
+	}
+	if c.Len() != 2*minCompaction {
+		t.Errorf("Len() = %d, want %d", c.Len(), 2*minCompaction)
+	}
+	if c.Reserve("last", now) {
+		t.Error("Reserve(last) of a recovered key = true, want false")
+	}
+	if !c.Reserve("a", now) {
+		t.Error("Reserve(a) of an expired key = false, want true")
+	}
+	if err := c.Delete(); err != nil {
+		t.Fatal("Delete() =", err)
+	}
+	if c, err = Open(path, 2*minCompaction, time.Minute); err != nil || c.Len() != 0 {
+		t.Errorf("Open() after Delete() = %d keys, %v, want none", c.Len(), err)
+	}
+}
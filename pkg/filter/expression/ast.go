@@ -0,0 +1,541 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package expression
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// typ is the type of a value, as named in the error messages.
+type typ string
+
+const (
+	dynType       typ = "dyn"
+	boolType      typ = "bool"
+	intType       typ = "int"
+	doubleType    typ = "double"
+	stringType    typ = "string"
+	nullType      typ = "null_type"
+	listType      typ = "list"
+	mapType       typ = "map"
+	timestampType typ = "timestamp"
+	// attrsType is the type of the event variable, whose values are all
+	// strings.
+	attrsType typ = "map(string, string)"
+)
+
+// typeOf returns the type of the value v.
+func typeOf(v interface{}) typ {
+	switch v.(type) {
+	case bool:
+		return boolType
+	case int64:
+		return intType
+	case float64:
+		return doubleType
+	case string:
+		return stringType
+	case nil:
+		return nullType
+	case []interface{}:
+		return listType
+	case map[string]interface{}:
+		return mapType
+	case map[string]string:
+		return attrsType
+	case time.Time:
+		return timestampType
+	}
+	return dynType
+}
+
+// assignable tells whether a value of type t may be passed as a parameter
+// of type param.
+func assignable(param, t typ) bool {
+	return param == dynType || param == t || param == mapType && t == attrsType
+}
+
+// scope holds the types of the variables while an expression is checked.
+type scope struct {
+	name   string
+	t      typ
+	parent *scope
+}
+
+func (s *scope) lookup(name string) (typ, bool) {
+	for ; s != nil; s = s.parent {
+		if s.name == name {
+			return s.t, true
+		}
+	}
+	return "", false
+}
+
+// activation holds the values of the variables while an expression is
+// evaluated.
+type activation struct {
+	name   string
+	value  interface{}
+	parent *activation
+}
+
+func (a *activation) lookup(name string) interface{} {
+	for ; a != nil; a = a.parent {
+		if a.name == name {
+			return a.value
+		}
+	}
+	return nil
+}
+
+// node is a node of the syntax tree of an expression. check returns the
+// type the node evaluates to, dyn when it is only known at evaluation.
+type node interface {
+	check(s *scope) (typ, error)
+	eval(a *activation) (interface{}, error)
+}
+
+type literalNode struct {
+	v interface{}
+}
+
+func (n *literalNode) check(*scope) (typ, error) {
+	return typeOf(n.v), nil
+}
+
+func (n *literalNode) eval(*activation) (interface{}, error) {
+	return n.v, nil
+}
+
+type identNode struct {
+	pos  int
+	name string
+}
+
+func (n *identNode) check(s *scope) (typ, error) {
+	t, ok := s.lookup(n.name)
+	if !ok {
+		return "", errorf(n.pos, "undeclared reference to '%s'", n.name)
+	}
+	return t, nil
+}
+
+func (n *identNode) eval(a *activation) (interface{}, error) {
+	return a.lookup(n.name), nil
+}
+
+type listNode struct {
+	elems []node
+}
+
+func (n *listNode) check(s *scope) (typ, error) {
+	for _, e := range n.elems {
+		if _, err := e.check(s); err != nil {
+			return "", err
+		}
+	}
+	return listType, nil
+}
+
+func (n *listNode) eval(a *activation) (interface{}, error) {
+	l := make([]interface{}, 0, len(n.elems))
+	for _, e := range n.elems {
+		v, err := e.eval(a)
+		if err != nil {
+			return nil, err
+		}
+		l = append(l, v)
+	}
+	return l, nil
+}
+
+// selectNode selects the field of a map, the operand.field expression.
+type selectNode struct {
+	pos     int
+	operand node
+	field   string
+}
+
+func (n *selectNode) check(s *scope) (typ, error) {
+	t, err := n.operand.check(s)
+	if err != nil {
+		return "", err
+	}
+	switch t {
+	case attrsType:
+		return stringType, nil
+	case mapType, dynType:
+		return dynType, nil
+	}
+	return "", errorf(n.pos, "type '%s' does not support field selection", t)
+}
+
+func (n *selectNode) eval(a *activation) (interface{}, error) {
+	v, ok, err := n.lookup(a)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("no such key: %s", n.field)
+	}
+	return v, nil
+}
+
+// lookup returns the field of the operand, and whether it is set.
+func (n *selectNode) lookup(a *activation) (interface{}, bool, error) {
+	v, err := n.operand.eval(a)
+	if err != nil {
+		return nil, false, err
+	}
+	switch m := v.(type) {
+	case map[string]interface{}:
+		f, ok := m[n.field]
+		return f, ok, nil
+	case map[string]string:
+		f, ok := m[n.field]
+		return f, ok, nil
+	}
+	return nil, false, fmt.Errorf("type '%s' does not support field selection", typeOf(v))
+}
+
+// hasNode tests whether a field is set, the has(operand.field) macro.
+type hasNode struct {
+	sel *selectNode
+}
+
+func (n *hasNode) check(s *scope) (typ, error) {
+	if _, err := n.sel.check(s); err != nil {
+		return "", err
+	}
+	return boolType, nil
+}
+
+func (n *hasNode) eval(a *activation) (interface{}, error) {
+	_, ok, err := n.sel.lookup(a)
+	if err != nil {
+		return nil, err
+	}
+	return ok, nil
+}
+
+// indexNode indexes a list or a map, the operand[index] expression.
+type indexNode struct {
+	pos     int
+	operand node
+	index   node
+}
+
+func (n *indexNode) check(s *scope) (typ, error) {
+	t, err := n.operand.check(s)
+	if err != nil {
+		return "", err
+	}
+	i, err := n.index.check(s)
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case t == listType && assignable(i, intType), t == mapType && assignable(i, stringType), t == dynType:
+		return dynType, nil
+	case t == attrsType && assignable(i, stringType):
+		return stringType, nil
+	}
+	return "", errorf(n.pos, "no matching overload for '[]' applied to (%s, %s)", t, i)
+}
+
+func (n *indexNode) eval(a *activation) (interface{}, error) {
+	v, err := n.operand.eval(a)
+	if err != nil {
+		return nil, err
+	}
+	i, err := n.index.eval(a)
+	if err != nil {
+		return nil, err
+	}
+	switch v := v.(type) {
+	case []interface{}:
+		if i, ok := i.(int64); ok {
+			if i < 0 || i >= int64(len(v)) {
+				return nil, fmt.Errorf("index out of range: %d", i)
+			}
+			return v[i], nil
+		}
+	case map[string]interface{}:
+		if k, ok := i.(string); ok {
+			if f, ok := v[k]; ok {
+				return f, nil
+			}
+			return nil, fmt.Errorf("no such key: %s", k)
+		}
+	case map[string]string:
+		if k, ok := i.(string); ok {
+			if f, ok := v[k]; ok {
+				return f, nil
+			}
+			return nil, fmt.Errorf("no such key: %s", k)
+		}
+	}
+	return nil, fmt.Errorf("no matching overload for '[]' applied to (%s, %s)", typeOf(v), typeOf(i))
+}
+
+// logicalNode is the && operator, or the || operator. As in CEL, an error
+// on one side is ignored when the other side decides the result, so that
+// e.g. has(data.x) && data.x > 1 and data.x > 1 && has(data.x) are both
+// false without x.
+type logicalNode struct {
+	pos  int
+	or   bool
+	l, r node
+}
+
+func (n *logicalNode) op() string {
+	if n.or {
+		return "||"
+	}
+	return "&&"
+}
+
+func (n *logicalNode) check(s *scope) (typ, error) {
+	l, err := n.l.check(s)
+	if err != nil {
+		return "", err
+	}
+	r, err := n.r.check(s)
+	if err != nil {
+		return "", err
+	}
+	if !assignable(boolType, l) || !assignable(boolType, r) {
+		return "", errorf(n.pos, "no matching overload for '%s' applied to (%s, %s)", n.op(), l, r)
+	}
+	return boolType, nil
+}
+
+func (n *logicalNode) eval(a *activation) (interface{}, error) {
+	// The result when one side is true for ||, or false for &&.
+	decisive := n.or
+	var errs []error
+	for _, side := range []node{n.l, n.r} {
+		v, err := side.eval(a)
+		if err == nil {
+			if b, ok := v.(bool); !ok {
+				err = fmt.Errorf("no matching overload for '%s' applied to (%s)", n.op(), typeOf(v))
+			} else if b == decisive {
+				return decisive, nil
+			}
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errs[0]
+	}
+	return !decisive, nil
+}
+
+// condNode is the cond ? then : els expression.
+type condNode struct {
+	pos             int
+	cond, then, els node
+}
+
+func (n *condNode) check(s *scope) (typ, error) {
+	c, err := n.cond.check(s)
+	if err != nil {
+		return "", err
+	}
+	if !assignable(boolType, c) {
+		return "", errorf(n.pos, "no matching overload for '?:' applied to (%s)", c)
+	}
+	t, err := n.then.check(s)
+	if err != nil {
+		return "", err
+	}
+	e, err := n.els.check(s)
+	if err != nil {
+		return "", err
+	}
+	if t != e {
+		return dynType, nil
+	}
+	return t, nil
+}
+
+func (n *condNode) eval(a *activation) (interface{}, error) {
+	c, err := n.cond.eval(a)
+	if err != nil {
+		return nil, err
+	}
+	b, ok := c.(bool)
+	if !ok {
+		return nil, fmt.Errorf("no matching overload for '?:' applied to (%s)", typeOf(c))
+	}
+	if b {
+		return n.then.eval(a)
+	}
+	return n.els.eval(a)
+}
+
+// callNode is the call of an operator or of a function. The target of a
+// method call, target.fn(args), is its first argument.
+type callNode struct {
+	pos      int
+	fn       string
+	receiver bool
+	args     []node
+}
+
+func (n *callNode) check(s *scope) (typ, error) {
+	types := make([]typ, len(n.args))
+	for i, arg := range n.args {
+		t, err := arg.check(s)
+		if err != nil {
+			return "", err
+		}
+		types[i] = t
+	}
+	overloads, ok := functions[n.fn]
+	if !ok {
+		return "", errorf(n.pos, "undeclared reference to '%s'", n.fn)
+	}
+	var result typ
+	for _, o := range overloads {
+		if o.receiver != n.receiver || !o.accepts(types, true) {
+			continue
+		}
+		if result == "" {
+			result = o.result
+		} else if result != o.result {
+			result = dynType
+		}
+	}
+	if result == "" {
+		return "", errorf(n.pos, "no matching overload for '%s' applied to (%s)", n.fn, typeNames(types))
+	}
+	return result, nil
+}
+
+func (n *callNode) eval(a *activation) (interface{}, error) {
+	args := make([]interface{}, len(n.args))
+	types := make([]typ, len(n.args))
+	for i, arg := range n.args {
+		v, err := arg.eval(a)
+		if err != nil {
+			return nil, err
+		}
+		args[i], types[i] = v, typeOf(v)
+	}
+	for _, o := range functions[n.fn] {
+		if o.receiver == n.receiver && o.accepts(types, false) {
+			return o.fn(args)
+		}
+	}
+	return nil, fmt.Errorf("no matching overload for '%s' applied to (%s)", n.fn, typeNames(types))
+}
+
+func typeNames(types []typ) string {
+	names := make([]string, len(types))
+	for i, t := range types {
+		names[i] = string(t)
+	}
+	return strings.Join(names, ", ")
+}
+
+// comprehensionNode is the target.exists(v, pred) macro, true when pred is
+// true for an element of target, or the target.all(v, pred) macro, true
+// when it is true for every element. The elements of a map are its keys.
+type comprehensionNode struct {
+	pos    int
+	all    bool
+	target node
+	v      string
+	pred   node
+}
+
+func (n *comprehensionNode) check(s *scope) (typ, error) {
+	t, err := n.target.check(s)
+	if err != nil {
+		return "", err
+	}
+	var elem typ
+	switch t {
+	case listType, dynType:
+		elem = dynType
+	case mapType, attrsType:
+		elem = stringType
+	default:
+		return "", errorf(n.pos, "expression of type '%s' cannot be the range of a comprehension", t)
+	}
+	p, err := n.pred.check(&scope{name: n.v, t: elem, parent: s})
+	if err != nil {
+		return "", err
+	}
+	if !assignable(boolType, p) {
+		return "", errorf(n.pos, "expected a bool predicate, got %s", p)
+	}
+	return boolType, nil
+}
+
+func (n *comprehensionNode) eval(a *activation) (interface{}, error) {
+	v, err := n.target.eval(a)
+	if err != nil {
+		return nil, err
+	}
+	var elems []interface{}
+	switch v := v.(type) {
+	case []interface{}:
+		elems = v
+	case map[string]interface{}:
+		for k := range v {
+			elems = append(elems, k)
+		}
+	case map[string]string:
+		for k := range v {
+			elems = append(elems, k)
+		}
+	default:
+		return nil, fmt.Errorf("expression of type '%s' cannot be the range of a comprehension", typeOf(v))
+	}
+	if _, ok := v.([]interface{}); !ok {
+		sort.Slice(elems, func(i, j int) bool { return elems[i].(string) < elems[j].(string) })
+	}
+
+	// As with &&, an error is ignored when another element decides the
+	// result: true for exists, false for all.
+	decisive := !n.all
+	var first error
+	for _, e := range elems {
+		p, err := n.pred.eval(&activation{name: n.v, value: e, parent: a})
+		if err == nil {
+			if b, ok := p.(bool); !ok {
+				err = fmt.Errorf("expected a bool predicate, got %s", typeOf(p))
+			} else if b == decisive {
+				return decisive, nil
+			}
+		}
+		if err != nil && first == nil {
+			first = err
+		}
+	}
+	if first != nil {
+		return nil, first
+	}
+	return !decisive, nil
+}
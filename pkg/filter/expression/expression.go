@@ -0,0 +1,125 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package expression evaluates the CEL expressions of the filters of
+// BrokerChannels.
+//
+// It implements the subset of CEL (https://github.com/google/cel-spec)
+// filters need, without its runtime and dependencies:
+//   - int, double, string, bool, null and list literals;
+//   - field selection, a.b, and indexing, a["b"] or a[0];
+//   - the operators !, -, *, /, %, +, <, <=, >, >=, ==, !=, in, &&, || and
+//     ?:, with the precedence of CEL;
+//   - the has() macro, and the exists() and all() macros of lists and maps;
+//   - the size(), timestamp(), int(), double() and string() functions, and
+//     the contains(), startsWith(), endsWith(), matches() and size()
+//     methods.
+//
+// As in CEL, && and || ignore an error on one side when the other side
+// decides the result, and ints and doubles compare with each other.
+package expression
+
+import (
+	"encoding/json"
+	"fmt"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/cloudevents/sdk-go/v2/types"
+)
+
+// Expression is a compiled CEL expression over a CloudEvent. The event
+// variable maps the names of the attributes set on the event, context
+// attributes or extensions, to their value as a string, and the data
+// variable is its payload decoded from JSON, null when it is not JSON.
+type Expression struct {
+	root node
+}
+
+// variables declares the variables of the expressions.
+var variables = &scope{name: "event", t: attrsType, parent: &scope{name: "data", t: dynType}}
+
+// Compile parses and checks src, which must evaluate to a bool.
+func Compile(src string) (*Expression, error) {
+	root, err := parse(src)
+	if err == nil {
+		var t typ
+		if t, err = root.check(variables); err == nil && t != boolType && t != dynType {
+			err = errorf(0, "expected a bool expression, got %s", t)
+		}
+	}
+	if e, ok := err.(*posError); ok {
+		line, col := position(src, e.pos)
+		return nil, fmt.Errorf("%d:%d: %s", line, col, e.msg)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Expression{root: root}, nil
+}
+
+// Match evaluates e over event. It returns an error when the expression
+// fails to evaluate, e.g. on an attribute or a field which is not set, or
+// does not evaluate to a bool.
+func (e *Expression) Match(event cloudevents.Event) (bool, error) {
+	out, err := e.root.eval(&activation{
+		name:   "event",
+		value:  attributes(event),
+		parent: &activation{name: "data", value: data(event)},
+	})
+	if err != nil {
+		return false, err
+	}
+	b, ok := out.(bool)
+	if !ok {
+		return false, fmt.Errorf("expected a bool, got %s", typeOf(out))
+	}
+	return b, nil
+}
+
+// attributes returns the attributes set on event, formatted as strings.
+func attributes(event cloudevents.Event) map[string]string {
+	attrs := make(map[string]string)
+	set := func(name, value string) {
+		if value != "" {
+			attrs[name] = value
+		}
+	}
+	set("specversion", event.SpecVersion())
+	set("id", event.ID())
+	set("source", event.Source())
+	set("type", event.Type())
+	set("subject", event.Subject())
+	set("dataschema", event.DataSchema())
+	set("datacontenttype", event.DataContentType())
+	if t := event.Time(); !t.IsZero() {
+		set("time", types.FormatTime(t))
+	}
+	for name, ext := range event.Extensions() {
+		if s, err := types.Format(ext); err == nil {
+			attrs[name] = s
+		}
+	}
+	return attrs
+}
+
+// data returns the payload of event decoded from JSON, or nil.
+func data(event cloudevents.Event) interface{} {
+	var v interface{}
+	if err := json.Unmarshal(event.Data(), &v); err != nil {
+		return nil
+	}
+	return v
+}
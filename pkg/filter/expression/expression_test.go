@@ -0,0 +1,199 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package expression
+
+import (
+	"testing"
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+)
+
+func TestMatch(t *testing.T) {
+	event := cloudevents.NewEvent()
+	event.SetID("1")
+	event.SetType("dev.knative.sensor.temperature")
+	event.SetSource("/sensors/hall")
+	event.SetTime(time.Date(2021, 4, 20, 8, 0, 0, 0, time.UTC))
+	event.SetExtension("floor", 2)
+	if err := event.SetData(cloudevents.ApplicationJSON, map[string]interface{}{
+		"celsius":  31,
+		"readings": []int{30, 31},
+		"sensor":   map[string]string{"model": "t-100"},
+	}); err != nil {
+		t.Fatal("SetData() =", err)
+	}
+	text := cloudevents.NewEvent()
+	text.SetID("2")
+	text.SetType("dev.knative.sensor.log")
+	text.SetSource("/sensors/hall")
+	if err := text.SetData(cloudevents.TextPlain, "rebooted"); err != nil {
+		t.Fatal("SetData() =", err)
+	}
+
+	tests := []struct {
+		name  string
+		expr  string
+		event cloudevents.Event
+		want  bool
+		err   bool
+	}{{
+		name:  "attributes",
+		expr:  `event.type == "dev.knative.sensor.temperature" && event.source.startsWith("/sensors/")`,
+		event: event,
+		want:  true,
+	}, {
+		name:  "extension",
+		expr:  `event.floor == "2"`,
+		event: event,
+		want:  true,
+	}, {
+		name:  "time",
+		expr:  `timestamp(event.time) > timestamp("2021-01-01T00:00:00Z")`,
+		event: event,
+		want:  true,
+	}, {
+		name:  "unset attribute",
+		expr:  `has(event.subject)`,
+		event: event,
+		want:  false,
+	}, {
+		name:  "payload",
+		expr:  `data.celsius > 30 && data.sensor.model == "t-100"`,
+		event: event,
+		want:  true,
+	}, {
+		name:  "payload list",
+		expr:  `data.readings.exists(r, r < 30)`,
+		event: event,
+		want:  false,
+	}, {
+		name:  "missing field",
+		expr:  `data.humidity > 50`,
+		event: event,
+		err:   true,
+	}, {
+		name:  "payload not JSON",
+		expr:  `data == null`,
+		event: text,
+		want:  true,
+	}, {
+		name:  "not a bool",
+		expr:  `data.sensor`,
+		event: event,
+		err:   true,
+	}, {
+		name:  "error absorbed by ||",
+		expr:  `data.humidity > 50 || event.floor == "2"`,
+		event: event,
+		want:  true,
+	}, {
+		name:  "error absorbed by &&",
+		expr:  `data.humidity > 50 && event.floor == "3"`,
+		event: event,
+		want:  false,
+	}, {
+		name:  "precedence",
+		expr:  `1 + 2 * 3 == 7 && -(1 - 3) % 3 == 2 && !false == true`,
+		event: event,
+		want:  true,
+	}, {
+		name:  "ternary",
+		expr:  `(data.celsius > 30 ? "hot" : "cold") == "hot"`,
+		event: event,
+		want:  true,
+	}, {
+		name:  "index",
+		expr:  `data["sensor"]["model"] == "t-100" && data.readings[1] == 31 && event["floor"] == "2"`,
+		event: event,
+		want:  true,
+	}, {
+		name:  "index out of range",
+		expr:  `data.readings[2] == 31`,
+		event: event,
+		err:   true,
+	}, {
+		name:  "in",
+		expr:  `event.type in ["dev.knative.sensor.temperature", "dev.knative.sensor.humidity"] && "sensor" in data`,
+		event: event,
+		want:  true,
+	}, {
+		name:  "all",
+		expr:  `data.readings.all(r, r >= 30) && event.all(k, k.size() > 1)`,
+		event: event,
+		want:  true,
+	}, {
+		name:  "string functions",
+		expr:  `event.source.contains("hall") && event.type.endsWith(".temperature") && event.id.matches("^[0-9]+$")`,
+		event: event,
+		want:  true,
+	}, {
+		name:  "conversions",
+		expr:  `int(event.floor) + 1 == 3 && double(event.floor) == 2.0 && string(data.celsius) == "31" && size(data.readings) == 2`,
+		event: event,
+		want:  true,
+	}, {
+		name:  "escapes",
+		expr:  `"t\x2d100" == data.sensor.model && r"\d" == '\\d'`,
+		event: event,
+		want:  true,
+	}, {
+		name:  "division by zero",
+		expr:  `1 / (size(data.readings) - 2) == 1`,
+		event: event,
+		err:   true,
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			e, err := Compile(tc.expr)
+			if err != nil {
+				t.Fatal("Compile() =", err)
+			}
+			got, err := e.Match(tc.event)
+			if (err != nil) != tc.err {
+				t.Fatalf("Match() = %v, want error %t", err, tc.err)
+			}
+			if got != tc.want {
+				t.Errorf("Match() = %t, want %t", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	for _, tc := range []struct {
+		expr string
+		want string
+	}{
+		{`event.type ==`, "1:14: unexpected end of input"},
+		{`event.type`, "1:1: expected a bool expression, got string"},
+		{`data.celsius > 30 && unknown`, "1:22: undeclared reference to 'unknown'"},
+		{`event.type + 1`, "1:12: no matching overload for '+' applied to (string, int)"},
+		{`event.type.value == "x"`, "1:12: type 'string' does not support field selection"},
+		{`data.readings.exists(1, true)`, "1:15: the first argument of exists() must be a variable name"},
+		{`event.type.lower() == "x"`, "1:12: undeclared reference to 'lower'"},
+		{`has(data)`, "1:1: invalid argument to has(), expected a field selection"},
+		{`"open == data.state`, "1:1: unterminated string"},
+		{`data.state == "a" ;`, "1:19: unexpected character ';'"},
+	} {
+		_, err := Compile(tc.expr)
+		if err == nil || err.Error() != tc.want {
+			t.Errorf("Compile(%q) = %v, want %s", tc.expr, err, tc.want)
+		}
+	}
+}
@@ -0,0 +1,399 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package expression
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// overload is an implementation of an operator or a function for the
+// parameters params. The first parameter of a method is its target.
+type overload struct {
+	receiver bool
+	params   []typ
+	result   typ
+	fn       func(args []interface{}) (interface{}, error)
+}
+
+// accepts tells whether the overload applies to arguments of the types
+// args. A dyn argument, only known at evaluation, is accepted when
+// checking.
+func (o *overload) accepts(args []typ, checking bool) bool {
+	if len(args) != len(o.params) {
+		return false
+	}
+	for i, t := range args {
+		if !assignable(o.params[i], t) && !(checking && t == dynType) {
+			return false
+		}
+	}
+	return true
+}
+
+func function(result typ, fn func(args []interface{}) (interface{}, error), params ...typ) overload {
+	return overload{params: params, result: result, fn: fn}
+}
+
+func method(result typ, fn func(args []interface{}) (interface{}, error), params ...typ) overload {
+	return overload{receiver: true, params: params, result: result, fn: fn}
+}
+
+var errDivisionByZero = errors.New("division by zero")
+
+func errOverflow(op string) error {
+	return fmt.Errorf("int overflow on '%s'", op)
+}
+
+// functions are the overloads of the operators and of the functions, by
+// name.
+var functions = map[string][]overload{
+	"!": {function(boolType, func(a []interface{}) (interface{}, error) {
+		return !a[0].(bool), nil
+	}, boolType)},
+	"-": {
+		function(intType, func(a []interface{}) (interface{}, error) {
+			if a[0].(int64) == math.MinInt64 {
+				return nil, errOverflow("-")
+			}
+			return -a[0].(int64), nil
+		}, intType),
+		function(doubleType, func(a []interface{}) (interface{}, error) {
+			return -a[0].(float64), nil
+		}, doubleType),
+		function(intType, func(a []interface{}) (interface{}, error) {
+			x, y := a[0].(int64), a[1].(int64)
+			if r := x - y; (r < x) == (y > 0) {
+				return r, nil
+			}
+			return nil, errOverflow("-")
+		}, intType, intType),
+		function(doubleType, func(a []interface{}) (interface{}, error) {
+			return a[0].(float64) - a[1].(float64), nil
+		}, doubleType, doubleType),
+	},
+	"+": {
+		function(intType, func(a []interface{}) (interface{}, error) {
+			x, y := a[0].(int64), a[1].(int64)
+			if r := x + y; (r > x) == (y > 0) {
+				return r, nil
+			}
+			return nil, errOverflow("+")
+		}, intType, intType),
+		function(doubleType, func(a []interface{}) (interface{}, error) {
+			return a[0].(float64) + a[1].(float64), nil
+		}, doubleType, doubleType),
+		function(stringType, func(a []interface{}) (interface{}, error) {
+			return a[0].(string) + a[1].(string), nil
+		}, stringType, stringType),
+		function(listType, func(a []interface{}) (interface{}, error) {
+			x, y := a[0].([]interface{}), a[1].([]interface{})
+			return append(append(make([]interface{}, 0, len(x)+len(y)), x...), y...), nil
+		}, listType, listType),
+	},
+	"*": {
+		function(intType, func(a []interface{}) (interface{}, error) {
+			x, y := a[0].(int64), a[1].(int64)
+			r := x * y
+			if x != 0 && (r/x != y || x == -1 && y == math.MinInt64 || y == -1 && x == math.MinInt64) {
+				return nil, errOverflow("*")
+			}
+			return r, nil
+		}, intType, intType),
+		function(doubleType, func(a []interface{}) (interface{}, error) {
+			return a[0].(float64) * a[1].(float64), nil
+		}, doubleType, doubleType),
+	},
+	"/": {
+		function(intType, func(a []interface{}) (interface{}, error) {
+			x, y := a[0].(int64), a[1].(int64)
+			switch {
+			case y == 0:
+				return nil, errDivisionByZero
+			case x == math.MinInt64 && y == -1:
+				return nil, errOverflow("/")
+			}
+			return x / y, nil
+		}, intType, intType),
+		function(doubleType, func(a []interface{}) (interface{}, error) {
+			return a[0].(float64) / a[1].(float64), nil
+		}, doubleType, doubleType),
+	},
+	"%": {function(intType, func(a []interface{}) (interface{}, error) {
+		x, y := a[0].(int64), a[1].(int64)
+		switch {
+		case y == 0:
+			return nil, errors.New("modulus by zero")
+		case y == -1:
+			return int64(0), nil
+		}
+		return x % y, nil
+	}, intType, intType)},
+	"==": {function(boolType, func(a []interface{}) (interface{}, error) {
+		return equal(a[0], a[1]), nil
+	}, dynType, dynType)},
+	"!=": {function(boolType, func(a []interface{}) (interface{}, error) {
+		return !equal(a[0], a[1]), nil
+	}, dynType, dynType)},
+	"<":  comparisons(func(c int) bool { return c < 0 }),
+	"<=": comparisons(func(c int) bool { return c <= 0 }),
+	">":  comparisons(func(c int) bool { return c > 0 }),
+	">=": comparisons(func(c int) bool { return c >= 0 }),
+	"in": {
+		function(boolType, func(a []interface{}) (interface{}, error) {
+			for _, e := range a[1].([]interface{}) {
+				if equal(a[0], e) {
+					return true, nil
+				}
+			}
+			return false, nil
+		}, dynType, listType),
+		function(boolType, func(a []interface{}) (interface{}, error) {
+			_, ok := mapKeys(a[1])[a[0].(string)]
+			return ok, nil
+		}, stringType, mapType),
+	},
+
+	"size": {
+		function(intType, size, stringType),
+		function(intType, size, listType),
+		function(intType, size, mapType),
+		method(intType, size, stringType),
+		method(intType, size, listType),
+		method(intType, size, mapType),
+	},
+	"contains":   {method(boolType, stringFunc(strings.Contains), stringType, stringType)},
+	"startsWith": {method(boolType, stringFunc(strings.HasPrefix), stringType, stringType)},
+	"endsWith":   {method(boolType, stringFunc(strings.HasSuffix), stringType, stringType)},
+	"matches": {method(boolType, func(a []interface{}) (interface{}, error) {
+		re, err := regexp.Compile(a[1].(string))
+		if err != nil {
+			return nil, err
+		}
+		return re.MatchString(a[0].(string)), nil
+	}, stringType, stringType)},
+
+	"timestamp": {
+		function(timestampType, func(a []interface{}) (interface{}, error) {
+			return time.Parse(time.RFC3339Nano, a[0].(string))
+		}, stringType),
+		function(timestampType, identity, timestampType),
+	},
+	"int": {
+		function(intType, identity, intType),
+		function(intType, func(a []interface{}) (interface{}, error) {
+			f := a[0].(float64)
+			if math.IsNaN(f) || f <= math.MinInt64 || f >= math.MaxInt64 {
+				return nil, errors.New("double is out of the range of int")
+			}
+			return int64(f), nil
+		}, doubleType),
+		function(intType, func(a []interface{}) (interface{}, error) {
+			return strconv.ParseInt(a[0].(string), 10, 64)
+		}, stringType),
+		function(intType, func(a []interface{}) (interface{}, error) {
+			return a[0].(time.Time).Unix(), nil
+		}, timestampType),
+	},
+	"double": {
+		function(doubleType, identity, doubleType),
+		function(doubleType, func(a []interface{}) (interface{}, error) {
+			return float64(a[0].(int64)), nil
+		}, intType),
+		function(doubleType, func(a []interface{}) (interface{}, error) {
+			return strconv.ParseFloat(a[0].(string), 64)
+		}, stringType),
+	},
+	"string": {
+		function(stringType, identity, stringType),
+		function(stringType, func(a []interface{}) (interface{}, error) {
+			return strconv.FormatInt(a[0].(int64), 10), nil
+		}, intType),
+		function(stringType, func(a []interface{}) (interface{}, error) {
+			return strconv.FormatFloat(a[0].(float64), 'g', -1, 64), nil
+		}, doubleType),
+		function(stringType, func(a []interface{}) (interface{}, error) {
+			return strconv.FormatBool(a[0].(bool)), nil
+		}, boolType),
+		function(stringType, func(a []interface{}) (interface{}, error) {
+			return a[0].(time.Time).UTC().Format(time.RFC3339Nano), nil
+		}, timestampType),
+	},
+}
+
+func identity(a []interface{}) (interface{}, error) {
+	return a[0], nil
+}
+
+func stringFunc(f func(s, arg string) bool) func([]interface{}) (interface{}, error) {
+	return func(a []interface{}) (interface{}, error) {
+		return f(a[0].(string), a[1].(string)), nil
+	}
+}
+
+func size(a []interface{}) (interface{}, error) {
+	switch v := a[0].(type) {
+	case string:
+		return int64(utf8.RuneCountInString(v)), nil
+	case []interface{}:
+		return int64(len(v)), nil
+	}
+	return int64(len(mapKeys(a[0]))), nil
+}
+
+// mapKeys returns the entries of the map v.
+func mapKeys(v interface{}) map[string]interface{} {
+	switch m := v.(type) {
+	case map[string]interface{}:
+		return m
+	case map[string]string:
+		entries := make(map[string]interface{}, len(m))
+		for k, v := range m {
+			entries[k] = v
+		}
+		return entries
+	}
+	return nil
+}
+
+// comparisons returns the overloads of an ordering operator, true when
+// test holds for the result of compare. Ints and doubles compare with each
+// other, as the numbers of JSON payloads are doubles.
+func comparisons(test func(int) bool) []overload {
+	fn := func(a []interface{}) (interface{}, error) {
+		return test(compare(a[0], a[1])), nil
+	}
+	var overloads []overload
+	for _, p := range [][]typ{
+		{intType, intType}, {doubleType, doubleType}, {intType, doubleType}, {doubleType, intType},
+		{stringType, stringType}, {boolType, boolType}, {timestampType, timestampType},
+	} {
+		overloads = append(overloads, function(boolType, fn, p...))
+	}
+	return overloads
+}
+
+// compare returns -1, 0 or 1 when x is lower than, equal to or greater than
+// y, which have one of the types of the comparisons.
+func compare(x, y interface{}) int {
+	switch x := x.(type) {
+	case int64:
+		if y, ok := y.(int64); ok {
+			return compareInts(x, y)
+		}
+		return compareFloats(float64(x), y.(float64))
+	case float64:
+		if y, ok := y.(int64); ok {
+			return compareFloats(x, float64(y))
+		}
+		return compareFloats(x, y.(float64))
+	case string:
+		return strings.Compare(x, y.(string))
+	case bool:
+		switch y := y.(bool); {
+		case x == y:
+			return 0
+		case y:
+			return -1
+		}
+		return 1
+	case time.Time:
+		y := y.(time.Time)
+		switch {
+		case x.Before(y):
+			return -1
+		case x.After(y):
+			return 1
+		}
+	}
+	return 0
+}
+
+func compareInts(x, y int64) int {
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	}
+	return 0
+}
+
+func compareFloats(x, y float64) int {
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	}
+	return 0
+}
+
+// equal tells whether x and y are equal. Values of different types are not,
+// except ints and doubles, which are compared as numbers.
+func equal(x, y interface{}) bool {
+	switch x := x.(type) {
+	case int64:
+		switch y := y.(type) {
+		case int64:
+			return x == y
+		case float64:
+			return float64(x) == y
+		}
+		return false
+	case float64:
+		switch y := y.(type) {
+		case int64:
+			return x == float64(y)
+		case float64:
+			return x == y
+		}
+		return false
+	case []interface{}:
+		y, ok := y.([]interface{})
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for i := range x {
+			if !equal(x[i], y[i]) {
+				return false
+			}
+		}
+		return true
+	case map[string]interface{}, map[string]string:
+		xm, ym := mapKeys(x), mapKeys(y)
+		if ym == nil || len(xm) != len(ym) {
+			return false
+		}
+		for k, v := range xm {
+			if w, ok := ym[k]; !ok || !equal(v, w) {
+				return false
+			}
+		}
+		return true
+	case time.Time:
+		y, ok := y.(time.Time)
+		return ok && x.Equal(y)
+	}
+	return x == y
+}
@@ -0,0 +1,539 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package expression
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// posError is an error at the byte offset pos of the source of an
+// expression.
+type posError struct {
+	pos int
+	msg string
+}
+
+func (e *posError) Error() string {
+	return e.msg
+}
+
+func errorf(pos int, format string, args ...interface{}) error {
+	return &posError{pos: pos, msg: fmt.Sprintf(format, args...)}
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokInt
+	tokDouble
+	tokString
+	tokOp
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+	val  interface{}
+}
+
+func (t token) String() string {
+	if t.kind == tokEOF {
+		return "end of input"
+	}
+	return strconv.Quote(t.text)
+}
+
+// operators are the operators and punctuation of the language, the longest
+// first.
+var operators = []string{
+	"==", "!=", "<=", ">=", "&&", "||",
+	"<", ">", "!", "+", "-", "*", "/", "%", "?", ":", ".", ",", "(", ")", "[", "]",
+}
+
+// lex splits src into tokens.
+func lex(src string) ([]token, error) {
+	var toks []token
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case (c == 'r' || c == 'R') && i+1 < len(src) && (src[i+1] == '"' || src[i+1] == '\''):
+			end := strings.IndexByte(src[i+2:], src[i+1])
+			if end < 0 {
+				return nil, errorf(i, "unterminated string")
+			}
+			text := src[i : i+3+end]
+			toks = append(toks, token{kind: tokString, text: text, pos: i, val: src[i+2 : i+2+end]})
+			i += len(text)
+		case c == '_' || isLetter(c):
+			j := i + 1
+			for j < len(src) && (src[j] == '_' || isLetter(src[j]) || isDigit(src[j])) {
+				j++
+			}
+			kind := tokIdent
+			if src[i:j] == "in" {
+				kind = tokOp
+			}
+			toks = append(toks, token{kind: kind, text: src[i:j], pos: i})
+			i = j
+		case isDigit(c):
+			t, err := lexNumber(src, i)
+			if err != nil {
+				return nil, err
+			}
+			toks = append(toks, t)
+			i += len(t.text)
+		case c == '"' || c == '\'':
+			t, err := lexString(src, i)
+			if err != nil {
+				return nil, err
+			}
+			toks = append(toks, t)
+			i += len(t.text)
+		default:
+			op := ""
+			for _, o := range operators {
+				if strings.HasPrefix(src[i:], o) {
+					op = o
+					break
+				}
+			}
+			if op == "" {
+				r, _ := utf8.DecodeRuneInString(src[i:])
+				return nil, errorf(i, "unexpected character %q", r)
+			}
+			toks = append(toks, token{kind: tokOp, text: op, pos: i})
+			i += len(op)
+		}
+	}
+	return append(toks, token{kind: tokEOF, pos: len(src)}), nil
+}
+
+func isLetter(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+func isHexDigit(c byte) bool {
+	return isDigit(c) || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+// lexNumber reads the int or double literal at src[i:].
+func lexNumber(src string, i int) (token, error) {
+	j := i
+	if strings.HasPrefix(src[i:], "0x") || strings.HasPrefix(src[i:], "0X") {
+		j += 2
+		for j < len(src) && isHexDigit(src[j]) {
+			j++
+		}
+		n, err := strconv.ParseInt(src[i+2:j], 16, 64)
+		if err != nil {
+			return token{}, errorf(i, "invalid int literal %s", src[i:j])
+		}
+		return token{kind: tokInt, text: src[i:j], pos: i, val: n}, nil
+	}
+
+	double := false
+	for j < len(src) && isDigit(src[j]) {
+		j++
+	}
+	if j+1 < len(src) && src[j] == '.' && isDigit(src[j+1]) {
+		double = true
+		j++
+		for j < len(src) && isDigit(src[j]) {
+			j++
+		}
+	}
+	if j < len(src) && (src[j] == 'e' || src[j] == 'E') {
+		k := j + 1
+		if k < len(src) && (src[k] == '+' || src[k] == '-') {
+			k++
+		}
+		if k < len(src) && isDigit(src[k]) {
+			double = true
+			for j = k; j < len(src) && isDigit(src[j]); j++ {
+			}
+		}
+	}
+	text := src[i:j]
+	if double {
+		f, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return token{}, errorf(i, "invalid double literal %s", text)
+		}
+		return token{kind: tokDouble, text: text, pos: i, val: f}, nil
+	}
+	n, err := strconv.ParseInt(text, 10, 64)
+	if err != nil {
+		return token{}, errorf(i, "invalid int literal %s", text)
+	}
+	return token{kind: tokInt, text: text, pos: i, val: n}, nil
+}
+
+// lexString reads the quoted string literal at src[i:], and decodes its
+// escape sequences.
+func lexString(src string, i int) (token, error) {
+	quote := src[i]
+	var b strings.Builder
+	for j := i + 1; j < len(src); {
+		c := src[j]
+		switch {
+		case c == quote:
+			return token{kind: tokString, text: src[i : j+1], pos: i, val: b.String()}, nil
+		case c == '\n':
+			return token{}, errorf(i, "unterminated string")
+		case c != '\\':
+			b.WriteByte(c)
+			j++
+			continue
+		}
+		if j+1 >= len(src) {
+			break
+		}
+		switch e := src[j+1]; e {
+		case '\\', '"', '\'', '`', '?':
+			b.WriteByte(e)
+			j += 2
+		case 'a', 'b', 'f', 'n', 'r', 't', 'v':
+			b.WriteByte("\a\b\f\n\r\t\v"[strings.IndexByte("abfnrtv", e)])
+			j += 2
+		case 'x', 'u', 'U':
+			n := map[byte]int{'x': 2, 'u': 4, 'U': 8}[e]
+			if j+2+n > len(src) {
+				return token{}, errorf(j, "invalid escape sequence")
+			}
+			r, err := strconv.ParseUint(src[j+2:j+2+n], 16, 32)
+			if err != nil || !utf8.ValidRune(rune(r)) {
+				return token{}, errorf(j, "invalid escape sequence %s", src[j:j+2+n])
+			}
+			b.WriteRune(rune(r))
+			j += 2 + n
+		default:
+			return token{}, errorf(j, "invalid escape sequence \\%c", e)
+		}
+	}
+	return token{}, errorf(i, "unterminated string")
+}
+
+// parser builds the syntax tree of an expression, following the grammar of
+// CEL:
+//
+//	expr     = or ["?" or ":" expr]
+//	or       = and {"||" and}
+//	and      = relation {"&&" relation}
+//	relation = addition {("<" | "<=" | ">=" | ">" | "==" | "!=" | "in") addition}
+//	addition = product {("+" | "-") product}
+//	product  = unary {("*" | "/" | "%") unary}
+//	unary    = member | "!" {"!"} member | "-" {"-"} member
+//	member   = primary {"." IDENT ["(" [args] ")"] | "[" expr "]"}
+//	primary  = IDENT ["(" [args] ")"] | "(" expr ")" | "[" [args] [","] "]" | literal
+type parser struct {
+	toks []token
+	i    int
+}
+
+// parse returns the syntax tree of src.
+func parse(src string) (node, error) {
+	toks, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{toks: toks}
+	n, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, errorf(t.pos, "unexpected %s", t)
+	}
+	return n, nil
+}
+
+func (p *parser) peek() token {
+	return p.toks[p.i]
+}
+
+func (p *parser) next() token {
+	t := p.toks[p.i]
+	if t.kind != tokEOF {
+		p.i++
+	}
+	return t
+}
+
+// accept consumes the next token when it is one of the operators ops.
+func (p *parser) accept(ops ...string) (token, bool) {
+	t := p.peek()
+	if t.kind != tokOp {
+		return t, false
+	}
+	for _, op := range ops {
+		if t.text == op {
+			return p.next(), true
+		}
+	}
+	return t, false
+}
+
+func (p *parser) expect(op string) error {
+	if t, ok := p.accept(op); !ok {
+		return errorf(t.pos, "expected %q, got %s", op, t)
+	}
+	return nil
+}
+
+func (p *parser) expr() (node, error) {
+	c, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	t, ok := p.accept("?")
+	if !ok {
+		return c, nil
+	}
+	then, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(":"); err != nil {
+		return nil, err
+	}
+	els, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	return &condNode{pos: t.pos, cond: c, then: then, els: els}, nil
+}
+
+func (p *parser) or() (node, error) {
+	l, err := p.and()
+	for err == nil {
+		t, ok := p.accept("||")
+		if !ok {
+			return l, nil
+		}
+		var r node
+		if r, err = p.and(); err == nil {
+			l = &logicalNode{pos: t.pos, or: true, l: l, r: r}
+		}
+	}
+	return nil, err
+}
+
+func (p *parser) and() (node, error) {
+	l, err := p.binary(0)
+	for err == nil {
+		t, ok := p.accept("&&")
+		if !ok {
+			return l, nil
+		}
+		var r node
+		if r, err = p.binary(0); err == nil {
+			l = &logicalNode{pos: t.pos, l: l, r: r}
+		}
+	}
+	return nil, err
+}
+
+// binaryLevels are the left associative binary operators, by increasing
+// precedence.
+var binaryLevels = [][]string{
+	{"<", "<=", ">=", ">", "==", "!=", "in"},
+	{"+", "-"},
+	{"*", "/", "%"},
+}
+
+func (p *parser) binary(level int) (node, error) {
+	if level == len(binaryLevels) {
+		return p.unary()
+	}
+	l, err := p.binary(level + 1)
+	for err == nil {
+		t, ok := p.accept(binaryLevels[level]...)
+		if !ok {
+			return l, nil
+		}
+		var r node
+		if r, err = p.binary(level + 1); err == nil {
+			l = &callNode{pos: t.pos, fn: t.text, args: []node{l, r}}
+		}
+	}
+	return nil, err
+}
+
+func (p *parser) unary() (node, error) {
+	t, ok := p.accept("!", "-")
+	if !ok {
+		return p.member()
+	}
+	x, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	if lit, ok := x.(*literalNode); ok && t.text == "-" {
+		// Fold negative numbers, so that the lowest int can be written.
+		switch v := lit.v.(type) {
+		case int64:
+			return &literalNode{v: -v}, nil
+		case float64:
+			return &literalNode{v: -v}, nil
+		}
+	}
+	return &callNode{pos: t.pos, fn: t.text, args: []node{x}}, nil
+}
+
+func (p *parser) member() (node, error) {
+	n, err := p.primary()
+	for err == nil {
+		t, ok := p.accept(".", "[")
+		if !ok {
+			return n, nil
+		}
+		if t.text == "[" {
+			var index node
+			if index, err = p.expr(); err == nil {
+				err = p.expect("]")
+				n = &indexNode{pos: t.pos, operand: n, index: index}
+			}
+			continue
+		}
+
+		name := p.next()
+		if name.kind != tokIdent {
+			return nil, errorf(name.pos, "expected a field name, got %s", name)
+		}
+		if _, ok := p.accept("("); !ok {
+			n = &selectNode{pos: name.pos, operand: n, field: name.text}
+			continue
+		}
+		var args []node
+		if args, err = p.args(")"); err == nil {
+			n, err = newMethodCall(name, n, args)
+		}
+	}
+	return nil, err
+}
+
+func (p *parser) primary() (node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokInt, tokDouble, tokString:
+		return &literalNode{v: t.val}, nil
+	case tokIdent:
+		switch t.text {
+		case "true":
+			return &literalNode{v: true}, nil
+		case "false":
+			return &literalNode{v: false}, nil
+		case "null":
+			return &literalNode{v: nil}, nil
+		}
+		if _, ok := p.accept("("); !ok {
+			return &identNode{pos: t.pos, name: t.text}, nil
+		}
+		args, err := p.args(")")
+		if err != nil {
+			return nil, err
+		}
+		if t.text == "has" {
+			if len(args) != 1 {
+				return nil, errorf(t.pos, "has() takes a single field selection")
+			}
+			sel, ok := args[0].(*selectNode)
+			if !ok {
+				return nil, errorf(t.pos, "invalid argument to has(), expected a field selection")
+			}
+			return &hasNode{sel: sel}, nil
+		}
+		return &callNode{pos: t.pos, fn: t.text, args: args}, nil
+	case tokOp:
+		switch t.text {
+		case "(":
+			n, err := p.expr()
+			if err != nil {
+				return nil, err
+			}
+			return n, p.expect(")")
+		case "[":
+			elems, err := p.args("]")
+			if err != nil {
+				return nil, err
+			}
+			return &listNode{elems: elems}, nil
+		}
+	}
+	return nil, errorf(t.pos, "unexpected %s", t)
+}
+
+// args parses a comma separated list of expressions, up to the closing
+// operator end, allowing a trailing comma in lists.
+func (p *parser) args(end string) ([]node, error) {
+	var args []node
+	for {
+		if _, ok := p.accept(end); ok {
+			return args, nil
+		}
+		if len(args) > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+			if _, ok := p.accept(end); ok && end == "]" {
+				return args, nil
+			}
+		}
+		n, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, n)
+	}
+}
+
+// newMethodCall returns the call of the method name on target, expanding
+// the exists and all macros.
+func newMethodCall(name token, target node, args []node) (node, error) {
+	switch name.text {
+	case "exists", "all":
+		if len(args) != 2 {
+			return nil, errorf(name.pos, "%s() takes a variable and a predicate", name.text)
+		}
+		v, ok := args[0].(*identNode)
+		if !ok {
+			return nil, errorf(name.pos, "the first argument of %s() must be a variable name", name.text)
+		}
+		return &comprehensionNode{pos: name.pos, all: name.text == "all", target: target, v: v.name, pred: args[1]}, nil
+	}
+	return &callNode{pos: name.pos, fn: name.text, receiver: true, args: append([]node{target}, args...)}, nil
+}
+
+// position returns the line and column, counted from 1, of the byte offset
+// pos of src.
+func position(src string, pos int) (line, col int) {
+	line = 1 + strings.Count(src[:pos], "\n")
+	start := strings.LastIndexByte(src[:pos], '\n') + 1
+	return line, 1 + len([]rune(src[start:pos]))
+}
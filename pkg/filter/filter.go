@@ -0,0 +1,149 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package filter builds the event filters of BrokerChannels.
+package filter
+
+import (
+	"context"
+	"strings"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/cloudevents/sdk-go/v2/types"
+	"knative.dev/eventing/pkg/eventfilter"
+	"knative.dev/eventing/pkg/eventfilter/attributes"
+
+	"github.com/ShixiongQi/brokerchannel/pkg/apis/samples/v1beta1"
+	"github.com/ShixiongQi/brokerchannel/pkg/filter/expression"
+)
+
+// New returns the filter of spec, which passes the events matching all of
+// its entries. It returns eventfilter.NoFilter for a nil spec, and an error
+// when the CEL expression of spec does not compile.
+func New(spec *v1beta1.Filter) (eventfilter.Filter, error) {
+	if spec == nil {
+		return eventfilter.Filters{}, nil
+	}
+	var filters eventfilter.Filters
+	if len(spec.Exact) > 0 {
+		filters = append(filters, attributes.NewAttributesFilter(spec.Exact))
+	}
+	if len(spec.Prefix) > 0 {
+		filters = append(filters, NewPrefixFilter(spec.Prefix))
+	}
+	if len(spec.Suffix) > 0 {
+		filters = append(filters, NewSuffixFilter(spec.Suffix))
+	}
+	if spec.CEL != "" {
+		f, err := NewExpressionFilter(spec.CEL)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, f)
+	}
+	return filters, nil
+}
+
+// matchFilter passes the events whose attributes all match their value.
+type matchFilter struct {
+	attrs map[string]string
+	match func(attr, value string) bool
+}
+
+// NewPrefixFilter returns an event filter passing the events whose attributes
+// start with the values of attrs.
+func NewPrefixFilter(attrs map[string]string) eventfilter.Filter {
+	return &matchFilter{attrs: attrs, match: strings.HasPrefix}
+}
+
+// NewSuffixFilter returns an event filter passing the events whose attributes
+// end with the values of attrs.
+func NewSuffixFilter(attrs map[string]string) eventfilter.Filter {
+	return &matchFilter{attrs: attrs, match: strings.HasSuffix}
+}
+
+func (f *matchFilter) Filter(ctx context.Context, event cloudevents.Event) eventfilter.FilterResult {
+	for name, value := range f.attrs {
+		attr, ok := attribute(event, name)
+		if !ok || !f.match(attr, value) {
+			return eventfilter.FailFilter
+		}
+	}
+	return eventfilter.PassFilter
+}
+
+// expressionFilter passes the events for which a CEL expression evaluates
+// to true.
+type expressionFilter struct {
+	expr *expression.Expression
+}
+
+// NewExpressionFilter returns an event filter passing the events for which
+// the CEL expression src evaluates to true. An expression failing to
+// evaluate does not pass.
+func NewExpressionFilter(src string) (eventfilter.Filter, error) {
+	expr, err := expression.Compile(src)
+	if err != nil {
+		return nil, err
+	}
+	return &expressionFilter{expr: expr}, nil
+}
+
+func (f *expressionFilter) Filter(ctx context.Context, event cloudevents.Event) eventfilter.FilterResult {
+	if ok, err := f.expr.Match(event); err != nil || !ok {
+		return eventfilter.FailFilter
+	}
+	return eventfilter.PassFilter
+}
+
+// attribute returns the value of the context attribute or extension name of
+// event, and whether it is set.
+func attribute(event cloudevents.Event, name string) (string, bool) {
+	var v string
+	switch name {
+	case "specversion":
+		v = event.SpecVersion()
+	case "id":
+		v = event.ID()
+	case "source":
+		v = event.Source()
+	case "type":
+		v = event.Type()
+	case "subject":
+		v = event.Subject()
+	case "time":
+		if t := event.Time(); !t.IsZero() {
+			v = types.FormatTime(t)
+		}
+	case "dataschema", "schemaurl":
+		v = event.DataSchema()
+	case "datacontenttype":
+		v = event.DataContentType()
+	default:
+		ext, ok := event.Extensions()[name]
+		if !ok {
+			return "", false
+		}
+		s, err := types.Format(ext)
+		return s, err == nil
+	}
+	return v, v != ""
+}
+
+var (
+	_ eventfilter.Filter = (*matchFilter)(nil)
+	_ eventfilter.Filter = (*expressionFilter)(nil)
+)
@@ -0,0 +1,133 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package filter
+
+import (
+	"context"
+	"testing"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"knative.dev/eventing/pkg/eventfilter"
+
+	"github.com/ShixiongQi/brokerchannel/pkg/apis/samples/v1beta1"
+)
+
+func TestFilter(t *testing.T) {
+	event := cloudevents.NewEvent()
+	event.SetID("1")
+	event.SetType("dev.knative.sensor.motion")
+	event.SetSource("/sensors/hall")
+	event.SetSubject("building-1/door")
+	event.SetExtension("location", "hall")
+	if err := event.SetData(cloudevents.ApplicationJSON, map[string]interface{}{"confidence": 0.9}); err != nil {
+		t.Fatal("SetData() =", err)
+	}
+
+	tests := []struct {
+		name string
+		spec *v1beta1.Filter
+		want eventfilter.FilterResult
+	}{{
+		name: "no filter",
+		want: eventfilter.NoFilter,
+	}, {
+		name: "exact",
+		spec: &v1beta1.Filter{Exact: map[string]string{"type": "dev.knative.sensor.motion", "location": "hall"}},
+		want: eventfilter.PassFilter,
+	}, {
+		name: "exact any",
+		spec: &v1beta1.Filter{Exact: map[string]string{"location": ""}},
+		want: eventfilter.PassFilter,
+	}, {
+		name: "exact mismatch",
+		spec: &v1beta1.Filter{Exact: map[string]string{"type": "dev.knative.sensor.temperature"}},
+		want: eventfilter.FailFilter,
+	}, {
+		name: "prefix",
+		spec: &v1beta1.Filter{Prefix: map[string]string{"source": "/sensors/", "location": "ha"}},
+		want: eventfilter.PassFilter,
+	}, {
+		name: "prefix mismatch",
+		spec: &v1beta1.Filter{Prefix: map[string]string{"source": "/actuators/"}},
+		want: eventfilter.FailFilter,
+	}, {
+		name: "prefix of missing attribute",
+		spec: &v1beta1.Filter{Prefix: map[string]string{"room": "h"}},
+		want: eventfilter.FailFilter,
+	}, {
+		name: "suffix",
+		spec: &v1beta1.Filter{Suffix: map[string]string{"subject": "/door"}},
+		want: eventfilter.PassFilter,
+	}, {
+		name: "suffix of unset attribute",
+		spec: &v1beta1.Filter{Suffix: map[string]string{"dataschema": ".json"}},
+		want: eventfilter.FailFilter,
+	}, {
+		name: "all match",
+		spec: &v1beta1.Filter{
+			Exact:  map[string]string{"type": "dev.knative.sensor.motion"},
+			Prefix: map[string]string{"source": "/sensors/"},
+			Suffix: map[string]string{"subject": "/door"},
+		},
+		want: eventfilter.PassFilter,
+	}, {
+		name: "one mismatch",
+		spec: &v1beta1.Filter{
+			Exact:  map[string]string{"type": "dev.knative.sensor.motion"},
+			Prefix: map[string]string{"source": "/sensors/"},
+			Suffix: map[string]string{"subject": "/window"},
+		},
+		want: eventfilter.FailFilter,
+	}, {
+		name: "cel",
+		spec: &v1beta1.Filter{CEL: `event.location == "hall" && data.confidence > 0.8`},
+		want: eventfilter.PassFilter,
+	}, {
+		name: "cel mismatch",
+		spec: &v1beta1.Filter{CEL: `data.confidence > 0.95`},
+		want: eventfilter.FailFilter,
+	}, {
+		name: "cel of missing field",
+		spec: &v1beta1.Filter{CEL: `data.celsius > 30`},
+		want: eventfilter.FailFilter,
+	}, {
+		name: "cel and attributes",
+		spec: &v1beta1.Filter{
+			Exact: map[string]string{"type": "dev.knative.sensor.motion"},
+			CEL:   `has(event.subject) && event.subject.startsWith("building-1/")`,
+		},
+		want: eventfilter.PassFilter,
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			f, err := New(tc.spec)
+			if err != nil {
+				t.Fatal("New() =", err)
+			}
+			if got := f.Filter(context.Background(), event); got != tc.want {
+				t.Errorf("Filter() = %s, want %s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestNewInvalidExpression(t *testing.T) {
+	if _, err := New(&v1beta1.Filter{CEL: `data.confidence >`}); err == nil {
+		t.Error("New() = nil, want an error")
+	}
+}
@@ -0,0 +1,225 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mqtt
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/eclipse/paho.golang/packets"
+)
+
+// ackConn is the connection of paho to the broker. paho acknowledges the
+// messages as soon as it reads them, so ackConn takes the PUBLISH and
+// PUBREL packets out of the stream it reads and acknowledges them when the
+// handler says so. The packets are written whole, so that the
+// acknowledgements do not interleave with the packets written by paho.
+type ackConn struct {
+	net.Conn
+	handle func(p *packets.Publish, ack func())
+	pr     *io.PipeReader
+	pw     *io.PipeWriter
+	// handlers holds a slot per message being handled.
+	handlers chan struct{}
+
+	wmu sync.Mutex
+	// partial is the beginning of the packet being written by paho, and
+	// acks the acknowledgements waiting for it to be written.
+	partial []byte
+	acks    [][]byte
+}
+
+func newAckConn(conn net.Conn, handle func(p *packets.Publish, ack func())) *ackConn {
+	pr, pw := io.Pipe()
+	c := &ackConn{Conn: conn, handle: handle, pr: pr, pw: pw, handlers: make(chan struct{}, MaxHandlers)}
+	go c.readLoop()
+	return c
+}
+
+// Read reads the packets left for paho.
+func (c *ackConn) Read(b []byte) (int, error) {
+	return c.pr.Read(b)
+}
+
+func (c *ackConn) Close() error {
+	err := c.Conn.Close()
+	c.pr.Close()
+	return err
+}
+
+// Write buffers the packets of paho until they are complete.
+func (c *ackConn) Write(b []byte) (int, error) {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	c.partial = append(c.partial, b...)
+	for {
+		n, ok := packetLen(c.partial)
+		if !ok {
+			break
+		}
+		if _, err := c.Conn.Write(c.partial[:n]); err != nil {
+			c.partial = nil
+			return 0, err
+		}
+		c.partial = c.partial[n:]
+	}
+	if len(c.partial) > 0 {
+		return len(b), nil
+	}
+	c.partial = nil
+	for _, a := range c.acks {
+		if _, err := c.Conn.Write(a); err != nil {
+			c.acks = nil
+			return 0, err
+		}
+	}
+	c.acks = nil
+	return len(b), nil
+}
+
+// writePacket writes p, once paho is done writing its current packet.
+func (c *ackConn) writePacket(p io.WriterTo) error {
+	var b bytes.Buffer
+	if _, err := p.WriteTo(&b); err != nil {
+		return err
+	}
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if len(c.partial) > 0 {
+		c.acks = append(c.acks, b.Bytes())
+		return nil
+	}
+	_, err := c.Conn.Write(b.Bytes())
+	return err
+}
+
+// readLoop passes the messages to the handler and the other packets to
+// paho, until the connection is closed. It waits for a handler to return
+// once MaxHandlers messages are being handled.
+func (c *ackConn) readLoop() {
+	r := bufio.NewReader(c.Conn)
+	for {
+		raw, err := readPacket(r)
+		if err != nil {
+			c.pw.CloseWithError(err)
+			return
+		}
+		switch packets.PacketType(raw[0] >> 4) {
+		case packets.PUBLISH:
+			cp, err := packets.ReadPacket(bytes.NewReader(raw))
+			if err != nil {
+				c.pw.CloseWithError(err)
+				return
+			}
+			p := cp.Content.(*packets.Publish)
+			// packets.ReadPacket leaves the RETAIN flag of the fixed
+			// header out.
+			p.Retain = raw[0]&1 == 1
+			c.handlers <- struct{}{}
+			go func() {
+				defer func() { <-c.handlers }()
+				c.handle(p, c.acker(p))
+			}()
+		case packets.PUBREL:
+			cp, err := packets.ReadPacket(bytes.NewReader(raw))
+			if err != nil {
+				c.pw.CloseWithError(err)
+				return
+			}
+			c.writePacket(&packets.Pubcomp{PacketID: cp.Content.(*packets.Pubrel).PacketID, Properties: &packets.Properties{}})
+		default:
+			if _, err := c.pw.Write(raw); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// acker returns the function acknowledging p, once.
+func (c *ackConn) acker(p *packets.Publish) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			switch p.QoS {
+			case 1:
+				c.writePacket(&packets.Puback{PacketID: p.PacketID, Properties: &packets.Properties{}})
+			case 2:
+				c.writePacket(&packets.Pubrec{PacketID: p.PacketID, Properties: &packets.Properties{}})
+			}
+		})
+	}
+}
+
+// MaxHandlers bounds the messages of a session handled at once. The broker
+// holds back the QoS 1 and 2 messages past the Receive Maximum of the
+// session, but not the QoS 0 messages.
+const MaxHandlers = 256
+
+// errMalformedLength is returned for a remaining length of more than four
+// bytes.
+var errMalformedLength = errors.New("malformed remaining length")
+
+// readPacket reads the next packet of r whole: its fixed header, with the
+// variable length encoding of its remaining length, and the rest.
+func readPacket(r *bufio.Reader) ([]byte, error) {
+	first, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	raw := []byte{first}
+	length, mul := 0, 1
+	for i := 0; ; i++ {
+		if i == 4 {
+			return nil, errMalformedLength
+		}
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		raw = append(raw, b)
+		length += int(b&0x7f) * mul
+		if b&0x80 == 0 {
+			break
+		}
+		mul *= 128
+	}
+	n := len(raw)
+	raw = append(raw, make([]byte, length)...)
+	if _, err := io.ReadFull(r, raw[n:]); err != nil {
+		return nil, err
+	}
+	return raw, nil
+}
+
+// packetLen returns the length of the packet at the beginning of b, and
+// whether b holds all of it.
+func packetLen(b []byte) (int, bool) {
+	length, mul := 0, 1
+	for i := 1; i < len(b) && i <= 4; i++ {
+		length += int(b[i]&0x7f) * mul
+		if b[i]&0x80 == 0 {
+			n := i + 1 + length
+			return n, len(b) >= n
+		}
+		mul *= 128
+	}
+	return 0, false
+}
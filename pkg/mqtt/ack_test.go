@@ -0,0 +1,135 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mqtt_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/eclipse/paho.golang/paho"
+
+	"github.com/ShixiongQi/brokerchannel/pkg/mqtt"
+	"github.com/ShixiongQi/brokerchannel/pkg/mqtttest"
+)
+
+func TestConnectWithAcks(t *testing.T) {
+	b := mqtttest.NewBroker(t)
+	cfg := &mqtt.Config{Address: b.Addr(), KeepAlive: 30, ClientID: "sensors", SessionExpiry: 60}
+	acks := make(chan func(), 10)
+	connect := func() *mqtt.Conn {
+		conn, err := mqtt.ConnectWithAcks(context.Background(), cfg, func(m *paho.Publish, ack func()) {
+			acks <- ack
+		})
+		if err != nil {
+			t.Fatal("ConnectWithAcks() =", err)
+		}
+		return conn
+	}
+
+	conn := connect()
+	if _, err := conn.Subscribe(context.Background(), &paho.Subscribe{
+		Subscriptions: map[string]paho.SubscribeOptions{"motion/#": {QoS: 1}},
+	}); err != nil {
+		t.Fatal("Subscribe() =", err)
+	}
+	b.Publish("motion/hall", 1, []byte("1"), nil)
+	b.Publish("motion/hall", 1, []byte("2"), nil)
+	ack := <-acks
+	<-acks
+	b.WaitForUnacked(t, 2)
+	ack()
+	ack()
+	b.WaitForUnacked(t, 1)
+
+	// The broker sends the message left unacknowledged again when the
+	// session is resumed.
+	conn.Close()
+	b.WaitForStored(t, "sensors")
+	conn = connect()
+	defer conn.End()
+	(<-acks)()
+	b.WaitForUnacked(t, 0)
+}
+
+func TestConnectWithAcksRetained(t *testing.T) {
+	b := mqtttest.NewBroker(t)
+	b.PublishRetained("status/hall", 1, []byte("on"), nil)
+	cfg := &mqtt.Config{Address: b.Addr(), KeepAlive: 30, ClientID: "sensors"}
+	retained := make(chan bool, 10)
+	conn, err := mqtt.ConnectWithAcks(context.Background(), cfg, func(m *paho.Publish, ack func()) {
+		retained <- m.Retain
+		ack()
+	})
+	if err != nil {
+		t.Fatal("ConnectWithAcks() =", err)
+	}
+	defer conn.End()
+	if _, err := conn.Subscribe(context.Background(), &paho.Subscribe{
+		Subscriptions: map[string]paho.SubscribeOptions{"status/#": {QoS: 1}},
+	}); err != nil {
+		t.Fatal("Subscribe() =", err)
+	}
+	if !<-retained {
+		t.Error("The retained message sent on subscription is not flagged")
+	}
+	b.Publish("status/hall", 1, []byte("off"), nil)
+	if <-retained {
+		t.Error("A live message is flagged as retained")
+	}
+}
+
+func TestConnectWithAcksBoundsHandlers(t *testing.T) {
+	b := mqtttest.NewBroker(t)
+	cfg := &mqtt.Config{Address: b.Addr(), KeepAlive: 30, ClientID: "sensors"}
+	started := make(chan struct{}, 2*mqtt.MaxHandlers)
+	release := make(chan struct{})
+	conn, err := mqtt.ConnectWithAcks(context.Background(), cfg, func(m *paho.Publish, ack func()) {
+		started <- struct{}{}
+		<-release
+	})
+	if err != nil {
+		t.Fatal("ConnectWithAcks() =", err)
+	}
+	defer conn.End()
+	if _, err := conn.Subscribe(context.Background(), &paho.Subscribe{
+		Subscriptions: map[string]paho.SubscribeOptions{"motion/#": {QoS: 0}},
+	}); err != nil {
+		t.Fatal("Subscribe() =", err)
+	}
+	for i := 0; i < mqtt.MaxHandlers+10; i++ {
+		b.Publish("motion/hall", 0, []byte("1"), nil)
+	}
+	for i := 0; i < mqtt.MaxHandlers; i++ {
+		<-started
+	}
+	select {
+	case <-started:
+		t.Fatalf("More than %d messages are handled at once", mqtt.MaxHandlers)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	// The other messages are handled once the handlers return.
+	close(release)
+	for i := 0; i < 10; i++ {
+		select {
+		case <-started:
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timed out waiting for the messages held back")
+		}
+	}
+}
@@ -0,0 +1,227 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mqtt
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/eclipse/paho.golang/packets"
+	"github.com/eclipse/paho.golang/paho"
+)
+
+// Config holds everything needed to connect to a broker. It only holds
+// comparable data so that a change of the settings can be detected with ==.
+type Config struct {
+	// Address is the host:port of the broker.
+	Address string
+	// TLS enables TLS, verified against CACert, or the system roots when
+	// CACert is empty. ServerName defaults to the host of Address.
+	TLS        bool
+	ServerName string
+	CACert     string
+	// ClientCert and ClientKey are the PEM certificate and key presented to
+	// the broker.
+	ClientCert string
+	ClientKey  string
+	Username   string
+	Password   string
+	// KeepAlive is the keep alive interval in seconds.
+	KeepAlive uint16
+	// ClientID identifies the session, the broker assigns one when empty.
+	ClientID string
+	// SessionExpiry is the time in seconds the broker keeps the session
+	// once disconnected. The session is resumed by the next connection with
+	// the same ClientID when it is not zero, and starts clean otherwise.
+	SessionExpiry uint32
+	// ReceiveMaximum is the number of QoS 1 and 2 messages the broker sends
+	// before waiting for their acknowledgement, 65535 when zero.
+	ReceiveMaximum uint16
+}
+
+// TLSConfig builds the TLS configuration of the connection.
+func (c *Config) TLSConfig() (*tls.Config, error) {
+	tc := &tls.Config{ServerName: c.ServerName}
+	if c.CACert != "" {
+		tc.RootCAs = x509.NewCertPool()
+		if !tc.RootCAs.AppendCertsFromPEM([]byte(c.CACert)) {
+			return nil, errors.New("no certificate found in the CA bundle")
+		}
+	}
+	if c.ClientCert != "" {
+		cert, err := tls.X509KeyPair([]byte(c.ClientCert), []byte(c.ClientKey))
+		if err != nil {
+			return nil, err
+		}
+		tc.Certificates = []tls.Certificate{cert}
+	}
+	return tc, nil
+}
+
+// Dial opens the network connection to the broker.
+func Dial(ctx context.Context, c *Config) (net.Conn, error) {
+	if !c.TLS {
+		var d net.Dialer
+		return d.DialContext(ctx, "tcp", c.Address)
+	}
+	tc, err := c.TLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	d := tls.Dialer{Config: tc}
+	return d.DialContext(ctx, "tcp", c.Address)
+}
+
+// Conn is an MQTT session with a broker.
+type Conn struct {
+	*paho.Client
+	nc *notifyConn
+}
+
+// Connect dials the broker and opens an MQTT session, which is clean
+// unless the Config has a SessionExpiry. The messages received on the
+// session are acknowledged on receipt and passed to router.
+func Connect(ctx context.Context, c *Config, router paho.Router) (*Conn, error) {
+	return connect(ctx, c, func(p *packets.Publish, ack func()) {
+		ack()
+		router.Route(p)
+	})
+}
+
+// AckHandler handles a message received on a session. ack acknowledges a
+// QoS 1 or 2 message to the broker, which sends it again when a session
+// left it unacknowledged is resumed. It does nothing for QoS 0 messages.
+type AckHandler func(m *paho.Publish, ack func())
+
+// ConnectWithAcks is Connect, but the messages received on the session are
+// passed to h, which acknowledges them. Up to MaxHandlers messages are passed
+// at once, each from its own goroutine, so they may be handled out of order;
+// reading the session then waits for one of them to be handled.
+func ConnectWithAcks(ctx context.Context, c *Config, h AckHandler) (*Conn, error) {
+	return connect(ctx, c, func(p *packets.Publish, ack func()) {
+		h(paho.PublishFromPacketPublish(p), ack)
+	})
+}
+
+func connect(ctx context.Context, c *Config, handle func(p *packets.Publish, ack func())) (*Conn, error) {
+	nc, err := Dial(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	conn := &Conn{
+		Client: paho.NewClient(),
+		nc:     &notifyConn{Conn: nc, closed: make(chan struct{})},
+	}
+	conn.Client.Conn = newAckConn(conn.nc, handle)
+
+	cp := &paho.Connect{ClientID: c.ClientID, CleanStart: c.SessionExpiry == 0, KeepAlive: c.KeepAlive}
+	cp.Properties = &paho.ConnectProperties{}
+	if c.SessionExpiry > 0 {
+		expiry := c.SessionExpiry
+		cp.Properties.SessionExpiryInterval = &expiry
+	}
+	if c.ReceiveMaximum > 0 {
+		max := c.ReceiveMaximum
+		cp.Properties.ReceiveMaximum = &max
+	}
+	if c.Username != "" {
+		cp.UsernameFlag, cp.Username = true, c.Username
+	}
+	if c.Password != "" {
+		cp.PasswordFlag, cp.Password = true, []byte(c.Password)
+	}
+	ca, err := conn.Client.Connect(ctx, cp)
+	if err != nil {
+		conn.Client.Conn.Close()
+		return nil, err
+	}
+	if ca.ReasonCode != 0 {
+		conn.Client.Conn.Close()
+		return nil, &RefusedError{Address: c.Address, ReasonCode: ca.ReasonCode, Reason: ca.Properties.ReasonString}
+	}
+	return conn, nil
+}
+
+// RefusedError is returned by Connect when the broker refuses the session.
+type RefusedError struct {
+	Address    string
+	ReasonCode byte
+	Reason     string
+}
+
+func (e *RefusedError) Error() string {
+	return fmt.Sprintf("connection refused by %s: %d - %s", e.Address, e.ReasonCode, e.Reason)
+}
+
+// Reason codes of a CONNACK refusing the credentials of the client.
+const (
+	badUserNameOrPassword = 0x86
+	notAuthorized         = 0x87
+	badAuthMethod         = 0x8C
+)
+
+// IsAuthError tells whether err is the refusal of the credentials of the
+// client by the broker.
+func IsAuthError(err error) bool {
+	var re *RefusedError
+	if !errors.As(err, &re) {
+		return false
+	}
+	switch re.ReasonCode {
+	case badUserNameOrPassword, notAuthorized, badAuthMethod:
+		return true
+	}
+	return false
+}
+
+// Done is closed once the connection to the broker is closed or lost.
+func (c *Conn) Done() <-chan struct{} {
+	return c.nc.closed
+}
+
+// Close disconnects from the broker, which keeps the session until it
+// expires.
+func (c *Conn) Close() error {
+	return c.Client.Disconnect(&paho.Disconnect{ReasonCode: 0})
+}
+
+// End disconnects from the broker and discards the session.
+func (c *Conn) End() error {
+	var expiry uint32
+	return c.Client.Disconnect(&paho.Disconnect{
+		ReasonCode: 0,
+		Properties: &paho.DisconnectProperties{SessionExpiryInterval: &expiry},
+	})
+}
+
+// notifyConn closes its closed channel once the connection is closed, which
+// paho does when the connection to the broker is lost.
+type notifyConn struct {
+	net.Conn
+	once   sync.Once
+	closed chan struct{}
+}
+
+func (c *notifyConn) Close() error {
+	c.once.Do(func() { close(c.closed) })
+	return c.Conn.Close()
+}
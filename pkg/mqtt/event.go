@@ -0,0 +1,116 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mqtt
+
+import (
+	"errors"
+	"fmt"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/cloudevents/sdk-go/v2/types"
+	"github.com/eclipse/paho.golang/paho"
+)
+
+// Names of the user properties holding the context attributes of an event,
+// as in the binary content mode of the CloudEvents MQTT binding.
+const (
+	specVersionProperty = "specversion"
+	idProperty          = "id"
+	sourceProperty      = "source"
+	typeProperty        = "type"
+	subjectProperty     = "subject"
+	timeProperty        = "time"
+	dataSchemaProperty  = "dataschema"
+)
+
+// EncodeEvent returns the MQTT 5 message carrying e in binary content mode:
+// the context attributes are user properties, the data is the payload.
+func EncodeEvent(topic string, e *cloudevents.Event) (*paho.Publish, error) {
+	user := map[string]string{
+		specVersionProperty: e.SpecVersion(),
+		idProperty:          e.ID(),
+		sourceProperty:      e.Source(),
+		typeProperty:        e.Type(),
+	}
+	if s := e.Subject(); s != "" {
+		user[subjectProperty] = s
+	}
+	if t := e.Time(); !t.IsZero() {
+		user[timeProperty] = types.FormatTime(t)
+	}
+	if s := e.DataSchema(); s != "" {
+		user[dataSchemaProperty] = s
+	}
+	for name, v := range e.Extensions() {
+		s, err := types.Format(v)
+		if err != nil {
+			return nil, fmt.Errorf("extension %q: %w", name, err)
+		}
+		user[name] = s
+	}
+	return &paho.Publish{
+		Topic:   topic,
+		Payload: e.Data(),
+		Properties: &paho.PublishProperties{
+			ContentType: e.DataContentType(),
+			User:        user,
+		},
+	}, nil
+}
+
+// DecodeEvent returns the event carried by a message built by EncodeEvent.
+func DecodeEvent(m *paho.Publish) (*cloudevents.Event, error) {
+	if m.Properties == nil || m.Properties.User[specVersionProperty] == "" {
+		return nil, errors.New("message is not a binary mode CloudEvent")
+	}
+	user := m.Properties.User
+	e := cloudevents.NewEvent(user[specVersionProperty])
+	for name, v := range user {
+		switch name {
+		case specVersionProperty:
+		case idProperty:
+			e.SetID(v)
+		case sourceProperty:
+			e.SetSource(v)
+		case typeProperty:
+			e.SetType(v)
+		case subjectProperty:
+			e.SetSubject(v)
+		case timeProperty:
+			t, err := types.ParseTime(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid time %q: %w", v, err)
+			}
+			e.SetTime(t)
+		case dataSchemaProperty:
+			e.SetDataSchema(v)
+		default:
+			if err := e.Context.SetExtension(name, v); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if len(m.Payload) > 0 || m.Properties.ContentType != "" {
+		if err := e.SetData(m.Properties.ContentType, m.Payload); err != nil {
+			return nil, err
+		}
+	}
+	if err := e.Validate(); err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
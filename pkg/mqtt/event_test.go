@@ -0,0 +1,61 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mqtt
+
+import (
+	"testing"
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/eclipse/paho.golang/paho"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestEventRoundTrip(t *testing.T) {
+	want := cloudevents.NewEvent()
+	want.SetID("1234")
+	want.SetSource("/sensors")
+	want.SetType("dev.knative.sample")
+	want.SetSubject("motion")
+	want.SetTime(time.Date(2021, 4, 20, 8, 0, 0, 0, time.UTC))
+	want.SetExtension("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	if err := want.SetData(cloudevents.ApplicationJSON, []byte(`{"sequence":1}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := EncodeEvent("knative/channels/default/ch", &want)
+	if err != nil {
+		t.Fatal("EncodeEvent() =", err)
+	}
+	if m.Topic != "knative/channels/default/ch" {
+		t.Errorf("Topic = %q, want knative/channels/default/ch", m.Topic)
+	}
+	got, err := DecodeEvent(m)
+	if err != nil {
+		t.Fatal("DecodeEvent() =", err)
+	}
+	if !cmp.Equal(want.String(), got.String()) {
+		t.Error("Round trip (-want, +got):", cmp.Diff(want.String(), got.String()))
+	}
+}
+
+func TestDecodeEventRejectsPlainMessages(t *testing.T) {
+	m := &paho.Publish{Topic: "motion", Payload: []byte("on"), Properties: &paho.PublishProperties{}}
+	if e, err := DecodeEvent(m); err == nil {
+		t.Errorf("DecodeEvent() = %v, wanted an error", e)
+	}
+}
@@ -0,0 +1,121 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package resolver builds the connection settings of the brokers described
+// by the API.
+package resolver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"knative.dev/pkg/tracker"
+
+	"github.com/ShixiongQi/brokerchannel/pkg/apis/samples/v1beta1"
+	listers "github.com/ShixiongQi/brokerchannel/pkg/client/listers/samples/v1beta1"
+	"github.com/ShixiongQi/brokerchannel/pkg/mqtt"
+)
+
+// Resolver reads MQTTBrokers and their secrets.
+type Resolver struct {
+	Brokers listers.MQTTBrokerLister
+	Secrets corelisters.SecretLister
+	// Tracker, when set, tracks the secrets read for an object, so that it
+	// is resynced, and reconnected, when one of them changes.
+	Tracker tracker.Interface
+}
+
+// Resolve returns the connection settings of an inline broker, or of the
+// MQTTBroker named by ref in namespace, for the connection of obj.
+func (r *Resolver) Resolve(ctx context.Context, obj interface{}, namespace string, broker *v1beta1.BrokerSpec, ref *corev1.LocalObjectReference) (*mqtt.Config, error) {
+	if broker != nil {
+		return &mqtt.Config{
+			Address:   broker.Address(),
+			TLS:       broker.TLS,
+			KeepAlive: v1beta1.DefaultKeepAlive,
+		}, nil
+	}
+	if ref == nil {
+		return nil, errors.New("neither broker nor brokerRef is set")
+	}
+
+	mb, err := r.Brokers.MQTTBrokers(namespace).Get(ref.Name)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &mqtt.Config{
+		Address:   mb.Spec.Endpoint().Address(),
+		TLS:       mb.Spec.TLS != nil,
+		KeepAlive: uint16(mb.Spec.KeepAlive),
+	}
+	if cfg.KeepAlive == 0 {
+		cfg.KeepAlive = v1beta1.DefaultKeepAlive
+	}
+
+	secret := func(sel *corev1.SecretKeySelector) (string, error) {
+		if sel == nil {
+			return "", nil
+		}
+		if r.Tracker != nil {
+			if err := r.Tracker.TrackReference(SecretReference(mb.Namespace, sel.Name), obj); err != nil {
+				return "", err
+			}
+		}
+		s, err := r.Secrets.Secrets(mb.Namespace).Get(sel.Name)
+		if err != nil {
+			return "", err
+		}
+		v, ok := s.Data[sel.Key]
+		if !ok {
+			return "", fmt.Errorf("secret %q has no key %q", sel.Name, sel.Key)
+		}
+		return string(v), nil
+	}
+	if t := mb.Spec.TLS; t != nil {
+		cfg.ServerName = t.ServerName
+		if cfg.CACert, err = secret(t.CACert); err != nil {
+			return nil, err
+		}
+		if cfg.ClientCert, err = secret(t.ClientCert); err != nil {
+			return nil, err
+		}
+		if cfg.ClientKey, err = secret(t.ClientKey); err != nil {
+			return nil, err
+		}
+	}
+	if c := mb.Spec.Credentials; c != nil {
+		if cfg.Username, err = secret(c.Username); err != nil {
+			return nil, err
+		}
+		if cfg.Password, err = secret(c.Password); err != nil {
+			return nil, err
+		}
+	}
+	return cfg, nil
+}
+
+// SecretReference is the tracker reference of the secret name in namespace.
+func SecretReference(namespace, name string) tracker.Reference {
+	return tracker.Reference{
+		APIVersion: "v1",
+		Kind:       "Secret",
+		Namespace:  namespace,
+		Name:       name,
+	}
+}
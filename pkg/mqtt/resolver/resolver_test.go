@@ -0,0 +1,109 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resolver
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"knative.dev/pkg/controller"
+	"knative.dev/pkg/tracker"
+
+	"github.com/ShixiongQi/brokerchannel/pkg/apis/samples/v1beta1"
+	listers "github.com/ShixiongQi/brokerchannel/pkg/client/listers/samples/v1beta1"
+)
+
+func newIndexer(objs ...interface{}) cache.Indexer {
+	i := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	for _, o := range objs {
+		i.Add(o)
+	}
+	return i
+}
+
+func secretKey(name, key string) *corev1.SecretKeySelector {
+	return &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: name}, Key: key}
+}
+
+func TestResolveTracksSecrets(t *testing.T) {
+	mb := &v1beta1.MQTTBroker{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "broker"},
+		Spec: v1beta1.MQTTBrokerSpec{
+			Host:        "mqtt.example.com",
+			TLS:         &v1beta1.BrokerTLS{CACert: secretKey("broker-tls", "ca.crt")},
+			Credentials: &v1beta1.BrokerCredentials{Username: secretKey("broker-auth", "username"), Password: secretKey("broker-auth", "password")},
+		},
+	}
+	tls := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "broker-tls"},
+		Data:       map[string][]byte{"ca.crt": []byte("CA")},
+	}
+	auth := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "broker-auth"},
+		Data:       map[string][]byte{"username": []byte("user"), "password": []byte("s3cr3t")},
+	}
+	var synced []types.NamespacedName
+	r := &Resolver{
+		Brokers: listers.NewMQTTBrokerLister(newIndexer(mb)),
+		Secrets: corelisters.NewSecretLister(newIndexer(tls, auth)),
+		Tracker: tracker.New(func(key types.NamespacedName) {
+			synced = append(synced, key)
+		}, time.Hour),
+	}
+	bc := &v1beta1.BrokerChannel{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "bc"}}
+
+	cfg, err := r.Resolve(context.Background(), bc, "default", nil, &corev1.LocalObjectReference{Name: "broker"})
+	if err != nil {
+		t.Fatal("Resolve() =", err)
+	}
+	if cfg.CACert != "CA" || cfg.Username != "user" || cfg.Password != "s3cr3t" {
+		t.Errorf("Resolve() = %+v, want the values of the secrets", cfg)
+	}
+
+	// The tracker syncs the new observers once to catch up.
+	synced = nil
+	controller.EnsureTypeMeta(r.Tracker.OnChanged, corev1.SchemeGroupVersion.WithKind("Secret"))(auth)
+	want := types.NamespacedName{Namespace: "default", Name: "bc"}
+	if len(synced) != 1 || synced[0] != want {
+		t.Errorf("synced = %v, want [%v]", synced, want)
+	}
+}
+
+func TestResolveMissingKey(t *testing.T) {
+	mb := &v1beta1.MQTTBroker{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "broker"},
+		Spec: v1beta1.MQTTBrokerSpec{
+			Host:        "mqtt.example.com",
+			Credentials: &v1beta1.BrokerCredentials{Username: secretKey("broker-auth", "username")},
+		},
+	}
+	r := &Resolver{
+		Brokers: listers.NewMQTTBrokerLister(newIndexer(mb)),
+		Secrets: corelisters.NewSecretLister(newIndexer(&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "broker-auth"},
+		})),
+	}
+	if _, err := r.Resolve(context.Background(), nil, "default", nil, &corev1.LocalObjectReference{Name: "broker"}); err == nil {
+		t.Error("Resolve() = nil, want an error for the missing key")
+	}
+}
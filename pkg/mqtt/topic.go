@@ -0,0 +1,112 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package mqtt holds the MQTT helpers shared by the API and the data plane.
+package mqtt
+
+import (
+	"errors"
+	"strings"
+)
+
+// maxTopicLength is the longest UTF-8 string an MQTT packet can carry.
+const maxTopicLength = 65535
+
+// sharePrefix starts the filters of MQTT 5 shared subscriptions.
+const sharePrefix = "$share/"
+
+// SharedFilter returns the filter subscribing to filter as a member of the
+// share group.
+func SharedFilter(group, filter string) string {
+	return sharePrefix + group + "/" + filter
+}
+
+// ParseSharedFilter returns the share group and the topic filter of a shared
+// subscription filter, and false when s is not one.
+func ParseSharedFilter(s string) (group, filter string, ok bool) {
+	if !strings.HasPrefix(s, sharePrefix) {
+		return "", "", false
+	}
+	parts := strings.SplitN(strings.TrimPrefix(s, sharePrefix), "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
+
+// ValidateTopicFilter checks filter against the MQTT 5 topic filter grammar:
+// "#" may only appear as the last level, "+" must occupy a whole level and
+// NUL characters are not allowed.
+func ValidateTopicFilter(filter string) error {
+	if err := validateTopic(filter); err != nil {
+		return err
+	}
+	levels := strings.Split(filter, "/")
+	for i, level := range levels {
+		if strings.Contains(level, "#") && (level != "#" || i != len(levels)-1) {
+			return errors.New(`"#" must occupy the last level of the filter`)
+		}
+		if strings.Contains(level, "+") && level != "+" {
+			return errors.New(`"+" must occupy an entire level of the filter`)
+		}
+	}
+	return nil
+}
+
+// ValidateTopicName checks that name can be used to publish a message, that
+// is a topic without wildcards.
+func ValidateTopicName(name string) error {
+	if err := validateTopic(name); err != nil {
+		return err
+	}
+	if strings.ContainsAny(name, "#+") {
+		return errors.New("wildcards are not allowed in topic names")
+	}
+	return nil
+}
+
+func validateTopic(topic string) error {
+	switch {
+	case topic == "":
+		return errors.New("topic must not be empty")
+	case len(topic) > maxTopicLength:
+		return errors.New("topic is longer than 65535 bytes")
+	case strings.ContainsRune(topic, 0):
+		return errors.New("topic must not contain NUL characters")
+	}
+	return nil
+}
+
+// MatchTopic reports whether topic matches filter.
+func MatchTopic(filter, topic string) bool {
+	// Topics starting with "$" are reserved for the broker and are not
+	// matched by filters starting with a wildcard.
+	if strings.HasPrefix(topic, "$") && (strings.HasPrefix(filter, "#") || strings.HasPrefix(filter, "+")) {
+		return false
+	}
+	f, t := strings.Split(filter, "/"), strings.Split(topic, "/")
+	for i, level := range f {
+		switch {
+		case level == "#":
+			return true
+		case i >= len(t):
+			return false
+		case level != "+" && level != t[i]:
+			return false
+		}
+	}
+	return len(f) == len(t)
+}
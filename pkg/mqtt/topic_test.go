@@ -0,0 +1,97 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mqtt
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateTopicFilter(t *testing.T) {
+	tests := []struct {
+		filter string
+		valid  bool
+	}{
+		{"motion", true},
+		{"sensors/+/temperature", true},
+		{"sensors/#", true},
+		{"#", true},
+		{"+", true},
+		{"+/+", true},
+		{"/leading/slash", true},
+		{"", false},
+		{"sensors/#/temperature", false},
+		{"sensors#", false},
+		{"sensors/+temp", false},
+		{"sensors/te+mp", false},
+		{"bad\x00topic", false},
+		{strings.Repeat("a", 65536), false},
+	}
+	for _, tc := range tests {
+		if err := ValidateTopicFilter(tc.filter); (err == nil) != tc.valid {
+			t.Errorf("ValidateTopicFilter(%q) = %v, want valid %v", tc.filter, err, tc.valid)
+		}
+	}
+}
+
+func TestValidateTopicName(t *testing.T) {
+	if err := ValidateTopicName("sensors/motion"); err != nil {
+		t.Errorf("ValidateTopicName() = %v", err)
+	}
+	if err := ValidateTopicName("sensors/+"); err == nil {
+		t.Error("ValidateTopicName() accepted a wildcard")
+	}
+}
+
+func TestMatchTopic(t *testing.T) {
+	tests := []struct {
+		filter, topic string
+		want          bool
+	}{
+		{"motion", "motion", true},
+		{"motion", "motion/1", false},
+		{"sensors/+", "sensors/motion", true},
+		{"sensors/+", "sensors/motion/1", false},
+		{"sensors/+/temp", "sensors/kitchen/temp", true},
+		{"sensors/#", "sensors", true},
+		{"sensors/#", "sensors/a/b/c", true},
+		{"#", "a/b", true},
+		{"#", "$SYS/uptime", false},
+		{"+/uptime", "$SYS/uptime", false},
+		{"$SYS/#", "$SYS/uptime", true},
+	}
+	for _, tc := range tests {
+		if got := MatchTopic(tc.filter, tc.topic); got != tc.want {
+			t.Errorf("MatchTopic(%q, %q) = %v, want %v", tc.filter, tc.topic, got, tc.want)
+		}
+	}
+}
+
+func TestSharedFilter(t *testing.T) {
+	s := SharedFilter("5cbf7a8e", "sensors/+/motion")
+	if want := "$share/5cbf7a8e/sensors/+/motion"; s != want {
+		t.Errorf("SharedFilter() = %q, want %q", s, want)
+	}
+	if group, filter, ok := ParseSharedFilter(s); !ok || group != "5cbf7a8e" || filter != "sensors/+/motion" {
+		t.Errorf("ParseSharedFilter(%q) = %q, %q, %v", s, group, filter, ok)
+	}
+	for _, s := range []string{"sensors/#", "$share/", "$share/group", "$share//sensors", "$share/group/"} {
+		if _, _, ok := ParseSharedFilter(s); ok {
+			t.Errorf("ParseSharedFilter(%q) = true, want false", s)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/eclipse/paho.golang/paho"
+	"go.opencensus.io/plugin/ochttp/propagation/tracecontext"
+	"go.opencensus.io/trace"
+)
+
+// Names of the user properties holding the W3C trace context of a message.
+// They match the attributes of the CloudEvents distributed tracing
+// extension, so binary mode events carry it in the same place.
+const (
+	traceParentProperty = "traceparent"
+	traceStateProperty  = "tracestate"
+)
+
+var traceFormat = &tracecontext.HTTPFormat{}
+
+// SpanContext returns the trace context carried by m, either in its user
+// properties or in the distributed tracing extension of a structured mode
+// event payload.
+func SpanContext(m *paho.Publish) (trace.SpanContext, bool) {
+	if m.Properties == nil {
+		return trace.SpanContext{}, false
+	}
+	if tp := m.Properties.User[traceParentProperty]; tp != "" {
+		return traceFormat.SpanContextFromHeaders(tp, m.Properties.User[traceStateProperty])
+	}
+	if m.Properties.ContentType != cloudevents.ApplicationCloudEventsJSON {
+		return trace.SpanContext{}, false
+	}
+	var ext struct {
+		TraceParent string `json:"traceparent"`
+		TraceState  string `json:"tracestate"`
+	}
+	if err := json.Unmarshal(m.Payload, &ext); err != nil || ext.TraceParent == "" {
+		return trace.SpanContext{}, false
+	}
+	return traceFormat.SpanContextFromHeaders(ext.TraceParent, ext.TraceState)
+}
+
+// InjectSpanContext writes the trace context of the span in ctx, if any, to
+// the user properties of m.
+func InjectSpanContext(ctx context.Context, m *paho.Publish) {
+	span := trace.FromContext(ctx)
+	if span == nil {
+		return
+	}
+	tp, ts := traceFormat.SpanContextToHeaders(span.SpanContext())
+	if m.Properties == nil {
+		m.Properties = &paho.PublishProperties{}
+	}
+	if m.Properties.User == nil {
+		m.Properties.User = make(map[string]string, 2)
+	}
+	m.Properties.User[traceParentProperty] = tp
+	if ts != "" {
+		m.Properties.User[traceStateProperty] = ts
+	} else {
+		delete(m.Properties.User, traceStateProperty)
+	}
+}
+
+// StartSpan starts a span for the receipt of m, continuing the trace it
+// carries if any. The caller must end the returned span.
+func StartSpan(ctx context.Context, name string, m *paho.Publish) (context.Context, *trace.Span) {
+	var span *trace.Span
+	if parent, ok := SpanContext(m); ok {
+		ctx, span = trace.StartSpanWithRemoteParent(ctx, name, parent, trace.WithSpanKind(trace.SpanKindServer))
+	} else {
+		ctx, span = trace.StartSpan(ctx, name, trace.WithSpanKind(trace.SpanKindServer))
+	}
+	span.AddAttributes(
+		trace.StringAttribute("messaging.system", "mqtt"),
+		trace.StringAttribute("messaging.destination", m.Topic),
+	)
+	return ctx, span
+}
@@ -0,0 +1,89 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mqtt
+
+import (
+	"context"
+	"testing"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/eclipse/paho.golang/paho"
+	"go.opencensus.io/trace"
+)
+
+const traceParent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func TestSpanContext(t *testing.T) {
+	tests := []struct {
+		name   string
+		m      *paho.Publish
+		wantOK bool
+	}{{
+		name: "no properties",
+		m:    &paho.Publish{Topic: "motion"},
+	}, {
+		name: "user property",
+		m: &paho.Publish{Topic: "motion", Properties: &paho.PublishProperties{
+			User: map[string]string{traceParentProperty: traceParent},
+		}},
+		wantOK: true,
+	}, {
+		name: "structured event",
+		m: &paho.Publish{Topic: "motion", Payload: []byte(`{"specversion":"1.0","traceparent":"` + traceParent + `"}`),
+			Properties: &paho.PublishProperties{ContentType: cloudevents.ApplicationCloudEventsJSON},
+		},
+		wantOK: true,
+	}, {
+		name: "plain json",
+		m: &paho.Publish{Topic: "motion", Payload: []byte(`{"traceparent":"` + traceParent + `"}`),
+			Properties: &paho.PublishProperties{ContentType: cloudevents.ApplicationJSON},
+		},
+	}, {
+		name: "malformed",
+		m: &paho.Publish{Topic: "motion", Properties: &paho.PublishProperties{
+			User: map[string]string{traceParentProperty: "00-zz"},
+		}},
+	}}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sc, ok := SpanContext(test.m)
+			if ok != test.wantOK {
+				t.Fatalf("SpanContext() ok = %v, want %v", ok, test.wantOK)
+			}
+			if ok && sc.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+				t.Errorf("TraceID = %s, want 4bf92f3577b34da6a3ce929d0e0e4736", sc.TraceID)
+			}
+		})
+	}
+}
+
+func TestInjectSpanContext(t *testing.T) {
+	ctx, span := trace.StartSpan(context.Background(), "ingress", trace.WithSampler(trace.AlwaysSample()))
+	defer span.End()
+
+	m := &paho.Publish{Topic: "motion"}
+	InjectSpanContext(ctx, m)
+	ctx, child := StartSpan(context.Background(), "receive", m)
+	defer child.End()
+
+	if got, want := child.SpanContext().TraceID, span.SpanContext().TraceID; got != want {
+		t.Errorf("TraceID = %s, want %s", got, want)
+	}
+	if trace.FromContext(ctx) != child {
+		t.Error("StartSpan() did not return the span in its context")
+	}
+}
@@ -0,0 +1,590 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package mqtttest provides an in-process MQTT 5 broker, a CloudEvents sink
+// recording the events it receives and a fake BrokerChannel informer, to
+// test the data planes without any external service.
+package mqtttest
+
+import (
+	"net"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/eclipse/paho.golang/packets"
+
+	"github.com/ShixiongQi/brokerchannel/pkg/apis/samples/v1beta1"
+	"github.com/ShixiongQi/brokerchannel/pkg/mqtt"
+)
+
+// Timeout bounds the wait of the helpers for something to happen.
+const Timeout = 10 * time.Second
+
+// maxQoS is the highest quality of service granted by the Broker.
+const maxQoS = 1
+
+// Broker is an MQTT 5 broker listening on a random port of the loopback
+// interface. It grants QoS 1 at most, supports shared subscriptions and
+// retained messages, and honours the Receive Maximum of the clients. It
+// keeps the sessions of the clients connecting with a session expiry once
+// they disconnect, with their unacknowledged and queued QoS 1 messages,
+// but never expires them.
+type Broker struct {
+	ln net.Listener
+	wg sync.WaitGroup
+
+	mu       sync.Mutex
+	sessions map[*session]struct{}
+	// stored holds the sessions kept for the disconnected clients, by client
+	// identifier.
+	stored map[string]*storedSession
+	// retained holds the retained messages, by topic.
+	retained map[string]*packets.Publish
+	// lastID numbers the sessions, next picks the member of a share group
+	// receiving the next message.
+	lastID int
+	next   int
+}
+
+// session is the connection of a client. clientID and expiry are guarded
+// by the mutex of the Broker.
+type session struct {
+	id       int
+	conn     net.Conn
+	clientID string
+	expiry   uint32
+
+	// wmu serializes the packets written to conn.
+	wmu sync.Mutex
+
+	mu     sync.Mutex
+	subs   map[string]byte
+	nextID uint16
+	// unacked are the QoS 1 messages sent to the client and not
+	// acknowledged yet, in order. pending are the QoS 1 messages waiting
+	// for the number of unacked messages to fall below receiveMax, and
+	// maxUnacked the highest number of unacked messages.
+	unacked    []*packets.Publish
+	pending    []*packets.Publish
+	receiveMax uint16
+	maxUnacked int
+}
+
+// storedSession is the state of a session kept once its client
+// disconnected.
+type storedSession struct {
+	subs  map[string]byte
+	queue []*packets.Publish
+}
+
+// NewBroker starts a Broker, closed when the test ends.
+func NewBroker(t testing.TB) *Broker {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("Failed to listen:", err)
+	}
+	b := &Broker{ln: ln, sessions: make(map[*session]struct{}), stored: make(map[string]*storedSession), retained: make(map[string]*packets.Publish)}
+	b.wg.Add(1)
+	go b.serve()
+	t.Cleanup(b.Close)
+	return b
+}
+
+// Addr is the host:port of the broker.
+func (b *Broker) Addr() string {
+	return b.ln.Addr().String()
+}
+
+// Spec describes how to reach the broker in a BrokerChannel.
+func (b *Broker) Spec() *v1beta1.BrokerSpec {
+	addr := b.ln.Addr().(*net.TCPAddr)
+	return &v1beta1.BrokerSpec{Host: addr.IP.String(), Port: int32(addr.Port)}
+}
+
+// Close stops the broker and closes the connections of its clients.
+func (b *Broker) Close() {
+	b.ln.Close()
+	b.DropConnections()
+	b.wg.Wait()
+}
+
+// DropConnections closes the connections of the clients, as a broker going
+// down would.
+func (b *Broker) DropConnections() {
+	for _, s := range b.snapshot() {
+		s.conn.Close()
+	}
+}
+
+// Publish sends a message to the matching subscribers, as if a client
+// published it.
+func (b *Broker) Publish(topic string, qos byte, payload []byte, user map[string]string) {
+	b.route(&packets.Publish{
+		Topic:      topic,
+		QoS:        qos,
+		Payload:    payload,
+		Properties: &packets.Properties{User: user},
+	})
+}
+
+// PublishExpiring publishes a message with an MQTT 5 Message Expiry
+// Interval of expiry seconds.
+func (b *Broker) PublishExpiring(topic string, qos byte, payload []byte, user map[string]string, expiry uint32) {
+	b.route(&packets.Publish{
+		Topic:      topic,
+		QoS:        qos,
+		Payload:    payload,
+		Properties: &packets.Properties{User: user, MessageExpiry: &expiry},
+	})
+}
+
+// PublishRetained publishes a message and retains it, to be sent to the
+// clients subscribing to its topic later on. An empty payload removes the
+// retained message of the topic.
+func (b *Broker) PublishRetained(topic string, qos byte, payload []byte, user map[string]string) {
+	p := &packets.Publish{
+		Topic:      topic,
+		QoS:        qos,
+		Payload:    payload,
+		Properties: &packets.Properties{User: user},
+	}
+	b.mu.Lock()
+	if len(payload) == 0 {
+		delete(b.retained, topic)
+	} else {
+		r := *p
+		r.Retain = true
+		b.retained[topic] = &r
+	}
+	b.mu.Unlock()
+	b.route(p)
+}
+
+// Subscriptions returns the QoS granted to every topic filter subscribed
+// to by a client.
+func (b *Broker) Subscriptions() map[string]byte {
+	subs := make(map[string]byte)
+	for _, s := range b.snapshot() {
+		s.mu.Lock()
+		for filter, qos := range s.subs {
+			subs[filter] = qos
+		}
+		s.mu.Unlock()
+	}
+	return subs
+}
+
+// Subscribers returns the number of clients subscribed to filter.
+func (b *Broker) Subscribers(filter string) int {
+	n := 0
+	for _, s := range b.snapshot() {
+		s.mu.Lock()
+		if _, ok := s.subs[filter]; ok {
+			n++
+		}
+		s.mu.Unlock()
+	}
+	return n
+}
+
+// Unacked returns the number of QoS 1 messages sent to the connected
+// clients and not acknowledged yet.
+func (b *Broker) Unacked() int {
+	n := 0
+	for _, s := range b.snapshot() {
+		s.mu.Lock()
+		n += len(s.unacked)
+		s.mu.Unlock()
+	}
+	return n
+}
+
+// MaxUnacked returns the highest number of QoS 1 messages a connected
+// client had not acknowledged at once.
+func (b *Broker) MaxUnacked() int {
+	n := 0
+	for _, s := range b.snapshot() {
+		s.mu.Lock()
+		if s.maxUnacked > n {
+			n = s.maxUnacked
+		}
+		s.mu.Unlock()
+	}
+	return n
+}
+
+// WaitForUnacked waits until n QoS 1 messages sent to the connected
+// clients are not acknowledged yet.
+func (b *Broker) WaitForUnacked(t testing.TB, n int) {
+	t.Helper()
+	b.waitFor(t, func() bool {
+		return b.Unacked() == n
+	}, "%d unacknowledged messages", n)
+}
+
+// Stored tells whether the broker keeps the session of the disconnected
+// client clientID.
+func (b *Broker) Stored(clientID string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	_, ok := b.stored[clientID]
+	return ok
+}
+
+// WaitForStored waits until the broker keeps the session of the
+// disconnected client clientID.
+func (b *Broker) WaitForStored(t testing.TB, clientID string) {
+	t.Helper()
+	b.waitFor(t, func() bool {
+		return b.Stored(clientID)
+	}, "the session of %q to be stored", clientID)
+}
+
+// WaitForSubscription waits until a client subscribes to filter.
+func (b *Broker) WaitForSubscription(t testing.TB, filter string) {
+	t.Helper()
+	b.waitFor(t, func() bool {
+		return b.Subscribers(filter) > 0
+	}, "a subscription to %q", filter)
+}
+
+// WaitForSubscribers waits until n clients subscribe to filter.
+func (b *Broker) WaitForSubscribers(t testing.TB, filter string, n int) {
+	t.Helper()
+	b.waitFor(t, func() bool {
+		return b.Subscribers(filter) == n
+	}, "%d subscriptions to %q", n, filter)
+}
+
+// WaitForUnsubscription waits until no client subscribes to filter.
+func (b *Broker) WaitForUnsubscription(t testing.TB, filter string) {
+	t.Helper()
+	b.waitFor(t, func() bool {
+		return b.Subscribers(filter) == 0
+	}, "no subscription to %q", filter)
+}
+
+func (b *Broker) waitFor(t testing.TB, cond func() bool, format string, args ...interface{}) {
+	t.Helper()
+	deadline := time.Now().Add(Timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for "+format, args...)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func (b *Broker) snapshot() []*session {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	sessions := make([]*session, 0, len(b.sessions))
+	for s := range b.sessions {
+		sessions = append(sessions, s)
+	}
+	return sessions
+}
+
+func (b *Broker) serve() {
+	defer b.wg.Done()
+	for {
+		conn, err := b.ln.Accept()
+		if err != nil {
+			return
+		}
+		s := &session{conn: conn, subs: make(map[string]byte)}
+		b.mu.Lock()
+		b.lastID++
+		s.id = b.lastID
+		b.sessions[s] = struct{}{}
+		b.mu.Unlock()
+
+		b.wg.Add(1)
+		go func() {
+			defer b.wg.Done()
+			b.handle(s)
+			conn.Close()
+			b.disconnect(s)
+		}()
+	}
+}
+
+// handle reads the packets of a client until it disconnects.
+func (b *Broker) handle(s *session) {
+	for {
+		cp, err := packets.ReadPacket(s.conn)
+		if err != nil {
+			return
+		}
+		switch p := cp.Content.(type) {
+		case *packets.Connect:
+			present, queue := b.connect(s, p)
+			s.write(&packets.Connack{SessionPresent: present, Properties: &packets.Properties{}})
+			for _, q := range queue {
+				s.deliver(q, q.QoS)
+			}
+		case *packets.Publish:
+			switch p.QoS {
+			case 1:
+				s.write(&packets.Puback{PacketID: p.PacketID, Properties: &packets.Properties{}})
+			case 2:
+				s.write(&packets.Pubrec{PacketID: p.PacketID, Properties: &packets.Properties{}})
+			}
+			b.route(p)
+		case *packets.Puback:
+			s.mu.Lock()
+			for i, u := range s.unacked {
+				if u.PacketID == p.PacketID {
+					s.unacked = append(s.unacked[:i:i], s.unacked[i+1:]...)
+					break
+				}
+			}
+			var next *packets.Publish
+			if len(s.pending) > 0 {
+				next, s.pending = s.pending[0], s.pending[1:]
+			}
+			s.mu.Unlock()
+			if next != nil {
+				s.deliver(next, next.QoS)
+			}
+		case *packets.Pubrel:
+			s.write(&packets.Pubcomp{PacketID: p.PacketID, Properties: &packets.Properties{}})
+		case *packets.Subscribe:
+			reasons := make([]byte, 0, len(p.Subscriptions))
+			sendRetained := make(map[string]byte)
+			s.mu.Lock()
+			for filter, opts := range p.Subscriptions {
+				qos := opts.QoS
+				if qos > maxQoS {
+					qos = maxQoS
+				}
+				_, exists := s.subs[filter]
+				s.subs[filter] = qos
+				reasons = append(reasons, qos)
+				// Retained messages are not sent for shared subscriptions.
+				// paho keeps Retain Handling in place, in bits 4 and 5.
+				handling := opts.RetainHandling >> 4
+				if _, _, shared := mqtt.ParseSharedFilter(filter); !shared && (handling == 0 || handling == 1 && !exists) {
+					sendRetained[filter] = qos
+				}
+			}
+			s.mu.Unlock()
+			s.write(&packets.Suback{PacketID: p.PacketID, Reasons: reasons, Properties: &packets.Properties{}})
+			for filter, qos := range sendRetained {
+				for _, r := range b.retainedFor(filter, qos) {
+					s.deliver(r, r.QoS)
+				}
+			}
+		case *packets.Unsubscribe:
+			reasons := make([]byte, len(p.Topics))
+			s.mu.Lock()
+			for _, filter := range p.Topics {
+				delete(s.subs, filter)
+			}
+			s.mu.Unlock()
+			s.write(&packets.Unsuback{PacketID: p.PacketID, Reasons: reasons, Properties: &packets.Properties{}})
+		case *packets.Pingreq:
+			s.write(&packets.Pingresp{})
+		case *packets.Disconnect:
+			if p.Properties != nil && p.Properties.SessionExpiryInterval != nil {
+				b.mu.Lock()
+				s.expiry = *p.Properties.SessionExpiryInterval
+				b.mu.Unlock()
+			}
+			return
+		}
+	}
+}
+
+// connect starts the session of the client connecting with p. A client
+// connecting with the identifier of a connected client takes its session
+// over. The stored session of the client is resumed unless it starts
+// clean, along with the messages queued while it was disconnected.
+func (b *Broker) connect(s *session, p *packets.Connect) (bool, []*packets.Publish) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s.clientID = p.ClientID
+	if p.Properties != nil && p.Properties.SessionExpiryInterval != nil {
+		s.expiry = *p.Properties.SessionExpiryInterval
+	}
+	if p.Properties != nil && p.Properties.ReceiveMaximum != nil {
+		s.mu.Lock()
+		s.receiveMax = *p.Properties.ReceiveMaximum
+		s.mu.Unlock()
+	}
+	if s.clientID == "" {
+		return false, nil
+	}
+	for o := range b.sessions {
+		if o == s || o.clientID != s.clientID {
+			continue
+		}
+		o.mu.Lock()
+		b.stored[s.clientID] = &storedSession{subs: o.subs, queue: append(o.unacked, o.pending...)}
+		o.subs, o.unacked, o.pending = make(map[string]byte), nil, nil
+		o.mu.Unlock()
+		o.clientID = ""
+		o.conn.Close()
+	}
+	st, ok := b.stored[s.clientID]
+	delete(b.stored, s.clientID)
+	if !ok || p.CleanStart {
+		return false, nil
+	}
+	s.mu.Lock()
+	s.subs = st.subs
+	s.mu.Unlock()
+	return true, st.queue
+}
+
+// disconnect ends the session of s, and stores it when it has not expired.
+func (b *Broker) disconnect(s *session) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.sessions, s)
+	if s.clientID == "" || s.expiry == 0 {
+		return
+	}
+	s.mu.Lock()
+	b.stored[s.clientID] = &storedSession{subs: s.subs, queue: append(s.unacked, s.pending...)}
+	s.mu.Unlock()
+}
+
+// route delivers a message once to every client with a matching
+// subscription, at the highest QoS they were granted. The messages of a
+// shared subscription are delivered to one of the members of the group, in
+// turn.
+func (b *Broker) route(p *packets.Publish) {
+	granted := make(map[*session]byte)
+	shared := make(map[string][]member)
+	for _, s := range b.snapshot() {
+		s.mu.Lock()
+		for filter, qos := range s.subs {
+			if group, f, ok := mqtt.ParseSharedFilter(filter); ok {
+				if mqtt.MatchTopic(f, p.Topic) {
+					shared[group+"/"+f] = append(shared[group+"/"+f], member{s, qos})
+				}
+				continue
+			}
+			if mqtt.MatchTopic(filter, p.Topic) {
+				if g, ok := granted[s]; !ok || qos > g {
+					granted[s] = qos
+				}
+			}
+		}
+		s.mu.Unlock()
+	}
+	for _, members := range shared {
+		sort.Slice(members, func(i, j int) bool { return members[i].s.id < members[j].s.id })
+		b.mu.Lock()
+		m := members[b.next%len(members)]
+		b.next++
+		b.mu.Unlock()
+		m.s.deliver(p, m.qos)
+	}
+	for s, qos := range granted {
+		s.deliver(p, qos)
+	}
+	if p.QoS > 0 {
+		b.queue(p)
+	}
+}
+
+// retainedFor returns the retained messages matching filter, at the
+// granted QoS at most.
+func (b *Broker) retainedFor(filter string, granted byte) []*packets.Publish {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var matching []*packets.Publish
+	for topic, r := range b.retained {
+		if mqtt.MatchTopic(filter, topic) {
+			q := *r
+			if q.QoS > granted {
+				q.QoS = granted
+			}
+			matching = append(matching, &q)
+		}
+	}
+	return matching
+}
+
+// queue keeps p for the stored sessions with a matching subscription.
+func (b *Broker) queue(p *packets.Publish) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, st := range b.stored {
+		var granted byte
+		for filter, qos := range st.subs {
+			if _, _, ok := mqtt.ParseSharedFilter(filter); !ok && qos > granted && mqtt.MatchTopic(filter, p.Topic) {
+				granted = qos
+			}
+		}
+		if granted > 0 {
+			q := *p
+			if q.QoS > granted {
+				q.QoS = granted
+			}
+			st.queue = append(st.queue, &q)
+		}
+	}
+}
+
+// member is a session subscribed to a shared subscription.
+type member struct {
+	s   *session
+	qos byte
+}
+
+// deliver sends p to s, at the granted QoS at most. A QoS 1 message waits
+// while the client has receiveMax messages to acknowledge.
+func (s *session) deliver(p *packets.Publish, granted byte) {
+	out := &packets.Publish{Topic: p.Topic, Payload: p.Payload, QoS: p.QoS, Retain: p.Retain, Properties: &packets.Properties{}}
+	if p.Properties != nil {
+		out.Properties.User = p.Properties.User
+		out.Properties.ContentType = p.Properties.ContentType
+		out.Properties.MessageExpiry = p.Properties.MessageExpiry
+	}
+	if out.QoS > granted {
+		out.QoS = granted
+	}
+	if out.QoS > 0 {
+		s.mu.Lock()
+		if s.receiveMax > 0 && len(s.unacked) >= int(s.receiveMax) {
+			s.pending = append(s.pending, out)
+			s.mu.Unlock()
+			return
+		}
+		if s.nextID++; s.nextID == 0 {
+			s.nextID++
+		}
+		out.PacketID = s.nextID
+		s.unacked = append(s.unacked, out)
+		if len(s.unacked) > s.maxUnacked {
+			s.maxUnacked = len(s.unacked)
+		}
+		s.mu.Unlock()
+	}
+	s.write(out)
+}
+
+func (s *session) write(p packets.Packet) {
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+	p.WriteTo(s.conn)
+}
@@ -0,0 +1,107 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mqtttest
+
+import (
+	"sync"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/ShixiongQi/brokerchannel/pkg/apis/samples/v1beta1"
+	listers "github.com/ShixiongQi/brokerchannel/pkg/client/listers/samples/v1beta1"
+)
+
+// BrokerChannelInformer is a fake informer of BrokerChannels. Add, Update
+// and Delete change its cache and notify its handlers synchronously. Like the
+// API server, Update increments the generation when the spec changes.
+type BrokerChannelInformer struct {
+	indexer cache.Indexer
+
+	mu       sync.Mutex
+	handlers []cache.ResourceEventHandler
+}
+
+// NewBrokerChannelInformer returns an empty informer.
+func NewBrokerChannelInformer() *BrokerChannelInformer {
+	return &BrokerChannelInformer{
+		indexer: cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{
+			cache.NamespaceIndex: cache.MetaNamespaceIndexFunc,
+		}),
+	}
+}
+
+// AddEventHandler registers h for the changes of the BrokerChannels.
+func (i *BrokerChannelInformer) AddEventHandler(h cache.ResourceEventHandler) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.handlers = append(i.handlers, h)
+}
+
+// Lister lists the BrokerChannels in the cache.
+func (i *BrokerChannelInformer) Lister() listers.BrokerChannelLister {
+	return listers.NewBrokerChannelLister(i.indexer)
+}
+
+// Add creates bc.
+func (i *BrokerChannelInformer) Add(t testing.TB, bc *v1beta1.BrokerChannel) {
+	t.Helper()
+	if err := i.indexer.Add(bc); err != nil {
+		t.Fatal("Failed to add:", err)
+	}
+	for _, h := range i.snapshot() {
+		h.OnAdd(bc)
+	}
+}
+
+// Update replaces the BrokerChannel with the name of bc.
+func (i *BrokerChannelInformer) Update(t testing.TB, bc *v1beta1.BrokerChannel) {
+	t.Helper()
+	old, ok, err := i.indexer.Get(bc)
+	if err != nil || !ok {
+		t.Fatalf("Failed to get %s/%s: %v", bc.Namespace, bc.Name, err)
+	}
+	prev := old.(*v1beta1.BrokerChannel)
+	bc.Generation = prev.Generation
+	if !equality.Semantic.DeepEqual(bc.Spec, prev.Spec) {
+		bc.Generation++
+	}
+	if err := i.indexer.Update(bc); err != nil {
+		t.Fatal("Failed to update:", err)
+	}
+	for _, h := range i.snapshot() {
+		h.OnUpdate(old, bc)
+	}
+}
+
+// Delete removes bc.
+func (i *BrokerChannelInformer) Delete(t testing.TB, bc *v1beta1.BrokerChannel) {
+	t.Helper()
+	if err := i.indexer.Delete(bc); err != nil {
+		t.Fatal("Failed to delete:", err)
+	}
+	for _, h := range i.snapshot() {
+		h.OnDelete(bc)
+	}
+}
+
+func (i *BrokerChannelInformer) snapshot() []cache.ResourceEventHandler {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return append([]cache.ResourceEventHandler(nil), i.handlers...)
+}
@@ -0,0 +1,156 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mqtttest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/cloudevents/sdk-go/v2/binding"
+	cehttp "github.com/cloudevents/sdk-go/v2/protocol/http"
+	"knative.dev/pkg/apis"
+
+	"github.com/ShixiongQi/brokerchannel/pkg/signature"
+)
+
+// Sink is an HTTP server recording the CloudEvents sent to it.
+type Sink struct {
+	server *httptest.Server
+	events chan cloudevents.Event
+	status int32
+	delay  int64
+
+	mu         sync.Mutex
+	retryAfter string
+	required   http.Header
+	signingKey []byte
+}
+
+// NewSink starts a Sink answering 202, closed when the test ends.
+func NewSink(t testing.TB) *Sink {
+	s := &Sink{
+		events: make(chan cloudevents.Event, 1000),
+		status: http.StatusAccepted,
+	}
+	s.server = httptest.NewServer(s)
+	t.Cleanup(s.server.Close)
+	return s
+}
+
+// URL is the address of the sink.
+func (s *Sink) URL() *apis.URL {
+	u, _ := apis.ParseURL(s.server.URL)
+	return u
+}
+
+// SetStatus sets the status code of the responses of the sink.
+func (s *Sink) SetStatus(code int) {
+	atomic.StoreInt32(&s.status, int32(code))
+}
+
+// SetDelay makes the sink wait for d before handling each request.
+func (s *Sink) SetDelay(d time.Duration) {
+	atomic.StoreInt64(&s.delay, int64(d))
+}
+
+// SetRetryAfter sets the Retry-After header of the responses of the sink,
+// none when empty.
+func (s *Sink) SetRetryAfter(v string) {
+	s.mu.Lock()
+	s.retryAfter = v
+	s.mu.Unlock()
+}
+
+// RequireHeader makes the sink reject the requests without the header name
+// set to value, with 401 and without recording their event.
+func (s *Sink) RequireHeader(name, value string) {
+	s.mu.Lock()
+	if s.required == nil {
+		s.required = make(http.Header)
+	}
+	s.required.Set(name, value)
+	s.mu.Unlock()
+}
+
+// RequireSignature makes the sink reject the requests not signed with key,
+// with 401 and without recording their event.
+func (s *Sink) RequireSignature(key []byte) {
+	s.mu.Lock()
+	s.signingKey = key
+	s.mu.Unlock()
+}
+
+func (s *Sink) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	time.Sleep(time.Duration(atomic.LoadInt64(&s.delay)))
+	s.mu.Lock()
+	for name := range s.required {
+		if r.Header.Get(name) != s.required.Get(name) {
+			s.mu.Unlock()
+			http.Error(w, "missing "+name, http.StatusUnauthorized)
+			return
+		}
+	}
+	key := s.signingKey
+	s.mu.Unlock()
+	if key != nil {
+		if err := signature.Verify(r, key, time.Minute); err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+	}
+	message := cehttp.NewMessageFromHttpRequest(r)
+	defer message.Finish(nil)
+	event, err := binding.ToEvent(r.Context(), message)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.events <- *event
+	s.mu.Lock()
+	if s.retryAfter != "" {
+		w.Header().Set("Retry-After", s.retryAfter)
+	}
+	s.mu.Unlock()
+	w.WriteHeader(int(atomic.LoadInt32(&s.status)))
+}
+
+// Next returns the next event received by the sink.
+func (s *Sink) Next(t testing.TB) cloudevents.Event {
+	t.Helper()
+	select {
+	case e := <-s.events:
+		return e
+	case <-time.After(Timeout):
+		t.Fatal("Timed out waiting for an event")
+		return cloudevents.Event{}
+	}
+}
+
+// ExpectNone checks that the sink receives no event for d.
+func (s *Sink) ExpectNone(t testing.TB, d time.Duration) {
+	t.Helper()
+	select {
+	case e := <-s.events:
+		t.Error("Unexpected event:", e)
+	case <-time.After(d):
+	}
+}
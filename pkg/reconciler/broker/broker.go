@@ -0,0 +1,132 @@
+/*
+Copyright 2019 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package broker
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	eventingv1 "knative.dev/eventing/pkg/apis/eventing/v1"
+	"knative.dev/pkg/apis"
+	"knative.dev/pkg/network"
+	pkgreconciler "knative.dev/pkg/reconciler"
+	"knative.dev/pkg/tracker"
+
+	"github.com/ShixiongQi/brokerchannel/pkg/apis/samples/v1beta1"
+	"github.com/ShixiongQi/brokerchannel/pkg/broker"
+	listers "github.com/ShixiongQi/brokerchannel/pkg/client/listers/samples/v1beta1"
+)
+
+// BrokerConditionMQTTBroker has status True when the MQTTBroker configuring
+// the broker is ready.
+const BrokerConditionMQTTBroker apis.ConditionType = "MQTTBrokerReady"
+
+// brokerCondSet replaces the trigger channel of the channel based brokers
+// with the MQTTBroker.
+var brokerCondSet = apis.NewLivingConditionSet(
+	eventingv1.BrokerConditionIngress,
+	eventingv1.BrokerConditionFilter,
+	eventingv1.BrokerConditionAddressable,
+	BrokerConditionMQTTBroker,
+)
+
+// Reconciler gives the brokers of the MQTT class an address on the shared
+// ingress and reports the readiness of the data plane.
+type Reconciler struct {
+	endpointsLister  corev1listers.EndpointsLister
+	mqttBrokerLister listers.MQTTBrokerLister
+	tracker          tracker.Interface
+
+	systemNamespace string
+}
+
+func (r *Reconciler) ReconcileKind(ctx context.Context, b *eventingv1.Broker) pkgreconciler.Event {
+	b.Status.InitializeConditions()
+	m := brokerCondSet.Manage(&b.Status)
+
+	if err := r.reconcileConfig(ctx, b, m); err != nil {
+		return err
+	}
+
+	for cond, svc := range map[apis.ConditionType]string{
+		eventingv1.BrokerConditionIngress: broker.IngressService,
+		eventingv1.BrokerConditionFilter:  broker.FilterService,
+	} {
+		ep, err := r.endpointsLister.Endpoints(r.systemNamespace).Get(svc)
+		if apierrors.IsNotFound(err) {
+			m.MarkFalse(cond, "ServiceNotFound", "Service %q does not exist", svc)
+			continue
+		} else if err != nil {
+			return err
+		}
+		if hasAddresses(ep) {
+			m.MarkTrue(cond)
+		} else {
+			m.MarkFalse(cond, "EndpointsUnavailable", "Endpoints %q have no ready address", svc)
+		}
+	}
+
+	b.Status.SetAddress(&apis.URL{
+		Scheme: "http",
+		Host:   network.GetServiceHostname(broker.IngressService, r.systemNamespace),
+		Path:   broker.IngressPath(b.Namespace, b.Name),
+	})
+
+	b.Status.ObservedGeneration = b.Generation
+	return nil
+}
+
+// reconcileConfig reflects the readiness of the MQTTBroker referenced by the
+// spec.config of b.
+func (r *Reconciler) reconcileConfig(ctx context.Context, b *eventingv1.Broker, m apis.ConditionManager) error {
+	namespace, ref, err := broker.ConfigRef(b)
+	if err != nil {
+		m.MarkFalse(BrokerConditionMQTTBroker, "InvalidConfig", "%s", err)
+		return nil
+	}
+
+	if err := r.tracker.TrackReference(tracker.Reference{
+		APIVersion: v1beta1.SchemeGroupVersion.String(),
+		Kind:       "MQTTBroker",
+		Namespace:  namespace,
+		Name:       ref.Name,
+	}, b); err != nil {
+		return err
+	}
+
+	mb, err := r.mqttBrokerLister.MQTTBrokers(namespace).Get(ref.Name)
+	if apierrors.IsNotFound(err) {
+		// The tracker enqueues b again once the MQTTBroker is created.
+		m.MarkFalse(BrokerConditionMQTTBroker, "NotFound", "MQTTBroker %q does not exist", ref.Name)
+		return nil
+	} else if err != nil {
+		return err
+	}
+	v1beta1.PropagateMQTTBrokerStatus(m, BrokerConditionMQTTBroker, &mb.Status)
+	return nil
+}
+
+func hasAddresses(ep *corev1.Endpoints) bool {
+	for _, s := range ep.Subsets {
+		if len(s.Addresses) > 0 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,83 @@
+/*
+Copyright 2019 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package broker
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/cache"
+	eventingv1 "knative.dev/eventing/pkg/apis/eventing/v1"
+	brokerinformer "knative.dev/eventing/pkg/client/injection/informers/eventing/v1/broker"
+	brokerreconciler "knative.dev/eventing/pkg/client/injection/reconciler/eventing/v1/broker"
+	endpointsinformer "knative.dev/pkg/client/injection/kube/informers/core/v1/endpoints"
+	"knative.dev/pkg/configmap"
+	"knative.dev/pkg/controller"
+	"knative.dev/pkg/logging"
+	pkgreconciler "knative.dev/pkg/reconciler"
+	"knative.dev/pkg/system"
+	"knative.dev/pkg/tracker"
+
+	"github.com/ShixiongQi/brokerchannel/pkg/apis/samples/v1beta1"
+	"github.com/ShixiongQi/brokerchannel/pkg/broker"
+	mqttbrokerinformer "github.com/ShixiongQi/brokerchannel/pkg/client/injection/informers/samples/v1beta1/mqttbroker"
+)
+
+// NewController initializes the controller of the brokers of the MQTT class.
+func NewController(
+	ctx context.Context,
+	cmw configmap.Watcher,
+) *controller.Impl {
+	brokerInformer := brokerinformer.Get(ctx)
+	endpointsInformer := endpointsinformer.Get(ctx)
+	mqttBrokerInformer := mqttbrokerinformer.Get(ctx)
+
+	eventingv1.RegisterAlternateBrokerConditionSet(brokerCondSet)
+
+	r := &Reconciler{
+		endpointsLister:  endpointsInformer.Lister(),
+		mqttBrokerLister: mqttBrokerInformer.Lister(),
+		systemNamespace:  system.Namespace(),
+	}
+	impl := brokerreconciler.NewImpl(ctx, r, broker.Class)
+
+	logging.FromContext(ctx).Info("Setting up event handlers")
+	brokerInformer.Informer().AddEventHandler(cache.FilteringResourceEventHandler{
+		FilterFunc: pkgreconciler.AnnotationFilterFunc(brokerreconciler.ClassAnnotationKey, broker.Class, false),
+		Handler:    controller.HandleAll(impl.Enqueue),
+	})
+
+	// Reconcile every broker when the ingress or the filter scale.
+	endpointsInformer.Informer().AddEventHandler(cache.FilteringResourceEventHandler{
+		FilterFunc: func(obj interface{}) bool {
+			ep, ok := obj.(*corev1.Endpoints)
+			return ok && ep.Namespace == r.systemNamespace &&
+				(ep.Name == broker.IngressService || ep.Name == broker.FilterService)
+		},
+		Handler: controller.HandleAll(func(interface{}) {
+			impl.GlobalResync(brokerInformer.Informer())
+		}),
+	})
+
+	// Reconcile the brokers configured by an MQTTBroker when it changes.
+	r.tracker = tracker.New(impl.EnqueueKey, controller.GetTrackerLease(ctx))
+	mqttBrokerInformer.Informer().AddEventHandler(controller.HandleAll(
+		controller.EnsureTypeMeta(r.tracker.OnChanged, v1beta1.SchemeGroupVersion.WithKind("MQTTBroker")),
+	))
+
+	return impl
+}
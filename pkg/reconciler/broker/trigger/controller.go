@@ -0,0 +1,84 @@
+/*
+Copyright 2019 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package trigger
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/cache"
+	eventingv1 "knative.dev/eventing/pkg/apis/eventing/v1"
+	brokerinformer "knative.dev/eventing/pkg/client/injection/informers/eventing/v1/broker"
+	triggerinformer "knative.dev/eventing/pkg/client/injection/informers/eventing/v1/trigger"
+	triggerreconciler "knative.dev/eventing/pkg/client/injection/reconciler/eventing/v1/trigger"
+	"knative.dev/pkg/configmap"
+	"knative.dev/pkg/controller"
+	"knative.dev/pkg/logging"
+	"knative.dev/pkg/resolver"
+
+	"github.com/ShixiongQi/brokerchannel/pkg/broker"
+)
+
+// NewController initializes the controller of the Triggers of the MQTT
+// brokers.
+func NewController(
+	ctx context.Context,
+	cmw configmap.Watcher,
+) *controller.Impl {
+	logger := logging.FromContext(ctx)
+	brokerInformer := brokerinformer.Get(ctx)
+	triggerInformer := triggerinformer.Get(ctx)
+
+	r := &Reconciler{
+		brokerLister: brokerInformer.Lister(),
+	}
+	impl := triggerreconciler.NewImpl(ctx, r)
+	r.sinkResolver = resolver.NewURIResolver(ctx, impl.EnqueueKey)
+
+	logger.Info("Setting up event handlers")
+	triggerInformer.Informer().AddEventHandler(cache.FilteringResourceEventHandler{
+		FilterFunc: func(obj interface{}) bool {
+			t, ok := obj.(*eventingv1.Trigger)
+			if !ok {
+				return false
+			}
+			b, err := brokerInformer.Lister().Brokers(t.Namespace).Get(t.Spec.Broker)
+			return err == nil && broker.IsMQTT(b)
+		},
+		Handler: controller.HandleAll(impl.Enqueue),
+	})
+
+	// Reconcile the Triggers of a broker when its status changes.
+	brokerInformer.Informer().AddEventHandler(controller.HandleAll(func(obj interface{}) {
+		b, ok := obj.(*eventingv1.Broker)
+		if !ok || !broker.IsMQTT(b) {
+			return
+		}
+		triggers, err := triggerInformer.Lister().Triggers(b.Namespace).List(labels.Everything())
+		if err != nil {
+			logger.Errorw("Failed to list Triggers", "error", err)
+			return
+		}
+		for _, t := range triggers {
+			if t.Spec.Broker == b.Name {
+				impl.Enqueue(t)
+			}
+		}
+	}))
+
+	return impl
+}
@@ -0,0 +1,75 @@
+/*
+Copyright 2019 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package trigger
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	eventingv1 "knative.dev/eventing/pkg/apis/eventing/v1"
+	eventinglisters "knative.dev/eventing/pkg/client/listers/eventing/v1"
+	"knative.dev/pkg/apis"
+	pkgreconciler "knative.dev/pkg/reconciler"
+	"knative.dev/pkg/resolver"
+
+	"github.com/ShixiongQi/brokerchannel/pkg/broker"
+)
+
+// Reconciler resolves the subscribers of the Triggers of the MQTT brokers.
+// The filter reads the Triggers directly, there is no Subscription.
+type Reconciler struct {
+	brokerLister eventinglisters.BrokerLister
+	sinkResolver *resolver.URIResolver
+}
+
+func (r *Reconciler) ReconcileKind(ctx context.Context, t *eventingv1.Trigger) pkgreconciler.Event {
+	b, err := r.brokerLister.Brokers(t.Namespace).Get(t.Spec.Broker)
+	if apierrors.IsNotFound(err) {
+		// Without a broker the class of the Trigger is unknown, the Trigger
+		// controller of knative-eventing reports it.
+		return nil
+	} else if err != nil {
+		return err
+	} else if !broker.IsMQTT(b) {
+		// Another class reconciles the Trigger.
+		return nil
+	}
+
+	t.Status.InitializeConditions()
+	t.Status.PropagateBrokerCondition(b.Status.GetTopLevelCondition())
+
+	dest := t.Spec.Subscriber.DeepCopy()
+	if dest.Ref != nil && dest.Ref.Namespace == "" {
+		dest.Ref.Namespace = t.Namespace
+	}
+	uri, err := r.sinkResolver.URIFromDestinationV1(ctx, *dest, t)
+	if err != nil {
+		t.Status.SubscriberURI = nil
+		t.Status.MarkSubscriberResolvedFailed("Unable to get the subscriber's URI", "%v", err)
+		return err
+	}
+	t.Status.SubscriberURI = uri
+	t.Status.MarkSubscriberResolvedSucceeded()
+
+	// The filter delivers to the Trigger as soon as its subscriber is resolved.
+	t.Status.PropagateSubscriptionCondition(&apis.Condition{Status: corev1.ConditionTrue})
+	t.Status.MarkDependencySucceeded()
+
+	t.Status.ObservedGeneration = t.Generation
+	return nil
+}
@@ -0,0 +1,208 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package reconciler
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"knative.dev/pkg/apis"
+	duckv1 "knative.dev/pkg/apis/duck/v1"
+	"knative.dev/pkg/client/injection/ducks/duck/v1/addressable"
+	fakekubeclient "knative.dev/pkg/client/injection/kube/client/fake"
+	"knative.dev/pkg/kmeta"
+	pkgreconciler "knative.dev/pkg/reconciler"
+	"knative.dev/pkg/resolver"
+
+	sourcesv1 "knative.dev/eventing/pkg/apis/sources/v1"
+
+	"github.com/ShixiongQi/brokerchannel/pkg/apis/samples/v1beta1"
+
+	_ "knative.dev/pkg/injection/clients/dynamicclient/fake"
+
+	rttesting "knative.dev/pkg/reconciler/testing"
+)
+
+const (
+	testNS    = "test-namespace"
+	testName  = "sensors"
+	testImage = "ko://github.com/ShixiongQi/brokerchannel/cmd/brokerchannel"
+	oldImage  = "ko://github.com/ShixiongQi/brokerchannel/cmd/brokerchannel:old"
+	sinkURI   = "http://sink.test-namespace.svc.cluster.local/"
+)
+
+func TestReconcileDeployment(t *testing.T) {
+	owner := &v1beta1.BrokerChannel{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      testName,
+			Namespace: testNS,
+			UID:       "1234",
+		},
+	}
+
+	tests := []struct {
+		name        string
+		existing    *appsv1.Deployment
+		wantVerbs   []string
+		wantReason  string
+		wantMessage string
+		wantImage   string
+	}{{
+		name:        "create",
+		wantVerbs:   []string{"get", "create"},
+		wantReason:  "DeploymentCreated",
+		wantMessage: `created deployment: "test-namespace/sensors"`,
+		wantImage:   testImage,
+	}, {
+		name:        "update image and sink",
+		existing:    makeDeployment(owner, oldImage),
+		wantVerbs:   []string{"get", "update"},
+		wantReason:  "DeploymentUpdated",
+		wantMessage: `updated deployment: "test-namespace/sensors"`,
+		wantImage:   testImage,
+	}, {
+		name:        "not owned",
+		existing:    makeDeployment(nil, testImage),
+		wantVerbs:   []string{"get"},
+		wantMessage: `deployment "sensors" is not owned by BrokerChannel "sensors"`,
+	}, {
+		name:      "reuse",
+		existing:  withSink(makeDeployment(owner, testImage)),
+		wantVerbs: []string{"get"},
+		wantImage: testImage,
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, _ := rttesting.SetupFakeContext(t)
+			ctx = addressable.WithDuck(ctx)
+			ctx = sourcesv1.WithURIResolver(ctx, resolver.NewURIResolver(ctx, func(types.NamespacedName) {}))
+
+			var objs []runtime.Object
+			if tc.existing != nil {
+				objs = append(objs, tc.existing)
+			}
+			ctx, kubeClient := fakekubeclient.With(ctx, objs...)
+
+			r := &DeploymentReconciler{KubeClientSet: kubeClient}
+			ra, _, event := r.ReconcileDeployment(ctx, owner, makeBinder(owner), makeDeployment(owner, testImage))
+
+			var verbs []string
+			for _, a := range kubeClient.Actions() {
+				verbs = append(verbs, a.GetVerb())
+			}
+			if diff := cmp.Diff(tc.wantVerbs, verbs); diff != "" {
+				t.Errorf("Unexpected actions (-want, +got): %s", diff)
+			}
+
+			switch {
+			case tc.wantMessage == "" && event != nil:
+				t.Fatalf("ReconcileDeployment() = %v, wanted no event", event)
+			case tc.wantMessage != "" && event == nil:
+				t.Fatalf("ReconcileDeployment() = nil, wanted %q", tc.wantMessage)
+			case event != nil:
+				if got := event.Error(); got != tc.wantMessage {
+					t.Errorf("ReconcileDeployment() = %q, wanted %q", got, tc.wantMessage)
+				}
+				var re *pkgreconciler.ReconcilerEvent
+				if pkgreconciler.EventAs(event, &re) {
+					if re.Reason != tc.wantReason {
+						t.Errorf("Reason = %q, wanted %q", re.Reason, tc.wantReason)
+					}
+				} else if tc.wantReason != "" {
+					t.Errorf("ReconcileDeployment() = %v, wanted a %s event", event, tc.wantReason)
+				}
+			}
+
+			if tc.wantImage == "" {
+				if ra != nil {
+					t.Errorf("ReconcileDeployment() returned deployment %v, wanted nil", ra)
+				}
+				return
+			}
+			c := ra.Spec.Template.Spec.Containers[0]
+			if c.Image != tc.wantImage {
+				t.Errorf("Image = %q, wanted %q", c.Image, tc.wantImage)
+			}
+			if got := envValue(c, "K_SINK"); got != sinkURI {
+				t.Errorf("K_SINK = %q, wanted %q", got, sinkURI)
+			}
+		})
+	}
+}
+
+func makeBinder(owner kmeta.Accessor) *sourcesv1.SinkBinding {
+	sink := apis.HTTP("sink.test-namespace.svc.cluster.local")
+	sink.Path = "/"
+	return &sourcesv1.SinkBinding{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      owner.GetName(),
+			Namespace: owner.GetNamespace(),
+		},
+		Spec: sourcesv1.SinkBindingSpec{
+			SourceSpec: duckv1.SourceSpec{
+				Sink: duckv1.Destination{URI: sink},
+			},
+		},
+	}
+}
+
+func makeDeployment(owner kmeta.OwnerRefable, image string) *appsv1.Deployment {
+	d := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      testName,
+			Namespace: testNS,
+		},
+		Spec: appsv1.DeploymentSpec{
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{
+						Name:  "receive-adapter",
+						Image: image,
+					}},
+				},
+			},
+		},
+	}
+	if owner != nil {
+		d.OwnerReferences = []metav1.OwnerReference{*kmeta.NewControllerRef(owner)}
+	}
+	return d
+}
+
+func withSink(d *appsv1.Deployment) *appsv1.Deployment {
+	c := &d.Spec.Template.Spec.Containers[0]
+	c.Env = append(c.Env,
+		corev1.EnvVar{Name: "K_SINK", Value: sinkURI},
+		corev1.EnvVar{Name: "K_CE_OVERRIDES"},
+	)
+	return d
+}
+
+func envValue(c corev1.Container, name string) string {
+	for _, e := range c.Env {
+		if e.Name == name {
+			return e.Value
+		}
+	}
+	return ""
+}
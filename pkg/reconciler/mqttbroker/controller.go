@@ -0,0 +1,66 @@
+/*
+Copyright 2019 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mqttbroker
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	"knative.dev/pkg/client/injection/kube/informers/core/v1/secret"
+	"knative.dev/pkg/configmap"
+	"knative.dev/pkg/controller"
+	"knative.dev/pkg/logging"
+	"knative.dev/pkg/tracker"
+
+	mqttbrokerinformer "github.com/ShixiongQi/brokerchannel/pkg/client/injection/informers/samples/v1beta1/mqttbroker"
+	mqttbrokerreconciler "github.com/ShixiongQi/brokerchannel/pkg/client/injection/reconciler/samples/v1beta1/mqttbroker"
+	"github.com/ShixiongQi/brokerchannel/pkg/mqtt"
+	"github.com/ShixiongQi/brokerchannel/pkg/mqtt/resolver"
+)
+
+// NewController initializes the controller and is called by the generated code
+// Registers event handlers to enqueue events
+func NewController(
+	ctx context.Context,
+	cmw configmap.Watcher,
+) *controller.Impl {
+	mqttBrokerInformer := mqttbrokerinformer.Get(ctx)
+
+	secretInformer := secret.Get(ctx)
+
+	r := &Reconciler{
+		resolver: &resolver.Resolver{
+			Brokers: mqttBrokerInformer.Lister(),
+			Secrets: secretInformer.Lister(),
+		},
+		connect: mqtt.Connect,
+	}
+	impl := mqttbrokerreconciler.NewImpl(ctx, r)
+	r.enqueueAfter = impl.EnqueueAfter
+
+	logging.FromContext(ctx).Info("Setting up event handlers")
+	mqttBrokerInformer.Informer().AddEventHandler(controller.HandleAll(impl.Enqueue))
+
+	// Probe the brokers again when one of the secrets of their MQTTBroker
+	// changes.
+	r.resolver.Tracker = tracker.New(impl.EnqueueKey, controller.GetTrackerLease(ctx))
+	secretInformer.Informer().AddEventHandler(controller.HandleAll(
+		controller.EnsureTypeMeta(r.resolver.Tracker.OnChanged, corev1.SchemeGroupVersion.WithKind("Secret")),
+	))
+
+	return impl
+}
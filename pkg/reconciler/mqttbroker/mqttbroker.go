@@ -0,0 +1,76 @@
+/*
+Copyright 2019 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mqttbroker
+
+import (
+	"context"
+	"time"
+
+	"github.com/eclipse/paho.golang/paho"
+	corev1 "k8s.io/api/core/v1"
+	pkgreconciler "knative.dev/pkg/reconciler"
+
+	"github.com/ShixiongQi/brokerchannel/pkg/apis/samples/v1beta1"
+	"github.com/ShixiongQi/brokerchannel/pkg/mqtt"
+	"github.com/ShixiongQi/brokerchannel/pkg/mqtt/resolver"
+)
+
+const (
+	// probeInterval is how often the reachability of a broker is checked.
+	probeInterval = time.Minute
+	// probeTimeout bounds the connection attempt of a probe.
+	probeTimeout = 5 * time.Second
+)
+
+// Reconciler reports whether the brokers described by MQTTBrokers accept
+// sessions with the settings and credentials of the MQTTBrokers.
+type Reconciler struct {
+	resolver     *resolver.Resolver
+	connect      func(ctx context.Context, c *mqtt.Config, router paho.Router) (*mqtt.Conn, error)
+	enqueueAfter func(obj interface{}, after time.Duration)
+}
+
+func (r *Reconciler) ReconcileKind(ctx context.Context, mb *v1beta1.MQTTBroker) pkgreconciler.Event {
+	mb.Status.InitializeConditions()
+	mb.Status.ObservedGeneration = mb.Generation
+
+	// Brokers go up and down without the MQTTBroker changing, so probe them
+	// periodically.
+	defer r.enqueueAfter(mb, probeInterval)
+
+	cfg, err := r.resolver.Resolve(ctx, mb, mb.Namespace, nil, &corev1.LocalObjectReference{Name: mb.Name})
+	if err != nil {
+		mb.Status.MarkUnreachable("SecretsNotResolved", "%s", err)
+		return nil
+	}
+
+	// Open a clean session, the same way the data plane does, so that the
+	// TLS settings and the credentials are checked along with the address.
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+	conn, err := r.connect(ctx, cfg, paho.NewSingleHandlerRouter(nil))
+	switch {
+	case mqtt.IsAuthError(err):
+		mb.Status.MarkUnreachable("Unauthorized", "%s", err)
+	case err != nil:
+		mb.Status.MarkUnreachable("ConnectFailed", "%s", err)
+	default:
+		conn.End()
+		mb.Status.MarkReachable()
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mqttbroker
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/eclipse/paho.golang/paho"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"knative.dev/pkg/apis"
+
+	"github.com/ShixiongQi/brokerchannel/pkg/apis/samples/v1beta1"
+	"github.com/ShixiongQi/brokerchannel/pkg/mqtt"
+	"github.com/ShixiongQi/brokerchannel/pkg/mqtt/resolver"
+	"github.com/ShixiongQi/brokerchannel/pkg/mqtttest"
+	. "github.com/ShixiongQi/brokerchannel/pkg/reconciler/testing"
+)
+
+const (
+	testNS = "test-namespace"
+	mbName = "mosquitto"
+)
+
+func withEndpoint(addr string) MQTTBrokerOption {
+	return func(mb *v1beta1.MQTTBroker) {
+		host, port, _ := net.SplitHostPort(addr)
+		p, _ := strconv.Atoi(port)
+		mb.Spec.Host, mb.Spec.Port = host, int32(p)
+	}
+}
+
+func withPassword(secret string) MQTTBrokerOption {
+	return func(mb *v1beta1.MQTTBroker) {
+		mb.Spec.Credentials = &v1beta1.BrokerCredentials{
+			Username: &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: secret}, Key: "username"},
+			Password: &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: secret}, Key: "password"},
+		}
+	}
+}
+
+func newReconciler(objs ...runtime.Object) *Reconciler {
+	ls := NewListers(objs)
+	return &Reconciler{
+		resolver: &resolver.Resolver{
+			Brokers: ls.GetMQTTBrokerLister(),
+			Secrets: ls.GetSecretLister(),
+		},
+		connect:      mqtt.Connect,
+		enqueueAfter: func(interface{}, time.Duration) {},
+	}
+}
+
+func reachable(t *testing.T, mb *v1beta1.MQTTBroker) *apis.Condition {
+	t.Helper()
+	c := mb.Status.GetCondition(v1beta1.MQTTBrokerConditionReachable)
+	if c == nil {
+		t.Fatal("No Reachable condition")
+	}
+	return c
+}
+
+func TestProbesTheBroker(t *testing.T) {
+	b := mqtttest.NewBroker(t)
+	mb := NewMQTTBroker(mbName, testNS, withEndpoint(b.Addr()))
+	r := newReconciler(mb)
+
+	if err := r.ReconcileKind(context.Background(), mb); err != nil {
+		t.Fatal("ReconcileKind() =", err)
+	}
+	if c := reachable(t, mb); !c.IsTrue() {
+		t.Errorf("Reachable = %s %s: %s, want True", c.Status, c.Reason, c.Message)
+	}
+
+	b.Close()
+	if err := r.ReconcileKind(context.Background(), mb); err != nil {
+		t.Fatal("ReconcileKind() =", err)
+	}
+	if c := reachable(t, mb); !c.IsFalse() || c.Reason != "ConnectFailed" {
+		t.Errorf("Reachable = %s %s: %s, want False ConnectFailed", c.Status, c.Reason, c.Message)
+	}
+}
+
+func TestProbesWithTheCredentials(t *testing.T) {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: testNS, Name: "mosquitto-auth"},
+		Data:       map[string][]byte{"username": []byte("user"), "password": []byte("wrong")},
+	}
+	mb := NewMQTTBroker(mbName, testNS, withPassword(secret.Name))
+	r := newReconciler(mb, secret)
+	r.connect = func(ctx context.Context, c *mqtt.Config, router paho.Router) (*mqtt.Conn, error) {
+		if c.Username != "user" || c.Password != "wrong" {
+			t.Errorf("Connected as %q:%q, want user:wrong", c.Username, c.Password)
+		}
+		return nil, &mqtt.RefusedError{Address: c.Address, ReasonCode: 0x86, Reason: "Bad User Name or Password"}
+	}
+
+	if err := r.ReconcileKind(context.Background(), mb); err != nil {
+		t.Fatal("ReconcileKind() =", err)
+	}
+	if c := reachable(t, mb); !c.IsFalse() || c.Reason != "Unauthorized" {
+		t.Errorf("Reachable = %s %s: %s, want False Unauthorized", c.Status, c.Reason, c.Message)
+	}
+}
+
+func TestReportsMissingSecrets(t *testing.T) {
+	mb := NewMQTTBroker(mbName, testNS, withPassword("missing"))
+	r := newReconciler(mb)
+	r.connect = func(context.Context, *mqtt.Config, paho.Router) (*mqtt.Conn, error) {
+		t.Error("Connected without the credentials")
+		return nil, nil
+	}
+
+	if err := r.ReconcileKind(context.Background(), mb); err != nil {
+		t.Fatal("ReconcileKind() =", err)
+	}
+	if c := reachable(t, mb); !c.IsFalse() || c.Reason != "SecretsNotResolved" {
+		t.Errorf("Reachable = %s %s: %s, want False SecretsNotResolved", c.Status, c.Reason, c.Message)
+	}
+}
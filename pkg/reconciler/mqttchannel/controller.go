@@ -0,0 +1,76 @@
+/*
+Copyright 2019 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mqttchannel
+
+import (
+	"context"
+
+	"k8s.io/client-go/tools/cache"
+	kubeclient "knative.dev/pkg/client/injection/kube/client"
+	serviceinformer "knative.dev/pkg/client/injection/kube/informers/core/v1/service"
+	"knative.dev/pkg/configmap"
+	"knative.dev/pkg/controller"
+	"knative.dev/pkg/logging"
+	"knative.dev/pkg/system"
+	"knative.dev/pkg/tracker"
+
+	"github.com/ShixiongQi/brokerchannel/pkg/apis/samples/v1beta1"
+	mqttbrokerinformer "github.com/ShixiongQi/brokerchannel/pkg/client/injection/informers/samples/v1beta1/mqttbroker"
+	mqttchannelinformer "github.com/ShixiongQi/brokerchannel/pkg/client/injection/informers/samples/v1beta1/mqttchannel"
+	mqttchannelreconciler "github.com/ShixiongQi/brokerchannel/pkg/client/injection/reconciler/samples/v1beta1/mqttchannel"
+)
+
+// DispatcherService is the Service of the MQTTChannel dispatcher, in the
+// system namespace.
+const DispatcherService = "mqtt-ch-dispatcher"
+
+// NewController initializes the controller and is called by the generated code
+// Registers event handlers to enqueue events
+func NewController(
+	ctx context.Context,
+	cmw configmap.Watcher,
+) *controller.Impl {
+	mqttChannelInformer := mqttchannelinformer.Get(ctx)
+	mqttBrokerInformer := mqttbrokerinformer.Get(ctx)
+	serviceInformer := serviceinformer.Get(ctx)
+
+	r := &Reconciler{
+		kubeClientSet:       kubeclient.Get(ctx),
+		serviceLister:       serviceInformer.Lister(),
+		mqttBrokerLister:    mqttBrokerInformer.Lister(),
+		dispatcherNamespace: system.Namespace(),
+		dispatcherService:   DispatcherService,
+	}
+	impl := mqttchannelreconciler.NewImpl(ctx, r)
+
+	logging.FromContext(ctx).Info("Setting up event handlers")
+	mqttChannelInformer.Informer().AddEventHandler(controller.HandleAll(impl.Enqueue))
+
+	// Reconcile an MQTTChannel when its Service changes.
+	serviceInformer.Informer().AddEventHandler(cache.FilteringResourceEventHandler{
+		FilterFunc: controller.FilterControllerGVK(v1beta1.SchemeGroupVersion.WithKind("MQTTChannel")),
+		Handler:    controller.HandleAll(impl.EnqueueControllerOf),
+	})
+
+	// Reconcile the MQTTChannels referencing an MQTTBroker when it changes.
+	r.tracker = tracker.New(impl.EnqueueKey, controller.GetTrackerLease(ctx))
+	mqttBrokerInformer.Informer().AddEventHandler(controller.HandleAll(
+		controller.EnsureTypeMeta(r.tracker.OnChanged, v1beta1.SchemeGroupVersion.WithKind("MQTTBroker")),
+	))
+
+	return impl
+}
@@ -0,0 +1,122 @@
+/*
+Copyright 2019 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dispatcher
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/cache"
+	"knative.dev/eventing/pkg/channel"
+	"knative.dev/pkg/client/injection/kube/informers/core/v1/secret"
+	"knative.dev/pkg/configmap"
+	"knative.dev/pkg/controller"
+	"knative.dev/pkg/logging"
+	"knative.dev/pkg/tracing"
+	tracingconfig "knative.dev/pkg/tracing/config"
+	"knative.dev/pkg/tracker"
+
+	"github.com/ShixiongQi/brokerchannel/pkg/apis/samples/v1beta1"
+	samplesclient "github.com/ShixiongQi/brokerchannel/pkg/client/injection/client"
+	mqttbrokerinformer "github.com/ShixiongQi/brokerchannel/pkg/client/injection/informers/samples/v1beta1/mqttbroker"
+	mqttchannelinformer "github.com/ShixiongQi/brokerchannel/pkg/client/injection/informers/samples/v1beta1/mqttchannel"
+	mqttchannelreconciler "github.com/ShixiongQi/brokerchannel/pkg/client/injection/reconciler/samples/v1beta1/mqttchannel"
+	"github.com/ShixiongQi/brokerchannel/pkg/mqtt/resolver"
+)
+
+// NewController initializes the dispatcher controller and starts the ingress
+// of the channels.
+func NewController(
+	ctx context.Context,
+	cmw configmap.Watcher,
+) *controller.Impl {
+	logger := logging.FromContext(ctx)
+	if err := tracing.SetupDynamicPublishing(logger, cmw, "mqtt-ch-dispatcher", tracingconfig.ConfigName); err != nil {
+		logger.Fatalw("Error setting up trace publishing", zap.Error(err))
+	}
+	mqttChannelInformer := mqttchannelinformer.Get(ctx)
+	mqttBrokerInformer := mqttbrokerinformer.Get(ctx)
+	secretInformer := secret.Get(ctx)
+
+	var impl *controller.Impl
+	d := NewDispatcher(logger.Desugar(), func(key types.NamespacedName) {
+		// Reconnect the channel.
+		impl.EnqueueKey(key)
+	})
+	r := &Reconciler{
+		clientSet: samplesclient.Get(ctx),
+		resolver: &resolver.Resolver{
+			Brokers: mqttBrokerInformer.Lister(),
+			Secrets: secretInformer.Lister(),
+		},
+		dispatcher: d,
+	}
+	impl = mqttchannelreconciler.NewImpl(ctx, r, func(impl *controller.Impl) controller.Options {
+		return controller.Options{SkipStatusUpdates: true}
+	})
+
+	logger.Info("Setting up event handlers")
+	mqttChannelInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    impl.Enqueue,
+		UpdateFunc: controller.PassNew(impl.Enqueue),
+		DeleteFunc: func(obj interface{}) {
+			if mc, ok := obj.(*v1beta1.MQTTChannel); ok {
+				d.DeleteChannel(types.NamespacedName{Namespace: mc.Namespace, Name: mc.Name})
+			}
+		},
+	})
+	// Reconnect the channels of an MQTTBroker when it changes.
+	mqttBrokerInformer.Informer().AddEventHandler(controller.HandleAll(func(obj interface{}) {
+		mb, ok := obj.(*v1beta1.MQTTBroker)
+		if !ok {
+			return
+		}
+		mcs, err := mqttChannelInformer.Lister().MQTTChannels(mb.Namespace).List(labels.Everything())
+		if err != nil {
+			logger.Errorw("Failed to list MQTTChannels", zap.Error(err))
+			return
+		}
+		for _, mc := range mcs {
+			if mc.Spec.BrokerRef != nil && mc.Spec.BrokerRef.Name == mb.Name {
+				impl.Enqueue(mc)
+			}
+		}
+	}))
+
+	// Reconnect the channels when a secret of their MQTTBroker changes.
+	r.resolver.Tracker = tracker.New(impl.EnqueueKey, controller.GetTrackerLease(ctx))
+	secretInformer.Informer().AddEventHandler(controller.HandleAll(
+		controller.EnsureTypeMeta(r.resolver.Tracker.OnChanged, corev1.SchemeGroupVersion.WithKind("Secret")),
+	))
+
+	reporter := channel.NewStatsReporter("mqtt-ch-dispatcher", "mqtt-ch-dispatcher")
+	receiver, err := channel.NewMessageReceiver(d.Receive, logger.Desugar(), reporter,
+		channel.ResolveMessageChannelFromHostHeader(d.HostToChannel))
+	if err != nil {
+		logger.Fatalw("Failed to create the ingress", zap.Error(err))
+	}
+	go func() {
+		if err := receiver.Start(ctx); err != nil {
+			logger.Fatalw("Failed to start the ingress", zap.Error(err))
+		}
+	}()
+
+	return impl
+}
@@ -0,0 +1,236 @@
+/*
+Copyright 2019 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dispatcher
+
+import (
+	"context"
+	"fmt"
+	nethttp "net/http"
+	"sync"
+
+	"github.com/cloudevents/sdk-go/v2/binding"
+	"github.com/eclipse/paho.golang/paho"
+	"go.uber.org/zap"
+	"k8s.io/apimachinery/pkg/types"
+	"knative.dev/eventing/pkg/channel"
+	"knative.dev/eventing/pkg/channel/fanout"
+	"knative.dev/eventing/pkg/tracing"
+
+	"github.com/ShixiongQi/brokerchannel/pkg/mqtt"
+)
+
+// channelQoS is the quality of service used to publish and consume the
+// events of the channels.
+const channelQoS = 1
+
+// Dispatcher publishes the events received by the ingress of the channels to
+// their MQTT topic, and fans the events of the topics out to the subscribers.
+type Dispatcher struct {
+	dispatcher channel.MessageDispatcher
+	logger     *zap.Logger
+
+	// lost is called with the key of a channel whose connection was lost.
+	lost func(types.NamespacedName)
+
+	mu       sync.RWMutex
+	channels map[types.NamespacedName]*channelHandler
+	hosts    map[string]types.NamespacedName
+}
+
+// channelHandler holds the MQTT session of a channel.
+type channelHandler struct {
+	cfg   mqtt.Config
+	topic string
+	conn  *mqtt.Conn
+
+	mu   sync.RWMutex
+	subs []fanout.Subscription
+}
+
+// NewDispatcher returns a Dispatcher calling lost when the connection of a
+// channel to its broker is lost.
+func NewDispatcher(logger *zap.Logger, lost func(types.NamespacedName)) *Dispatcher {
+	return &Dispatcher{
+		dispatcher: channel.NewMessageDispatcher(logger),
+		logger:     logger,
+		lost:       lost,
+		channels:   make(map[types.NamespacedName]*channelHandler),
+		hosts:      make(map[string]types.NamespacedName),
+	}
+}
+
+// SetChannel connects the channel key, reachable on host, to the broker
+// described by cfg and fans the events of topic out to subs. The connection
+// is reused as long as cfg and topic do not change, and its session, when
+// cfg has a SessionExpiry, is resumed after the connection was lost.
+func (d *Dispatcher) SetChannel(ctx context.Context, key types.NamespacedName, host string, cfg *mqtt.Config, topic string, subs []fanout.Subscription) error {
+	d.mu.RLock()
+	h, ok := d.channels[key]
+	d.mu.RUnlock()
+
+	if ok && (h.cfg != *cfg || h.topic != topic) {
+		// The session is subscribed to the previous topic.
+		d.DeleteChannel(key)
+		ok = false
+	} else if ok && isClosed(h.conn) {
+		d.closeChannel(key, false)
+		ok = false
+	}
+	if !ok {
+		h = &channelHandler{cfg: *cfg, topic: topic, subs: subs}
+		// The events are acknowledged once dispatched, so that the broker
+		// sends those in flight again when the session is resumed.
+		conn, err := mqtt.ConnectWithAcks(ctx, cfg, func(m *paho.Publish, ack func()) {
+			d.dispatch(key, h, m)
+			ack()
+		})
+		if err != nil {
+			return fmt.Errorf("failed to connect to %s: %w", cfg.Address, err)
+		}
+		h.conn = conn
+		if _, err := conn.Subscribe(ctx, &paho.Subscribe{Subscriptions: map[string]paho.SubscribeOptions{
+			topic: {QoS: channelQoS},
+		}}); err != nil {
+			conn.Close()
+			return fmt.Errorf("failed to subscribe to %s: %w", topic, err)
+		}
+		go func() {
+			<-conn.Done()
+			d.lost(key)
+		}()
+	}
+
+	h.mu.Lock()
+	h.subs = subs
+	h.mu.Unlock()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.channels[key] = h
+	for hh, k := range d.hosts {
+		if k == key {
+			delete(d.hosts, hh)
+		}
+	}
+	d.hosts[host] = key
+	return nil
+}
+
+// DeleteChannel disconnects the channel key from its broker, and discards
+// its session.
+func (d *Dispatcher) DeleteChannel(key types.NamespacedName) {
+	d.closeChannel(key, true)
+}
+
+// closeChannel disconnects the channel key from its broker, and discards its
+// session when end is true.
+func (d *Dispatcher) closeChannel(key types.NamespacedName, end bool) {
+	d.mu.Lock()
+	h, ok := d.channels[key]
+	delete(d.channels, key)
+	for host, k := range d.hosts {
+		if k == key {
+			delete(d.hosts, host)
+		}
+	}
+	d.mu.Unlock()
+	switch {
+	case ok && end:
+		h.conn.End()
+	case ok:
+		h.conn.Close()
+	}
+}
+
+// HostToChannel resolves the channel addressed by host, for the ingress.
+func (d *Dispatcher) HostToChannel(host string) (channel.ChannelReference, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	key, ok := d.hosts[host]
+	if !ok {
+		return channel.ChannelReference{}, channel.UnknownHostError(host)
+	}
+	return channel.ChannelReference{Namespace: key.Namespace, Name: key.Name}, nil
+}
+
+// Receive publishes an event received by the ingress of a channel.
+func (d *Dispatcher) Receive(ctx context.Context, ref channel.ChannelReference, m binding.Message, transformers []binding.Transformer, _ nethttp.Header) error {
+	d.mu.RLock()
+	h, ok := d.channels[types.NamespacedName{Namespace: ref.Namespace, Name: ref.Name}]
+	d.mu.RUnlock()
+	if !ok {
+		return &channel.UnknownChannelError{Channel: ref}
+	}
+
+	event, err := binding.ToEvent(ctx, m, transformers...)
+	if err != nil {
+		return err
+	}
+	pub, err := mqtt.EncodeEvent(h.topic, event)
+	if err != nil {
+		return err
+	}
+	pub.QoS = channelQoS
+	mqtt.InjectSpanContext(ctx, pub)
+	if _, err := h.conn.Publish(ctx, pub); err != nil {
+		return fmt.Errorf("failed to publish to %s: %w", h.topic, err)
+	}
+	return nil
+}
+
+// dispatch sends an event read from the topic of a channel to every
+// subscriber, with their reply and dead letter sinks, and returns once they
+// all have been dispatched.
+func (d *Dispatcher) dispatch(key types.NamespacedName, h *channelHandler, m *paho.Publish) {
+	logger := d.logger.With(zap.String("channel", key.String()))
+	event, err := mqtt.DecodeEvent(m)
+	if err != nil {
+		logger.Warn("Dropping a message which is not an event", zap.Error(err))
+		return
+	}
+
+	h.mu.RLock()
+	subs := h.subs
+	h.mu.RUnlock()
+
+	ctx, span := mqtt.StartSpan(context.Background(), "channel:"+key.Name+"."+key.Namespace, m)
+	defer span.End()
+	span.AddAttributes(tracing.MessagingMessageIDAttribute(event.ID()))
+
+	var wg sync.WaitGroup
+	for _, sub := range subs {
+		wg.Add(1)
+		go func(sub fanout.Subscription) {
+			defer wg.Done()
+			// An EventMessage can be read any number of times.
+			msg := binding.ToMessage(event)
+			if _, err := d.dispatcher.DispatchMessageWithRetries(ctx, msg, nil, sub.Subscriber, sub.Reply, sub.DeadLetter, sub.RetryConfig); err != nil {
+				logger.Warn("Failed to dispatch an event", zap.String("id", event.ID()), zap.Error(err))
+			}
+		}(sub)
+	}
+	wg.Wait()
+}
+
+func isClosed(c *mqtt.Conn) bool {
+	select {
+	case <-c.Done():
+		return true
+	default:
+		return false
+	}
+}
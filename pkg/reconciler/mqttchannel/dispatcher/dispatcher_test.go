@@ -0,0 +1,91 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dispatcher
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"go.uber.org/zap"
+	"k8s.io/apimachinery/pkg/types"
+	"knative.dev/eventing/pkg/channel/fanout"
+
+	"github.com/ShixiongQi/brokerchannel/pkg/mqtt"
+	"github.com/ShixiongQi/brokerchannel/pkg/mqtttest"
+)
+
+func TestAcknowledgesDispatchedEvents(t *testing.T) {
+	b := mqtttest.NewBroker(t)
+	sink := mqtttest.NewSink(t)
+	d := NewDispatcher(zap.NewNop(), func(types.NamespacedName) {})
+	key := types.NamespacedName{Namespace: "default", Name: "orders"}
+	const topic = "knative/channels/default/orders"
+	cfg := &mqtt.Config{Address: b.Addr(), KeepAlive: 30, ClientID: "mqttchannel-orders", SessionExpiry: 60}
+	subs := []fanout.Subscription{{Subscriber: sink.URL().URL()}}
+	setChannel := func() {
+		t.Helper()
+		if err := d.SetChannel(context.Background(), key, "orders.default.svc", cfg, topic, subs); err != nil {
+			t.Fatal("SetChannel() =", err)
+		}
+	}
+	setChannel()
+	t.Cleanup(func() { d.DeleteChannel(key) })
+	b.WaitForSubscription(t, topic)
+
+	// The event is left unacknowledged while it is dispatched, and the
+	// broker keeps it when the connection is lost.
+	sink.SetDelay(300 * time.Millisecond)
+	event := cloudevents.NewEvent()
+	event.SetID("1")
+	event.SetSource("/orders")
+	event.SetType("dev.knative.order")
+	pub, err := mqtt.EncodeEvent(topic, &event)
+	if err != nil {
+		t.Fatal("EncodeEvent() =", err)
+	}
+	b.Publish(topic, channelQoS, pub.Payload, pub.Properties.User)
+	b.WaitForUnacked(t, 1)
+	time.Sleep(100 * time.Millisecond)
+	if n := b.Unacked(); n != 1 {
+		t.Fatalf("Unacked() = %d while the event is dispatched, want 1", n)
+	}
+	d.mu.RLock()
+	conn := d.channels[key].conn
+	d.mu.RUnlock()
+	b.DropConnections()
+	b.WaitForStored(t, cfg.ClientID)
+	select {
+	case <-conn.Done():
+	case <-time.After(mqtttest.Timeout):
+		t.Fatal("Timed out waiting for the connection to close")
+	}
+	if e := sink.Next(t); e.ID() != "1" {
+		t.Errorf("Sink received %q, want 1", e.ID())
+	}
+
+	// The resumed session sends it again, and it is acknowledged once
+	// dispatched.
+	sink.SetDelay(0)
+	setChannel()
+	if e := sink.Next(t); e.ID() != "1" {
+		t.Errorf("Sink received %q, want 1", e.ID())
+	}
+	b.WaitForUnacked(t, 0)
+	sink.ExpectNone(t, 200*time.Millisecond)
+}
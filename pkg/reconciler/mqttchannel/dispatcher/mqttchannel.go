@@ -0,0 +1,132 @@
+/*
+Copyright 2019 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dispatcher
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	eventingduckv1 "knative.dev/eventing/pkg/apis/duck/v1"
+	"knative.dev/eventing/pkg/channel/fanout"
+	"knative.dev/pkg/apis/duck"
+	"knative.dev/pkg/logging"
+	pkgreconciler "knative.dev/pkg/reconciler"
+
+	"github.com/ShixiongQi/brokerchannel/pkg/apis/samples/v1beta1"
+	clientset "github.com/ShixiongQi/brokerchannel/pkg/client/clientset/versioned"
+	"github.com/ShixiongQi/brokerchannel/pkg/mqtt"
+	"github.com/ShixiongQi/brokerchannel/pkg/mqtt/resolver"
+)
+
+// sessionExpiry is how long the broker keeps the session of a channel, and
+// queues its events, once the dispatcher is disconnected.
+const sessionExpiry = 10 * time.Minute
+
+// Reconciler connects the MQTTChannels to their broker and reports the
+// readiness of their subscribers.
+type Reconciler struct {
+	clientSet  clientset.Interface
+	resolver   *resolver.Resolver
+	dispatcher *Dispatcher
+}
+
+func (r *Reconciler) ReconcileKind(ctx context.Context, mc *v1beta1.MQTTChannel) pkgreconciler.Event {
+	if mc.Status.Address == nil || mc.Status.Address.URL == nil {
+		// The controller has not given the channel an address yet.
+		return nil
+	}
+
+	cfg, err := r.resolver.Resolve(ctx, mc, mc.Namespace, mc.Spec.Broker, mc.Spec.BrokerRef)
+	if err != nil {
+		return err
+	}
+	subs, err := fanoutSubscriptions(mc)
+	if err != nil {
+		return err
+	}
+
+	persist(cfg, mc)
+	key := types.NamespacedName{Namespace: mc.Namespace, Name: mc.Name}
+	if err := r.dispatcher.SetChannel(ctx, key, mc.Status.Address.URL.Host, cfg, mc.Spec.Topic, subs); err != nil {
+		return err
+	}
+	return r.patchSubscribersStatus(ctx, mc)
+}
+
+// persist makes the session of mc outlive its connection, under a client
+// identifier of its own, so that the events published while the dispatcher
+// reconnects or restarts are dispatched once it resumes the session.
+func persist(cfg *mqtt.Config, mc *v1beta1.MQTTChannel) {
+	cfg.ClientID = "mqttchannel-" + string(mc.UID)
+	cfg.SessionExpiry = uint32(sessionExpiry / time.Second)
+}
+
+// fanoutSubscriptions returns the delivery configuration of the subscribers
+// of mc. Subscribers without their own delivery spec fall back to the one of
+// the channel, if it has a resolved dead letter sink.
+func fanoutSubscriptions(mc *v1beta1.MQTTChannel) ([]fanout.Subscription, error) {
+	subs := make([]fanout.Subscription, 0, len(mc.Spec.Subscribers))
+	for _, sub := range mc.Spec.Subscribers {
+		if sub.Delivery == nil && mc.Spec.Delivery != nil &&
+			mc.Spec.Delivery.DeadLetterSink != nil && mc.Spec.Delivery.DeadLetterSink.URI != nil {
+			sub.Delivery = mc.Spec.Delivery
+		}
+		conf, err := fanout.SubscriberSpecToFanoutConfig(sub)
+		if err != nil {
+			return nil, err
+		}
+		subs = append(subs, *conf)
+	}
+	return subs, nil
+}
+
+func (r *Reconciler) patchSubscribersStatus(ctx context.Context, mc *v1beta1.MQTTChannel) error {
+	after := mc.DeepCopy()
+
+	after.Status.Subscribers = make([]eventingduckv1.SubscriberStatus, 0, len(mc.Spec.Subscribers))
+	for _, sub := range mc.Spec.Subscribers {
+		after.Status.Subscribers = append(after.Status.Subscribers, eventingduckv1.SubscriberStatus{
+			UID:                sub.UID,
+			ObservedGeneration: sub.Generation,
+			Ready:              corev1.ConditionTrue,
+		})
+	}
+	jsonPatch, err := duck.CreatePatch(mc, after)
+	if err != nil {
+		return fmt.Errorf("creating JSON patch: %w", err)
+	}
+	// An empty patch is [], there is nothing to do.
+	if len(jsonPatch) == 0 {
+		return nil
+	}
+
+	patch, err := jsonPatch.MarshalJSON()
+	if err != nil {
+		return fmt.Errorf("marshaling JSON patch: %w", err)
+	}
+	_, err = r.clientSet.SamplesV1beta1().MQTTChannels(mc.Namespace).Patch(ctx, mc.Name, types.JSONPatchType, patch, metav1.PatchOptions{}, "status")
+	if err != nil {
+		return fmt.Errorf("failed patching: %w", err)
+	}
+	logging.FromContext(ctx).Debugw("Patched subscribers status", zap.ByteString("patch", patch))
+	return nil
+}
@@ -0,0 +1,118 @@
+/*
+Copyright 2019 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mqttchannel
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"knative.dev/pkg/apis"
+	"knative.dev/pkg/network"
+	pkgreconciler "knative.dev/pkg/reconciler"
+	"knative.dev/pkg/tracker"
+
+	"github.com/ShixiongQi/brokerchannel/pkg/apis/samples/v1beta1"
+	listers "github.com/ShixiongQi/brokerchannel/pkg/client/listers/samples/v1beta1"
+	"github.com/ShixiongQi/brokerchannel/pkg/reconciler/mqttchannel/resources"
+)
+
+// Reconciler gives MQTTChannels an address served by the dispatcher. The
+// dispatcher itself connects the channels to their broker.
+type Reconciler struct {
+	kubeClientSet    kubernetes.Interface
+	serviceLister    corev1listers.ServiceLister
+	mqttBrokerLister listers.MQTTBrokerLister
+	tracker          tracker.Interface
+
+	dispatcherNamespace string
+	dispatcherService   string
+}
+
+func (r *Reconciler) ReconcileKind(ctx context.Context, mc *v1beta1.MQTTChannel) pkgreconciler.Event {
+	mc.Status.InitializeConditions()
+
+	if err := r.reconcileBroker(ctx, mc); err != nil {
+		return err
+	}
+
+	svc, err := r.reconcileChannelService(ctx, mc)
+	if err != nil {
+		mc.Status.MarkChannelServiceFailed("ChannelServiceFailed", "%s", err)
+		return err
+	}
+	mc.Status.MarkChannelServiceTrue()
+	mc.Status.SetAddress(&apis.URL{
+		Scheme: "http",
+		Host:   network.GetServiceHostname(svc.Name, svc.Namespace),
+	})
+
+	mc.Status.ObservedGeneration = mc.Generation
+	return nil
+}
+
+// reconcileBroker reflects the readiness of the MQTTBroker referenced by mc.
+// Inline brokers are not probed.
+func (r *Reconciler) reconcileBroker(ctx context.Context, mc *v1beta1.MQTTChannel) error {
+	if mc.Spec.BrokerRef == nil {
+		mc.Status.MarkBrokerReady()
+		return nil
+	}
+
+	ref := tracker.Reference{
+		APIVersion: v1beta1.SchemeGroupVersion.String(),
+		Kind:       "MQTTBroker",
+		Namespace:  mc.Namespace,
+		Name:       mc.Spec.BrokerRef.Name,
+	}
+	if err := r.tracker.TrackReference(ref, mc); err != nil {
+		return err
+	}
+
+	mb, err := r.mqttBrokerLister.MQTTBrokers(mc.Namespace).Get(mc.Spec.BrokerRef.Name)
+	if apierrors.IsNotFound(err) {
+		// The tracker enqueues mc again once the MQTTBroker is created.
+		mc.Status.MarkNoBroker("NotFound", "MQTTBroker %q does not exist", mc.Spec.BrokerRef.Name)
+		return nil
+	} else if err != nil {
+		return err
+	}
+	mc.Status.PropagateBrokerStatus(&mb.Status)
+	return nil
+}
+
+func (r *Reconciler) reconcileChannelService(ctx context.Context, mc *v1beta1.MQTTChannel) (*corev1.Service, error) {
+	expected := resources.MakeChannelService(mc, r.dispatcherNamespace, r.dispatcherService)
+
+	svc, err := r.serviceLister.Services(mc.Namespace).Get(expected.Name)
+	if apierrors.IsNotFound(err) {
+		return r.kubeClientSet.CoreV1().Services(mc.Namespace).Create(ctx, expected, metav1.CreateOptions{})
+	} else if err != nil {
+		return nil, err
+	} else if !metav1.IsControlledBy(svc, mc) {
+		return nil, fmt.Errorf("service %q is not owned by MQTTChannel %q", svc.Name, mc.Name)
+	} else if svc.Spec.ExternalName != expected.Spec.ExternalName || svc.Spec.Type != expected.Spec.Type {
+		svc = svc.DeepCopy()
+		svc.Spec = expected.Spec
+		return r.kubeClientSet.CoreV1().Services(mc.Namespace).Update(ctx, svc, metav1.UpdateOptions{})
+	}
+	return svc, nil
+}
@@ -0,0 +1,58 @@
+/*
+Copyright 2019 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"knative.dev/pkg/kmeta"
+	"knative.dev/pkg/network"
+
+	"github.com/ShixiongQi/brokerchannel/pkg/apis/samples/v1beta1"
+)
+
+const (
+	// MessagingRoleLabel and MessagingRole label the Services of channels.
+	MessagingRoleLabel = "messaging.knative.dev/role"
+	MessagingRole      = "mqtt-channel"
+)
+
+// ChannelServiceName is the name of the Service addressing a channel.
+func ChannelServiceName(name string) string {
+	return kmeta.ChildName(name, "-kn-channel")
+}
+
+// MakeChannelService returns the Service giving mc its own host name. It
+// points to the dispatcher Service, which tells the channels apart by host.
+func MakeChannelService(mc *v1beta1.MQTTChannel, dispatcherNamespace, dispatcherService string) *corev1.Service {
+	return &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      ChannelServiceName(mc.Name),
+			Namespace: mc.Namespace,
+			Labels: map[string]string{
+				MessagingRoleLabel: MessagingRole,
+			},
+			OwnerReferences: []metav1.OwnerReference{
+				*kmeta.NewControllerRef(mc),
+			},
+		},
+		Spec: corev1.ServiceSpec{
+			Type:         corev1.ServiceTypeExternalName,
+			ExternalName: network.GetServiceHostname(dispatcherService, dispatcherNamespace),
+		},
+	}
+}
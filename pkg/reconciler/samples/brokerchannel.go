@@ -2,12 +2,20 @@ package samples
 
 import (
 	"context"
+	"encoding/json"
 
-	v1alpha1 "github.com/ShixiongQi/brokerchannel/pkg/apis/samples/v1alpha1"
+	"github.com/ShixiongQi/brokerchannel/pkg/apis/samples/v1beta1"
+	listers "github.com/ShixiongQi/brokerchannel/pkg/client/listers/samples/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/client-go/dynamic"
 	sourcesv1 "knative.dev/eventing/pkg/apis/sources/v1"
+	"go.uber.org/zap"
+	"knative.dev/pkg/apis"
+	duckv1 "knative.dev/pkg/apis/duck/v1"
+	"knative.dev/pkg/logging"
 	pkgreconciler "knative.dev/pkg/reconciler"
 	"knative.dev/pkg/resolver"
+	"knative.dev/pkg/tracker"
 )
 
 type Reconciler struct {
@@ -15,12 +23,44 @@ type Reconciler struct {
 	// dynamicClientSet allows us to configure pluggable Build objects
 	dynamicClientSet dynamic.Interface
 	sinkResolver *resolver.URIResolver
+
+	// mqttBrokerLister resolves the brokerRef of BrokerChannels, which are
+	// tracked to be reconciled again when their MQTTBroker changes.
+	mqttBrokerLister listers.MQTTBrokerLister
+	tracker          tracker.Interface
 }
 
-func (r *Reconciler) ReconcileKind(ctx context.Context, bc *v1alpha1.BrokerChannel) pkgreconciler.Event {
+func (r *Reconciler) ReconcileKind(ctx context.Context, bc *v1beta1.BrokerChannel) pkgreconciler.Event {
 	bc.Status.InitializeConditions()
 	ctx = sourcesv1.WithURIResolver(ctx, r.sinkResolver)
-	dest := bc.Spec.Sink.DeepCopy()
+	reconcileDataPlaneStatus(ctx, bc)
+
+	if err := r.reconcileBroker(ctx, bc); err != nil {
+		return err
+	}
+
+	uri, err := r.resolveDestination(ctx, bc, bc.Spec.Sink)
+	if err != nil {
+		bc.Status.MarkNoSink("NotFound", "%s", err)
+		return err
+	}
+	bc.Status.MarkSink(uri)
+
+	if err := r.reconcileRoutes(ctx, bc); err != nil {
+		return err
+	}
+
+	if err := r.reconcileDeadLetterSink(ctx, bc); err != nil {
+		return err
+	}
+
+	bc.Status.ObservedGeneration = bc.Generation
+	return nil
+}
+
+// resolveDestination returns the URI of dest, a destination of bc.
+func (r *Reconciler) resolveDestination(ctx context.Context, bc *v1beta1.BrokerChannel, dest duckv1.Destination) (*apis.URL, error) {
+	dest = *dest.DeepCopy()
 	if dest.Ref != nil {
 		// To call URIFromDestination(), dest.Ref must have a Namespace. If there is
 		// no Namespace defined in dest.Ref, we will use the Namespace of the source
@@ -29,15 +69,83 @@ func (r *Reconciler) ReconcileKind(ctx context.Context, bc *v1alpha1.BrokerChann
 			dest.Ref.Namespace = bc.GetNamespace()
 		}
 	}
+	return r.sinkResolver.URIFromDestinationV1(ctx, dest, bc)
+}
+
+// reconcileRoutes resolves the destinations of the routes of bc into its
+// status.
+func (r *Reconciler) reconcileRoutes(ctx context.Context, bc *v1beta1.BrokerChannel) error {
+	var routes []v1beta1.RouteStatus
+	for _, route := range bc.Spec.Routes {
+		uri, err := r.resolveDestination(ctx, bc, route.Destination)
+		if err != nil {
+			bc.Status.MarkNoRoutes(routes, "NotFound", "route %q: %s", route.Name, err)
+			return err
+		}
+		routes = append(routes, v1beta1.RouteStatus{Name: route.Name, URI: uri})
+	}
+	bc.Status.MarkRoutes(routes)
+	return nil
+}
 
-	uri, err := r.sinkResolver.URIFromDestinationV1(ctx, *dest, bc)
+// reconcileDeadLetterSink resolves the dead letter sink of bc, if any, into
+// its status.
+func (r *Reconciler) reconcileDeadLetterSink(ctx context.Context, bc *v1beta1.BrokerChannel) error {
+	if bc.Spec.DeadLetterSink == nil {
+		bc.Status.MarkDeadLetterSink(nil)
+		return nil
+	}
+	uri, err := r.resolveDestination(ctx, bc, *bc.Spec.DeadLetterSink)
 	if err != nil {
-		bc.Status.MarkNoSink("NotFound", "%s", err)
+		bc.Status.MarkNoDeadLetterSink("NotFound", "%s", err)
 		return err
 	}
-
-	bc.Status.MarkSink(uri)
-	bc.Status.ObservedGeneration = bc.Generation
+	bc.Status.MarkDeadLetterSink(uri)
 	return nil
 }
 
+// reconcileDataPlaneStatus copies the status reported by the data plane in
+// the annotations of bc into its status.
+func reconcileDataPlaneStatus(ctx context.Context, bc *v1beta1.BrokerChannel) {
+	a, ok := bc.Annotations[v1beta1.DataPlaneStatusAnnotation]
+	if !ok {
+		bc.Status.PropagateDataPlaneStatus(nil)
+		return
+	}
+	dps := &v1beta1.DataPlaneStatus{}
+	if err := json.Unmarshal([]byte(a), dps); err != nil {
+		logging.FromContext(ctx).Warnw("Invalid data plane status", zap.Error(err))
+		return
+	}
+	bc.Status.PropagateDataPlaneStatus(dps)
+}
+
+// reconcileBroker reflects the readiness of the MQTTBroker referenced by bc.
+// Inline brokers are not probed.
+func (r *Reconciler) reconcileBroker(ctx context.Context, bc *v1beta1.BrokerChannel) error {
+	if bc.Spec.BrokerRef == nil {
+		bc.Status.MarkBrokerReady()
+		return nil
+	}
+
+	ref := tracker.Reference{
+		APIVersion: v1beta1.SchemeGroupVersion.String(),
+		Kind:       "MQTTBroker",
+		Namespace:  bc.Namespace,
+		Name:       bc.Spec.BrokerRef.Name,
+	}
+	if err := r.tracker.TrackReference(ref, bc); err != nil {
+		return err
+	}
+
+	mb, err := r.mqttBrokerLister.MQTTBrokers(bc.Namespace).Get(bc.Spec.BrokerRef.Name)
+	if apierrors.IsNotFound(err) {
+		// The tracker enqueues bc again once the MQTTBroker is created.
+		bc.Status.MarkNoBroker("NotFound", "MQTTBroker %q does not exist", bc.Spec.BrokerRef.Name)
+		return nil
+	} else if err != nil {
+		return err
+	}
+	bc.Status.PropagateBrokerStatus(&mb.Status)
+	return nil
+}
@@ -0,0 +1,421 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package samples
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgotesting "k8s.io/client-go/testing"
+	"knative.dev/pkg/apis"
+	duckv1 "knative.dev/pkg/apis/duck/v1"
+	"knative.dev/pkg/client/injection/ducks/duck/v1/addressable"
+	"knative.dev/pkg/configmap"
+	"knative.dev/pkg/controller"
+	fakedynamicclient "knative.dev/pkg/injection/clients/dynamicclient/fake"
+	"knative.dev/pkg/logging"
+	"knative.dev/pkg/resolver"
+
+	"github.com/ShixiongQi/brokerchannel/pkg/apis/samples/v1beta1"
+	fakesamplesclient "github.com/ShixiongQi/brokerchannel/pkg/client/injection/client/fake"
+	brokerchannelreconciler "github.com/ShixiongQi/brokerchannel/pkg/client/injection/reconciler/samples/v1beta1/brokerchannel"
+
+	_ "github.com/ShixiongQi/brokerchannel/pkg/client/injection/informers/samples/v1beta1/brokerchannel/fake"
+	_ "github.com/ShixiongQi/brokerchannel/pkg/client/injection/informers/samples/v1beta1/mqttbroker/fake"
+
+	. "github.com/ShixiongQi/brokerchannel/pkg/reconciler/testing"
+	. "knative.dev/pkg/reconciler/testing"
+)
+
+const (
+	testNS   = "test-namespace"
+	bcName   = "sensors"
+	mbName   = "mosquitto"
+	sinkName = "sink"
+	sinkURI  = "http://sink.test-namespace.svc.cluster.local/"
+)
+
+func TestReconcile(t *testing.T) {
+	table := TableTest{{
+		Name: "bad workqueue key",
+		// Make sure Reconcile handles bad keys.
+		Key: "too/many/parts",
+	}, {
+		Name: "key not found",
+		// Make sure Reconcile handles good keys that don't exist.
+		Key: "foo/not-found",
+	}, {
+		Name: "sink URI",
+		Objects: []runtime.Object{
+			NewBrokerChannel(bcName, testNS,
+				WithInlineBroker("mosquitto"),
+				WithSinkURI(sinkURI),
+			),
+		},
+		Key: testNS + "/" + bcName,
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: NewBrokerChannel(bcName, testNS,
+				WithInlineBroker("mosquitto"),
+				WithSinkURI(sinkURI),
+				WithInitBrokerChannelConditions,
+				WithBrokerChannelConnected,
+				WithBrokerChannelBrokerReady,
+				WithBrokerChannelSink(sinkURI),
+				WithBrokerChannelRoutes(),
+				WithBrokerChannelDeadLetterSink(""),
+			),
+		}},
+	}, {
+		Name: "sink ref defaults to the namespace of the BrokerChannel",
+		Objects: []runtime.Object{
+			NewBrokerChannel(bcName, testNS,
+				WithInlineBroker("mosquitto"),
+				WithSinkRef(SinkRef(sinkName, "")),
+			),
+			NewSink(sinkName, testNS, sinkURI),
+		},
+		Key: testNS + "/" + bcName,
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: NewBrokerChannel(bcName, testNS,
+				WithInlineBroker("mosquitto"),
+				WithSinkRef(SinkRef(sinkName, "")),
+				WithInitBrokerChannelConditions,
+				WithBrokerChannelConnected,
+				WithBrokerChannelBrokerReady,
+				WithBrokerChannelSink(sinkURI),
+				WithBrokerChannelRoutes(),
+				WithBrokerChannelDeadLetterSink(""),
+			),
+		}},
+	}, {
+		Name: "sink not found",
+		Objects: []runtime.Object{
+			NewBrokerChannel(bcName, testNS,
+				WithInlineBroker("mosquitto"),
+				WithSinkRef(SinkRef(sinkName, testNS)),
+			),
+		},
+		Key:     testNS + "/" + bcName,
+		WantErr: true,
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: NewBrokerChannel(bcName, testNS,
+				WithInlineBroker("mosquitto"),
+				WithSinkRef(SinkRef(sinkName, testNS)),
+				WithInitBrokerChannelConditions,
+				WithBrokerChannelConnected,
+				WithBrokerChannelBrokerReady,
+				WithBrokerChannelNoSink(sinkNotFound),
+			),
+		}},
+	}, {
+		Name: "routes",
+		Objects: []runtime.Object{
+			NewBrokerChannel(bcName, testNS,
+				WithInlineBroker("mosquitto"),
+				WithSinkURI(sinkURI),
+				WithRoute("alarms", "site/+/alarm", duckv1.Destination{URI: alarmsURL}),
+				WithRoute("telemetry", "site/+/telemetry", duckv1.Destination{Ref: SinkRef(sinkName, "")}),
+			),
+			NewSink(sinkName, testNS, telemetryURI),
+		},
+		Key: testNS + "/" + bcName,
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: NewBrokerChannel(bcName, testNS,
+				WithInlineBroker("mosquitto"),
+				WithSinkURI(sinkURI),
+				WithRoute("alarms", "site/+/alarm", duckv1.Destination{URI: alarmsURL}),
+				WithRoute("telemetry", "site/+/telemetry", duckv1.Destination{Ref: SinkRef(sinkName, "")}),
+				WithInitBrokerChannelConditions,
+				WithBrokerChannelConnected,
+				WithBrokerChannelBrokerReady,
+				WithBrokerChannelSink(sinkURI),
+				WithBrokerChannelRoutes(RouteStatus("alarms", alarmsURI), RouteStatus("telemetry", telemetryURI)),
+				WithBrokerChannelDeadLetterSink(""),
+			),
+		}},
+	}, {
+		Name: "route destination not found",
+		Objects: []runtime.Object{
+			NewBrokerChannel(bcName, testNS,
+				WithInlineBroker("mosquitto"),
+				WithSinkURI(sinkURI),
+				WithRoute("alarms", "site/+/alarm", duckv1.Destination{URI: alarmsURL}),
+				WithRoute("telemetry", "site/+/telemetry", duckv1.Destination{Ref: SinkRef(sinkName, "")}),
+			),
+		},
+		Key:     testNS + "/" + bcName,
+		WantErr: true,
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: NewBrokerChannel(bcName, testNS,
+				WithInlineBroker("mosquitto"),
+				WithSinkURI(sinkURI),
+				WithRoute("alarms", "site/+/alarm", duckv1.Destination{URI: alarmsURL}),
+				WithRoute("telemetry", "site/+/telemetry", duckv1.Destination{Ref: SinkRef(sinkName, "")}),
+				WithInitBrokerChannelConditions,
+				WithBrokerChannelConnected,
+				WithBrokerChannelBrokerReady,
+				WithBrokerChannelSink(sinkURI),
+				WithBrokerChannelNoRoutes(`route "telemetry": `+sinkNotFound, RouteStatus("alarms", alarmsURI)),
+			),
+		}},
+	}, {
+		Name: "dead letter sink",
+		Objects: []runtime.Object{
+			NewBrokerChannel(bcName, testNS,
+				WithInlineBroker("mosquitto"),
+				WithSinkURI(sinkURI),
+				WithDeadLetterSink(duckv1.Destination{Ref: SinkRef(sinkName, "")}),
+			),
+			NewSink(sinkName, testNS, deadLetterURI),
+		},
+		Key: testNS + "/" + bcName,
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: NewBrokerChannel(bcName, testNS,
+				WithInlineBroker("mosquitto"),
+				WithSinkURI(sinkURI),
+				WithDeadLetterSink(duckv1.Destination{Ref: SinkRef(sinkName, "")}),
+				WithInitBrokerChannelConditions,
+				WithBrokerChannelConnected,
+				WithBrokerChannelBrokerReady,
+				WithBrokerChannelSink(sinkURI),
+				WithBrokerChannelRoutes(),
+				WithBrokerChannelDeadLetterSink(deadLetterURI),
+			),
+		}},
+	}, {
+		Name: "dead letter sink not found",
+		Objects: []runtime.Object{
+			NewBrokerChannel(bcName, testNS,
+				WithInlineBroker("mosquitto"),
+				WithSinkURI(sinkURI),
+				WithDeadLetterSink(duckv1.Destination{Ref: SinkRef(sinkName, "")}),
+			),
+		},
+		Key:     testNS + "/" + bcName,
+		WantErr: true,
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: NewBrokerChannel(bcName, testNS,
+				WithInlineBroker("mosquitto"),
+				WithSinkURI(sinkURI),
+				WithDeadLetterSink(duckv1.Destination{Ref: SinkRef(sinkName, "")}),
+				WithInitBrokerChannelConditions,
+				WithBrokerChannelConnected,
+				WithBrokerChannelBrokerReady,
+				WithBrokerChannelSink(sinkURI),
+				WithBrokerChannelRoutes(),
+				WithBrokerChannelNoDeadLetterSink(sinkNotFound),
+			),
+		}},
+	}, {
+		Name: "observed generation",
+		Objects: []runtime.Object{
+			NewBrokerChannel(bcName, testNS,
+				WithInlineBroker("mosquitto"),
+				WithSinkURI(sinkURI),
+				WithBrokerChannelGeneration(42),
+			),
+		},
+		Key: testNS + "/" + bcName,
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: NewBrokerChannel(bcName, testNS,
+				WithInlineBroker("mosquitto"),
+				WithSinkURI(sinkURI),
+				WithBrokerChannelGeneration(42),
+				WithInitBrokerChannelConditions,
+				WithBrokerChannelConnected,
+				WithBrokerChannelBrokerReady,
+				WithBrokerChannelSink(sinkURI),
+				WithBrokerChannelRoutes(),
+				WithBrokerChannelDeadLetterSink(""),
+				WithBrokerChannelObservedGeneration(42),
+			),
+		}},
+	}, {
+		Name: "data plane status",
+		Objects: []runtime.Object{
+			NewBrokerChannel(bcName, testNS,
+				WithInlineBroker("mosquitto"),
+				WithSinkURI(sinkURI),
+				WithDataPlaneStatusAnnotation(dataPlaneStatus),
+			),
+		},
+		Key: testNS + "/" + bcName,
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: NewBrokerChannel(bcName, testNS,
+				WithInlineBroker("mosquitto"),
+				WithSinkURI(sinkURI),
+				WithDataPlaneStatusAnnotation(dataPlaneStatus),
+				WithInitBrokerChannelConditions,
+				WithBrokerChannelConnected,
+				WithBrokerChannelBrokerReady,
+				WithBrokerChannelSink(sinkURI),
+				WithBrokerChannelRoutes(),
+				WithBrokerChannelDeadLetterSink(""),
+				WithBrokerChannelDataPlaneStatus(dataPlaneStatus),
+			),
+		}},
+	}, {
+		Name: "data plane status cleared",
+		Objects: []runtime.Object{
+			NewBrokerChannel(bcName, testNS,
+				WithInlineBroker("mosquitto"),
+				WithSinkURI(sinkURI),
+				WithDataPlaneStatusAnnotation(&v1beta1.DataPlaneStatus{}),
+				WithBrokerChannelDataPlaneStatus(dataPlaneStatus),
+			),
+		},
+		Key: testNS + "/" + bcName,
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: NewBrokerChannel(bcName, testNS,
+				WithInlineBroker("mosquitto"),
+				WithSinkURI(sinkURI),
+				WithDataPlaneStatusAnnotation(&v1beta1.DataPlaneStatus{}),
+				WithInitBrokerChannelConditions,
+				WithBrokerChannelConnected,
+				WithBrokerChannelBrokerReady,
+				WithBrokerChannelSink(sinkURI),
+				WithBrokerChannelRoutes(),
+				WithBrokerChannelDeadLetterSink(""),
+			),
+		}},
+	}, {
+		Name: "data plane connection failed",
+		Objects: []runtime.Object{
+			NewBrokerChannel(bcName, testNS,
+				WithInlineBroker("mosquitto"),
+				WithSinkURI(sinkURI),
+				WithDataPlaneStatusAnnotation(&v1beta1.DataPlaneStatus{Error: "failed to create the client"}),
+			),
+		},
+		Key: testNS + "/" + bcName,
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: NewBrokerChannel(bcName, testNS,
+				WithInlineBroker("mosquitto"),
+				WithSinkURI(sinkURI),
+				WithDataPlaneStatusAnnotation(&v1beta1.DataPlaneStatus{Error: "failed to create the client"}),
+				WithInitBrokerChannelConditions,
+				WithBrokerChannelBrokerReady,
+				WithBrokerChannelSink(sinkURI),
+				WithBrokerChannelRoutes(),
+				WithBrokerChannelDeadLetterSink(""),
+				WithBrokerChannelDataPlaneStatus(&v1beta1.DataPlaneStatus{Error: "failed to create the client"}),
+			),
+		}},
+	}, {
+		Name: "MQTTBroker not found",
+		Objects: []runtime.Object{
+			NewBrokerChannel(bcName, testNS,
+				WithBrokerRef(mbName),
+				WithSinkURI(sinkURI),
+			),
+		},
+		Key: testNS + "/" + bcName,
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: NewBrokerChannel(bcName, testNS,
+				WithBrokerRef(mbName),
+				WithSinkURI(sinkURI),
+				WithInitBrokerChannelConditions,
+				WithBrokerChannelConnected,
+				WithBrokerChannelNoBroker(mbName),
+				WithBrokerChannelSink(sinkURI),
+				WithBrokerChannelRoutes(),
+				WithBrokerChannelDeadLetterSink(""),
+			),
+		}},
+	}, {
+		Name: "MQTTBroker unreachable",
+		Objects: []runtime.Object{
+			NewBrokerChannel(bcName, testNS,
+				WithBrokerRef(mbName),
+				WithSinkURI(sinkURI),
+			),
+			NewMQTTBroker(mbName, testNS, WithMQTTBrokerUnreachable("connection refused")),
+		},
+		Key: testNS + "/" + bcName,
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: NewBrokerChannel(bcName, testNS,
+				WithBrokerRef(mbName),
+				WithSinkURI(sinkURI),
+				WithInitBrokerChannelConditions,
+				WithBrokerChannelConnected,
+				WithBrokerChannelBrokerStatus(NewMQTTBroker(mbName, testNS, WithMQTTBrokerUnreachable("connection refused"))),
+				WithBrokerChannelSink(sinkURI),
+				WithBrokerChannelRoutes(),
+				WithBrokerChannelDeadLetterSink(""),
+			),
+		}},
+	}, {
+		Name: "MQTTBroker ready",
+		Objects: []runtime.Object{
+			NewBrokerChannel(bcName, testNS,
+				WithBrokerRef(mbName),
+				WithSinkURI(sinkURI),
+			),
+			NewMQTTBroker(mbName, testNS, WithMQTTBrokerReachable),
+		},
+		Key: testNS + "/" + bcName,
+		WantStatusUpdates: []clientgotesting.UpdateActionImpl{{
+			Object: NewBrokerChannel(bcName, testNS,
+				WithBrokerRef(mbName),
+				WithSinkURI(sinkURI),
+				WithInitBrokerChannelConditions,
+				WithBrokerChannelConnected,
+				WithBrokerChannelBrokerReady,
+				WithBrokerChannelSink(sinkURI),
+				WithBrokerChannelRoutes(),
+				WithBrokerChannelDeadLetterSink(""),
+			),
+		}},
+	}}
+
+	table.Test(t, MakeFactory(func(ctx context.Context, listers *Listers, cmw configmap.Watcher) controller.Reconciler {
+		ctx = addressable.WithDuck(ctx)
+		r := &Reconciler{
+			dynamicClientSet: fakedynamicclient.Get(ctx),
+			sinkResolver:     resolver.NewURIResolver(ctx, func(types.NamespacedName) {}),
+			mqttBrokerLister: listers.GetMQTTBrokerLister(),
+			tracker:          &FakeTracker{},
+		}
+		return brokerchannelreconciler.NewReconciler(ctx, logging.FromContext(ctx),
+			fakesamplesclient.Get(ctx), listers.GetBrokerChannelLister(),
+			controller.GetEventRecorder(ctx), r)
+	}))
+}
+
+const (
+	alarmsURI     = "http://alarms.test-namespace.svc.cluster.local/"
+	telemetryURI  = "http://telemetry.test-namespace.svc.cluster.local/"
+	deadLetterURI = "http://dead-letter.test-namespace.svc.cluster.local/"
+)
+
+var alarmsURL, _ = apis.ParseURL(alarmsURI)
+
+var dataPlaneStatus = &v1beta1.DataPlaneStatus{
+	Buffer: &v1beta1.BufferStatus{Messages: 2, Bytes: 128},
+	CircuitBreakers: []v1beta1.CircuitBreakerStatus{{
+		URI:    apis.HTTP("sink.test-namespace.svc.cluster.local"),
+		State:  v1beta1.CircuitBreakerOpen,
+		Reason: "429 Too Many Requests",
+		Since:  metav1.NewTime(time.Date(2021, 4, 20, 8, 0, 0, 0, time.UTC)),
+	}},
+}
+
+const sinkNotFound = `sinks.testing.samples.knative.dev "sink" not found`
@@ -18,13 +18,16 @@ package samples
 
 import (
 	"context"
-	brokerchannelreconciler "github.com/ShixiongQi/brokerchannel/pkg/client/injection/reconciler/samples/v1alpha1/brokerchannel"
+	brokerchannelreconciler "github.com/ShixiongQi/brokerchannel/pkg/client/injection/reconciler/samples/v1beta1/brokerchannel"
 
 	"knative.dev/pkg/configmap"
 	"knative.dev/pkg/controller"
 	"knative.dev/pkg/logging"
+	"knative.dev/pkg/tracker"
 
-	brokerchannelinformer "github.com/ShixiongQi/brokerchannel/pkg/client/injection/informers/samples/v1alpha1/brokerchannel"
+	"github.com/ShixiongQi/brokerchannel/pkg/apis/samples/v1beta1"
+	brokerchannelinformer "github.com/ShixiongQi/brokerchannel/pkg/client/injection/informers/samples/v1beta1/brokerchannel"
+	mqttbrokerinformer "github.com/ShixiongQi/brokerchannel/pkg/client/injection/informers/samples/v1beta1/mqttbroker"
 	"knative.dev/pkg/injection/clients/dynamicclient"
 	"knative.dev/pkg/resolver"
 )
@@ -37,15 +40,22 @@ func NewController(
 ) *controller.Impl {
 	logging.FromContext(ctx).Error("Start running")
 	brokerChannelInformer := brokerchannelinformer.Get(ctx)
+	mqttBrokerInformer := mqttbrokerinformer.Get(ctx)
 
 	r := &Reconciler{
-		dynamicClientSet:   dynamicclient.Get(ctx),
+		dynamicClientSet: dynamicclient.Get(ctx),
+		mqttBrokerLister: mqttBrokerInformer.Lister(),
 	}
 	impl := brokerchannelreconciler.NewImpl(ctx, r)
 	r.sinkResolver = resolver.NewURIResolver(ctx, impl.EnqueueKey)
 	logging.FromContext(ctx).Info("Setting up event handlers")
 	brokerChannelInformer.Informer().AddEventHandler(controller.HandleAll(impl.Enqueue))
 
+	// Reconcile the BrokerChannels referencing an MQTTBroker when it changes.
+	r.tracker = tracker.New(impl.EnqueueKey, controller.GetTrackerLease(ctx))
+	mqttBrokerInformer.Informer().AddEventHandler(controller.HandleAll(
+		controller.EnsureTypeMeta(r.tracker.OnChanged, v1beta1.SchemeGroupVersion.WithKind("MQTTBroker")),
+	))
 
 	return impl
 }
@@ -0,0 +1,281 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package testing
+
+import (
+	"encoding/json"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"knative.dev/pkg/apis"
+	duckv1 "knative.dev/pkg/apis/duck/v1"
+
+	"github.com/ShixiongQi/brokerchannel/pkg/apis/samples/v1beta1"
+)
+
+// BrokerChannelOption enables further configuration of a BrokerChannel.
+type BrokerChannelOption func(*v1beta1.BrokerChannel)
+
+// MQTTBrokerOption enables further configuration of an MQTTBroker.
+type MQTTBrokerOption func(*v1beta1.MQTTBroker)
+
+// NewBrokerChannel creates a BrokerChannel with BrokerChannelOptions.
+func NewBrokerChannel(name, namespace string, o ...BrokerChannelOption) *v1beta1.BrokerChannel {
+	bc := &v1beta1.BrokerChannel{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+		},
+	}
+	for _, opt := range o {
+		opt(bc)
+	}
+	return bc
+}
+
+// WithBrokerChannelGeneration sets the generation of the BrokerChannel.
+func WithBrokerChannelGeneration(gen int64) BrokerChannelOption {
+	return func(bc *v1beta1.BrokerChannel) {
+		bc.Generation = gen
+	}
+}
+
+// WithBrokerChannelObservedGeneration sets the observed generation of the
+// BrokerChannel.
+func WithBrokerChannelObservedGeneration(gen int64) BrokerChannelOption {
+	return func(bc *v1beta1.BrokerChannel) {
+		bc.Status.ObservedGeneration = gen
+	}
+}
+
+// WithInlineBroker sets an inline broker.
+func WithInlineBroker(host string) BrokerChannelOption {
+	return func(bc *v1beta1.BrokerChannel) {
+		bc.Spec.Broker = &v1beta1.BrokerSpec{Host: host}
+	}
+}
+
+// WithBrokerRef references an MQTTBroker.
+func WithBrokerRef(name string) BrokerChannelOption {
+	return func(bc *v1beta1.BrokerChannel) {
+		bc.Spec.BrokerRef = &corev1.LocalObjectReference{Name: name}
+	}
+}
+
+// WithSubscription adds a subscription.
+func WithSubscription(topic string, qos int32) BrokerChannelOption {
+	return func(bc *v1beta1.BrokerChannel) {
+		bc.Spec.Subscriptions = append(bc.Spec.Subscriptions, v1beta1.Subscription{Topic: topic, QoS: qos})
+	}
+}
+
+// WithSinkURI sets the sink of the BrokerChannel to uri.
+func WithSinkURI(uri string) BrokerChannelOption {
+	return func(bc *v1beta1.BrokerChannel) {
+		u, _ := apis.ParseURL(uri)
+		bc.Spec.Sink = duckv1.Destination{URI: u}
+	}
+}
+
+// WithSinkRef sets the sink of the BrokerChannel to ref.
+func WithSinkRef(ref *duckv1.KReference) BrokerChannelOption {
+	return func(bc *v1beta1.BrokerChannel) {
+		bc.Spec.Sink = duckv1.Destination{Ref: ref}
+	}
+}
+
+// WithRoute adds a route of the messages matching topic to dest.
+func WithRoute(name, topic string, dest duckv1.Destination) BrokerChannelOption {
+	return func(bc *v1beta1.BrokerChannel) {
+		bc.Spec.Routes = append(bc.Spec.Routes, v1beta1.Route{Name: name, Topic: topic, Destination: dest})
+	}
+}
+
+// WithDeadLetterSink sets the dead letter sink of the BrokerChannel.
+func WithDeadLetterSink(dest duckv1.Destination) BrokerChannelOption {
+	return func(bc *v1beta1.BrokerChannel) {
+		bc.Spec.DeadLetterSink = &dest
+	}
+}
+
+// WithDataPlaneStatusAnnotation sets the status reported by the data plane
+// in the annotations of the BrokerChannel.
+func WithDataPlaneStatusAnnotation(dps *v1beta1.DataPlaneStatus) BrokerChannelOption {
+	return func(bc *v1beta1.BrokerChannel) {
+		b, _ := json.Marshal(dps)
+		if bc.Annotations == nil {
+			bc.Annotations = make(map[string]string, 1)
+		}
+		bc.Annotations[v1beta1.DataPlaneStatusAnnotation] = string(b)
+	}
+}
+
+// WithBrokerChannelDataPlaneStatus sets the status reported by the data
+// plane in the status of the BrokerChannel.
+func WithBrokerChannelDataPlaneStatus(dps *v1beta1.DataPlaneStatus) BrokerChannelOption {
+	return func(bc *v1beta1.BrokerChannel) {
+		bc.Status.PropagateDataPlaneStatus(dps)
+	}
+}
+
+// WithBrokerChannelConnected marks the connection of the BrokerChannel as set
+// up by the data plane, which reported no status.
+func WithBrokerChannelConnected(bc *v1beta1.BrokerChannel) {
+	bc.Status.PropagateDataPlaneStatus(nil)
+}
+
+// WithInitBrokerChannelConditions initializes the conditions of the
+// BrokerChannel.
+func WithInitBrokerChannelConditions(bc *v1beta1.BrokerChannel) {
+	bc.Status.InitializeConditions()
+}
+
+// WithBrokerChannelSink marks the sink of the BrokerChannel as resolved to
+// uri.
+func WithBrokerChannelSink(uri string) BrokerChannelOption {
+	return func(bc *v1beta1.BrokerChannel) {
+		u, _ := apis.ParseURL(uri)
+		bc.Status.MarkSink(u)
+	}
+}
+
+// WithBrokerChannelNoSink marks the sink of the BrokerChannel as not found.
+func WithBrokerChannelNoSink(message string) BrokerChannelOption {
+	return func(bc *v1beta1.BrokerChannel) {
+		bc.Status.MarkNoSink("NotFound", "%s", message)
+	}
+}
+
+// WithBrokerChannelRoutes marks the routes of the BrokerChannel as resolved.
+func WithBrokerChannelRoutes(routes ...v1beta1.RouteStatus) BrokerChannelOption {
+	return func(bc *v1beta1.BrokerChannel) {
+		bc.Status.MarkRoutes(routes)
+	}
+}
+
+// WithBrokerChannelNoRoutes marks the destination of a route of the
+// BrokerChannel as not found, after resolving routes.
+func WithBrokerChannelNoRoutes(message string, routes ...v1beta1.RouteStatus) BrokerChannelOption {
+	return func(bc *v1beta1.BrokerChannel) {
+		bc.Status.MarkNoRoutes(routes, "NotFound", "%s", message)
+	}
+}
+
+// WithBrokerChannelDeadLetterSink marks the dead letter sink of the
+// BrokerChannel as resolved to uri, or as not configured when uri is empty.
+func WithBrokerChannelDeadLetterSink(uri string) BrokerChannelOption {
+	return func(bc *v1beta1.BrokerChannel) {
+		u, _ := apis.ParseURL(uri)
+		bc.Status.MarkDeadLetterSink(u)
+	}
+}
+
+// WithBrokerChannelNoDeadLetterSink marks the dead letter sink of the
+// BrokerChannel as not found.
+func WithBrokerChannelNoDeadLetterSink(message string) BrokerChannelOption {
+	return func(bc *v1beta1.BrokerChannel) {
+		bc.Status.MarkNoDeadLetterSink("NotFound", "%s", message)
+	}
+}
+
+// RouteStatus returns the status of the route name resolved to uri.
+func RouteStatus(name, uri string) v1beta1.RouteStatus {
+	u, _ := apis.ParseURL(uri)
+	return v1beta1.RouteStatus{Name: name, URI: u}
+}
+
+// WithBrokerChannelBrokerReady marks the broker of the BrokerChannel as
+// ready.
+func WithBrokerChannelBrokerReady(bc *v1beta1.BrokerChannel) {
+	bc.Status.MarkBrokerReady()
+}
+
+// WithBrokerChannelNoBroker marks the MQTTBroker of the BrokerChannel as
+// missing.
+func WithBrokerChannelNoBroker(name string) BrokerChannelOption {
+	return func(bc *v1beta1.BrokerChannel) {
+		bc.Status.MarkNoBroker("NotFound", "MQTTBroker %q does not exist", name)
+	}
+}
+
+// WithBrokerChannelBrokerStatus mirrors the status of mb.
+func WithBrokerChannelBrokerStatus(mb *v1beta1.MQTTBroker) BrokerChannelOption {
+	return func(bc *v1beta1.BrokerChannel) {
+		bc.Status.PropagateBrokerStatus(&mb.Status)
+	}
+}
+
+// NewMQTTBroker creates an MQTTBroker with MQTTBrokerOptions.
+func NewMQTTBroker(name, namespace string, o ...MQTTBrokerOption) *v1beta1.MQTTBroker {
+	mb := &v1beta1.MQTTBroker{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+		},
+		Spec: v1beta1.MQTTBrokerSpec{
+			Host: "mosquitto." + namespace,
+		},
+	}
+	for _, opt := range o {
+		opt(mb)
+	}
+	return mb
+}
+
+// WithMQTTBrokerReachable marks the MQTTBroker as reachable.
+func WithMQTTBrokerReachable(mb *v1beta1.MQTTBroker) {
+	mb.Status.InitializeConditions()
+	mb.Status.MarkReachable()
+}
+
+// WithMQTTBrokerUnreachable marks the MQTTBroker as unreachable.
+func WithMQTTBrokerUnreachable(message string) MQTTBrokerOption {
+	return func(mb *v1beta1.MQTTBroker) {
+		mb.Status.InitializeConditions()
+		mb.Status.MarkUnreachable("Unreachable", "%s", message)
+	}
+}
+
+// NewSink creates an addressable object whose address is url.
+func NewSink(name, namespace, url string) *unstructured.Unstructured {
+	return &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": sinkGVK.GroupVersion().String(),
+			"kind":       sinkGVK.Kind,
+			"metadata": map[string]interface{}{
+				"namespace": namespace,
+				"name":      name,
+			},
+			"status": map[string]interface{}{
+				"address": map[string]interface{}{
+					"url": url,
+				},
+			},
+		},
+	}
+}
+
+// SinkRef refers to the sink created by NewSink, in namespace if not empty.
+func SinkRef(name, namespace string) *duckv1.KReference {
+	return &duckv1.KReference{
+		APIVersion: sinkGVK.GroupVersion().String(),
+		Kind:       sinkGVK.Kind,
+		Namespace:  namespace,
+		Name:       name,
+	}
+}
@@ -0,0 +1,98 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package testing
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	fakekubeclientset "k8s.io/client-go/kubernetes/fake"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"knative.dev/pkg/reconciler/testing"
+
+	"github.com/ShixiongQi/brokerchannel/pkg/apis/samples/v1beta1"
+	fakesamplesclientset "github.com/ShixiongQi/brokerchannel/pkg/client/clientset/versioned/fake"
+	listers "github.com/ShixiongQi/brokerchannel/pkg/client/listers/samples/v1beta1"
+)
+
+// sinkAddToScheme registers the addressable kind of NewSink.
+var sinkAddToScheme = func(scheme *runtime.Scheme) error {
+	scheme.AddKnownTypeWithName(sinkGVK, &unstructured.Unstructured{})
+	return nil
+}
+
+var sinkGVK = schema.GroupVersionKind{Group: "testing.samples.knative.dev", Version: "v1", Kind: "Sink"}
+
+var clientSetSchemes = []func(*runtime.Scheme) error{
+	fakekubeclientset.AddToScheme,
+	fakesamplesclientset.AddToScheme,
+	sinkAddToScheme,
+}
+
+// Listers serves the objects of a test from indexers.
+type Listers struct {
+	sorter testing.ObjectSorter
+}
+
+// NewScheme returns a scheme knowing every kind of object of the tests.
+func NewScheme() *runtime.Scheme {
+	scheme := runtime.NewScheme()
+	for _, addTo := range clientSetSchemes {
+		addTo(scheme)
+	}
+	return scheme
+}
+
+// NewListers sorts objs by kind.
+func NewListers(objs []runtime.Object) Listers {
+	ls := Listers{
+		sorter: testing.NewObjectSorter(NewScheme()),
+	}
+	ls.sorter.AddObjects(objs...)
+	return ls
+}
+
+func (l *Listers) indexerFor(obj runtime.Object) cache.Indexer {
+	return l.sorter.IndexerForObjectType(obj)
+}
+
+// GetKubeObjects returns the objects served by the Kubernetes client.
+func (l *Listers) GetKubeObjects() []runtime.Object {
+	return l.sorter.ObjectsForSchemeFunc(fakekubeclientset.AddToScheme)
+}
+
+// GetSamplesObjects returns the objects served by the samples client.
+func (l *Listers) GetSamplesObjects() []runtime.Object {
+	return l.sorter.ObjectsForSchemeFunc(fakesamplesclientset.AddToScheme)
+}
+
+// GetBrokerChannelLister lists the BrokerChannels of the test.
+func (l *Listers) GetBrokerChannelLister() listers.BrokerChannelLister {
+	return listers.NewBrokerChannelLister(l.indexerFor(&v1beta1.BrokerChannel{}))
+}
+
+// GetMQTTBrokerLister lists the MQTTBrokers of the test.
+func (l *Listers) GetMQTTBrokerLister() listers.MQTTBrokerLister {
+	return listers.NewMQTTBrokerLister(l.indexerFor(&v1beta1.MQTTBroker{}))
+}
+
+// GetSecretLister lists the Secrets of the test.
+func (l *Listers) GetSecretLister() corelisters.SecretLister {
+	return corelisters.NewSecretLister(l.indexerFor(&corev1.Secret{}))
+}
@@ -0,0 +1,174 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package signature signs the requests of the data plane with an HMAC of
+// their timestamp and body, and lets the sinks verify them.
+//
+// A signed request carries two headers:
+//
+//	X-Brokerchannel-Timestamp: 1618312345
+//	X-Brokerchannel-Signature: sha256=6b1e...
+//
+// The timestamp is in seconds since the epoch, and the signature is the
+// algorithm followed by the hex encoded HMAC of "<timestamp>.<body>". A Go
+// sink checks a request with:
+//
+//	if err := signature.Verify(r, key, 5*time.Minute); err != nil {
+//		http.Error(w, err.Error(), http.StatusUnauthorized)
+//		return
+//	}
+package signature
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"errors"
+	"fmt"
+	"hash"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// TimestampHeader holds the time the request was signed at.
+	TimestampHeader = "X-Brokerchannel-Timestamp"
+	// SignatureHeader holds the signature of the request.
+	SignatureHeader = "X-Brokerchannel-Signature"
+)
+
+// The algorithms of the signatures.
+const (
+	SHA256 = "sha256"
+	SHA512 = "sha512"
+)
+
+var (
+	// ErrMissing is returned for requests without signature.
+	ErrMissing = errors.New("missing signature")
+	// ErrMismatch is returned when the signature does not match the body
+	// and the timestamp.
+	ErrMismatch = errors.New("signature mismatch")
+	// ErrExpired is returned when the request was signed too long ago, or
+	// in the future.
+	ErrExpired = errors.New("signature timestamp outside of the tolerance")
+)
+
+// Sign returns the signature of body sent at timestamp, in seconds since
+// the epoch.
+func Sign(algorithm string, key []byte, timestamp int64, body []byte) (string, error) {
+	mac, err := newMAC(algorithm, key)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s=%x", algorithm, sum(mac, strconv.FormatInt(timestamp, 10), body)), nil
+}
+
+// SignRequest sets the signature headers of req, signed at now. The body of
+// req is read and replaced.
+func SignRequest(req *http.Request, algorithm string, key []byte, now time.Time) error {
+	body, err := readBody(req)
+	if err != nil {
+		return err
+	}
+	ts := now.Unix()
+	sig, err := Sign(algorithm, key, ts, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set(TimestampHeader, strconv.FormatInt(ts, 10))
+	req.Header.Set(SignatureHeader, sig)
+	return nil
+}
+
+// Verify checks that r is signed with key, less than tolerance ago. A zero
+// tolerance accepts any timestamp. The body of r is read and replaced, so
+// that the handler can still read it.
+func Verify(r *http.Request, key []byte, tolerance time.Duration) error {
+	timestamp, sig := r.Header.Get(TimestampHeader), r.Header.Get(SignatureHeader)
+	if timestamp == "" || sig == "" {
+		return ErrMissing
+	}
+	body, err := readBody(r)
+	if err != nil {
+		return err
+	}
+	return Check(key, timestamp, sig, body, tolerance, time.Now())
+}
+
+// Check checks the values of the signature headers against body and key,
+// for the sinks not built on net/http.
+func Check(key []byte, timestamp, sig string, body []byte, tolerance time.Duration, now time.Time) error {
+	if timestamp == "" || sig == "" {
+		return ErrMissing
+	}
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid signature timestamp %q", timestamp)
+	}
+	if d := now.Sub(time.Unix(ts, 0)); tolerance > 0 && (d > tolerance || d < -tolerance) {
+		return ErrExpired
+	}
+	i := strings.IndexByte(sig, '=')
+	if i < 0 {
+		return ErrMismatch
+	}
+	mac, err := newMAC(sig[:i], key)
+	if err != nil {
+		return err
+	}
+	want := fmt.Sprintf("%x", sum(mac, timestamp, body))
+	if !hmac.Equal([]byte(sig[i+1:]), []byte(want)) {
+		return ErrMismatch
+	}
+	return nil
+}
+
+func newMAC(algorithm string, key []byte) (hash.Hash, error) {
+	switch algorithm {
+	case SHA256:
+		return hmac.New(sha256.New, key), nil
+	case SHA512:
+		return hmac.New(sha512.New, key), nil
+	default:
+		return nil, fmt.Errorf("unknown signature algorithm %q", algorithm)
+	}
+}
+
+func sum(mac hash.Hash, timestamp string, body []byte) []byte {
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte{'.'})
+	mac.Write(body)
+	return mac.Sum(nil)
+}
+
+// readBody reads the body of r and replaces it with a copy.
+func readBody(r *http.Request) ([]byte, error) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil, nil
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	r.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
@@ -0,0 +1,129 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package signature
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignature(t *testing.T) {
+	key := []byte("s3cr3t")
+	now := time.Unix(1618312345, 0)
+	sig, err := Sign(SHA256, key, now.Unix(), []byte(`{"motion":true}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// echo -n '1618312345.{"motion":true}' | openssl dgst -sha256 -hmac s3cr3t
+	if want := "sha256=8d3719f312661f5a8b01165fc5859c46dac52c7d0a0380fd235f0bbb379b1d22"; sig != want {
+		t.Errorf("Sign() = %s, want %s", sig, want)
+	}
+
+	tests := []struct {
+		name      string
+		key       string
+		timestamp string
+		sig       string
+		body      string
+		want      error
+	}{{
+		name:      "valid",
+		key:       "s3cr3t",
+		timestamp: "1618312345",
+		sig:       sig,
+		body:      `{"motion":true}`,
+	}, {
+		name:      "tampered body",
+		key:       "s3cr3t",
+		timestamp: "1618312345",
+		sig:       sig,
+		body:      `{"motion":false}`,
+		want:      ErrMismatch,
+	}, {
+		name:      "tampered timestamp",
+		key:       "s3cr3t",
+		timestamp: "1618312346",
+		sig:       sig,
+		body:      `{"motion":true}`,
+		want:      ErrMismatch,
+	}, {
+		name:      "other key",
+		key:       "other",
+		timestamp: "1618312345",
+		sig:       sig,
+		body:      `{"motion":true}`,
+		want:      ErrMismatch,
+	}, {
+		name:      "expired",
+		key:       "s3cr3t",
+		timestamp: "1618311345",
+		sig:       sig,
+		body:      `{"motion":true}`,
+		want:      ErrExpired,
+	}, {
+		name: "missing",
+		key:  "s3cr3t",
+		body: `{"motion":true}`,
+		want: ErrMissing,
+	}}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := Check([]byte(test.key), test.timestamp, test.sig, []byte(test.body), 5*time.Minute, now)
+			if err != test.want {
+				t.Errorf("Check() = %v, want %v", err, test.want)
+			}
+		})
+	}
+}
+
+func TestVerify(t *testing.T) {
+	key := []byte("s3cr3t")
+	for _, algorithm := range []string{SHA256, SHA512} {
+		t.Run(algorithm, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/", strings.NewReader(`{"motion":true}`))
+			if err := SignRequest(req, algorithm, key, time.Now()); err != nil {
+				t.Fatal(err)
+			}
+			if sig := req.Header.Get(SignatureHeader); !strings.HasPrefix(sig, algorithm+"=") {
+				t.Errorf("%s = %s, want the %s prefix", SignatureHeader, sig, algorithm)
+			}
+			if _, err := strconv.ParseInt(req.Header.Get(TimestampHeader), 10, 64); err != nil {
+				t.Errorf("%s: %v", TimestampHeader, err)
+			}
+
+			if err := Verify(req, key, time.Minute); err != nil {
+				t.Errorf("Verify() = %v", err)
+			}
+			// The handler can still read the body.
+			body, _ := ioutil.ReadAll(req.Body)
+			if string(body) != `{"motion":true}` {
+				t.Errorf("Body = %s, want the signed body", body)
+			}
+			if err := Verify(req, []byte("other"), time.Minute); err != ErrMismatch {
+				t.Errorf("Verify() with another key = %v, want %v", err, ErrMismatch)
+			}
+		})
+	}
+
+	if _, err := Sign("md5", key, 0, nil); err == nil {
+		t.Error("Sign() with md5 succeeded, want an error")
+	}
+}
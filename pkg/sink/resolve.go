@@ -0,0 +1,109 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sink
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+
+	"github.com/ShixiongQi/brokerchannel/pkg/apis/samples/v1beta1"
+	"github.com/ShixiongQi/brokerchannel/pkg/signature"
+)
+
+// Resolve reads the secrets of auth from namespace into a Config, nil when
+// auth is nil. track, when set, is called with the name of every secret read,
+// so that the caller resolves auth again when one of them changes.
+func Resolve(ctx context.Context, lister corelisters.SecretLister, track func(name string) error, namespace string, auth *v1beta1.SinkAuth) (*Config, error) {
+	if auth == nil {
+		return nil, nil
+	}
+	secrets := make(map[string]*corev1.Secret)
+	get := func(name string) (*corev1.Secret, error) {
+		if s, ok := secrets[name]; ok {
+			return s, nil
+		}
+		if track != nil {
+			if err := track(name); err != nil {
+				return nil, err
+			}
+		}
+		s, err := lister.Secrets(namespace).Get(name)
+		if err != nil {
+			return nil, err
+		}
+		secrets[name] = s
+		return s, nil
+	}
+	secret := func(sel *corev1.SecretKeySelector) (string, error) {
+		if sel == nil {
+			return "", nil
+		}
+		s, err := get(sel.Name)
+		if err != nil {
+			return "", err
+		}
+		v, ok := s.Data[sel.Key]
+		if !ok {
+			return "", fmt.Errorf("secret %q has no key %q", sel.Name, sel.Key)
+		}
+		return string(v), nil
+	}
+
+	cfg := &Config{}
+	var err error
+	if cfg.CACert, err = secret(auth.CACert); err != nil {
+		return nil, err
+	}
+	if cfg.ClientCert, err = secret(auth.ClientCert); err != nil {
+		return nil, err
+	}
+	if cfg.ClientKey, err = secret(auth.ClientKey); err != nil {
+		return nil, err
+	}
+	if auth.Headers != nil {
+		s, err := get(auth.Headers.Name)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Headers = make(map[string]string, len(s.Data))
+		for k, v := range s.Data {
+			cfg.Headers[k] = string(v)
+		}
+	}
+	if o := auth.OAuth2; o != nil {
+		cfg.OAuth2 = &OAuth2{TokenURL: o.TokenURL, Scopes: o.Scopes}
+		if cfg.OAuth2.ClientID, err = secret(o.ClientID); err != nil {
+			return nil, err
+		}
+		if cfg.OAuth2.ClientSecret, err = secret(o.ClientSecret); err != nil {
+			return nil, err
+		}
+	}
+	if sg := auth.Signing; sg != nil {
+		cfg.Signing = &Signing{Algorithm: signature.SHA256}
+		if sg.Algorithm == v1beta1.HMACSHA512 {
+			cfg.Signing.Algorithm = signature.SHA512
+		}
+		if cfg.Signing.Key, err = secret(sg.Key); err != nil {
+			return nil, err
+		}
+	}
+	return cfg, nil
+}
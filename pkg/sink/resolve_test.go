@@ -0,0 +1,104 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sink
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/ShixiongQi/brokerchannel/pkg/apis/samples/v1beta1"
+	"github.com/ShixiongQi/brokerchannel/pkg/signature"
+)
+
+func secretKey(name, key string) *corev1.SecretKeySelector {
+	return &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: name}, Key: key}
+}
+
+func TestResolve(t *testing.T) {
+	secrets := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	for _, s := range []*corev1.Secret{{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "sink-tls"},
+		Data:       map[string][]byte{"ca.crt": []byte("CA"), "tls.crt": []byte("CERT"), "tls.key": []byte("KEY")},
+	}, {
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "sink-headers"},
+		Data:       map[string][]byte{"Authorization": []byte("Bearer static")},
+	}, {
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "sink-oauth2"},
+		Data:       map[string][]byte{"client-id": []byte("brokerchannel"), "client-secret": []byte("s3cr3t")},
+	}, {
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "sink-signing"},
+		Data:       map[string][]byte{"key": []byte("hmac")},
+	}} {
+		secrets.Add(s)
+	}
+	lister := corelisters.NewSecretLister(secrets)
+	auth := &v1beta1.SinkAuth{
+		CACert:     secretKey("sink-tls", "ca.crt"),
+		ClientCert: secretKey("sink-tls", "tls.crt"),
+		ClientKey:  secretKey("sink-tls", "tls.key"),
+		Headers:    &corev1.LocalObjectReference{Name: "sink-headers"},
+		OAuth2: &v1beta1.OAuth2ClientCredentials{
+			TokenURL:     "https://auth.example.com/token",
+			ClientID:     secretKey("sink-oauth2", "client-id"),
+			ClientSecret: secretKey("sink-oauth2", "client-secret"),
+			Scopes:       []string{"events"},
+		},
+		Signing: &v1beta1.Signing{Key: secretKey("sink-signing", "key"), Algorithm: v1beta1.HMACSHA512},
+	}
+
+	var tracked []string
+	got, err := Resolve(context.Background(), lister, func(name string) error {
+		tracked = append(tracked, name)
+		return nil
+	}, "default", auth)
+	if err != nil {
+		t.Fatal("Resolve() =", err)
+	}
+	if want := []string{"sink-tls", "sink-headers", "sink-oauth2", "sink-signing"}; !reflect.DeepEqual(tracked, want) {
+		t.Errorf("Tracked secrets %v, want %v", tracked, want)
+	}
+	want := &Config{
+		CACert:     "CA",
+		ClientCert: "CERT",
+		ClientKey:  "KEY",
+		Headers:    map[string]string{"Authorization": "Bearer static"},
+		OAuth2: &OAuth2{
+			TokenURL:     "https://auth.example.com/token",
+			ClientID:     "brokerchannel",
+			ClientSecret: "s3cr3t",
+			Scopes:       []string{"events"},
+		},
+		Signing: &Signing{Algorithm: signature.SHA512, Key: "hmac"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Resolve() = %+v, want %+v", got, want)
+	}
+
+	auth.ClientKey = secretKey("sink-tls", "missing")
+	if _, err := Resolve(context.Background(), lister, nil, "default", auth); err == nil {
+		t.Error("Resolve() succeeded with a missing key")
+	}
+	if got, err := Resolve(context.Background(), lister, nil, "default", nil); got != nil || err != nil {
+		t.Errorf("Resolve(nil) = %v, %v, want nil", got, err)
+	}
+}
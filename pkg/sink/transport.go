@@ -0,0 +1,142 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package sink builds the HTTP transports delivering the events of the
+// BrokerChannels to their destinations.
+package sink
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net/http"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+
+	"github.com/ShixiongQi/brokerchannel/pkg/signature"
+)
+
+// Config holds the TLS and authentication settings of the requests to the
+// destinations of a BrokerChannel.
+type Config struct {
+	// CACert holds the PEM certificates verifying the destinations, the
+	// system roots are used when it is empty.
+	CACert string
+	// ClientCert and ClientKey are the PEM certificate and key presented to
+	// the destinations.
+	ClientCert string
+	ClientKey  string
+	// Headers are added to every request.
+	Headers map[string]string
+	// OAuth2 authenticates the requests with a bearer token, when set.
+	OAuth2 *OAuth2
+	// Signing signs the requests, when set.
+	Signing *Signing
+}
+
+// OAuth2 is an OAuth2 client credentials grant.
+type OAuth2 struct {
+	TokenURL     string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+}
+
+// Signing signs the requests with the HMAC Algorithm of the signature
+// package, and Key.
+type Signing struct {
+	Algorithm string
+	Key       string
+}
+
+// Transport returns the transport of the requests to the destinations. The
+// tokens of the OAuth2 grant are requested over the same TLS settings, and
+// cached until they expire. A nil Config returns the default transport.
+func (c *Config) Transport() (http.RoundTripper, error) {
+	if c == nil {
+		return http.DefaultTransport, nil
+	}
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	if c.CACert != "" || c.ClientCert != "" {
+		tc := &tls.Config{}
+		if c.CACert != "" {
+			tc.RootCAs = x509.NewCertPool()
+			if !tc.RootCAs.AppendCertsFromPEM([]byte(c.CACert)) {
+				return nil, errors.New("no certificate found in the CA bundle")
+			}
+		}
+		if c.ClientCert != "" {
+			cert, err := tls.X509KeyPair([]byte(c.ClientCert), []byte(c.ClientKey))
+			if err != nil {
+				return nil, err
+			}
+			tc.Certificates = []tls.Certificate{cert}
+		}
+		t.TLSClientConfig = tc
+	}
+
+	var rt http.RoundTripper = t
+	if o := c.OAuth2; o != nil {
+		cc := &clientcredentials.Config{
+			ClientID:     o.ClientID,
+			ClientSecret: o.ClientSecret,
+			TokenURL:     o.TokenURL,
+			Scopes:       o.Scopes,
+		}
+		ctx := context.WithValue(context.Background(), oauth2.HTTPClient, &http.Client{Transport: t})
+		rt = &oauth2.Transport{Source: cc.TokenSource(ctx), Base: rt}
+	}
+	if len(c.Headers) > 0 {
+		rt = &headerTransport{base: rt, headers: c.Headers}
+	}
+	if c.Signing != nil {
+		rt = &signingTransport{base: rt, algorithm: c.Signing.Algorithm, key: []byte(c.Signing.Key)}
+	}
+	return rt, nil
+}
+
+// headerTransport adds headers to the requests sent through base. The
+// Authorization header of an OAuth2 grant replaces theirs.
+type headerTransport struct {
+	base    http.RoundTripper
+	headers map[string]string
+}
+
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	for k, v := range t.headers {
+		req.Header.Set(k, v)
+	}
+	return t.base.RoundTrip(req)
+}
+
+// signingTransport signs the requests sent through base.
+type signingTransport struct {
+	base      http.RoundTripper
+	algorithm string
+	key       []byte
+}
+
+func (t *signingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	if err := signature.SignRequest(req, t.algorithm, t.key, time.Now()); err != nil {
+		return nil, err
+	}
+	return t.base.RoundTrip(req)
+}
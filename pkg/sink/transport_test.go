@@ -0,0 +1,239 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sink
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ShixiongQi/brokerchannel/pkg/signature"
+)
+
+// certPEM encodes the certificate of srv.
+func certPEM(srv *httptest.Server) string {
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}))
+}
+
+// newClientCert returns a CA, and a client certificate with its key issued
+// by the CA to commonName, in PEM.
+func newClientCert(t *testing.T, commonName string) (*x509.CertPool, string, string) {
+	t.Helper()
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, ca, ca, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err = x509.ParseCertificate(caDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, ca, &key.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+	return pool,
+		string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+}
+
+// get sends a GET request to url through the transport of c.
+func get(t *testing.T, c *Config, url string) (*http.Response, error) {
+	t.Helper()
+	rt, err := c.Transport()
+	if err != nil {
+		t.Fatal("Transport() =", err)
+	}
+	resp, err := (&http.Client{Transport: rt}).Get(url)
+	if err == nil {
+		resp.Body.Close()
+	}
+	return resp, err
+}
+
+func TestTransportCACert(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	if _, err := get(t, &Config{}, srv.URL); err == nil {
+		t.Error("The certificate of the sink is trusted without a CA bundle")
+	}
+	if _, err := get(t, &Config{CACert: certPEM(srv)}, srv.URL); err != nil {
+		t.Error("Failed to verify the sink with the CA bundle:", err)
+	}
+	if _, err := (&Config{CACert: "not a certificate"}).Transport(); err == nil {
+		t.Error("Transport() succeeded with an invalid CA bundle")
+	}
+}
+
+func TestTransportClientCert(t *testing.T) {
+	pool, cert, key := newClientCert(t, "brokerchannel")
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if cn := r.TLS.PeerCertificates[0].Subject.CommonName; cn != "brokerchannel" {
+			http.Error(w, "unexpected client "+cn, http.StatusForbidden)
+		}
+	}))
+	srv.TLS = &tls.Config{ClientCAs: pool, ClientAuth: tls.RequireAndVerifyClientCert}
+	srv.StartTLS()
+	defer srv.Close()
+
+	if _, err := get(t, &Config{CACert: certPEM(srv)}, srv.URL); err == nil {
+		t.Error("The sink accepted a request without a client certificate")
+	}
+	resp, err := get(t, &Config{CACert: certPEM(srv), ClientCert: cert, ClientKey: key}, srv.URL)
+	if err != nil {
+		t.Fatal("Failed to send the client certificate:", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Status = %d, want 200", resp.StatusCode)
+	}
+}
+
+func TestTransportHeaders(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != "Bearer static" {
+			http.Error(w, "unexpected authorization "+got, http.StatusUnauthorized)
+		}
+	}))
+	defer srv.Close()
+
+	resp, err := get(t, &Config{Headers: map[string]string{"Authorization": "Bearer static"}}, srv.URL)
+	if err != nil {
+		t.Fatal("Failed to send the request:", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Status = %d, want 200", resp.StatusCode)
+	}
+}
+
+func TestTransportSigning(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := signature.Verify(r, []byte("s3cr3t"), time.Minute); err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+		}
+	}))
+	defer srv.Close()
+
+	rt, err := (&Config{Signing: &Signing{Algorithm: signature.SHA512, Key: "s3cr3t"}}).Transport()
+	if err != nil {
+		t.Fatal("Transport() =", err)
+	}
+	resp, err := (&http.Client{Transport: rt}).Post(srv.URL, "application/json", strings.NewReader(`{"motion":true}`))
+	if err != nil {
+		t.Fatal("Failed to send the request:", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Status = %d, want 200", resp.StatusCode)
+	}
+}
+
+func TestTransportOAuth2(t *testing.T) {
+	var tokens int32
+	auth := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, secret, _ := r.BasicAuth()
+		if id != "brokerchannel" || secret != "s3cr3t" || r.FormValue("grant_type") != "client_credentials" || r.FormValue("scope") != "events" {
+			http.Error(w, "invalid client", http.StatusUnauthorized)
+			return
+		}
+		n := atomic.AddInt32(&tokens, 1)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"access_token":"token-%d","token_type":"bearer","expires_in":3600}`, n)
+	}))
+	defer auth.Close()
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != "Bearer token-1" {
+			http.Error(w, "unexpected authorization "+got, http.StatusUnauthorized)
+		}
+		if got := r.Header.Get("X-Tenant"); got != "acme" {
+			http.Error(w, "unexpected tenant "+got, http.StatusForbidden)
+		}
+	}))
+	defer srv.Close()
+
+	// Both servers use the certificate of httptest.
+	c := &Config{
+		CACert:  certPEM(srv),
+		Headers: map[string]string{"X-Tenant": "acme"},
+		OAuth2: &OAuth2{
+			TokenURL:     auth.URL,
+			ClientID:     "brokerchannel",
+			ClientSecret: "s3cr3t",
+			Scopes:       []string{"events"},
+		},
+	}
+	rt, err := c.Transport()
+	if err != nil {
+		t.Fatal("Transport() =", err)
+	}
+	client := &http.Client{Transport: rt}
+	for i := 0; i < 2; i++ {
+		resp, err := client.Get(srv.URL)
+		if err != nil {
+			t.Fatal("Failed to send the request:", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("Status = %d, want 200", resp.StatusCode)
+		}
+	}
+	if n := atomic.LoadInt32(&tokens); n != 1 {
+		t.Errorf("Requested %d tokens, want 1", n)
+	}
+}
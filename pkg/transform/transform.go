@@ -0,0 +1,213 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package transform reshapes the MQTT messages of BrokerChannels into the
+// events sent to their sink.
+package transform
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"k8s.io/client-go/util/jsonpath"
+
+	"github.com/ShixiongQi/brokerchannel/pkg/apis/samples/v1beta1"
+)
+
+// Transformer applies the Transform of a BrokerChannel. A nil Transformer
+// leaves the events unchanged.
+type Transformer struct {
+	fields     []field
+	set        map[string]json.RawMessage
+	typ        *template.Template
+	subject    *template.Template
+	extensions map[string]*template.Template
+}
+
+// field is a parsed FieldMapping.
+type field struct {
+	name string
+	path *jsonpath.JSONPath
+}
+
+// templateData is what the templates of a Transform are executed with.
+type templateData struct {
+	Topic   string
+	Levels  []string
+	Payload interface{}
+}
+
+// New parses spec. It returns a nil Transformer for a nil spec.
+func New(spec *v1beta1.Transform) (*Transformer, error) {
+	if spec == nil {
+		return nil, nil
+	}
+	t := &Transformer{
+		set:        make(map[string]json.RawMessage, len(spec.Set)),
+		extensions: make(map[string]*template.Template, len(spec.Extensions)),
+	}
+	for _, fm := range spec.Fields {
+		p := jsonpath.New(fm.Name).AllowMissingKeys(true)
+		if err := p.Parse(fm.JSONPath()); err != nil {
+			return nil, fmt.Errorf("field %q: %w", fm.Name, err)
+		}
+		t.fields = append(t.fields, field{name: fm.Name, path: p})
+	}
+	for name, v := range spec.Set {
+		if !json.Valid(v.Raw) {
+			return nil, fmt.Errorf("field %q: invalid JSON value", name)
+		}
+		t.set[name] = json.RawMessage(v.Raw)
+	}
+	var err error
+	if t.typ, err = parseTemplate("type", spec.Type); err != nil {
+		return nil, err
+	}
+	if t.subject, err = parseTemplate("subject", spec.Subject); err != nil {
+		return nil, err
+	}
+	for name, tmpl := range spec.Extensions {
+		if t.extensions[name], err = parseTemplate(name, tmpl); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+// parseTemplate parses the template of an attribute, which is nil when tmpl
+// is empty.
+func parseTemplate(name, tmpl string) (*template.Template, error) {
+	if tmpl == "" {
+		return nil, nil
+	}
+	t, err := template.New(name).Option("missingkey=error").Parse(tmpl)
+	if err != nil {
+		return nil, fmt.Errorf("template of %s: %w", name, err)
+	}
+	return t, nil
+}
+
+// Apply transforms event, built from a message of topic carrying payload.
+// The event is left unchanged on error.
+func (t *Transformer) Apply(topic string, payload []byte, event *cloudevents.Event) error {
+	if t == nil {
+		return nil
+	}
+	var decoded interface{}
+	decodeErr := json.Unmarshal(payload, &decoded)
+
+	var data map[string]interface{}
+	switch {
+	case len(t.fields) > 0:
+		if decodeErr != nil {
+			return fmt.Errorf("payload is not JSON: %w", decodeErr)
+		}
+		data = make(map[string]interface{}, len(t.fields)+len(t.set))
+		for _, f := range t.fields {
+			v, ok, err := f.find(decoded)
+			if err != nil {
+				return fmt.Errorf("field %q: %w", f.name, err)
+			}
+			if ok {
+				data[f.name] = v
+			}
+		}
+	case len(t.set) > 0:
+		obj, ok := decoded.(map[string]interface{})
+		if !ok {
+			return errors.New("payload is not a JSON object")
+		}
+		data = obj
+	}
+	for name, v := range t.set {
+		data[name] = v
+	}
+
+	td := &templateData{
+		Topic:   topic,
+		Levels:  strings.Split(topic, "/"),
+		Payload: decoded,
+	}
+	typ, err := execute(t.typ, td)
+	if err != nil {
+		return err
+	}
+	subject, err := execute(t.subject, td)
+	if err != nil {
+		return err
+	}
+	extensions := make(map[string]string, len(t.extensions))
+	for name, tmpl := range t.extensions {
+		if extensions[name], err = execute(tmpl, td); err != nil {
+			return err
+		}
+	}
+
+	if data != nil {
+		if err := event.SetData(cloudevents.ApplicationJSON, data); err != nil {
+			return err
+		}
+	}
+	if t.typ != nil {
+		event.SetType(typ)
+	}
+	if t.subject != nil {
+		event.SetSubject(subject)
+	}
+	for name, v := range extensions {
+		event.SetExtension(name, v)
+	}
+	return nil
+}
+
+// find returns the values the path of f selects in payload, an array when
+// there are several, and whether there is any.
+func (f *field) find(payload interface{}) (interface{}, bool, error) {
+	results, err := f.path.FindResults(payload)
+	if err != nil {
+		return nil, false, err
+	}
+	var values []interface{}
+	for _, r := range results {
+		for _, v := range r {
+			values = append(values, v.Interface())
+		}
+	}
+	switch len(values) {
+	case 0:
+		return nil, false, nil
+	case 1:
+		return values[0], true, nil
+	default:
+		return values, true, nil
+	}
+}
+
+// execute returns the output of tmpl, or an empty string for a nil tmpl.
+func execute(tmpl *template.Template, td *templateData) (string, error) {
+	if tmpl == nil {
+		return "", nil
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, td); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
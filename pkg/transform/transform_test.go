@@ -0,0 +1,180 @@
+/*
+Copyright 2020 The Knative Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package transform
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	"github.com/google/go-cmp/cmp"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"sigs.k8s.io/yaml"
+
+	"github.com/ShixiongQi/brokerchannel/pkg/apis/samples/v1beta1"
+)
+
+var update = flag.Bool("update", false, "update the golden files of testdata")
+
+// newEvent returns the event the data plane builds from a message, before
+// its transformation.
+func newEvent(payload []byte) cloudevents.Event {
+	event := cloudevents.NewEvent()
+	event.SetID("1")
+	event.SetSource("/sensors")
+	event.SetType("dev.knative.sample")
+	event.SetData(cloudevents.ApplicationJSON, payload)
+	return event
+}
+
+// TestGolden transforms testdata/<name>/input.json with the Transform of
+// testdata/<name>/transform.yaml, and compares the event with
+// testdata/<name>/output.json. Run with -update to rewrite the output files.
+func TestGolden(t *testing.T) {
+	tests := []struct {
+		name  string
+		topic string
+	}{
+		{name: "project", topic: "sensors/temperature/building-1"},
+		{name: "set", topic: "sensors/temperature/building-1"},
+		{name: "attributes", topic: "sensors/temperature/building-1"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := filepath.Join("testdata", tc.name)
+			b, err := ioutil.ReadFile(filepath.Join(dir, "transform.yaml"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var spec v1beta1.Transform
+			if err := yaml.UnmarshalStrict(b, &spec); err != nil {
+				t.Fatal(err)
+			}
+			payload, err := ioutil.ReadFile(filepath.Join(dir, "input.json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			tr, err := New(&spec)
+			if err != nil {
+				t.Fatal("New() =", err)
+			}
+			event := newEvent(bytes.TrimSpace(payload))
+			if err := tr.Apply(tc.topic, event.Data(), &event); err != nil {
+				t.Fatal("Apply() =", err)
+			}
+			got, err := marshalSorted(event)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			golden := filepath.Join(dir, "output.json")
+			if *update {
+				if err := ioutil.WriteFile(golden, []byte(got), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := ioutil.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(string(want), got); diff != "" {
+				t.Errorf("Unexpected event (-want, +got): %s", diff)
+			}
+		})
+	}
+}
+
+// marshalSorted returns the indented JSON of event, with its attributes
+// sorted so that it can be compared to a golden file.
+func marshalSorted(event cloudevents.Event) (string, error) {
+	b, err := json.Marshal(event)
+	if err != nil {
+		return "", err
+	}
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return "", err
+	}
+	if b, err = json.MarshalIndent(v, "", "  "); err != nil {
+		return "", err
+	}
+	return string(b) + "\n", nil
+}
+
+func TestApplyErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    v1beta1.Transform
+		payload string
+		want    string
+	}{{
+		name:    "fields of non-JSON payload",
+		spec:    v1beta1.Transform{Fields: []v1beta1.FieldMapping{{Name: "temp", Path: "$.temp"}}},
+		payload: "21.5C",
+		want:    "payload is not JSON",
+	}, {
+		name:    "set in non-object payload",
+		spec:    v1beta1.Transform{Set: map[string]apiextensionsv1.JSON{"unit": {Raw: []byte(`"celsius"`)}}},
+		payload: "[21.5]",
+		want:    "payload is not a JSON object",
+	}, {
+		name:    "missing payload field",
+		spec:    v1beta1.Transform{Subject: "{{ .Payload.device }}"},
+		payload: `{"temp":21.5}`,
+		want:    `map has no entry for key "device"`,
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tr, err := New(&tc.spec)
+			if err != nil {
+				t.Fatal("New() =", err)
+			}
+			event := newEvent([]byte(tc.payload))
+			want := event.Clone()
+			err = tr.Apply("sensors/temperature", []byte(tc.payload), &event)
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("Apply() = %v, want an error containing %q", err, tc.want)
+			}
+			if diff := cmp.Diff(want.String(), event.String()); diff != "" {
+				t.Errorf("Apply() changed the event (-want, +got): %s", diff)
+			}
+		})
+	}
+}
+
+func TestNilTransformer(t *testing.T) {
+	tr, err := New(nil)
+	if err != nil || tr != nil {
+		t.Fatalf("New(nil) = %v, %v, want nil, nil", tr, err)
+	}
+	event := newEvent([]byte(`{"temp":21.5}`))
+	want := event.Clone()
+	if err := tr.Apply("sensors/temperature", event.Data(), &event); err != nil {
+		t.Fatal("Apply() =", err)
+	}
+	if diff := cmp.Diff(want.String(), event.String()); diff != "" {
+		t.Errorf("Apply() changed the event (-want, +got): %s", diff)
+	}
+}